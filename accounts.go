@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Учетная запись: подтверждение email, сброс пароля, смена пароля и email.
+// Ссылки в письмах несут одноразовый токен со сроком действия (UserToken).
+// Смена пароля или email увеличивает User.TokenVersion, и все выданные
+// раньше JWT перестают приниматься AuthMiddleware.
+//
+// Ответы на запросы писем не зависят от того, есть ли такой пользователь,
+// чтобы по ним нельзя было проверить, зарегистрирован ли адрес.
+
+// Назначения одноразовых токенов
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+	tokenPurposeChangeEmail   = "change_email"
+)
+
+// userTokenPurposes срок действия токена, путь ссылки в веб-интерфейсе и
+// письмо для каждого назначения
+var userTokenPurposes = map[string]struct {
+	ttl     time.Duration
+	path    string
+	subject string
+	body    string // %s - ссылка или токен, %s - срок действия
+}{
+	tokenPurposeVerifyEmail: {48 * time.Hour, "/verify-email", "Подтверждение email",
+		"Подтвердите адрес для входа в Parking Manager: %s\n\nСсылка действует %s."},
+	tokenPurposeResetPassword: {time.Hour, "/reset-password", "Сброс пароля",
+		"Чтобы задать новый пароль, перейдите по ссылке: %s\n\nСсылка действует %s. Если вы не запрашивали сброс, просто удалите письмо."},
+	tokenPurposeChangeEmail: {24 * time.Hour, "/confirm-email", "Подтверждение нового email",
+		"Подтвердите новый адрес для входа в Parking Manager: %s\n\nСсылка действует %s."},
+}
+
+// newUserToken возвращает токен для письма и его хеш для базы
+func newUserToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashUserToken(token), nil
+}
+
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretMatchesHash сверяет секрет устройства с хешем из базы. Пустой хеш
+// не совпадает ни с чем: устройство без выданного секрета не подключится.
+func secretMatchesHash(secret, hash string) bool {
+	if hash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashUserToken(secret)), []byte(hash)) == 1
+}
+
+// sendUserToken выдает токен назначения purpose и отправляет ссылку на
+// адрес to. Прежние неиспользованные токены того же назначения отзываются:
+// действует только ссылка из последнего письма.
+func (api *API) sendUserToken(ctx context.Context, user User, purpose, to string) error {
+	store := api.store.WithContext(ctx)
+	spec := userTokenPurposes[purpose]
+
+	token, hash, err := newUserToken()
+	if err != nil {
+		return err
+	}
+	if err := store.UserTokens.Revoke(user.ID, purpose); err != nil {
+		return err
+	}
+	record := UserToken{UserID: user.ID, Purpose: purpose, TokenHash: hash, ExpiresAt: time.Now().Add(spec.ttl)}
+	if purpose == tokenPurposeChangeEmail {
+		record.NewEmail = to
+	}
+	if err := store.UserTokens.Create(&record); err != nil {
+		return err
+	}
+
+	link := "код " + token
+	if base := api.services.Mail.LinkBaseURL; base != "" {
+		link = strings.TrimSuffix(base, "/") + spec.path + "?token=" + url.QueryEscape(token)
+	}
+	return api.services.Mailer.Send(MailMessage{
+		To:      []string{to},
+		Subject: spec.subject,
+		Body:    fmt.Sprintf(spec.body, link, formatTTL(spec.ttl)),
+	})
+}
+
+func formatTTL(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d ч", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d мин", int(d.Minutes()))
+}
+
+// notifyUser отправляет уведомление о смене учетных данных; ошибка только
+// логируется, изменение уже сохранено
+func (api *API) notifyUser(ctx context.Context, to, subject, body string) {
+	if err := api.services.Mailer.Send(MailMessage{To: []string{to}, Subject: subject, Body: body}); err != nil {
+		slog.WarnContext(ctx, "Не удалось отправить уведомление", "subject", subject, "error", err)
+	}
+}
+
+// consumeUserToken находит пользователя по одноразовому токену и отвечает
+// ошибкой сам, если это не удалось
+func (api *API) consumeUserToken(c *gin.Context, purpose, token string) (UserToken, User, bool) {
+	store := api.store.WithContext(c.Request.Context())
+	record, err := store.UserTokens.Consume(purpose, hashUserToken(token))
+	if err == nil {
+		var user User
+		user, err = store.Users.Get(record.UserID)
+		if err == nil {
+			return record, user, true
+		}
+	}
+	if errors.Is(err, errNotFound) {
+		respondError(c, CodeConfirmationInvalid)
+	} else {
+		c.Error(err)
+		respondError(c, CodeInternal)
+	}
+	return UserToken{}, User{}, false
+}
+
+// currentUser пользователь из токена запроса; отвечает ошибкой сам
+func (api *API) currentUser(c *gin.Context) (User, bool) {
+	user, err := api.store.WithContext(c.Request.Context()).Users.Get(c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeUserNotFound)
+		return User{}, false
+	}
+	return user, true
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail подтверждает email по токену из письма после регистрации
+func (api *API) VerifyEmail(c *gin.Context) {
+	var input VerifyEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	_, user, ok := api.consumeUserToken(c, tokenPurposeVerifyEmail, input.Token)
+	if !ok {
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := api.store.WithContext(c.Request.Context()).Users.Save(&user); err != nil {
+			c.Error(err)
+			respondError(c, CodeUserUpdateFailed)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Email подтвержден"})
+}
+
+// EmailRequest адрес, на который нужно отправить письмо
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendVerification повторно отправляет письмо для подтверждения email
+func (api *API) ResendVerification(c *gin.Context) {
+	var input EmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	user, err := api.store.WithContext(c.Request.Context()).Users.GetByEmail(input.Email)
+	if err == nil && user.EmailVerifiedAt == nil {
+		if err := api.sendUserToken(c.Request.Context(), user, tokenPurposeVerifyEmail, user.Email); err != nil {
+			c.Error(err)
+		}
+	} else if err != nil && !errors.Is(err, errNotFound) {
+		c.Error(err)
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Если адрес зарегистрирован и не подтвержден, письмо отправлено"})
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля
+func (api *API) ForgotPassword(c *gin.Context) {
+	var input EmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	user, err := api.store.WithContext(c.Request.Context()).Users.GetByEmail(input.Email)
+	if err == nil {
+		if err := api.sendUserToken(c.Request.Context(), user, tokenPurposeResetPassword, user.Email); err != nil {
+			c.Error(err)
+		}
+	} else if !errors.Is(err, errNotFound) {
+		c.Error(err)
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Если адрес зарегистрирован, письмо со ссылкой отправлено"})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// ResetPassword задает новый пароль по токену из письма и завершает все
+// сессии. Переход по ссылке из письма заодно подтверждает email.
+func (api *API) ResetPassword(c *gin.Context) {
+	var input ResetPasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	_, user, ok := api.consumeUserToken(c, tokenPurposeResetPassword, input.Token)
+	if !ok {
+		return
+	}
+	if !api.setPassword(c, &user, input.Password) {
+		return
+	}
+	api.limits.loginSucceeded(c.Request.Context(), user.Email)
+	api.notifyUser(c.Request.Context(), user.Email, "Пароль изменен",
+		"Пароль от Parking Manager был сброшен по ссылке из письма. Все сеансы завершены.")
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Пароль изменен, войдите заново"})
+}
+
+// setPassword сохраняет новый пароль, отзывает выданные токены и
+// неиспользованные ссылки сброса; отвечает ошибкой сам
+func (api *API) setPassword(c *gin.Context, user *User, password string) bool {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodePasswordHashFailed)
+		return false
+	}
+	user.Password = hashed
+	user.TokenVersion++
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	store := api.store.WithContext(c.Request.Context())
+	if err := store.Users.Save(user); err != nil {
+		c.Error(err)
+		respondError(c, CodeUserUpdateFailed)
+		return false
+	}
+	// Ссылка сброса, запрошенная до смены пароля, больше не должна работать
+	if err := store.UserTokens.Revoke(user.ID, tokenPurposeResetPassword); err != nil {
+		c.Error(err)
+		respondError(c, CodeUserUpdateFailed)
+		return false
+	}
+	return true
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ChangePassword меняет пароль текущего пользователя. Остальные сессии
+// завершаются, а в ответе - новый токен для этой.
+func (api *API) ChangePassword(c *gin.Context) {
+	var input ChangePasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	user, ok := api.currentUser(c)
+	if !ok {
+		return
+	}
+	if !api.checkCurrentPassword(c, user, input.CurrentPassword) {
+		return
+	}
+	if !api.setPassword(c, &user, input.NewPassword) {
+		return
+	}
+	api.notifyUser(c.Request.Context(), user.Email, "Пароль изменен",
+		"Пароль от Parking Manager был изменен. Все остальные сеансы завершены.")
+
+	token, err := api.issueToken(user)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeTokenCreateFailed)
+		return
+	}
+	c.JSON(http.StatusOK, TokenResponse{Token: token})
+}
+
+// checkCurrentPassword сверяет пароль перед изменением учетных данных.
+// Неудачи считаются как неудачные входы: украденный токен не должен
+// позволять подбирать пароль.
+func (api *API) checkCurrentPassword(c *gin.Context, user User, password string) bool {
+	ctx := c.Request.Context()
+	if wait, code := api.limits.loginAllowed(ctx, user.Email); wait > 0 {
+		respondRateLimited(c, code, wait)
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		api.limits.loginFailed(ctx, user.Email)
+		respondError(c, CodeCurrentPasswordInvalid)
+		return false
+	}
+	return true
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	NewEmail string `json:"new_email" binding:"required,email"`
+}
+
+// ChangeEmail отправляет ссылку подтверждения на новый адрес. Адрес
+// меняется только после перехода по ней, см. ConfirmEmailChange.
+func (api *API) ChangeEmail(c *gin.Context) {
+	var input ChangeEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	user, ok := api.currentUser(c)
+	if !ok {
+		return
+	}
+	if !api.checkCurrentPassword(c, user, input.Password) {
+		return
+	}
+	if _, err := api.store.WithContext(c.Request.Context()).Users.GetByEmail(input.NewEmail); err == nil {
+		respondError(c, CodeEmailTaken)
+		return
+	}
+
+	if err := api.sendUserToken(c.Request.Context(), user, tokenPurposeChangeEmail, input.NewEmail); err != nil {
+		c.Error(err)
+		respondError(c, CodeMailSendFailed)
+		return
+	}
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Подтвердите новый адрес по ссылке из письма"})
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ConfirmEmailChange меняет email по токену из письма на новый адрес и
+// завершает все сессии. На старый адрес уходит уведомление.
+func (api *API) ConfirmEmailChange(c *gin.Context) {
+	var input ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	record, user, ok := api.consumeUserToken(c, tokenPurposeChangeEmail, input.Token)
+	if !ok {
+		return
+	}
+	store := api.store.WithContext(c.Request.Context())
+	if _, err := store.Users.GetByEmail(record.NewEmail); err == nil {
+		respondError(c, CodeEmailTaken)
+		return
+	}
+
+	oldEmail := user.Email
+	now := time.Now()
+	user.Email = record.NewEmail
+	user.EmailVerifiedAt = &now
+	user.TokenVersion++
+	if err := store.Users.Save(&user); err != nil {
+		// Адрес мог занять другой пользователь между проверкой и сохранением
+		if isUniqueViolation(err) {
+			respondError(c, CodeEmailConflict)
+			return
+		}
+		c.Error(err)
+		respondError(c, CodeUserUpdateFailed)
+		return
+	}
+	api.notifyUser(c.Request.Context(), oldEmail, "Email изменен",
+		fmt.Sprintf("Адрес для входа в Parking Manager изменен на %s. Все сеансы завершены.", user.Email))
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Email изменен, войдите заново"})
+}
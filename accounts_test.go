@@ -0,0 +1,259 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{48 * time.Hour, "48 ч"},
+		{24 * time.Hour, "24 ч"},
+		{time.Hour, "60 мин"},
+		{90 * time.Minute, "90 мин"},
+	}
+	for _, tt := range tests {
+		if got := formatTTL(tt.ttl); got != tt.want {
+			t.Errorf("%s: %q, ожидалось %q", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestSecretMatchesHash(t *testing.T) {
+	hash := hashUserToken("secret")
+	tests := []struct {
+		secret, hash string
+		want         bool
+	}{
+		{"secret", hash, true},
+		{"Secret", hash, false},
+		{"", hash, false},
+		// Устройство без выданного секрета не подключается даже с пустым
+		{"", "", false},
+		{"secret", "", false},
+	}
+	for _, tt := range tests {
+		if got := secretMatchesHash(tt.secret, tt.hash); got != tt.want {
+			t.Errorf("%q и %q: %v, ожидалось %v", tt.secret, tt.hash, got, tt.want)
+		}
+	}
+}
+
+// mailsTo письма на адрес to
+func (s *testServer) mailsTo(to string) []MailMessage {
+	var mails []MailMessage
+	for _, m := range s.mailer.Sent() {
+		if m.To[0] == to {
+			mails = append(mails, m)
+		}
+	}
+	return mails
+}
+
+// Ответ на запрос письма не выдает, есть ли такой адрес, но письмо
+// уходит только тому, кому нужно
+func TestEmailRequests(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	s.createUser("verified@example.com", "secret123", UserRoleUser)
+	unverified := s.createUser("new@example.com", "secret123", UserRoleUser)
+	unverified.EmailVerifiedAt = nil
+	if err := s.store.Users.Save(&unverified); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		email   string
+		subject string // Пусто - письма нет
+	}{
+		{"подтверждение неподтвержденному", "/api/v1/email/verify/resend", "new@example.com", "Подтверждение email"},
+		{"подтверждение подтвержденному", "/api/v1/email/verify/resend", "verified@example.com", ""},
+		{"подтверждение неизвестному", "/api/v1/email/verify/resend", "nobody@example.com", ""},
+		{"сброс пароля", "/api/v1/password/forgot", "verified@example.com", "Сброс пароля"},
+		{"сброс пароля неизвестному", "/api/v1/password/forgot", "nobody@example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(s.mailsTo(tt.email))
+			s.expect(s.do(http.MethodPost, tt.path, "", EmailRequest{Email: tt.email}), http.StatusOK, nil)
+			mails := s.mailsTo(tt.email)[before:]
+			switch {
+			case tt.subject == "" && len(mails) != 0:
+				t.Errorf("лишнее письмо %q", mails[0].Subject)
+			case tt.subject != "" && (len(mails) != 1 || mails[0].Subject != tt.subject):
+				t.Errorf("письма %+v, ожидалось %q", mails, tt.subject)
+			}
+		})
+	}
+}
+
+var resetLink = regexp.MustCompile(`https://parking\.example\.com/reset-password\?token=(\S+)`)
+
+func TestResetPassword(t *testing.T) {
+	s := newTestServer(t, nil, func(cfg *Config) { cfg.Mail.LinkBaseURL = "https://parking.example.com/" })
+	const email = "driver@example.com"
+	user := s.createUser(email, "secret123", UserRoleUser)
+	user.EmailVerifiedAt = nil
+	if err := s.store.Users.Save(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ссылка ведет в веб-интерфейс; действует только из последнего письма
+	forgot := func() string {
+		t.Helper()
+		s.expect(s.do(http.MethodPost, "/api/v1/password/forgot", "", EmailRequest{Email: email}), http.StatusOK, nil)
+		mails := s.mailsTo(email)
+		m := resetLink.FindStringSubmatch(mails[len(mails)-1].Body)
+		if m == nil {
+			t.Fatalf("нет ссылки в письме: %s", mails[len(mails)-1].Body)
+		}
+		token, err := url.QueryUnescape(m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	first, second := forgot(), forgot()
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		code     ErrorCode // Пусто - пароль изменен
+	}{
+		{"ссылка из прежнего письма", first, "newsecret1", CodeConfirmationInvalid},
+		{"короткий пароль", second, "123", CodeValidationFailed},
+		{"неизвестный токен", "no-such-token", "newsecret1", CodeConfirmationInvalid},
+		{"ссылка из последнего письма", second, "newsecret1", ""},
+		{"ссылка одноразовая", second, "newsecret2", CodeConfirmationInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/api/v1/password/reset", "", ResetPasswordRequest{Token: tt.token, Password: tt.password})
+			if tt.code != "" {
+				s.expectError(w, http.StatusBadRequest, tt.code)
+				return
+			}
+			s.expect(w, http.StatusOK, nil)
+		})
+	}
+
+	// Переход по ссылке заодно подтверждает email: вход с новым паролем
+	// проходит, а на адрес приходит уведомление
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: email, Password: "secret123"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	s.login(email, "newsecret1")
+	if mails := s.mailsTo(email); mails[len(mails)-1].Subject != "Пароль изменен" {
+		t.Errorf("последнее письмо %q, ожидалось уведомление", mails[len(mails)-1].Subject)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	s.createUser("driver@example.com", "secret123", UserRoleUser)
+	token := s.login("driver@example.com", "secret123")
+	other := s.login("driver@example.com", "secret123")
+
+	tests := []struct {
+		name    string
+		request ChangePasswordRequest
+		status  int
+		code    ErrorCode // Пусто - пароль изменен
+	}{
+		{"неверный текущий пароль", ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "newsecret1"},
+			http.StatusBadRequest, CodeCurrentPasswordInvalid},
+		{"короткий новый пароль", ChangePasswordRequest{CurrentPassword: "secret123", NewPassword: "123"},
+			http.StatusBadRequest, CodeValidationFailed},
+		{"пароль изменен", ChangePasswordRequest{CurrentPassword: "secret123", NewPassword: "newsecret1"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/api/v1/account/password", token, tt.request)
+			if tt.code != "" {
+				s.expectError(w, tt.status, tt.code)
+				return
+			}
+			var resp TokenResponse
+			s.expect(w, tt.status, &resp)
+			token = resp.Token
+		})
+	}
+
+	// Сессия, сменившая пароль, продолжается с новым токеном, остальные завершены
+	s.expect(s.do(http.MethodGet, "/api/v1/parkings", token, nil), http.StatusOK, nil)
+	s.expectError(s.do(http.MethodGet, "/api/v1/parkings", other, nil), http.StatusUnauthorized, CodeTokenRevoked)
+	s.login("driver@example.com", "newsecret1")
+}
+
+func TestChangeEmail(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	const oldEmail, newEmail = "driver@example.com", "driver@example.org"
+	s.createUser(oldEmail, "secret123", UserRoleUser)
+	s.createUser("taken@example.com", "secret123", UserRoleUser)
+	token := s.login(oldEmail, "secret123")
+
+	tests := []struct {
+		name    string
+		request ChangeEmailRequest
+		status  int
+		code    ErrorCode // Пусто - письмо отправлено
+	}{
+		{"неверный пароль", ChangeEmailRequest{Password: "wrong", NewEmail: newEmail}, http.StatusBadRequest, CodeCurrentPasswordInvalid},
+		{"адрес занят", ChangeEmailRequest{Password: "secret123", NewEmail: "taken@example.com"}, http.StatusBadRequest, CodeEmailTaken},
+		{"не адрес", ChangeEmailRequest{Password: "secret123", NewEmail: "driver"}, http.StatusBadRequest, CodeValidationFailed},
+		{"письмо на новый адрес", ChangeEmailRequest{Password: "secret123", NewEmail: newEmail}, http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/api/v1/account/email", token, tt.request)
+			if tt.code != "" {
+				s.expectError(w, tt.status, tt.code)
+				return
+			}
+			s.expect(w, tt.status, nil)
+		})
+	}
+
+	// До подтверждения адрес не меняется
+	s.login(oldEmail, "secret123")
+	code := s.lastMailCode(newEmail)
+	s.expect(s.do(http.MethodPost, "/api/v1/email/change/confirm", "", ConfirmEmailChangeRequest{Token: code}), http.StatusOK, nil)
+	s.expectError(s.do(http.MethodPost, "/api/v1/email/change/confirm", "", ConfirmEmailChangeRequest{Token: code}), http.StatusBadRequest, CodeConfirmationInvalid)
+
+	s.expectError(s.do(http.MethodGet, "/api/v1/parkings", token, nil), http.StatusUnauthorized, CodeTokenRevoked)
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: oldEmail, Password: "secret123"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	s.login(newEmail, "secret123")
+	if mails := s.mailsTo(oldEmail); len(mails) != 1 || !strings.Contains(mails[0].Body, newEmail) {
+		t.Errorf("письма на старый адрес %+v, ожидалось уведомление о смене", mails)
+	}
+}
+
+// Просроченная ссылка не действует
+func TestExpiredUserToken(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	const email = "driver@example.com"
+	user := s.createUser(email, "secret123", UserRoleUser)
+	user.EmailVerifiedAt = nil
+	if err := s.store.Users.Save(&user); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.do(http.MethodPost, "/api/v1/email/verify/resend", "", EmailRequest{Email: email}), http.StatusOK, nil)
+
+	m := s.memory()
+	m.mu.Lock()
+	for id, token := range m.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Second)
+		m.tokens[id] = token
+	}
+	m.mu.Unlock()
+
+	s.expectError(s.do(http.MethodPost, "/api/v1/email/verify", "", VerifyEmailRequest{Token: s.lastMailCode(email)}), http.StatusBadRequest, CodeConfirmationInvalid)
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: email, Password: "secret123"}), http.StatusForbidden, CodeEmailNotVerified)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Гранулярность аналитики
+const (
+	Granularity15m  = "15m"
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+	GranularityWeek = "week"
+)
+
+// maxAnalyticsBuckets ограничивает размер ответа: 15-минутная разбивка за год
+// - это 35 тысяч интервалов на парковку
+const maxAnalyticsBuckets = 5000
+
+var errTooManyBuckets = errors.New("слишком много интервалов")
+
+// OccupancyBucket показатели парковки за один интервал
+type OccupancyBucket struct {
+	Start              time.Time `json:"start"`
+	Entries            int       `json:"entries"`
+	Exits              int       `json:"exits"`
+	OccupancyRate      float64   `json:"occupancy_rate"` // Доля занятого место-времени
+	PeakOccupancy      int       `json:"peak_occupancy"` // Максимум одновременно занятых мест
+	FullShare          float64   `json:"full_share"`     // Доля времени, когда парковка была заполнена
+	TurnoverPerSpot    float64   `json:"turnover_per_spot"`
+	Revenue            float64   `json:"revenue"`
+	AvgDwellMinutes    float64   `json:"avg_dwell_minutes"`
+	MedianDwellMinutes float64   `json:"median_dwell_minutes"`
+
+	occupiedMinutes float64 // Сумма занятых место-минут, для сводок
+}
+
+// ZoneRevenue выручка зоны парковки за день
+type ZoneRevenue struct {
+	Zone    string  `json:"zone"`
+	Day     string  `json:"day"`
+	Revenue float64 `json:"revenue"`
+}
+
+// OccupancyReport аналитика одной парковки за период
+type OccupancyReport struct {
+	ParkingID     uint              `json:"parking_id"`
+	TimeZone      string            `json:"time_zone"`
+	Granularity   string            `json:"granularity"`
+	Spots         int               `json:"spots"`
+	Summary       OccupancyBucket   `json:"summary"`
+	Buckets       []OccupancyBucket `json:"buckets"`
+	RevenueByZone []ZoneRevenue     `json:"revenue_by_zone"`
+}
+
+// stayRow стоянка, пересекающаяся с периодом аналитики
+type stayRow struct {
+	EntryTime time.Time
+	ExitTime  *time.Time
+	Zone      string
+	Amount    *float64
+}
+
+type occupancyEvent struct {
+	at    time.Time
+	delta int
+}
+
+// parkingLocation возвращает часовой пояс парковки, по умолчанию UTC
+func parkingLocation(parking Parking) *time.Location {
+	if parking.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(parking.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// truncateToBucket возвращает начало интервала, в котором находится t
+func truncateToBucket(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch granularity {
+	case Granularity15m:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()/15*15, 0, 0, loc)
+	case GranularityHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		// Неделя начинается с понедельника
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket возвращает начало следующего интервала. Дни и недели считаются
+// по календарю, чтобы переход на летнее время не сдвигал границы.
+func nextBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case Granularity15m:
+		return t.Add(15 * time.Minute)
+	case GranularityHour:
+		return t.Add(time.Hour)
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// parseAnalyticsRange разбирает общие параметры start_time и end_time
+func parseAnalyticsRange(c *gin.Context) (time.Time, time.Time, bool) {
+	startTimeStr := c.Query("start_time")
+	endTimeStr := c.Query("end_time")
+
+	if startTimeStr == "" || endTimeStr == "" {
+		respondError(c, CodeTimeRangeRequired)
+		return time.Time{}, time.Time{}, false
+	}
+
+	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	if err != nil {
+		respondError(c, CodeInvalidStartTime)
+		return time.Time{}, time.Time{}, false
+	}
+
+	endTime, err := time.Parse(time.RFC3339, endTimeStr)
+	if err != nil {
+		respondError(c, CodeInvalidEndTime)
+		return time.Time{}, time.Time{}, false
+	}
+
+	if !endTime.After(startTime) {
+		respondError(c, CodeTimeRangeInvalid)
+		return time.Time{}, time.Time{}, false
+	}
+
+	return startTime, endTime, true
+}
+
+// GetOccupancyAnalytics возвращает заполненность, время стоянки, оборачиваемость
+// мест и выручку по интервалам в часовом поясе каждой парковки
+func GetOccupancyAnalytics(c *gin.Context) {
+	startTime, endTime, ok := parseAnalyticsRange(c)
+	if !ok {
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", GranularityHour)
+	switch granularity {
+	case Granularity15m, GranularityHour, GranularityDay, GranularityWeek:
+	default:
+		respondError(c, CodeInvalidOccupancyGranularity)
+		return
+	}
+
+	query := db.Model(&Parking{})
+	if parkingID := c.Query("parking_id"); parkingID != "" {
+		query = query.Where("id = ?", parkingID)
+	}
+	var parkings []Parking
+	if err := query.Find(&parkings).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeParkingsListFailed)
+		return
+	}
+
+	reports := make([]OccupancyReport, 0, len(parkings))
+	for _, parking := range parkings {
+		report, err := buildOccupancyReport(parking, startTime, endTime, granularity)
+		if errors.Is(err, errTooManyBuckets) {
+			respondError(c, CodePeriodTooLong)
+			return
+		}
+		if err != nil {
+			c.Error(err)
+			respondError(c, CodeAnalyticsComputeFailed)
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+func buildOccupancyReport(parking Parking, start, end time.Time, granularity string) (OccupancyReport, error) {
+	loc := parkingLocation(parking)
+	report := OccupancyReport{
+		ParkingID:   parking.ID,
+		TimeZone:    loc.String(),
+		Granularity: granularity,
+	}
+
+	var bounds []time.Time
+	for t := truncateToBucket(start, granularity, loc); t.Before(end); t = nextBucket(t, granularity) {
+		bounds = append(bounds, t)
+		if len(bounds) > maxAnalyticsBuckets {
+			return report, errTooManyBuckets
+		}
+	}
+	bounds = append(bounds, nextBucket(bounds[len(bounds)-1], granularity))
+	rangeStart, rangeEnd := bounds[0], bounds[len(bounds)-1]
+
+	var spots int64
+	if err := db.Model(&Spot{}).Where("parking_id = ?", parking.ID).Count(&spots).Error; err != nil {
+		return report, err
+	}
+	report.Spots = int(spots)
+	if report.Spots == 0 {
+		report.Spots = parking.Capacity
+	}
+
+	var stays []stayRow
+	if err := db.Table("entries").
+		Select("entries.entry_time, entries.exit_time, spots.zone, payments.amount").
+		Joins("JOIN spots ON spots.id = entries.spot_id").
+		Joins("LEFT JOIN exits ON exits.entry_id = entries.id AND exits.deleted_at IS NULL").
+		Joins("LEFT JOIN payments ON payments.id = exits.payment_id").
+		Where("entries.deleted_at IS NULL AND spots.parking_id = ?", parking.ID).
+		Where("entries.entry_time < ? AND (entries.exit_time IS NULL OR entries.exit_time > ?)", rangeEnd, rangeStart).
+		Scan(&stays).Error; err != nil {
+		return report, err
+	}
+
+	buckets := make([]OccupancyBucket, len(bounds)-1)
+	dwell := make([][]float64, len(buckets))
+	var allDwell []float64
+	zoneRevenue := make(map[ZoneRevenue]float64)
+	var events []occupancyEvent
+	now := time.Now()
+
+	bucketIndex := func(t time.Time) int {
+		i := sort.Search(len(bounds), func(i int) bool { return bounds[i].After(t) }) - 1
+		if i < 0 || i >= len(buckets) {
+			return -1
+		}
+		return i
+	}
+
+	for _, stay := range stays {
+		stayEnd := now
+		if stay.ExitTime != nil {
+			stayEnd = *stay.ExitTime
+		}
+		events = append(events, occupancyEvent{stay.EntryTime, 1}, occupancyEvent{stayEnd, -1})
+
+		if i := bucketIndex(stay.EntryTime); i >= 0 {
+			buckets[i].Entries++
+		}
+		if stay.ExitTime == nil {
+			continue
+		}
+		i := bucketIndex(*stay.ExitTime)
+		if i < 0 {
+			continue
+		}
+		minutes := stay.ExitTime.Sub(stay.EntryTime).Minutes()
+		buckets[i].Exits++
+		dwell[i] = append(dwell[i], minutes)
+		allDwell = append(allDwell, minutes)
+		if stay.Amount != nil {
+			buckets[i].Revenue += *stay.Amount
+			key := ZoneRevenue{Zone: stay.Zone, Day: stay.ExitTime.In(loc).Format("2006-01-02")}
+			zoneRevenue[key] += *stay.Amount
+		}
+	}
+
+	sweepOccupancy(buckets, bounds, events, report.Spots)
+
+	summary := OccupancyBucket{Start: rangeStart}
+	var occupiedTotal, fullTotal float64
+	for i := range buckets {
+		b := &buckets[i]
+		b.Start = bounds[i]
+		if report.Spots > 0 {
+			b.TurnoverPerSpot = float64(b.Entries) / float64(report.Spots)
+		}
+		b.AvgDwellMinutes, b.MedianDwellMinutes = meanAndMedian(dwell[i])
+
+		length := bounds[i+1].Sub(bounds[i]).Minutes()
+		occupiedTotal += b.OccupancyRate * length
+		fullTotal += b.FullShare * length
+		summary.Entries += b.Entries
+		summary.Exits += b.Exits
+		summary.Revenue += b.Revenue
+		if b.PeakOccupancy > summary.PeakOccupancy {
+			summary.PeakOccupancy = b.PeakOccupancy
+		}
+	}
+	total := rangeEnd.Sub(rangeStart).Minutes()
+	summary.OccupancyRate = occupiedTotal / total
+	summary.FullShare = fullTotal / total
+	if report.Spots > 0 {
+		summary.TurnoverPerSpot = float64(summary.Entries) / float64(report.Spots)
+	}
+	summary.AvgDwellMinutes, summary.MedianDwellMinutes = meanAndMedian(allDwell)
+
+	report.Summary = summary
+	report.Buckets = buckets
+	for key, revenue := range zoneRevenue {
+		key.Revenue = revenue
+		report.RevenueByZone = append(report.RevenueByZone, key)
+	}
+	sort.Slice(report.RevenueByZone, func(i, j int) bool {
+		a, b := report.RevenueByZone[i], report.RevenueByZone[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		return a.Zone < b.Zone
+	})
+
+	return report, nil
+}
+
+// sweepOccupancy проходит по въездам и выездам в хронологическом порядке и
+// для каждого интервала считает долю занятого место-времени, пик
+// одновременно занятых мест и долю времени, когда парковка была заполнена
+func sweepOccupancy(buckets []OccupancyBucket, bounds []time.Time, events []occupancyEvent, spots int) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			// Выезд раньше въезда в ту же секунду, чтобы не завышать пик
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	count, e := 0, 0
+	for e < len(events) && events[e].at.Before(bounds[0]) {
+		count += events[e].delta
+		e++
+	}
+
+	for i := range buckets {
+		cursor, end := bounds[i], bounds[i+1]
+		// Выезды ровно на границе не должны попадать в пик следующего интервала
+		for e < len(events) && events[e].at.Equal(cursor) {
+			count += events[e].delta
+			e++
+		}
+		peak := count
+		var occupied, full time.Duration
+
+		advance := func(to time.Time) {
+			span := to.Sub(cursor)
+			occupied += time.Duration(count) * span
+			if spots > 0 && count >= spots {
+				full += span
+			}
+			cursor = to
+		}
+
+		for e < len(events) && events[e].at.Before(end) {
+			advance(events[e].at)
+			count += events[e].delta
+			if count > peak {
+				peak = count
+			}
+			e++
+		}
+		advance(end)
+
+		length := end.Sub(bounds[i])
+		buckets[i].PeakOccupancy = peak
+		buckets[i].occupiedMinutes = occupied.Minutes()
+		if spots > 0 {
+			buckets[i].OccupancyRate = float64(occupied) / float64(time.Duration(spots)*length)
+		}
+		buckets[i].FullShare = float64(full) / float64(length)
+	}
+}
+
+func meanAndMedian(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mid := len(sorted) / 2
+	median := sorted[mid]
+	if len(sorted)%2 == 0 {
+		median = (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sum / float64(len(sorted)), median
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// berlin часовой пояс с переходом на летнее время: в 2026 году 29 марта
+// длится 23 часа, 25 октября - 25 часов
+func berlin(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	return loc
+}
+
+func TestTruncateToBucket(t *testing.T) {
+	loc := berlin(t)
+	tests := []struct {
+		at          time.Time
+		granularity string
+		want        time.Time
+	}{
+		{time.Date(2026, 10, 14, 10, 44, 59, 0, time.UTC), Granularity15m, time.Date(2026, 10, 14, 12, 30, 0, 0, loc)},
+		{time.Date(2026, 10, 14, 10, 44, 59, 0, time.UTC), GranularityHour, time.Date(2026, 10, 14, 12, 0, 0, 0, loc)},
+		// 23:30 UTC - уже следующий день в Берлине
+		{time.Date(2026, 10, 14, 23, 30, 0, 0, time.UTC), GranularityDay, time.Date(2026, 10, 15, 0, 0, 0, 0, loc)},
+		// Неделя с понедельника, в том числе для воскресенья
+		{time.Date(2026, 10, 18, 12, 0, 0, 0, loc), GranularityWeek, time.Date(2026, 10, 12, 0, 0, 0, 0, loc)},
+		{time.Date(2026, 10, 12, 0, 0, 0, 0, loc), GranularityWeek, time.Date(2026, 10, 12, 0, 0, 0, 0, loc)},
+		// Неделя, в которую переводят часы, начинается в полночь по зимнему времени
+		{time.Date(2026, 3, 29, 12, 0, 0, 0, loc), GranularityWeek, time.Date(2026, 3, 23, 0, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 29, 3, 30, 0, 0, loc), GranularityHour, time.Date(2026, 3, 29, 3, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := truncateToBucket(tt.at, tt.granularity, loc); !got.Equal(tt.want) {
+			t.Errorf("%s по %s: %s, ожидалось %s", tt.at, tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestNextBucket(t *testing.T) {
+	loc := berlin(t)
+	tests := []struct {
+		start       time.Time
+		granularity string
+		want        time.Duration
+	}{
+		{time.Date(2026, 10, 14, 12, 0, 0, 0, loc), Granularity15m, 15 * time.Minute},
+		{time.Date(2026, 10, 14, 12, 0, 0, 0, loc), GranularityHour, time.Hour},
+		{time.Date(2026, 10, 14, 0, 0, 0, 0, loc), GranularityDay, 24 * time.Hour},
+		{time.Date(2026, 3, 29, 0, 0, 0, 0, loc), GranularityDay, 23 * time.Hour},
+		{time.Date(2026, 10, 25, 0, 0, 0, 0, loc), GranularityDay, 25 * time.Hour},
+		{time.Date(2026, 3, 23, 0, 0, 0, 0, loc), GranularityWeek, 7*24*time.Hour - time.Hour},
+		// Час перевода стрелок - тоже ровно час
+		{time.Date(2026, 3, 29, 1, 0, 0, 0, loc), GranularityHour, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := nextBucket(tt.start, tt.granularity).Sub(tt.start); got != tt.want {
+			t.Errorf("%s по %s: %s, ожидалось %s", tt.start, tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestSweepOccupancy(t *testing.T) {
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	stay := func(from, to int) []occupancyEvent {
+		return []occupancyEvent{{at(from), 1}, {at(to), -1}}
+	}
+	bounds := []time.Time{at(0), at(60), at(120)}
+
+	type want struct {
+		rate, full float64
+		peak       int
+	}
+	tests := []struct {
+		name   string
+		spots  int
+		events [][]occupancyEvent
+		want   [2]want
+	}{
+		{"пусто", 2, nil, [2]want{{0, 0, 0}, {0, 0, 0}}},
+		{"стоянка через границу интервалов", 2, [][]occupancyEvent{stay(30, 90)},
+			[2]want{{0.25, 0, 1}, {0.25, 0, 1}}},
+		{"въезд до периода, выезд после", 1, [][]occupancyEvent{stay(-30, 150)},
+			[2]want{{1, 1, 1}, {1, 1, 1}}},
+		{"заполнена полчаса", 2, [][]occupancyEvent{stay(0, 60), stay(15, 45)},
+			[2]want{{0.75, 0.5, 2}, {0, 0, 0}}},
+		// Выезд и въезд в одну секунду не дают пика в 2 места
+		{"выезд и въезд одновременно", 2, [][]occupancyEvent{stay(0, 30), stay(30, 60)},
+			[2]want{{0.5, 0, 1}, {0, 0, 0}}},
+		{"без мест", 0, [][]occupancyEvent{stay(0, 60)}, [2]want{{0, 0, 1}, {0, 0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []occupancyEvent
+			for _, e := range tt.events {
+				events = append(events, e...)
+			}
+			buckets := make([]OccupancyBucket, len(bounds)-1)
+			sweepOccupancy(buckets, bounds, events, tt.spots)
+			for i, b := range buckets {
+				w := tt.want[i]
+				if b.OccupancyRate != w.rate || b.FullShare != w.full || b.PeakOccupancy != w.peak {
+					t.Errorf("интервал %d: заполненность %v, заполнена %v, пик %d; ожидалось %v, %v, %d",
+						i, b.OccupancyRate, b.FullShare, b.PeakOccupancy, w.rate, w.full, w.peak)
+				}
+			}
+		})
+	}
+}
+
+// В день перевода часов интервал длится 23 часа, а заполненность считается
+// по его настоящей длине
+func TestSweepOccupancyDST(t *testing.T) {
+	loc := berlin(t)
+	day := time.Date(2026, 3, 29, 0, 0, 0, 0, loc)
+	bounds := []time.Time{day, nextBucket(day, GranularityDay)}
+	events := []occupancyEvent{{day, 1}, {day.Add(23 * time.Hour), -1}}
+
+	buckets := make([]OccupancyBucket, 1)
+	sweepOccupancy(buckets, bounds, events, 1)
+	if buckets[0].OccupancyRate != 1 || buckets[0].occupiedMinutes != 23*60 {
+		t.Errorf("заполненность %v, %v место-минут; ожидалось 1 и %d", buckets[0].OccupancyRate, buckets[0].occupiedMinutes, 23*60)
+	}
+}
+
+func TestMeanAndMedian(t *testing.T) {
+	tests := []struct {
+		values       []float64
+		mean, median float64
+	}{
+		{nil, 0, 0},
+		{[]float64{10}, 10, 10},
+		{[]float64{30, 10, 20}, 20, 20},
+		{[]float64{40, 10, 20, 10}, 20, 15},
+	}
+	for _, tt := range tests {
+		mean, median := meanAndMedian(tt.values)
+		if mean != tt.mean || median != tt.median {
+			t.Errorf("%v: %v и %v, ожидалось %v и %v", tt.values, mean, median, tt.mean, tt.median)
+		}
+	}
+}
+
+func TestBuildOccupancyReport(t *testing.T) {
+	testDB(t)
+	loc := berlin(t)
+	parking := Parking{Name: "Берлин", Capacity: 2, TimeZone: "Europe/Berlin"}
+	if err := db.Create(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	spots := []Spot{{ParkingID: parking.ID, Number: "A1", Zone: "A"}, {ParkingID: parking.ID, Number: "B1", Zone: "B"}}
+	if err := db.Create(&spots).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Стоянка в ночь перевода часов: с 1:00 до 4:00 по местному времени -
+	// два часа на самом деле
+	day := time.Date(2026, 3, 29, 0, 0, 0, 0, loc)
+	entryTime, exitTime := time.Date(2026, 3, 29, 1, 0, 0, 0, loc), time.Date(2026, 3, 29, 4, 0, 0, 0, loc)
+	payment := Payment{Amount: 200, Method: "cash", Status: "succeeded"}
+	if err := db.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{SpotID: spots[0].ID, VehicleID: 1, EntryTime: entryTime, ExitTime: &exitTime}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Exit{EntryID: entry.ID, ExitTime: exitTime, PaymentID: payment.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		granularity string
+		wantBuckets int
+		wantRate    float64 // Заполненность за весь период
+	}{
+		{GranularityDay, 1, 2.0 / (2 * 23)},
+		{GranularityHour, 23, 2.0 / (2 * 23)},
+		{Granularity15m, 92, 2.0 / (2 * 23)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.granularity, func(t *testing.T) {
+			report, err := buildOccupancyReport(parking, day, day.Add(23*time.Hour), tt.granularity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Buckets) != tt.wantBuckets {
+				t.Fatalf("%d интервалов, ожидалось %d", len(report.Buckets), tt.wantBuckets)
+			}
+			s := report.Summary
+			if s.Entries != 1 || s.Exits != 1 || s.Revenue != 200 || s.PeakOccupancy != 1 || s.AvgDwellMinutes != 120 {
+				t.Errorf("итог %+v, ожидались 1 въезд, 1 выезд, 200 выручки, пик 1 и 120 минут", s)
+			}
+			if diff := s.OccupancyRate - tt.wantRate; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("заполненность %v, ожидалось %v", s.OccupancyRate, tt.wantRate)
+			}
+			if len(report.RevenueByZone) != 1 || report.RevenueByZone[0] != (ZoneRevenue{Zone: "A", Day: "2026-03-29", Revenue: 200}) {
+				t.Errorf("выручка по зонам %+v", report.RevenueByZone)
+			}
+		})
+	}
+
+	if _, err := buildOccupancyReport(parking, day, day.AddDate(1, 0, 0), Granularity15m); err != errTooManyBuckets {
+		t.Errorf("год по 15 минут: %v, ожидалось %v", err, errTooManyBuckets)
+	}
+}
+
+func TestGetOccupancyAnalyticsParams(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	start, end := "2026-10-01T00:00:00Z", "2026-10-02T00:00:00Z"
+
+	tests := []struct {
+		query string
+		code  ErrorCode
+	}{
+		{"", CodeTimeRangeRequired},
+		{fmt.Sprintf("start_time=yesterday&end_time=%s", end), CodeInvalidStartTime},
+		{fmt.Sprintf("start_time=%s&end_time=tomorrow", start), CodeInvalidEndTime},
+		{fmt.Sprintf("start_time=%s&end_time=%s", end, start), CodeTimeRangeInvalid},
+		{fmt.Sprintf("start_time=%s&end_time=%s&granularity=minute", start, end), CodeInvalidOccupancyGranularity},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.code), func(t *testing.T) {
+			s.expectError(s.do(http.MethodGet, "/api/v1/analytics/occupancy?"+tt.query, admin, nil), http.StatusBadRequest, tt.code)
+		})
+	}
+}
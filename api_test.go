@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Сквозные проверки API через httptest: NewAPI с хранилищем в памяти и
+// маршрутами, как у сервера. Модули, которым нужен Postgres (абонементы,
+// продавцы), подменяются testPolicy через интерфейс EntryPolicy.
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  Store
+	mailer *captureMailer
+}
+
+// newTestServer поднимает API с настройками по умолчанию, которые может
+// поменять configure. Правила въезда - почасовой тариф, если wrap не задан,
+// иначе то, что wrap построит поверх него.
+func newTestServer(t *testing.T, wrap func(basic basicEntryPolicy) EntryPolicy, configure func(cfg *Config)) *testServer {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.Auth.JWTSecret = "test-secret-0123456789"
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	store := newMemoryStore()
+	var policy EntryPolicy = basicEntryPolicy{parkings: store.Parkings, pricing: cfg.Pricing}
+	if wrap != nil {
+		policy = wrap(policy.(basicEntryPolicy))
+	}
+	limits, err := newRateLimiter(cfg.RateLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := newServices(cfg)
+	mailer := &captureMailer{from: cfg.Mail.From}
+	services.Mailer = mailer
+
+	router := gin.New()
+	setupRoutes(router, NewAPI(cfg.Auth, store, policy, services, nil, limits), cfg.API)
+	return &testServer{t: t, router: router, store: store, mailer: mailer}
+}
+
+// memory данные хранилища, которых нет в его интерфейсах
+func (s *testServer) memory() *memoryDB {
+	return s.store.Users.(memoryUserRepository).m
+}
+
+// do отправляет запрос с телом body в JSON и токеном token, если он задан
+func (s *testServer) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect проверяет код ответа и разбирает тело в out, если он задан
+func (s *testServer) expect(w *httptest.ResponseRecorder, status int, out any) {
+	s.t.Helper()
+	if w.Code != status {
+		s.t.Fatalf("ответ %d, ожидался %d: %s", w.Code, status, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+}
+
+// expectError проверяет код ответа и код ошибки в теле
+func (s *testServer) expectError(w *httptest.ResponseRecorder, status int, code ErrorCode) {
+	s.t.Helper()
+	var body struct {
+		Code ErrorCode `json:"code"`
+	}
+	s.expect(w, status, &body)
+	if body.Code != code {
+		s.t.Fatalf("код ошибки %q, ожидался %q", body.Code, code)
+	}
+}
+
+// login входит и возвращает JWT
+func (s *testServer) login(email, password string) string {
+	s.t.Helper()
+	var resp TokenResponse
+	s.expect(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: email, Password: password}), http.StatusOK, &resp)
+	return resp.Token
+}
+
+// createUser создает подтвержденного пользователя с ролью role
+func (s *testServer) createUser(email, password, role string) User {
+	s.t.Helper()
+	hashed, err := hashPassword(password)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	now := time.Now()
+	user := User{Name: email, Email: email, Password: hashed, Role: role, EmailVerifiedAt: &now}
+	if err := s.store.Users.Create(&user); err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+var mailCode = regexp.MustCompile(`код (\S+)`)
+
+// lastMailCode токен из последнего письма на адрес to
+func (s *testServer) lastMailCode(to string) string {
+	s.t.Helper()
+	sent := s.mailer.Sent()
+	for i := len(sent) - 1; i >= 0; i-- {
+		if sent[i].To[0] != to {
+			continue
+		}
+		if m := mailCode.FindStringSubmatch(sent[i].Body); m != nil {
+			return m[1]
+		}
+	}
+	s.t.Fatalf("нет письма с кодом для %s", to)
+	return ""
+}
+
+func TestRegisterVerifyLogin(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	const email, password = "driver@example.com", "secret123"
+
+	s.expect(s.do(http.MethodPost, "/api/v1/register", "", RegisterRequest{Name: "Водитель", Email: email, Password: password}), http.StatusCreated, nil)
+	s.expectError(s.do(http.MethodPost, "/api/v1/register", "", RegisterRequest{Name: "Другой", Email: email, Password: password}), http.StatusBadRequest, CodeEmailTaken)
+
+	// До подтверждения email войти нельзя
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: email, Password: password}), http.StatusForbidden, CodeEmailNotVerified)
+
+	code := s.lastMailCode(email)
+	s.expect(s.do(http.MethodPost, "/api/v1/email/verify", "", VerifyEmailRequest{Token: code}), http.StatusOK, nil)
+	s.expectError(s.do(http.MethodPost, "/api/v1/email/verify", "", VerifyEmailRequest{Token: code}), http.StatusBadRequest, CodeConfirmationInvalid)
+
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: email, Password: "wrong-password"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	token := s.login(email, password)
+	s.expect(s.do(http.MethodGet, "/api/v1/parkings", token, nil), http.StatusOK, nil)
+
+	// Схема в Authorization без учета регистра, токен без схемы - для старых клиентов
+	for _, header := range []string{"bearer " + token, "BEARER " + token, token} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/parkings", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		s.expect(w, http.StatusOK, nil)
+	}
+	s.expectError(s.do(http.MethodGet, "/api/v1/parkings", "", nil), http.StatusUnauthorized, CodeTokenMissing)
+}
+
+// testPolicy почасовой тариф и упрощенные абонементы и валидации продавцов:
+// место из reserved доступно только указанному автомобилю, коды из
+// validations сокращают оплачиваемое время
+type testPolicy struct {
+	basicEntryPolicy
+	reserved    map[uint]uint // ID места -> ID автомобиля с абонементом
+	validations map[string]Validation
+}
+
+func (p testPolicy) EntryRate(ctx context.Context, spot Spot, vehicle Vehicle, at time.Time) (float64, error) {
+	if vehicleID, ok := p.reserved[spot.ID]; ok && vehicleID != vehicle.ID {
+		return 0, errSpotReserved
+	}
+	return p.basicEntryPolicy.EntryRate(ctx, spot, vehicle, at)
+}
+
+func (p testPolicy) QuoteExit(ctx context.Context, entry Entry, spot Spot, codes []string, at time.Time) (ExitQuote, error) {
+	var validations []Validation
+	for _, code := range codes {
+		v, ok := p.validations[code]
+		if !ok {
+			return ExitQuote{}, errValidationCodeInvalid
+		}
+		validations = append(validations, v)
+	}
+
+	full := float64(billableHours(at.Sub(entry.EntryTime))) * *entry.LockedRate
+	amount := float64(billableHours(at.Sub(entry.EntryTime)-validationDiscount(validations))) * *entry.LockedRate
+	return ExitQuote{Amount: amount, FullAmount: full, Validations: validations}, nil
+}
+
+// parkEntry ставит автомобиль на место и сдвигает въезд на ago назад
+func (s *testServer) parkEntry(token string, spotID, vehicleID uint, ago time.Duration) Entry {
+	s.t.Helper()
+	var entry Entry
+	s.expect(s.do(http.MethodPost, "/api/v1/entries", token, CreateEntryRequest{SpotID: spotID, VehicleID: vehicleID}), http.StatusCreated, &entry)
+	entry.EntryTime = entry.EntryTime.Add(-ago)
+	if err := s.store.Entries.Save(&entry); err != nil {
+		s.t.Fatal(err)
+	}
+	return entry
+}
+
+func TestEntryQuoteExit(t *testing.T) {
+	policy := testPolicy{
+		reserved:    map[uint]uint{},
+		validations: map[string]Validation{"CAFE60": {ID: 1, MerchantID: 1, DiscountMinutes: 60, Status: ValidationStatusIssued}},
+	}
+	s := newTestServer(t, func(basic basicEntryPolicy) EntryPolicy {
+		policy.basicEntryPolicy = basic
+		return policy
+	}, nil)
+
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	driver := s.createUser("driver@example.com", "secret123", UserRoleUser)
+	token := s.login("driver@example.com", "secret123")
+
+	// Парковку и места создает только администратор
+	parkingRequest := CreateParkingRequest{Name: "Центр", Latitude: 55.75, Longitude: 37.62, Capacity: 3,
+		Tariffs: []TariffInput{{Type: "почасовой", Price: 100}}}
+	s.expectError(s.do(http.MethodPost, "/api/v1/parkings", token, parkingRequest), http.StatusForbidden, CodeRoleRequired)
+	var parking Parking
+	s.expect(s.do(http.MethodPost, "/api/v1/parkings", admin, parkingRequest), http.StatusCreated, &parking)
+	spots := make([]Spot, 3)
+	for i, number := range []string{"A1", "A2", "A3"} {
+		s.expect(s.do(http.MethodPost, fmt.Sprintf("/api/v1/parkings/%d/spots", parking.ID), admin, AddSpotRequest{Number: number}), http.StatusCreated, &spots[i])
+	}
+
+	car := Vehicle{LicensePlate: "А123ВС77", OwnerID: driver.ID}
+	other := Vehicle{LicensePlate: "В456ОР77", OwnerID: driver.ID}
+	for _, v := range []*Vehicle{&car, &other} {
+		if err := s.store.Vehicles.Create(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Полтора часа по 100 - два оплачиваемых часа
+	entry := s.parkEntry(token, spots[0].ID, car.ID, 90*time.Minute)
+	if entry.LockedRate == nil || *entry.LockedRate != 100 {
+		t.Fatalf("зафиксирована ставка %v, ожидалась 100", entry.LockedRate)
+	}
+	s.expectError(s.do(http.MethodPost, "/api/v1/entries", token, CreateEntryRequest{SpotID: spots[0].ID, VehicleID: other.ID}), http.StatusBadRequest, CodeSpotOccupied)
+
+	var exit Exit
+	s.expect(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash"}), http.StatusCreated, &exit)
+	if payment := s.memory().payments[exit.PaymentID]; payment.Amount != 200 {
+		t.Fatalf("к оплате %v, ожидалось 200", payment.Amount)
+	}
+	if spot, _ := s.store.Spots.Get(spots[0].ID); spot.IsOccupied {
+		t.Fatal("место не освободилось после выезда")
+	}
+	s.expectError(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash"}), http.StatusBadRequest, CodeExitAlreadyRecorded)
+
+	// Валидация продавца на 60 минут: оплачивается полчаса, то есть час
+	entry = s.parkEntry(token, spots[0].ID, car.ID, 90*time.Minute)
+	s.expectError(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash", ValidationCodes: []string{"UNKNOWN"}}), http.StatusBadRequest, CodeValidationCodeInvalid)
+	s.expect(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash", ValidationCodes: []string{"CAFE60"}}), http.StatusCreated, &exit)
+	if payment := s.memory().payments[exit.PaymentID]; payment.Amount != 100 {
+		t.Fatalf("к оплате со скидкой %v, ожидалось 100", payment.Amount)
+	}
+	applied := s.memory().validations[1]
+	if applied.Status != ValidationStatusApplied || applied.EntryID == nil || *applied.EntryID != entry.ID || applied.DiscountAmount != 100 {
+		t.Fatalf("валидация не учтена на выезде: %+v", applied)
+	}
+
+	// Учтенный код второй раз не срабатывает
+	entry = s.parkEntry(token, spots[1].ID, other.ID, 30*time.Minute)
+	s.expectError(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash", ValidationCodes: []string{"CAFE60"}}), http.StatusBadRequest, CodeValidationCodeInvalid)
+
+	// Место по абонементу: чужой автомобиль не встанет, владелец абонемента встанет
+	policy.reserved[spots[2].ID] = car.ID
+	s.expectError(s.do(http.MethodPost, "/api/v1/entries", token, CreateEntryRequest{SpotID: spots[2].ID, VehicleID: other.ID}), http.StatusBadRequest, CodeSpotReserved)
+	s.parkEntry(token, spots[2].ID, car.ID, 0)
+}
+
+func TestRateLimits(t *testing.T) {
+	s := newTestServer(t, nil, func(cfg *Config) {
+		cfg.RateLimit.AuthPerIP = RateLimit{Requests: 3, Per: time.Hour}
+		cfg.RateLimit.APIPerToken = RateLimit{Requests: 2, Per: time.Hour}
+	})
+	s.createUser("driver@example.com", "secret123", UserRoleUser)
+
+	// Вход и регистрация ограничены по IP: четвертый запрос за час - 429
+	token := s.login("driver@example.com", "secret123")
+	for i := 0; i < 2; i++ {
+		s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: "nobody@example.com", Password: "secret123"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	}
+	w := s.do(http.MethodPost, "/api/v1/register", "", RegisterRequest{Name: "Новый", Email: "new@example.com", Password: "secret123"})
+	s.expectError(w, http.StatusTooManyRequests, CodeRateLimited)
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("нет заголовка Retry-After")
+	}
+
+	// Квота авторизованных запросов пользователя
+	for i := 0; i < 2; i++ {
+		s.expect(s.do(http.MethodGet, "/api/v1/parkings", token, nil), http.StatusOK, nil)
+	}
+	s.expectError(s.do(http.MethodGet, "/api/v1/parkings", token, nil), http.StatusTooManyRequests, CodeRateLimited)
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, nil, func(cfg *Config) {
+		cfg.RateLimit.AuthPerIP = RateLimit{}
+		cfg.RateLimit.Lockout = LockoutConfig{Threshold: 2, Base: time.Hour, Max: time.Hour, Window: time.Hour}
+	})
+	s.createUser("driver@example.com", "secret123", UserRoleUser)
+	s.createUser("other@example.com", "secret123", UserRoleUser)
+
+	// Успешный вход сбрасывает серию неудач
+	s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: "driver@example.com", Password: "wrong"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	s.login("driver@example.com", "secret123")
+
+	for i := 0; i < 2; i++ {
+		s.expectError(s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: "driver@example.com", Password: "wrong"}), http.StatusUnauthorized, CodeInvalidCredentials)
+	}
+	// Заблокирована учетная запись, а не клиент: верный пароль не помогает,
+	// другой пользователь входит
+	w := s.do(http.MethodPost, "/api/v1/login", "", LoginRequest{Email: "driver@example.com", Password: "secret123"})
+	s.expectError(w, http.StatusTooManyRequests, CodeLoginLocked)
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("нет заголовка Retry-After")
+	}
+	s.login("other@example.com", "secret123")
+}
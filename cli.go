@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const cliUsage = `Использование: parking_manager <команда> [флаги]
+
+Команды:
+  serve                  запустить HTTP-сервер (по умолчанию)
+  migrate                применить миграции: migrate [up [версия] | down [шагов] | status]
+  create-admin           создать администратора или выдать права существующему пользователю
+  import-spots           загрузить места парковки из CSV (номер, зона)
+  close-stale-entries    закрыть забытые открытые стоянки
+  recalc-payment         пересчитать сумму неоплаченного выезда
+  export                 выгрузить данные в CSV или XLSX
+  openapi                напечатать спецификацию OpenAPI
+  gen-client             сгенерировать Go-клиент API (пакет client)
+
+Флаги команды: parking_manager <команда> -h`
+
+// runCommand выбирает подкоманду по первому аргументу
+func runCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return serve(cfg)
+	}
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "serve":
+		return serve(cfg)
+	case "migrate":
+		return runMigrateCommand(db, args)
+	case "create-admin":
+		return createAdminCommand(args)
+	case "import-spots":
+		return importSpotsCommand(args)
+	case "close-stale-entries":
+		return closeStaleEntriesCommand(cfg, args)
+	case "recalc-payment":
+		return recalcPaymentCommand(cfg, args)
+	case "export":
+		return exportCommand(args)
+	case "help", "-h", "--help":
+		fmt.Println(cliUsage)
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда %q\n\n%s", name, cliUsage)
+	}
+}
+
+// offlineCommands команды, которым не нужны база и проверка настроек
+// сервера; запускаются до подключения к базе
+var offlineCommands = map[string]func(args []string) error{
+	"openapi":    openAPICommand,
+	"gen-client": genClientCommand,
+}
+
+// cliAPI возвращает обработчики для консольных команд: та же логика, что и
+// у HTTP, но без рассылки обновлений по WebSocket
+func cliAPI(cfg Config) *API {
+	services := newServices(cfg)
+	return NewAPI(cfg.Auth, newGormStore(db), featureEntryPolicy{pricing: services.Pricing}, services, nil, nil)
+}
+
+// cliReady проверяет версию схемы, как это делает сервер перед запуском
+func cliReady() error {
+	return checkSchemaVersion(db)
+}
+
+func createAdminCommand(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email администратора")
+	name := fs.String("name", "Администратор", "имя")
+	password := fs.String("password", "", "пароль; если не задан, берется из ADMIN_PASSWORD или читается из stdin")
+	fs.Parse(args)
+
+	if *email == "" {
+		return errors.New("нужен -email")
+	}
+	if err := cliReady(); err != nil {
+		return err
+	}
+
+	if *password == "" {
+		*password = os.Getenv("ADMIN_PASSWORD")
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Пароль: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		*password = strings.TrimSpace(line)
+	}
+	// Тот же минимум, что и в API (min=6). Без пароля можно только повысить
+	// существующего пользователя.
+	if *password != "" && utf8.RuneCountInString(*password) < 6 {
+		return errors.New("пароль должен быть не короче 6 символов")
+	}
+
+	users := newGormStore(db).Users
+	user, err := users.GetByEmail(*email)
+	switch {
+	case err == nil:
+		// Пользователь уже есть - повышаем до администратора, пароль меняем,
+		// только если его передали явно
+		updates := map[string]interface{}{"role": UserRoleAdmin}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if *password != "" {
+			hashed, err := hashPassword(*password)
+			if err != nil {
+				return err
+			}
+			updates["password"] = hashed
+			// Смена пароля завершает сессии, как и через API
+			updates["token_version"] = gorm.Expr("token_version + 1")
+		}
+		if err := db.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		fmt.Printf("Пользователь %s (ID %d) теперь администратор\n", user.Email, user.ID)
+		return nil
+	case !errors.Is(err, errNotFound):
+		return err
+	}
+
+	if *password == "" {
+		return errors.New("для нового администратора нужен пароль")
+	}
+	hashed, err := hashPassword(*password)
+	if err != nil {
+		return err
+	}
+	// Адрес администратора задает тот, у кого есть доступ к серверу, его
+	// не нужно подтверждать письмом
+	now := time.Now()
+	user = User{Name: *name, Email: *email, Password: hashed, Role: UserRoleAdmin, EmailVerifiedAt: &now}
+	if err := users.Create(&user); err != nil {
+		return err
+	}
+	fmt.Printf("Администратор %s создан (ID %d)\n", user.Email, user.ID)
+	return nil
+}
+
+// importSpotsCommand загружает места из CSV: номер места и необязательная зона.
+// Строка заголовка пропускается, места с уже существующим номером тоже.
+func importSpotsCommand(args []string) error {
+	fs := flag.NewFlagSet("import-spots", flag.ExitOnError)
+	parkingID := fs.Uint("parking", 0, "ID парковки")
+	file := fs.String("file", "", "CSV-файл; - для stdin")
+	fs.Parse(args)
+
+	if *parkingID == 0 || *file == "" {
+		return errors.New("нужны -parking и -file")
+	}
+	if err := cliReady(); err != nil {
+		return err
+	}
+
+	store := newGormStore(db)
+	parking, err := store.Parkings.Get(*parkingID)
+	if err != nil {
+		return fmt.Errorf("парковка %d: %w", *parkingID, err)
+	}
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	existing := make(map[string]bool, len(parking.Spots))
+	for _, s := range parking.Spots {
+		existing[s.Number] = true
+	}
+
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var spots []Spot
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("строка %d: %w", line, err)
+		}
+		number := strings.TrimSpace(record[0])
+		if number == "" || (line == 1 && strings.EqualFold(number, "number")) {
+			continue
+		}
+		if existing[number] {
+			continue
+		}
+		existing[number] = true
+
+		spot := Spot{ParkingID: parking.ID, Number: number}
+		if len(record) > 1 {
+			spot.Zone = strings.TrimSpace(record[1])
+		}
+		spots = append(spots, spot)
+	}
+
+	if len(spots) > 0 {
+		if err := db.CreateInBatches(&spots, 500).Error; err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Добавлено мест: %d\n", len(spots))
+	return nil
+}
+
+// closeStaleEntriesCommand закрывает стоянки, открытые дольше заданного
+// срока: обычно это машины, чей выезд не зарегистрировали. Оплата считается
+// так же, как при выезде через API.
+func closeStaleEntriesCommand(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("close-stale-entries", flag.ExitOnError)
+	olderThan := fs.Duration("older-than", 72*time.Hour, "закрыть стоянки старше")
+	parkingID := fs.Uint("parking", 0, "только эта парковка")
+	method := fs.String("method", "manual", "способ оплаты для созданных платежей")
+	dryRun := fs.Bool("dry-run", false, "только показать, что будет закрыто")
+	fs.Parse(args)
+
+	if err := cliReady(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := db.Joins("JOIN spots ON spots.id = entries.spot_id").
+		Where("entries.exit_time IS NULL AND entries.entry_time < ?", now.Add(-*olderThan))
+	if *parkingID != 0 {
+		query = query.Where("spots.parking_id = ?", *parkingID)
+	}
+	var entries []Entry
+	if err := query.Order("entries.entry_time").Find(&entries).Error; err != nil {
+		return err
+	}
+
+	api := cliAPI(cfg)
+	closed := 0
+	for _, entry := range entries {
+		if *dryRun {
+			fmt.Printf("Въезд %d, место %d, с %s\n", entry.ID, entry.SpotID, entry.EntryTime.Format(time.RFC3339))
+			continue
+		}
+		exit, err := api.closeEntry(context.Background(), entry, *method, nil, 0, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Въезд %d не закрыт: %v\n", entry.ID, err)
+			continue
+		}
+		closed++
+		fmt.Printf("Въезд %d закрыт, выезд %d, платеж %d\n", entry.ID, exit.ID, exit.PaymentID)
+	}
+
+	if *dryRun {
+		fmt.Printf("Будет закрыто стоянок: %d\n", len(entries))
+		return nil
+	}
+	fmt.Printf("Закрыто стоянок: %d из %d\n", closed, len(entries))
+	return nil
+}
+
+// recalcPaymentCommand пересчитывает сумму выезда по текущим правилам,
+// например после исправления тарифа. Оплаченные и вошедшие в счет платежи
+// не меняются.
+func recalcPaymentCommand(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("recalc-payment", flag.ExitOnError)
+	entryID := fs.Uint("entry", 0, "ID въезда")
+	dryRun := fs.Bool("dry-run", false, "только показать новую сумму")
+	fs.Parse(args)
+
+	if *entryID == 0 {
+		return errors.New("нужен -entry")
+	}
+	if err := cliReady(); err != nil {
+		return err
+	}
+
+	var entry Entry
+	if err := db.Preload("Exit.Payment").First(&entry, *entryID).Error; err != nil {
+		return fmt.Errorf("въезд %d: %w", *entryID, err)
+	}
+	if entry.Exit == nil {
+		return fmt.Errorf("по въезду %d еще нет выезда", entry.ID)
+	}
+	payment := entry.Exit.Payment
+	if payment.Status != "pending" && (payment.Status != PaymentStatusInvoiced || payment.InvoiceID != nil) {
+		return fmt.Errorf("платеж %d в статусе %s, пересчет невозможен", payment.ID, payment.Status)
+	}
+
+	var spot Spot
+	if err := db.First(&spot, entry.SpotID).Error; err != nil {
+		return fmt.Errorf("место %d: %w", entry.SpotID, err)
+	}
+
+	var validations []Validation
+	if err := db.Where("entry_id = ? AND status = ?", entry.ID, ValidationStatusApplied).Find(&validations).Error; err != nil {
+		return err
+	}
+	amount := newPricing(cfg.Pricing).calculatePayment(entry, spot.ParkingID, entry.Exit.ExitTime, validationDiscount(validations))
+
+	fmt.Printf("Платеж %d: %.2f -> %.2f\n", payment.ID, payment.Amount, amount)
+	if *dryRun || amount == payment.Amount {
+		return nil
+	}
+	return db.Model(&payment).Update("amount", amount).Error
+}
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	name := fs.String("dataset", "", "набор: entries, exits, payments или analytics")
+	format := fs.String("format", ExportFormatCSV, "csv или xlsx")
+	from := fs.String("from", "", "начало периода, RFC3339")
+	to := fs.String("to", "", "конец периода, RFC3339")
+	parkingID := fs.String("parking", "", "ID парковки")
+	out := fs.String("out", "", "файл; по умолчанию stdout")
+	fs.Parse(args)
+
+	dataset, ok := exportDatasets[*name]
+	if !ok {
+		return fmt.Errorf("неизвестный набор данных %q", *name)
+	}
+	if *format != ExportFormatCSV && *format != ExportFormatXLSX {
+		return errors.New("поддерживаются форматы csv и xlsx")
+	}
+	filter, err := parseExportFilter(url.Values{"from": {*from}, "to": {*to}, "parking_id": {*parkingID}})
+	if err != nil {
+		return err
+	}
+	if err := cliReady(); err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	rows, err := writeExport(dataset, filter, *format, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Выгружено строк: %d\n", rows)
+	return nil
+}
+
+func openAPICommand(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	out := fs.String("out", "", "файл; по умолчанию stdout")
+	fs.Parse(args)
+
+	spec, err := json.MarshalIndent(buildOpenAPI(apiRoutes(&API{})), "", "  ")
+	if err != nil {
+		return err
+	}
+	spec = append(spec, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(spec)
+		return err
+	}
+	return os.WriteFile(*out, spec, 0o644)
+}
+
+func genClientCommand(args []string) error {
+	fs := flag.NewFlagSet("gen-client", flag.ExitOnError)
+	out := fs.String("out", "client/client.go", "файл пакета client")
+	fs.Parse(args)
+
+	src, err := genClient(apiRoutes(&API{}))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(*out, src, 0o644)
+}
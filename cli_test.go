@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"help"}, ""},
+		{[]string{"--help"}, ""},
+		{[]string{"drop-database"}, `неизвестная команда "drop-database"`},
+		{[]string{"create-admin"}, "нужен -email"},
+		{[]string{"import-spots", "-parking", "1"}, "нужны -parking и -file"},
+		{[]string{"recalc-payment"}, "нужен -entry"},
+		{[]string{"export", "-dataset", "users"}, `неизвестный набор данных "users"`},
+		{[]string{"export", "-dataset", "entries", "-format", "pdf"}, "поддерживаются форматы csv и xlsx"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			err := runCommand(defaultConfig(), tt.args)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("%v, ожидалось %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateAdminCommand(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_PASSWORD", "")
+	stdin := os.Stdin
+	os.Stdin, _ = os.Open(os.DevNull)
+	t.Cleanup(func() { os.Stdin.Close(); os.Stdin = stdin })
+
+	hashed, err := hashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(t, &User{Name: "Оператор", Email: "operator@example.com", Password: hashed, Role: UserRoleUser})
+
+	// Шаги выполняются по порядку над одной базой
+	tests := []struct {
+		name         string
+		args         []string
+		wantErr      string
+		email        string // Чью запись проверить после команды
+		role         string
+		password     string
+		tokenVersion int
+	}{
+		{"короткий пароль не повышает существующего", []string{"-email", "operator@example.com", "-password", "12345"},
+			"не короче 6 символов", "operator@example.com", UserRoleUser, "old-password", 0},
+		{"повышение без пароля", []string{"-email", "operator@example.com"},
+			"", "operator@example.com", UserRoleAdmin, "old-password", 0},
+		{"смена пароля завершает сессии", []string{"-email", "operator@example.com", "-password", "new-password"},
+			"", "operator@example.com", UserRoleAdmin, "new-password", 1},
+		{"новый без пароля", []string{"-email", "admin@example.com"}, "нужен пароль", "", "", "", 0},
+		{"новый с коротким паролем", []string{"-email", "admin@example.com", "-password", "abc12"}, "не короче 6 символов", "", "", "", 0},
+		// Длина считается в символах, а не в байтах
+		{"новый с кириллическим паролем", []string{"-email", "admin@example.com", "-password", "пароль"},
+			"", "admin@example.com", UserRoleAdmin, "пароль", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := createAdminCommand(tt.args)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("%v, ожидалось %q", err, tt.wantErr)
+			}
+			if tt.email == "" {
+				var count int64
+				db.Model(&User{}).Where("email = ?", "admin@example.com").Count(&count)
+				if count != 0 {
+					t.Errorf("создан пользователь без подходящего пароля")
+				}
+				return
+			}
+
+			var user User
+			if err := db.Where("email = ?", tt.email).First(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.role || user.TokenVersion != tt.tokenVersion {
+				t.Errorf("роль %s, версия токенов %d; ожидалось %s и %d", user.Role, user.TokenVersion, tt.role, tt.tokenVersion)
+			}
+			if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(tt.password)) != nil {
+				t.Errorf("пароль не %q", tt.password)
+			}
+			if user.Role == UserRoleAdmin && user.EmailVerifiedAt == nil {
+				t.Errorf("адрес администратора не подтвержден")
+			}
+		})
+	}
+}
+
+func TestImportSpotsCommand(t *testing.T) {
+	testDB(t)
+	parking := Parking{Name: "Импорт", Capacity: 10}
+	create(t, &parking)
+	create(t, &Spot{ParkingID: parking.ID, Number: "A1", Zone: "A"})
+
+	file := filepath.Join(t.TempDir(), "spots.csv")
+	csv := "number,zone\nA1,A\nA2, A\n\nB1\nA2,B\n"
+	if err := os.WriteFile(file, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := importSpotsCommand([]string{"-parking", "999", "-file", file}); err == nil {
+		t.Error("импорт в несуществующую парковку прошел")
+	}
+	// Повторный импорт того же файла ничего не добавляет
+	for i := 0; i < 2; i++ {
+		if err := importSpotsCommand([]string{"-parking", strconv.FormatUint(uint64(parking.ID), 10), "-file", file}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var spots []Spot
+	db.Where("parking_id = ?", parking.ID).Order("number").Find(&spots)
+	want := map[string]string{"A1": "A", "A2": "A", "B1": ""}
+	if len(spots) != len(want) {
+		t.Fatalf("%d мест, ожидалось %d: %+v", len(spots), len(want), spots)
+	}
+	for _, s := range spots {
+		if zone, ok := want[s.Number]; !ok || zone != s.Zone {
+			t.Errorf("место %s в зоне %q", s.Number, s.Zone)
+		}
+	}
+}
+
+func TestRecalcPaymentCommand(t *testing.T) {
+	testDB(t)
+	cfg := defaultConfig()
+	parking := Parking{Name: "Пересчет", Capacity: 1}
+	create(t, &parking)
+	spot := Spot{ParkingID: parking.ID, Number: "1"}
+	create(t, &spot)
+	create(t, &Tariff{ParkingID: parking.ID, Type: "почасовой", Price: 100})
+
+	invoiceID := uint(1)
+	tests := []struct {
+		name      string
+		payment   Payment
+		dryRun    bool
+		wantErr   bool
+		wantTotal float64
+	}{
+		// Стоянка 2 ч 30 мин по тарифу 100 - 300
+		{"неоплаченный", Payment{Amount: 250, Method: "cash", Status: "pending"}, false, false, 300},
+		{"без изменений в пробном запуске", Payment{Amount: 250, Method: "cash", Status: "pending"}, true, false, 250},
+		{"в очереди на счет", Payment{Amount: 250, Method: "invoice", Status: PaymentStatusInvoiced}, false, false, 300},
+		{"уже в счете", Payment{Amount: 250, Method: "invoice", Status: PaymentStatusInvoiced, InvoiceID: &invoiceID}, false, true, 250},
+		{"оплаченный", Payment{Amount: 250, Method: "card", Status: "succeeded"}, false, true, 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := tt.payment
+			create(t, &payment)
+			exitTime := time.Now().Add(-time.Hour)
+			entry := Entry{SpotID: spot.ID, VehicleID: 1, EntryTime: exitTime.Add(-150 * time.Minute), ExitTime: &exitTime}
+			create(t, &entry)
+			create(t, &Exit{EntryID: entry.ID, ExitTime: exitTime, PaymentID: payment.ID})
+
+			args := []string{"-entry", strconv.FormatUint(uint64(entry.ID), 10)}
+			if tt.dryRun {
+				args = append(args, "-dry-run")
+			}
+			if err := recalcPaymentCommand(cfg, args); (err != nil) != tt.wantErr {
+				t.Fatalf("%v, ожидалась ошибка: %v", err, tt.wantErr)
+			}
+			db.First(&payment, payment.ID)
+			if payment.Amount != tt.wantTotal {
+				t.Errorf("сумма %v, ожидалось %v", payment.Amount, tt.wantTotal)
+			}
+		})
+	}
+
+	if err := recalcPaymentCommand(cfg, []string{"-entry", "999"}); err == nil {
+		t.Error("пересчет несуществующего въезда прошел")
+	}
+}
@@ -0,0 +1,1651 @@
+// Code generated by "parking_manager gen-client"; DO NOT EDIT.
+
+// Package client - клиент Parking Manager API. Сгенерирован по тем же
+// описаниям маршрутов, что и спецификация /openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client клиент API. Token передается в Authorization: Bearer, Language -
+// в Accept-Language и выбирает язык сообщений об ошибках. GatewayID и
+// GatewaySecret нужны только шлюзам датчиков.
+type Client struct {
+	BaseURL       string
+	HTTPClient    *http.Client
+	Token         string
+	Language      string
+	GatewayID     string
+	GatewaySecret string
+}
+
+// New клиент для сервера по адресу baseURL, например http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// Error ответ сервера с ошибкой. Code - стабильный код, по нему и стоит
+// принимать решения; Message зависит от языка. RetryAfter задан для 429.
+type Error struct {
+	StatusCode int           `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+	Message    string        `json:"error"`
+	Code       string        `json:"code"`
+	Details    []FieldError  `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// send выполняет запрос; ответ с кодом 400 и выше возвращается как *Error
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Language != "" {
+		req.Header.Set("Accept-Language", c.Language)
+	}
+	if c.GatewayID != "" {
+		req.Header.Set("X-Gateway-ID", c.GatewayID)
+		req.Header.Set("X-Gateway-Secret", c.GatewaySecret)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do выполняет запрос и разбирает JSON-ответ в out; out == nil - ответ без тела
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Нулевые значения параметров не передаются: сервер подставит умолчания
+
+func setString(q url.Values, name, v string) {
+	if v != "" {
+		q.Set(name, v)
+	}
+}
+
+func setInt(q url.Values, name string, v int) {
+	if v != 0 {
+		q.Set(name, strconv.Itoa(v))
+	}
+}
+
+func setBool(q url.Values, name string, v bool) {
+	if v {
+		q.Set(name, "true")
+	}
+}
+
+func setTime(q url.Values, name string, v time.Time) {
+	if !v.IsZero() {
+		q.Set(name, v.Format(time.RFC3339))
+	}
+}
+
+type AddOrganizationMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type AddOrganizationVehicleRequest struct {
+	LicensePlate string `json:"license_plate"`
+}
+
+type AddSpotRequest struct {
+	Number string `json:"number"`
+	Zone   string `json:"zone"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password"`
+	NewEmail string `json:"new_email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type CreateEntryRequest struct {
+	SpotID    uint `json:"spot_id"`
+	VehicleID uint `json:"vehicle_id"`
+	LaneID    uint `json:"lane_id"`
+}
+
+type CreateExitRequest struct {
+	EntryID         uint     `json:"entry_id"`
+	PaymentMethod   string   `json:"payment_method"`
+	LaneID          uint     `json:"lane_id"`
+	ValidationCodes []string `json:"validation_codes"`
+}
+
+type CreateHolidayRequest struct {
+	Date      string `json:"date"`
+	Name      string `json:"name"`
+	ParkingID *uint  `json:"parking_id"`
+}
+
+type CreateInvoiceRequest struct {
+	Month string `json:"month"`
+}
+
+type CreateLaneRequest struct {
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	DeviceID  string `json:"device_id"`
+}
+
+type CreateMerchantRequest struct {
+	ParkingID       uint   `json:"parking_id"`
+	Name            string `json:"name"`
+	DiscountMinutes int    `json:"discount_minutes"`
+	MonthlyLimit    int    `json:"monthly_limit"`
+}
+
+type CreateOrganizationRequest struct {
+	Name          string  `json:"name"`
+	BillingEmail  string  `json:"billing_email"`
+	BillingMode   string  `json:"billing_mode"`
+	SpendingLimit float64 `json:"spending_limit"`
+}
+
+type CreateParkingRequest struct {
+	Name      string        `json:"name"`
+	Latitude  float64       `json:"latitude"`
+	Longitude float64       `json:"longitude"`
+	Capacity  int           `json:"capacity"`
+	TimeZone  string        `json:"time_zone"`
+	Tariffs   []TariffInput `json:"tariffs"`
+}
+
+type CreatePermitProductRequest struct {
+	Name        string  `json:"name"`
+	Period      string  `json:"period"`
+	Window      string  `json:"window"`
+	SpotMode    string  `json:"spot_mode"`
+	Price       float64 `json:"price"`
+	OverageRate float64 `json:"overage_rate"`
+}
+
+type CreateReportScheduleRequest struct {
+	Frequency  string   `json:"frequency"`
+	Recipients []string `json:"recipients"`
+}
+
+type CreateSensorGatewayRequest struct {
+	Name      string `json:"name"`
+	GatewayID string `json:"gateway_id"`
+}
+
+type DynamicPricing struct {
+	ParkingID     uint      `json:"parking_id"`
+	Enabled       bool      `json:"enabled"`
+	FloorRate     float64   `json:"floor_rate"`
+	CeilingRate   float64   `json:"ceiling_rate"`
+	Step          float64   `json:"step"`
+	LowOccupancy  float64   `json:"low_occupancy"`
+	HighOccupancy float64   `json:"high_occupancy"`
+	CurrentRate   float64   `json:"current_rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type Entry struct {
+	ID         uint       `json:"id"`
+	SpotID     uint       `json:"spot_id"`
+	VehicleID  uint       `json:"vehicle_id"`
+	EntryTime  time.Time  `json:"entry_time"`
+	ExitTime   *time.Time `json:"exit_time,omitempty"`
+	LockedRate *float64   `json:"locked_rate,omitempty"`
+	Exit       *Exit      `json:"exit,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type Exit struct {
+	ID        uint      `json:"id"`
+	EntryID   uint      `json:"entry_id"`
+	ExitTime  time.Time `json:"exit_time"`
+	PaymentID uint      `json:"payment_id"`
+	Payment   Payment   `json:"payment"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExportJob struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"user_id"`
+	Dataset    string     `json:"dataset"`
+	Format     string     `json:"format"`
+	Query      string     `json:"query"`
+	Status     string     `json:"status"`
+	Rows       int        `json:"rows"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ForecastAccuracy struct {
+	HorizonHours int     `json:"horizon_hours"`
+	Samples      int     `json:"samples"`
+	MAE          float64 `json:"mae"`
+	Bias         float64 `json:"bias"`
+}
+
+type ForecastPoint struct {
+	Time              time.Time `json:"time"`
+	PredictedFree     float64   `json:"predicted_free"`
+	PredictedOccupied float64   `json:"predicted_occupied"`
+}
+
+type ForecastResponse struct {
+	ParkingID   uint            `json:"parking_id"`
+	Spots       int             `json:"spots"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Points      []ForecastPoint `json:"points"`
+}
+
+type GateEvent struct {
+	ID        uint      `json:"id"`
+	LaneID    uint      `json:"lane_id"`
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GenerateValidationCodesRequest struct {
+	Count           int `json:"count"`
+	DiscountMinutes int `json:"discount_minutes"`
+	ValidDays       int `json:"valid_days"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Holiday struct {
+	ID        uint      `json:"id"`
+	Date      string    `json:"date"`
+	Name      string    `json:"name"`
+	ParkingID *uint     `json:"parking_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type HourlyEntries struct {
+	ParkingID uint `json:"parking_id"`
+	Count     int  `json:"count"`
+	Hour      int  `json:"hour"`
+}
+
+type HourlyRollup struct {
+	ParkingID        uint      `json:"parking_id"`
+	BucketStart      time.Time `json:"bucket_start"`
+	Entries          int       `json:"entries"`
+	Exits            int       `json:"exits"`
+	OccupancyMinutes float64   `json:"occupancy_minutes"`
+	Revenue          float64   `json:"revenue"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type IngestResult struct {
+	Accepted int      `json:"accepted"`
+	Changed  int      `json:"changed"`
+	Rejected []string `json:"rejected"`
+}
+
+type IngestSensorReadingsRequest struct {
+	Readings []SensorReading `json:"readings"`
+}
+
+type Invoice struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	Number         string    `json:"number"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	Total          float64   `json:"total"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Lane struct {
+	ID           uint       `json:"id"`
+	ParkingID    uint       `json:"parking_id"`
+	Name         string     `json:"name"`
+	Direction    string     `json:"direction"`
+	DeviceID     string     `json:"device_id"`
+	Status       string     `json:"status"`
+	DeviceSecret string     `json:"device_secret,omitempty"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type LivenessResponse struct {
+	Status        string    `json:"status"`
+	Build         BuildInfo `json:"build"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type Merchant struct {
+	ID              uint      `json:"id"`
+	ParkingID       uint      `json:"parking_id"`
+	OwnerID         uint      `json:"owner_id"`
+	Name            string    `json:"name"`
+	DiscountMinutes int       `json:"discount_minutes"`
+	MonthlyLimit    int       `json:"monthly_limit"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type MerchantReport struct {
+	MerchantID      uint         `json:"merchant_id"`
+	Month           string       `json:"month"`
+	Validations     int          `json:"validations"`
+	Applied         int          `json:"applied"`
+	MonthlyLimit    int          `json:"monthly_limit"`
+	DiscountMinutes int          `json:"discount_minutes"`
+	DiscountAmount  float64      `json:"discount_amount"`
+	Items           []Validation `json:"items"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type OccupancyBucket struct {
+	Start              time.Time `json:"start"`
+	Entries            int       `json:"entries"`
+	Exits              int       `json:"exits"`
+	OccupancyRate      float64   `json:"occupancy_rate"`
+	PeakOccupancy      int       `json:"peak_occupancy"`
+	FullShare          float64   `json:"full_share"`
+	TurnoverPerSpot    float64   `json:"turnover_per_spot"`
+	Revenue            float64   `json:"revenue"`
+	AvgDwellMinutes    float64   `json:"avg_dwell_minutes"`
+	MedianDwellMinutes float64   `json:"median_dwell_minutes"`
+}
+
+type OccupancyReport struct {
+	ParkingID     uint              `json:"parking_id"`
+	TimeZone      string            `json:"time_zone"`
+	Granularity   string            `json:"granularity"`
+	Spots         int               `json:"spots"`
+	Summary       OccupancyBucket   `json:"summary"`
+	Buckets       []OccupancyBucket `json:"buckets"`
+	RevenueByZone []ZoneRevenue     `json:"revenue_by_zone"`
+}
+
+type Organization struct {
+	ID            uint                 `json:"id"`
+	Name          string               `json:"name"`
+	BillingEmail  string               `json:"billing_email"`
+	BillingMode   string               `json:"billing_mode"`
+	SpendingLimit float64              `json:"spending_limit"`
+	Members       []OrganizationMember `json:"members,omitempty"`
+	Vehicles      []Vehicle            `json:"vehicles,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+}
+
+type OrganizationMember struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	UserID         uint      `json:"user_id"`
+	User           User      `json:"user"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Parking struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Capacity  int       `json:"capacity"`
+	TimeZone  string    `json:"time_zone"`
+	Tariffs   []Tariff  `json:"tariffs"`
+	Spots     []Spot    `json:"spots"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Payment struct {
+	ID             uint      `json:"id"`
+	Amount         float64   `json:"amount"`
+	Method         string    `json:"method"`
+	Status         string    `json:"status"`
+	ProviderID     string    `json:"provider_id,omitempty"`
+	OrganizationID *uint     `json:"organization_id,omitempty"`
+	InvoiceID      *uint     `json:"invoice_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PaymentResult struct {
+	PaymentID uint   `json:"payment_id"`
+	Status    string `json:"status"`
+}
+
+type Permit struct {
+	ID             uint          `json:"id"`
+	ProductID      uint          `json:"product_id"`
+	Product        PermitProduct `json:"product"`
+	VehicleID      uint          `json:"vehicle_id"`
+	UserID         uint          `json:"user_id"`
+	SpotID         *uint         `json:"spot_id,omitempty"`
+	StartsAt       time.Time     `json:"starts_at"`
+	EndsAt         time.Time     `json:"ends_at"`
+	Status         string        `json:"status"`
+	LastPaymentID  *uint         `json:"last_payment_id,omitempty"`
+	ReminderSentAt *time.Time    `json:"reminder_sent_at,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+type PermitProduct struct {
+	ID          uint      `json:"id"`
+	ParkingID   uint      `json:"parking_id"`
+	Name        string    `json:"name"`
+	Period      string    `json:"period"`
+	Window      string    `json:"window"`
+	SpotMode    string    `json:"spot_mode"`
+	Price       float64   `json:"price"`
+	OverageRate float64   `json:"overage_rate"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type PriceChange struct {
+	ID                uint      `json:"id"`
+	ParkingID         uint      `json:"parking_id"`
+	OldRate           float64   `json:"old_rate"`
+	NewRate           float64   `json:"new_rate"`
+	Reason            string    `json:"reason"`
+	Occupancy         float64   `json:"occupancy"`
+	ForecastOccupancy float64   `json:"forecast_occupancy"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type PricingResponse struct {
+	ParkingID uint            `json:"parking_id"`
+	Rate      float64         `json:"rate"`
+	Dynamic   bool            `json:"dynamic"`
+	Config    *DynamicPricing `json:"config,omitempty"`
+}
+
+type ProcessPaymentRequest struct {
+	PaymentMethodID string `json:"payment_method_id"`
+	Amount          int64  `json:"amount"`
+}
+
+type PurchasePermitRequest struct {
+	ProductID       uint   `json:"product_id"`
+	VehicleID       uint   `json:"vehicle_id"`
+	SpotID          *uint  `json:"spot_id"`
+	PaymentMethodID string `json:"payment_method_id"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+	Build  BuildInfo              `json:"build"`
+}
+
+type RecomputeRollupsRequest struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	ParkingID uint      `json:"parking_id"`
+}
+
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type RegisterSensorRequest struct {
+	SpotID     uint   `json:"spot_id"`
+	ExternalID string `json:"external_id"`
+	Kind       string `json:"kind"`
+}
+
+type RenewPermitRequest struct {
+	PaymentMethodID string `json:"payment_method_id"`
+}
+
+type ReportSchedule struct {
+	ID         uint       `json:"id"`
+	ParkingID  uint       `json:"parking_id"`
+	UserID     uint       `json:"user_id"`
+	Frequency  string     `json:"frequency"`
+	Recipients string     `json:"recipients"`
+	NextRunAt  time.Time  `json:"next_run_at"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ResolveSensorMismatchRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+type SendLaneCommandRequest struct {
+	Command     string `json:"command"`
+	HoldSeconds int    `json:"hold_seconds"`
+}
+
+type Sensor struct {
+	ID           uint       `json:"id"`
+	SpotID       uint       `json:"spot_id"`
+	ExternalID   string     `json:"external_id"`
+	Kind         string     `json:"kind"`
+	Occupied     *bool      `json:"occupied,omitempty"`
+	Health       string     `json:"health"`
+	BatteryLevel *int       `json:"battery_level,omitempty"`
+	ErrorCount   int        `json:"error_count"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type SensorGateway struct {
+	ID         uint       `json:"id"`
+	ParkingID  uint       `json:"parking_id"`
+	Name       string     `json:"name"`
+	GatewayID  string     `json:"gateway_id"`
+	Secret     string     `json:"secret,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type SensorMismatch struct {
+	ID         uint       `json:"id"`
+	SpotID     uint       `json:"spot_id"`
+	SensorID   uint       `json:"sensor_id"`
+	Kind       string     `json:"kind"`
+	EntryID    *uint      `json:"entry_id,omitempty"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+}
+
+type SensorReading struct {
+	SensorID  string    `json:"sensor_id"`
+	Occupied  bool      `json:"occupied"`
+	Timestamp time.Time `json:"timestamp"`
+	Battery   *int      `json:"battery"`
+	Fault     string    `json:"fault"`
+}
+
+type Spot struct {
+	ID         uint      `json:"id"`
+	ParkingID  uint      `json:"parking_id"`
+	Number     string    `json:"number"`
+	Zone       string    `json:"zone"`
+	IsOccupied bool      `json:"is_occupied"`
+	Entries    []Entry   `json:"entries"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type Tariff struct {
+	ID        uint      `json:"id"`
+	ParkingID uint      `json:"parking_id"`
+	Type      string    `json:"type"`
+	Price     float64   `json:"price"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type TariffInput struct {
+	Type  string  `json:"type"`
+	Price float64 `json:"price"`
+}
+
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+type UpdateOrganizationRequest struct {
+	BillingEmail  *string  `json:"billing_email"`
+	BillingMode   *string  `json:"billing_mode"`
+	SpendingLimit *float64 `json:"spending_limit"`
+}
+
+type UpdatePricingRequest struct {
+	Enabled       bool     `json:"enabled"`
+	FloorRate     float64  `json:"floor_rate"`
+	CeilingRate   float64  `json:"ceiling_rate"`
+	Step          float64  `json:"step"`
+	LowOccupancy  *float64 `json:"low_occupancy"`
+	HighOccupancy *float64 `json:"high_occupancy"`
+}
+
+type User struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Vehicles        []Vehicle  `json:"vehicles"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type ValidateParkingRequest struct {
+	EntryID         uint   `json:"entry_id"`
+	LicensePlate    string `json:"license_plate"`
+	DiscountMinutes int    `json:"discount_minutes"`
+}
+
+type Validation struct {
+	ID              uint       `json:"id"`
+	MerchantID      uint       `json:"merchant_id"`
+	Code            *string    `json:"code,omitempty"`
+	EntryID         *uint      `json:"entry_id,omitempty"`
+	LicensePlate    string     `json:"license_plate,omitempty"`
+	DiscountMinutes int        `json:"discount_minutes"`
+	Status          string     `json:"status"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	ValidatedAt     *time.Time `json:"validated_at,omitempty"`
+	AppliedAt       *time.Time `json:"applied_at,omitempty"`
+	PaymentID       *uint      `json:"payment_id,omitempty"`
+	DiscountAmount  float64    `json:"discount_amount"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type Vehicle struct {
+	ID             uint      `json:"id"`
+	LicensePlate   string    `json:"license_plate"`
+	OwnerID        uint      `json:"owner_id"`
+	Owner          User      `json:"owner"`
+	OrganizationID *uint     `json:"organization_id,omitempty"`
+	Entries        []Entry   `json:"entries"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ZoneRevenue struct {
+	Zone    string  `json:"zone"`
+	Day     string  `json:"day"`
+	Revenue float64 `json:"revenue"`
+}
+
+// GetAnalyticsParams параметры GetAnalytics
+type GetAnalyticsParams struct {
+	StartTime time.Time // Обязательный. Начало периода, RFC 3339
+	EndTime   time.Time // Обязательный. Конец периода, RFC 3339
+}
+
+// GetOccupancyAnalyticsParams параметры GetOccupancyAnalytics
+type GetOccupancyAnalyticsParams struct {
+	StartTime   time.Time // Обязательный. Начало периода, RFC 3339
+	EndTime     time.Time // Обязательный. Конец периода, RFC 3339
+	Granularity string    // 15m, hour, day, week
+	ParkingID   int       // Только эта парковка
+}
+
+// GetRollupsParams параметры GetRollups
+type GetRollupsParams struct {
+	StartTime   time.Time // Обязательный. Начало периода, RFC 3339
+	EndTime     time.Time // Обязательный. Конец периода, RFC 3339
+	Granularity string    // hour, day
+	ParkingID   int       // Только эта парковка
+}
+
+// GetPriceChangesParams параметры GetPriceChanges
+type GetPriceChangesParams struct {
+	From time.Time
+}
+
+// GetForecastParams параметры GetForecast
+type GetForecastParams struct {
+	Hours int // Горизонт, от 1 до 72 часов
+}
+
+// GetForecastAccuracyParams параметры GetForecastAccuracy
+type GetForecastAccuracyParams struct {
+	Days int // За сколько последних дней, по умолчанию 7
+}
+
+// GetParkingReportParams параметры GetParkingReport
+type GetParkingReportParams struct {
+	Frequency string // daily, weekly, monthly
+}
+
+// ExportParams параметры Export
+type ExportParams struct {
+	Format    string // csv, xlsx
+	Async     bool   // Поставить в очередь и вернуть задание
+	From      time.Time
+	To        time.Time
+	ParkingID int // Только эта парковка
+}
+
+// GetSensorsParams параметры GetSensors
+type GetSensorsParams struct {
+	ParkingID int    // Только эта парковка
+	Health    string // ok, low_battery, faulty или offline
+}
+
+// GetSensorMismatchesParams параметры GetSensorMismatches
+type GetSensorMismatchesParams struct {
+	ParkingID int  // Только эта парковка
+	All       bool // Включая закрытые
+}
+
+// GetMerchantsParams параметры GetMerchants
+type GetMerchantsParams struct {
+	Status string // pending или approved
+}
+
+// GetMerchantReportParams параметры GetMerchantReport
+type GetMerchantReportParams struct {
+	Month string // ГГГГ-ММ, по умолчанию текущий месяц
+}
+
+// Healthz GET /healthz
+//
+// Liveness-проба
+func (c *Client) Healthz(ctx context.Context) (*LivenessResponse, error) {
+	var out LivenessResponse
+	if err := c.do(ctx, "GET", "/healthz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Readyz GET /readyz
+//
+// Readiness-проба: база, миграции, платежи; 503, если сервер не готов
+func (c *Client) Readyz(ctx context.Context) (*ReadinessResponse, error) {
+	var out ReadinessResponse
+	if err := c.do(ctx, "GET", "/readyz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Metrics GET /metrics
+//
+// Метрики Prometheus
+func (c *Client) Metrics(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", "/metrics", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Register POST /api/v1/register
+//
+// Регистрация
+func (c *Client) Register(ctx context.Context, body RegisterRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/register", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Login POST /api/v1/login
+//
+// Вход, возвращает JWT
+func (c *Client) Login(ctx context.Context, body LoginRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/login", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyEmail POST /api/v1/email/verify
+//
+// Подтвердить email по токену из письма
+func (c *Client) VerifyEmail(ctx context.Context, body VerifyEmailRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/email/verify", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResendVerification POST /api/v1/email/verify/resend
+//
+// Повторно отправить письмо для подтверждения email
+func (c *Client) ResendVerification(ctx context.Context, body EmailRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/email/verify/resend", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmEmailChange POST /api/v1/email/change/confirm
+//
+// Подтвердить новый email по токену из письма; завершает все сессии
+func (c *Client) ConfirmEmailChange(ctx context.Context, body ConfirmEmailChangeRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/email/change/confirm", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ForgotPassword POST /api/v1/password/forgot
+//
+// Отправить ссылку для сброса пароля
+func (c *Client) ForgotPassword(ctx context.Context, body EmailRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/password/forgot", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResetPassword POST /api/v1/password/reset
+//
+// Задать пароль по токену из письма; завершает все сессии
+func (c *Client) ResetPassword(ctx context.Context, body ResetPasswordRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/password/reset", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangePassword POST /api/v1/account/password
+//
+// Сменить пароль; остальные сессии завершаются, в ответе новый JWT
+func (c *Client) ChangePassword(ctx context.Context, body ChangePasswordRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/account/password", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangeEmail POST /api/v1/account/email
+//
+// Сменить email: отправляет ссылку подтверждения на новый адрес
+func (c *Client) ChangeEmail(ctx context.Context, body ChangeEmailRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/account/email", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateParking POST /api/v1/parkings
+//
+// Создать парковку
+func (c *Client) CreateParking(ctx context.Context, body CreateParkingRequest) (*Parking, error) {
+	var out Parking
+	if err := c.do(ctx, "POST", "/api/v1/parkings", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetParkings GET /api/v1/parkings
+//
+// Список парковок
+func (c *Client) GetParkings(ctx context.Context) ([]Parking, error) {
+	var out []Parking
+	err := c.do(ctx, "GET", "/api/v1/parkings", nil, nil, &out)
+	return out, err
+}
+
+// GetParking GET /api/v1/parkings/{id}
+//
+// Парковка
+func (c *Client) GetParking(ctx context.Context, id uint) (*Parking, error) {
+	var out Parking
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSpots GET /api/v1/parkings/{id}/spots
+//
+// Места парковки
+func (c *Client) GetSpots(ctx context.Context, id uint) ([]Spot, error) {
+	var out []Spot
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/spots", id), nil, nil, &out)
+	return out, err
+}
+
+// AddSpot POST /api/v1/parkings/{id}/spots
+//
+// Добавить место
+func (c *Client) AddSpot(ctx context.Context, id uint, body AddSpotRequest) (*Spot, error) {
+	var out Spot
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/parkings/%d/spots", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateEntry POST /api/v1/entries
+//
+// Зафиксировать въезд
+func (c *Client) CreateEntry(ctx context.Context, body CreateEntryRequest) (*Entry, error) {
+	var out Entry
+	if err := c.do(ctx, "POST", "/api/v1/entries", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateExit POST /api/v1/exits
+//
+// Зафиксировать выезд и оплату
+func (c *Client) CreateExit(ctx context.Context, body CreateExitRequest) (*Exit, error) {
+	var out Exit
+	if err := c.do(ctx, "POST", "/api/v1/exits", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ProcessPayment POST /api/v1/payments
+//
+// Оплата картой через Stripe
+func (c *Client) ProcessPayment(ctx context.Context, body ProcessPaymentRequest) (*PaymentResult, error) {
+	var out PaymentResult
+	if err := c.do(ctx, "POST", "/api/v1/payments", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PaymentWebhook POST /api/v1/payments/webhook
+//
+// Вебхук Stripe: подтверждение платежей после 3-D Secure, подпись в Stripe-Signature
+func (c *Client) PaymentWebhook(ctx context.Context) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/payments/webhook", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAnalytics GET /api/v1/analytics
+//
+// Въезды по часам суток
+func (c *Client) GetAnalytics(ctx context.Context, params GetAnalyticsParams) ([]HourlyEntries, error) {
+	q := url.Values{}
+	setTime(q, "start_time", params.StartTime)
+	setTime(q, "end_time", params.EndTime)
+	var out []HourlyEntries
+	err := c.do(ctx, "GET", "/api/v1/analytics", q, nil, &out)
+	return out, err
+}
+
+// GetOccupancyAnalytics GET /api/v1/analytics/occupancy
+//
+// Загрузка парковок по интервалам
+func (c *Client) GetOccupancyAnalytics(ctx context.Context, params GetOccupancyAnalyticsParams) ([]OccupancyReport, error) {
+	q := url.Values{}
+	setTime(q, "start_time", params.StartTime)
+	setTime(q, "end_time", params.EndTime)
+	setString(q, "granularity", params.Granularity)
+	setInt(q, "parking_id", params.ParkingID)
+	var out []OccupancyReport
+	err := c.do(ctx, "GET", "/api/v1/analytics/occupancy", q, nil, &out)
+	return out, err
+}
+
+// GetRollups GET /api/v1/analytics/rollups
+//
+// Почасовые или дневные сводки
+func (c *Client) GetRollups(ctx context.Context, params GetRollupsParams) ([]HourlyRollup, error) {
+	q := url.Values{}
+	setTime(q, "start_time", params.StartTime)
+	setTime(q, "end_time", params.EndTime)
+	setString(q, "granularity", params.Granularity)
+	setInt(q, "parking_id", params.ParkingID)
+	var out []HourlyRollup
+	err := c.do(ctx, "GET", "/api/v1/analytics/rollups", q, nil, &out)
+	return out, err
+}
+
+// RecomputeRollups POST /api/v1/analytics/rollups/recompute
+//
+// Пересчитать сводки за период
+func (c *Client) RecomputeRollups(ctx context.Context, body RecomputeRollupsRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", "/api/v1/analytics/rollups/recompute", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPricing GET /api/v1/parkings/{id}/pricing
+//
+// Действующая ставка
+func (c *Client) GetPricing(ctx context.Context, id uint) (*PricingResponse, error) {
+	var out PricingResponse
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/pricing", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePricing PUT /api/v1/parkings/{id}/pricing
+//
+// Настройки динамической цены
+func (c *Client) UpdatePricing(ctx context.Context, id uint, body UpdatePricingRequest) (*DynamicPricing, error) {
+	var out DynamicPricing
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/api/v1/parkings/%d/pricing", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPriceChanges GET /api/v1/parkings/{id}/pricing/changes
+//
+// Журнал изменений цены
+func (c *Client) GetPriceChanges(ctx context.Context, id uint, params GetPriceChangesParams) ([]PriceChange, error) {
+	q := url.Values{}
+	setTime(q, "from", params.From)
+	var out []PriceChange
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/pricing/changes", id), q, nil, &out)
+	return out, err
+}
+
+// GetForecast GET /api/v1/parkings/{id}/forecast
+//
+// Прогноз свободных мест
+func (c *Client) GetForecast(ctx context.Context, id uint, params GetForecastParams) (*ForecastResponse, error) {
+	q := url.Values{}
+	setInt(q, "hours", params.Hours)
+	var out ForecastResponse
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/forecast", id), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetForecastAccuracy GET /api/v1/parkings/{id}/forecast/accuracy
+//
+// Точность прогнозов
+func (c *Client) GetForecastAccuracy(ctx context.Context, id uint, params GetForecastAccuracyParams) ([]ForecastAccuracy, error) {
+	q := url.Values{}
+	setInt(q, "days", params.Days)
+	var out []ForecastAccuracy
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/forecast/accuracy", id), q, nil, &out)
+	return out, err
+}
+
+// GetHolidays GET /api/v1/holidays
+//
+// Праздники
+func (c *Client) GetHolidays(ctx context.Context) ([]Holiday, error) {
+	var out []Holiday
+	err := c.do(ctx, "GET", "/api/v1/holidays", nil, nil, &out)
+	return out, err
+}
+
+// CreateHoliday POST /api/v1/holidays
+//
+// Добавить праздник
+func (c *Client) CreateHoliday(ctx context.Context, body CreateHolidayRequest) (*Holiday, error) {
+	var out Holiday
+	if err := c.do(ctx, "POST", "/api/v1/holidays", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetParkingReport GET /api/v1/parkings/{id}/report
+//
+// Отчет по парковке в PDF
+func (c *Client) GetParkingReport(ctx context.Context, id uint, params GetParkingReportParams) (io.ReadCloser, error) {
+	q := url.Values{}
+	setString(q, "frequency", params.Frequency)
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/report", id), q, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetReportSchedules GET /api/v1/parkings/{id}/report-schedules
+//
+// Расписания рассылки отчетов
+func (c *Client) GetReportSchedules(ctx context.Context, id uint) ([]ReportSchedule, error) {
+	var out []ReportSchedule
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/report-schedules", id), nil, nil, &out)
+	return out, err
+}
+
+// CreateReportSchedule POST /api/v1/parkings/{id}/report-schedules
+//
+// Создать расписание
+func (c *Client) CreateReportSchedule(ctx context.Context, id uint, body CreateReportScheduleRequest) (*ReportSchedule, error) {
+	var out ReportSchedule
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/parkings/%d/report-schedules", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteReportSchedule DELETE /api/v1/report-schedules/{id}
+//
+// Удалить расписание
+func (c *Client) DeleteReportSchedule(ctx context.Context, id uint) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/report-schedules/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendReportNow POST /api/v1/report-schedules/{id}/send
+//
+// Отправить отчет сейчас
+func (c *Client) SendReportNow(ctx context.Context, id uint) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/report-schedules/%d/send", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export GET /api/v1/exports/{dataset}
+//
+// Выгрузка набора данных; с async=true ставится в очередь
+func (c *Client) Export(ctx context.Context, dataset string, params ExportParams) (io.ReadCloser, error) {
+	q := url.Values{}
+	setString(q, "format", params.Format)
+	setBool(q, "async", params.Async)
+	setTime(q, "from", params.From)
+	setTime(q, "to", params.To)
+	setInt(q, "parking_id", params.ParkingID)
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/api/v1/exports/%s", url.PathEscape(dataset)), q, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetExportJob GET /api/v1/export-jobs/{id}
+//
+// Состояние фоновой выгрузки
+func (c *Client) GetExportJob(ctx context.Context, id uint) (*ExportJob, error) {
+	var out ExportJob
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/export-jobs/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadExportJob GET /api/v1/export-jobs/{id}/download
+//
+// Скачать готовую выгрузку
+func (c *Client) DownloadExportJob(ctx context.Context, id uint) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/api/v1/export-jobs/%d/download", id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GetLanes GET /api/v1/parkings/{id}/lanes
+//
+// Полосы парковки
+func (c *Client) GetLanes(ctx context.Context, id uint) ([]Lane, error) {
+	var out []Lane
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/lanes", id), nil, nil, &out)
+	return out, err
+}
+
+// CreateLane POST /api/v1/parkings/{id}/lanes
+//
+// Добавить полосу
+func (c *Client) CreateLane(ctx context.Context, id uint, body CreateLaneRequest) (*Lane, error) {
+	var out Lane
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/parkings/%d/lanes", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RotateLaneSecret POST /api/v1/lanes/{id}/secret
+//
+// Выдать полосе новый секрет устройства; старый перестает действовать
+func (c *Client) RotateLaneSecret(ctx context.Context, id uint) (*Lane, error) {
+	var out Lane
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/lanes/%d/secret", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendLaneCommand POST /api/v1/lanes/{id}/command
+//
+// Команда шлагбауму
+func (c *Client) SendLaneCommand(ctx context.Context, id uint, body SendLaneCommandRequest) (*MessageResponse, error) {
+	var out MessageResponse
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/lanes/%d/command", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLaneEvents GET /api/v1/lanes/{id}/events
+//
+// События полосы
+func (c *Client) GetLaneEvents(ctx context.Context, id uint) ([]GateEvent, error) {
+	var out []GateEvent
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/lanes/%d/events", id), nil, nil, &out)
+	return out, err
+}
+
+// RegisterSensor POST /api/v1/sensors
+//
+// Зарегистрировать датчик
+func (c *Client) RegisterSensor(ctx context.Context, body RegisterSensorRequest) (*Sensor, error) {
+	var out Sensor
+	if err := c.do(ctx, "POST", "/api/v1/sensors", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSensors GET /api/v1/sensors
+//
+// Датчики
+func (c *Client) GetSensors(ctx context.Context, params GetSensorsParams) ([]Sensor, error) {
+	q := url.Values{}
+	setInt(q, "parking_id", params.ParkingID)
+	setString(q, "health", params.Health)
+	var out []Sensor
+	err := c.do(ctx, "GET", "/api/v1/sensors", q, nil, &out)
+	return out, err
+}
+
+// IngestSensorReadings POST /api/v1/sensors/readings
+//
+// Пакет показаний датчиков от шлюза
+func (c *Client) IngestSensorReadings(ctx context.Context, body IngestSensorReadingsRequest) (*IngestResult, error) {
+	var out IngestResult
+	if err := c.do(ctx, "POST", "/api/v1/sensors/readings", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSensorGateways GET /api/v1/parkings/{id}/sensor-gateways
+//
+// Шлюзы датчиков парковки
+func (c *Client) GetSensorGateways(ctx context.Context, id uint) ([]SensorGateway, error) {
+	var out []SensorGateway
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/sensor-gateways", id), nil, nil, &out)
+	return out, err
+}
+
+// CreateSensorGateway POST /api/v1/parkings/{id}/sensor-gateways
+//
+// Добавить шлюз датчиков; секрет возвращается один раз
+func (c *Client) CreateSensorGateway(ctx context.Context, id uint, body CreateSensorGatewayRequest) (*SensorGateway, error) {
+	var out SensorGateway
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/parkings/%d/sensor-gateways", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RotateSensorGatewaySecret POST /api/v1/sensor-gateways/{id}/secret
+//
+// Выдать шлюзу новый секрет; старый перестает действовать
+func (c *Client) RotateSensorGatewaySecret(ctx context.Context, id uint) (*SensorGateway, error) {
+	var out SensorGateway
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/sensor-gateways/%d/secret", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSensorMismatches GET /api/v1/sensors/mismatches
+//
+// Расхождения датчиков с въездами
+func (c *Client) GetSensorMismatches(ctx context.Context, params GetSensorMismatchesParams) ([]SensorMismatch, error) {
+	q := url.Values{}
+	setInt(q, "parking_id", params.ParkingID)
+	setBool(q, "all", params.All)
+	var out []SensorMismatch
+	err := c.do(ctx, "GET", "/api/v1/sensors/mismatches", q, nil, &out)
+	return out, err
+}
+
+// ResolveSensorMismatch POST /api/v1/sensors/mismatches/{id}/resolve
+//
+// Закрыть расхождение
+func (c *Client) ResolveSensorMismatch(ctx context.Context, id uint, body ResolveSensorMismatchRequest) (*SensorMismatch, error) {
+	var out SensorMismatch
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/sensors/mismatches/%d/resolve", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPermitProducts GET /api/v1/parkings/{id}/permit-products
+//
+// Виды абонементов парковки
+func (c *Client) GetPermitProducts(ctx context.Context, id uint) ([]PermitProduct, error) {
+	var out []PermitProduct
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/parkings/%d/permit-products", id), nil, nil, &out)
+	return out, err
+}
+
+// CreatePermitProduct POST /api/v1/parkings/{id}/permit-products
+//
+// Создать вид абонемента
+func (c *Client) CreatePermitProduct(ctx context.Context, id uint, body CreatePermitProductRequest) (*PermitProduct, error) {
+	var out PermitProduct
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/parkings/%d/permit-products", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPermits GET /api/v1/permits
+//
+// Абонементы пользователя
+func (c *Client) GetPermits(ctx context.Context) ([]Permit, error) {
+	var out []Permit
+	err := c.do(ctx, "GET", "/api/v1/permits", nil, nil, &out)
+	return out, err
+}
+
+// PurchasePermit POST /api/v1/permits
+//
+// Купить абонемент
+func (c *Client) PurchasePermit(ctx context.Context, body PurchasePermitRequest) (*Permit, error) {
+	var out Permit
+	if err := c.do(ctx, "POST", "/api/v1/permits", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenewPermit POST /api/v1/permits/{id}/renew
+//
+// Продлить абонемент
+func (c *Client) RenewPermit(ctx context.Context, id uint, body RenewPermitRequest) (*Permit, error) {
+	var out Permit
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/permits/%d/renew", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateOrganization POST /api/v1/organizations
+//
+// Создать организацию
+func (c *Client) CreateOrganization(ctx context.Context, body CreateOrganizationRequest) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, "POST", "/api/v1/organizations", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOrganization GET /api/v1/organizations/{id}
+//
+// Организация
+func (c *Client) GetOrganization(ctx context.Context, id uint) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/organizations/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateOrganization PATCH /api/v1/organizations/{id}
+//
+// Изменить организацию
+func (c *Client) UpdateOrganization(ctx context.Context, id uint, body UpdateOrganizationRequest) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, "PATCH", fmt.Sprintf("/api/v1/organizations/%d", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddOrganizationMember POST /api/v1/organizations/{id}/members
+//
+// Добавить участника
+func (c *Client) AddOrganizationMember(ctx context.Context, id uint, body AddOrganizationMemberRequest) (*OrganizationMember, error) {
+	var out OrganizationMember
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/organizations/%d/members", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveOrganizationMember DELETE /api/v1/organizations/{id}/members/{userID}
+//
+// Удалить участника
+func (c *Client) RemoveOrganizationMember(ctx context.Context, id uint, userID uint) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/organizations/%d/members/%d", id, userID), nil, nil, nil)
+}
+
+// AddOrganizationVehicle POST /api/v1/organizations/{id}/vehicles
+//
+// Добавить автомобиль в автопарк
+func (c *Client) AddOrganizationVehicle(ctx context.Context, id uint, body AddOrganizationVehicleRequest) (*Vehicle, error) {
+	var out Vehicle
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/organizations/%d/vehicles", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveOrganizationVehicle DELETE /api/v1/organizations/{id}/vehicles/{vehicleID}
+//
+// Убрать автомобиль из автопарка
+func (c *Client) RemoveOrganizationVehicle(ctx context.Context, id uint, vehicleID uint) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/organizations/%d/vehicles/%d", id, vehicleID), nil, nil, nil)
+}
+
+// GetInvoices GET /api/v1/organizations/{id}/invoices
+//
+// Счета организации
+func (c *Client) GetInvoices(ctx context.Context, id uint) ([]Invoice, error) {
+	var out []Invoice
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/organizations/%d/invoices", id), nil, nil, &out)
+	return out, err
+}
+
+// CreateInvoice POST /api/v1/organizations/{id}/invoices
+//
+// Выставить счет за месяц
+func (c *Client) CreateInvoice(ctx context.Context, id uint, body CreateInvoiceRequest) (*Invoice, error) {
+	var out Invoice
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/organizations/%d/invoices", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadInvoice GET /api/v1/organizations/{id}/invoices/{invoiceID}/{format}
+//
+// Скачать счет
+func (c *Client) DownloadInvoice(ctx context.Context, id uint, invoiceID uint, format string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", fmt.Sprintf("/api/v1/organizations/%d/invoices/%d/%s", id, invoiceID, url.PathEscape(format)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// CreateMerchant POST /api/v1/merchants
+//
+// Зарегистрировать продавца; скидки доступны после одобрения администратором
+func (c *Client) CreateMerchant(ctx context.Context, body CreateMerchantRequest) (*Merchant, error) {
+	var out Merchant
+	if err := c.do(ctx, "POST", "/api/v1/merchants", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMerchants GET /api/v1/merchants
+//
+// Продавцы
+func (c *Client) GetMerchants(ctx context.Context, params GetMerchantsParams) ([]Merchant, error) {
+	q := url.Values{}
+	setString(q, "status", params.Status)
+	var out []Merchant
+	err := c.do(ctx, "GET", "/api/v1/merchants", q, nil, &out)
+	return out, err
+}
+
+// ApproveMerchant POST /api/v1/merchants/{id}/approve
+//
+// Одобрить продавца
+func (c *Client) ApproveMerchant(ctx context.Context, id uint) (*Merchant, error) {
+	var out Merchant
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/merchants/%d/approve", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GenerateValidationCodes POST /api/v1/merchants/{id}/codes
+//
+// Выпустить коды валидации
+func (c *Client) GenerateValidationCodes(ctx context.Context, id uint, body GenerateValidationCodesRequest) ([]Validation, error) {
+	var out []Validation
+	err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/merchants/%d/codes", id), nil, body, &out)
+	return out, err
+}
+
+// ValidateParking POST /api/v1/merchants/{id}/validations
+//
+// Оплатить парковку клиенту
+func (c *Client) ValidateParking(ctx context.Context, id uint, body ValidateParkingRequest) (*Validation, error) {
+	var out Validation
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/merchants/%d/validations", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMerchantReport GET /api/v1/merchants/{id}/report
+//
+// Отчет продавца за месяц
+func (c *Client) GetMerchantReport(ctx context.Context, id uint, params GetMerchantReportParams) (*MerchantReport, error) {
+	q := url.Values{}
+	setString(q, "month", params.Month)
+	var out MerchantReport
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/merchants/%d/report", id), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run . gen-client -out client/client.go
+
+// Клиент для внутренних сервисов генерируется из apiRoutes, как и
+// /openapi.json: типы запросов и ответов копируются из типов обработчиков,
+// на каждый маршрут - метод. WebSocket /ws клиентом не покрывается.
+// После изменения маршрутов или типов: go generate.
+
+// genClient возвращает исходный код пакета client
+func genClient(routes []Route) ([]byte, error) {
+	g := &clientGen{types: map[string]reflect.Type{}}
+	g.goType(reflect.TypeOf(FieldError{})) // Нужен типу Error
+
+	var methods bytes.Buffer
+	for _, r := range routes {
+		if r.Status == http.StatusSwitchingProtocols {
+			continue
+		}
+		g.method(&methods, r)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(clientHeader)
+	out.WriteString(clientRuntime)
+
+	names := make([]string, 0, len(g.types))
+	for name := range g.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&out, "\ntype %s %s\n", name, g.structType(g.types[name]))
+	}
+	out.Write(g.params.Bytes())
+	out.Write(methods.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("сгенерированный клиент не компилируется: %w", err)
+	}
+	return src, nil
+}
+
+type clientGen struct {
+	types  map[string]reflect.Type // Именованные структуры, которые нужно объявить
+	params bytes.Buffer            // Структуры параметров query-строки
+}
+
+// goType имя типа Go в клиенте; именованные структуры запоминаются для
+// объявления
+func (g *clientGen) goType(t reflect.Type) string {
+	if t == timeType {
+		return "time.Time"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.goType(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.goType(t.Elem())
+	case reflect.Map:
+		return "map[" + g.goType(t.Key()) + "]" + g.goType(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structType(t)
+		}
+		if _, ok := g.types[t.Name()]; !ok {
+			g.types[t.Name()] = t
+			g.structType(t) // Собрать вложенные типы
+		}
+		return t.Name()
+	case reflect.Interface:
+		return "json.RawMessage"
+	}
+	return t.Kind().String()
+}
+
+func (g *clientGen) structType(t reflect.Type) string {
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	g.writeFields(&b, t)
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g *clientGen) writeFields(b *strings.Builder, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.writeFields(b, f.Type)
+			continue
+		}
+		if tag != "" {
+			fmt.Fprintf(b, "\t%s %s `json:%q`\n", f.Name, g.goType(f.Type), tag)
+		} else {
+			fmt.Fprintf(b, "\t%s %s\n", f.Name, g.goType(f.Type))
+		}
+	}
+}
+
+func (g *clientGen) method(w *bytes.Buffer, r Route) {
+	args := []string{"ctx context.Context"}
+	pathExpr, pathArgs := clientPath(r)
+	args = append(args, pathArgs...)
+
+	var query []Param
+	for _, p := range routeParams(r) {
+		if p.In == "query" {
+			query = append(query, p)
+		}
+	}
+	queryExpr := "nil"
+	if len(query) > 0 {
+		paramsType := r.Name + "Params"
+		fmt.Fprintf(&g.params, "\n// %s параметры %s\ntype %s struct {\n", paramsType, r.Name, paramsType)
+		for _, p := range query {
+			comment := p.Description
+			if p.Required {
+				comment = strings.TrimSpace("Обязательный. " + comment)
+			}
+			if len(p.Enum) > 0 {
+				comment = strings.TrimSpace(comment + " " + strings.Join(p.Enum, ", "))
+			}
+			if comment != "" {
+				comment = " // " + comment
+			}
+			fmt.Fprintf(&g.params, "\t%s %s%s\n", exportedName(p.Name), queryGoType(p), comment)
+		}
+		g.params.WriteString("}\n")
+		args = append(args, "params "+paramsType)
+		queryExpr = "q"
+	}
+
+	bodyExpr := "nil"
+	if r.Request != nil {
+		args = append(args, "body "+g.goType(reflect.TypeOf(r.Request)))
+		bodyExpr = "body"
+	}
+
+	var result, call string
+	sendArgs := fmt.Sprintf("ctx, %q, %s, %s, %s", r.Method, pathExpr, queryExpr, bodyExpr)
+	switch {
+	case r.Produces != "":
+		result = "(io.ReadCloser, error)"
+		call = fmt.Sprintf("resp, err := c.send(%s)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn resp.Body, nil", sendArgs)
+	case r.Response == nil:
+		result = "error"
+		call = fmt.Sprintf("return c.do(%s, nil)", sendArgs)
+	case reflect.TypeOf(r.Response).Kind() == reflect.Slice:
+		typ := g.goType(reflect.TypeOf(r.Response))
+		result = "(" + typ + ", error)"
+		call = fmt.Sprintf("var out %s\n\terr := c.do(%s, &out)\n\treturn out, err", typ, sendArgs)
+	default:
+		typ := g.goType(reflect.TypeOf(r.Response))
+		result = "(*" + typ + ", error)"
+		call = fmt.Sprintf("var out %s\n\tif err := c.do(%s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil", typ, sendArgs)
+	}
+
+	fmt.Fprintf(w, "\n// %s %s %s\n//\n// %s\n", r.Name, r.Method, openAPIPath(r.Path), r.Summary)
+	fmt.Fprintf(w, "func (c *Client) %s(%s) %s {\n", r.Name, strings.Join(args, ", "), result)
+	if len(query) > 0 {
+		w.WriteString("\tq := url.Values{}\n")
+		for _, p := range query {
+			fmt.Fprintf(w, "\t%s(q, %q, params.%s)\n", querySetter(p), p.Name, exportedName(p.Name))
+		}
+	}
+	fmt.Fprintf(w, "\t%s\n}\n", call)
+}
+
+// clientPath выражение пути и аргументы метода для параметров пути
+func clientPath(r Route) (string, []string) {
+	types := map[string]string{}
+	for _, p := range routeParams(r) {
+		if p.In == "path" {
+			types[p.Name] = p.Type
+		}
+	}
+
+	var format strings.Builder
+	var values, args []string
+	for i, segment := range strings.Split(r.Path, "/") {
+		if i > 0 {
+			format.WriteByte('/')
+		}
+		if !strings.HasPrefix(segment, ":") {
+			format.WriteString(segment)
+			continue
+		}
+		name := segment[1:]
+		if types[name] == "integer" {
+			format.WriteString("%d")
+			values = append(values, name)
+			args = append(args, name+" uint")
+		} else {
+			format.WriteString("%s")
+			values = append(values, "url.PathEscape("+name+")")
+			args = append(args, name+" string")
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("%q", format.String()), nil
+	}
+	return fmt.Sprintf("fmt.Sprintf(%q, %s)", format.String(), strings.Join(values, ", ")), args
+}
+
+func queryGoType(p Param) string {
+	switch {
+	case p.Type == "integer":
+		return "int"
+	case p.Type == "boolean":
+		return "bool"
+	case p.Format == "date-time":
+		return "time.Time"
+	}
+	return "string"
+}
+
+func querySetter(p Param) string {
+	switch queryGoType(p) {
+	case "int":
+		return "setInt"
+	case "bool":
+		return "setBool"
+	case "time.Time":
+		return "setTime"
+	}
+	return "setString"
+}
+
+// exportedName переводит parking_id в ParkingID
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+const clientHeader = `// Code generated by "parking_manager gen-client"; DO NOT EDIT.
+
+// Package client - клиент Parking Manager API. Сгенерирован по тем же
+// описаниям маршрутов, что и спецификация /openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+`
+
+const clientRuntime = `
+// Client клиент API. Token передается в Authorization: Bearer, Language -
+// в Accept-Language и выбирает язык сообщений об ошибках. GatewayID и
+// GatewaySecret нужны только шлюзам датчиков.
+type Client struct {
+	BaseURL       string
+	HTTPClient    *http.Client
+	Token         string
+	Language      string
+	GatewayID     string
+	GatewaySecret string
+}
+
+// New клиент для сервера по адресу baseURL, например http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// Error ответ сервера с ошибкой. Code - стабильный код, по нему и стоит
+// принимать решения; Message зависит от языка. RetryAfter задан для 429.
+type Error struct {
+	StatusCode int           ` + "`json:\"-\"`" + `
+	RetryAfter time.Duration ` + "`json:\"-\"`" + `
+	Message    string        ` + "`json:\"error\"`" + `
+	Code       string        ` + "`json:\"code\"`" + `
+	Details    []FieldError  ` + "`json:\"details,omitempty\"`" + `
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// send выполняет запрос; ответ с кодом 400 и выше возвращается как *Error
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Language != "" {
+		req.Header.Set("Accept-Language", c.Language)
+	}
+	if c.GatewayID != "" {
+		req.Header.Set("X-Gateway-ID", c.GatewayID)
+		req.Header.Set("X-Gateway-Secret", c.GatewaySecret)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do выполняет запрос и разбирает JSON-ответ в out; out == nil - ответ без тела
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Нулевые значения параметров не передаются: сервер подставит умолчания
+
+func setString(q url.Values, name, v string) {
+	if v != "" {
+		q.Set(name, v)
+	}
+}
+
+func setInt(q url.Values, name string, v int) {
+	if v != 0 {
+		q.Set(name, strconv.Itoa(v))
+	}
+}
+
+func setBool(q url.Values, name string, v bool) {
+	if v {
+		q.Set(name, "true")
+	}
+}
+
+func setTime(q url.Values, name string, v time.Time) {
+	if !v.IsZero() {
+		q.Set(name, v.Format(time.RFC3339))
+	}
+}
+`
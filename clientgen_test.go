@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// client/client.go должен совпадать с тем, что генерируется из текущих
+// маршрутов и типов
+func TestClientUpToDate(t *testing.T) {
+	src, err := genClient(apiRoutes(&API{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("client/client.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, committed) {
+		t.Fatal("client/client.go устарел, выполните go generate")
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config настройки приложения. Загружаются один раз при запуске: сначала
+// значения по умолчанию, затем YAML-файл (-config или CONFIG_FILE), затем
+// переменные окружения и в конце флаги командной строки. Каждый следующий
+// источник перекрывает предыдущий.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	API       APIConfig       `yaml:"api"`
+	CORS      CORSConfig      `yaml:"cors"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Pricing   PricingConfig   `yaml:"pricing"`
+	Payments  PaymentsConfig  `yaml:"payments"`
+	Merchants MerchantsConfig `yaml:"merchants"`
+	Mail      MailConfig      `yaml:"mail"`
+	Gates     GatesConfig     `yaml:"gates"`
+	Export    ExportConfig    `yaml:"export"`
+	Reports   ReportsConfig   `yaml:"reports"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+}
+
+// ServerConfig HTTP-сервер
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // Сколько ждать запросы и фоновые задачи при остановке
+	// TrustedProxies адреса и подсети прокси, которым можно верить в
+	// X-Forwarded-For. Пусто - адрес клиента берется из соединения, иначе
+	// ограничение по IP обходилось бы подделкой заголовка.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig подключение к Postgres
+type DatabaseConfig struct {
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// AuthConfig выдача и проверка JWT
+type AuthConfig struct {
+	JWTSecret string        `yaml:"jwt_secret"`
+	TokenTTL  time.Duration `yaml:"token_ttl"`
+	// RequireVerifiedEmail не пускать пользователей, не подтвердивших email
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+}
+
+// APIConfig версии API, см. apiVersions
+type APIConfig struct {
+	LegacyRoutes bool   `yaml:"legacy_routes"` // Пути без /api/v1 как устаревшие синонимы v1
+	LegacySunset string `yaml:"legacy_sunset"` // Дата ГГГГ-ММ-ДД для заголовка Sunset; пусто - не отдавать
+}
+
+// LegacySunsetTime дата отключения путей без префикса версии; нулевая, если
+// не задана
+func (c APIConfig) LegacySunsetTime() time.Time {
+	t, _ := time.Parse(time.DateOnly, c.LegacySunset)
+	return t
+}
+
+// CORSConfig разрешенные источники для браузерных клиентов и WebSocket.
+// Пустой список - CORS-заголовки не отдаются, WebSocket принимает любой Origin.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// RateLimitConfig ограничение частоты запросов, см. RateLimiter
+type RateLimitConfig struct {
+	Enabled         bool               `yaml:"enabled"`
+	Backend         string             `yaml:"backend"`   // memory или redis
+	RedisURL        string             `yaml:"redis_url"` // redis://host:6379/0
+	AuthPerIP       RateLimit          `yaml:"auth_per_ip"`
+	LoginPerAccount RateLimit          `yaml:"login_per_account"`
+	APIPerToken     RateLimit          `yaml:"api_per_token"`
+	Partners        map[uint]RateLimit `yaml:"partners"` // Квоты интеграций по ID пользователя вместо api_per_token
+	Lockout         LockoutConfig      `yaml:"lockout"`
+}
+
+// LockoutConfig блокировка входа после неудачных паролей
+type LockoutConfig struct {
+	Threshold int           `yaml:"threshold"` // С какой неудачи подряд блокировать; 0 - не блокировать
+	Base      time.Duration `yaml:"base"`      // Первая блокировка, дальше удваивается
+	Max       time.Duration `yaml:"max"`
+	Window    time.Duration `yaml:"window"` // Сколько помнить неудачи без успешного входа
+}
+
+// PricingConfig цены по умолчанию
+type PricingConfig struct {
+	DefaultHourlyRate float64 `yaml:"default_hourly_rate"` // Если у парковки нет почасового тарифа
+}
+
+// PaymentsConfig платежный провайдер
+type PaymentsConfig struct {
+	StripeSecretKey     string `yaml:"stripe_secret_key"`     // Пустой ключ отключает оплату картой
+	StripeWebhookSecret string `yaml:"stripe_webhook_secret"` // Подпись вебхуков Stripe (whsec_...)
+	Currency            string `yaml:"currency"`
+}
+
+// MerchantsConfig валидации парковки продавцами
+type MerchantsConfig struct {
+	// MaxDiscountMinutes наибольшая скидка одной валидации. Не больше суток:
+	// это же ограничение стоит в запросах (lte=1440).
+	MaxDiscountMinutes int `yaml:"max_discount_minutes"`
+}
+
+// MailConfig отправка писем, см. Mailer
+type MailConfig struct {
+	Driver       string `yaml:"driver"` // capture или smtp
+	From         string `yaml:"from"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password"`
+	CaptureDir   string `yaml:"capture_dir"`
+	// LinkBaseURL адрес веб-интерфейса для ссылок в письмах:
+	// https://parking.example.com/reset-password?token=...; пусто - в письме
+	// только токен
+	LinkBaseURL string `yaml:"link_base_url"`
+}
+
+// GatesConfig сервер контроллеров шлагбаумов
+type GatesConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	Simulator  bool   `yaml:"simulator"` // Только для стенда: выдает полосам новые секреты устройств
+}
+
+// ExportConfig фоновые выгрузки
+type ExportConfig struct {
+	Dir           string        `yaml:"dir"`
+	StreamTimeout time.Duration `yaml:"stream_timeout"` // Сколько можно писать синхронную выгрузку, вместо write_timeout
+	Retention     time.Duration `yaml:"retention"`      // Сколько хранятся файлы фоновых выгрузок
+}
+
+// ReportsConfig PDF-отчеты и счета
+type ReportsConfig struct {
+	PDFFontPath string `yaml:"pdf_font_path"` // TTF со шрифтом с кириллицей
+}
+
+// LogConfig логирование, см. setupLogging
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn или error
+	Format string `yaml:"format"` // json или text (удобнее при разработке)
+}
+
+// TracingConfig трассировка OpenTelemetry, см. setupTracing
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"` // none или otlp
+	Endpoint    string  `yaml:"endpoint"` // host:port коллектора OTLP/HTTP
+	Insecure    bool    `yaml:"insecure"` // http вместо https
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"` // Доля новых трасс, которые записываются
+}
+
+func defaultConfig() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: AuthConfig{TokenTTL: 24 * time.Hour, RequireVerifiedEmail: true},
+		API:  APIConfig{LegacyRoutes: true, LegacySunset: "2027-04-01"},
+		RateLimit: RateLimitConfig{
+			Enabled:         true,
+			Backend:         "memory",
+			AuthPerIP:       RateLimit{Requests: 20, Per: time.Minute},
+			LoginPerAccount: RateLimit{Requests: 10, Per: 15 * time.Minute},
+			APIPerToken:     RateLimit{Requests: 600, Per: time.Minute},
+			Lockout:         LockoutConfig{Threshold: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour},
+		},
+		Pricing:   PricingConfig{DefaultHourlyRate: 2.5},
+		Payments:  PaymentsConfig{Currency: "rub"},
+		Merchants: MerchantsConfig{MaxDiscountMinutes: 480},
+		Export:    ExportConfig{StreamTimeout: 10 * time.Minute, Retention: 24 * time.Hour},
+		Mail: MailConfig{
+			Driver:   "capture",
+			From:     "parking@localhost",
+			SMTPPort: 587,
+		},
+		Gates: GatesConfig{ListenAddr: ":7070"},
+		Log:   LogConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			ServiceName: "parking_manager",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// loadConfig собирает настройки из всех источников. Флаги разбираются до
+// первого аргумента-команды, остальные аргументы возвращаются для runCommand.
+func loadConfig(args []string) (Config, []string, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("parking_manager", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML-файл настроек")
+	port := fs.Int("port", 0, "порт HTTP-сервера")
+	dsn := fs.String("database-url", "", "строка подключения к Postgres")
+	gateAddr := fs.String("gate-addr", "", "адрес сервера шлагбаумов")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: parking_manager [флаги] <команда> [флаги команды]")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s\n", cliUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return cfg, nil, fmt.Errorf("файл настроек: %w", err)
+		}
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+		f.Close()
+		if err != nil {
+			return cfg, nil, fmt.Errorf("файл настроек %s: %w", *file, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, nil, err
+	}
+
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+	if *dsn != "" {
+		cfg.Database.URL = *dsn
+	}
+	if *gateAddr != "" {
+		cfg.Gates.ListenAddr = *gateAddr
+	}
+	return cfg, fs.Args(), nil
+}
+
+// applyEnv перекрывает настройки переменными окружения. Имена переменных
+// сохранены прежними, чтобы существующие .env продолжали работать.
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	num := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: ожидается число, получено %q", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	decimal := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: ожидается число, получено %q", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: ожидается длительность вида 30s или 5m, получено %q", name, v))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: ожидается true или false, получено %q", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	num("PORT", &c.Server.Port)
+	duration("READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	str("DATABASE_URL", &c.Database.URL)
+	num("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+
+	str("JWT_SECRET", &c.Auth.JWTSecret)
+	duration("JWT_TTL", &c.Auth.TokenTTL)
+	boolean("REQUIRE_VERIFIED_EMAIL", &c.Auth.RequireVerifiedEmail)
+
+	boolean("API_LEGACY_ROUTES", &c.API.LegacyRoutes)
+	str("API_LEGACY_SUNSET", &c.API.LegacySunset)
+
+	boolean("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	str("RATE_LIMIT_BACKEND", &c.RateLimit.Backend)
+	str("REDIS_URL", &c.RateLimit.RedisURL)
+
+	if v, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		c.CORS.AllowedOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, origin)
+			}
+		}
+	}
+
+	decimal("DEFAULT_HOURLY_RATE", &c.Pricing.DefaultHourlyRate)
+
+	str("STRIPE_SECRET_KEY", &c.Payments.StripeSecretKey)
+	str("STRIPE_WEBHOOK_SECRET", &c.Payments.StripeWebhookSecret)
+	str("PAYMENT_CURRENCY", &c.Payments.Currency)
+
+	num("MERCHANT_MAX_DISCOUNT_MINUTES", &c.Merchants.MaxDiscountMinutes)
+
+	str("MAIL_DRIVER", &c.Mail.Driver)
+	str("MAIL_FROM", &c.Mail.From)
+	str("SMTP_HOST", &c.Mail.SMTPHost)
+	num("SMTP_PORT", &c.Mail.SMTPPort)
+	str("SMTP_USER", &c.Mail.SMTPUser)
+	str("SMTP_PASSWORD", &c.Mail.SMTPPassword)
+	str("MAIL_CAPTURE_DIR", &c.Mail.CaptureDir)
+	str("MAIL_LINK_BASE_URL", &c.Mail.LinkBaseURL)
+
+	str("GATE_LISTEN_ADDR", &c.Gates.ListenAddr)
+	boolean("GATE_SIMULATOR", &c.Gates.Simulator)
+
+	str("EXPORT_DIR", &c.Export.Dir)
+	duration("EXPORT_STREAM_TIMEOUT", &c.Export.StreamTimeout)
+	duration("EXPORT_RETENTION", &c.Export.Retention)
+	str("PDF_FONT_PATH", &c.Reports.PDFFontPath)
+
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", &c.Log.Format)
+
+	str("TRACING_EXPORTER", &c.Tracing.Exporter)
+	str("OTEL_EXPORTER_OTLP_ENDPOINT", &c.Tracing.Endpoint)
+	boolean("OTEL_EXPORTER_OTLP_INSECURE", &c.Tracing.Insecure)
+	str("OTEL_SERVICE_NAME", &c.Tracing.ServiceName)
+	decimal("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	return errors.Join(errs...)
+}
+
+// Validate проверяет настройки и возвращает все ошибки разом. Секрет JWT
+// нужен только серверу: консольные команды токены не выдают.
+func (c Config) Validate(serving bool) error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port: порт должен быть от 1 до 65535, получено %d", c.Server.Port)
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		fail("server: таймауты должны быть положительными")
+	}
+
+	if c.Database.URL == "" {
+		fail("database.url (DATABASE_URL) не задан")
+	}
+	if c.Database.MaxOpenConns < 1 || c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("database: нужно max_open_conns >= 1 и 0 <= max_idle_conns <= max_open_conns")
+	}
+
+	if serving {
+		switch {
+		case c.Auth.JWTSecret == "":
+			fail("auth.jwt_secret (JWT_SECRET) не задан")
+		case len(c.Auth.JWTSecret) < 16:
+			fail("auth.jwt_secret (JWT_SECRET) слишком короткий: нужно не меньше 16 символов")
+		}
+	}
+	if c.Auth.TokenTTL <= 0 {
+		fail("auth.token_ttl должен быть положительным")
+	}
+
+	if c.RateLimit.Enabled {
+		rl := c.RateLimit
+		switch rl.Backend {
+		case "memory":
+		case "redis":
+			if rl.RedisURL == "" {
+				fail("rate_limit.redis_url (REDIS_URL) не задан для backend redis")
+			}
+		default:
+			fail("rate_limit.backend: ожидается memory или redis, получено %q", rl.Backend)
+		}
+		limits := map[string]RateLimit{"auth_per_ip": rl.AuthPerIP, "login_per_account": rl.LoginPerAccount, "api_per_token": rl.APIPerToken}
+		for id, limit := range rl.Partners {
+			limits[fmt.Sprintf("partners.%d", id)] = limit
+		}
+		for name, limit := range limits {
+			if limit.Requests > 0 && limit.Per <= 0 {
+				fail("rate_limit.%s: per должен быть положительным", name)
+			}
+		}
+		if rl.Lockout.Threshold > 0 && (rl.Lockout.Base <= 0 || rl.Lockout.Max < rl.Lockout.Base || rl.Lockout.Window <= 0) {
+			fail("rate_limit.lockout: base и window должны быть положительными, max - не меньше base")
+		}
+	}
+
+	if c.API.LegacySunset != "" {
+		if _, err := time.Parse(time.DateOnly, c.API.LegacySunset); err != nil {
+			fail("api.legacy_sunset: ожидается дата ГГГГ-ММ-ДД, получено %q", c.API.LegacySunset)
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			fail("cors.allowed_origins: %q должен иметь вид https://example.com или *", origin)
+		}
+	}
+
+	if c.Pricing.DefaultHourlyRate <= 0 {
+		fail("pricing.default_hourly_rate должен быть положительным")
+	}
+
+	if key := c.Payments.StripeSecretKey; key != "" && !strings.HasPrefix(key, "sk_") && !strings.HasPrefix(key, "rk_") {
+		fail("payments.stripe_secret_key (STRIPE_SECRET_KEY) должен начинаться с sk_ или rk_")
+	}
+	if len(c.Payments.Currency) != 3 {
+		fail("payments.currency: ожидается трехбуквенный код ISO 4217, получено %q", c.Payments.Currency)
+	}
+
+	if m := c.Merchants.MaxDiscountMinutes; m < 1 || m > maxValidationDiscountMinutes {
+		fail("merchants.max_discount_minutes (MERCHANT_MAX_DISCOUNT_MINUTES): ожидается от 1 до %d, получено %d", maxValidationDiscountMinutes, m)
+	}
+
+	if c.Export.StreamTimeout <= 0 || c.Export.Retention <= 0 {
+		fail("export.stream_timeout и export.retention должны быть положительными")
+	}
+
+	switch c.Mail.Driver {
+	case "capture":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			fail("mail.smtp_host (SMTP_HOST) обязателен для драйвера smtp")
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			fail("mail.smtp_port: порт должен быть от 1 до 65535, получено %d", c.Mail.SMTPPort)
+		}
+	default:
+		fail("mail.driver (MAIL_DRIVER): ожидается capture или smtp, получено %q", c.Mail.Driver)
+	}
+	// Письмо с подтверждением, которое только хранится в памяти, прочитать
+	// некому, и без подтверждения никто не войдет
+	if serving && c.Auth.RequireVerifiedEmail && c.Mail.Driver == "capture" && c.Mail.CaptureDir == "" {
+		fail("auth.require_verified_email: письма с подтверждением никуда не уходят; задайте mail.driver smtp или mail.capture_dir (MAIL_CAPTURE_DIR), либо отключите подтверждение (REQUIRE_VERIFIED_EMAIL=false)")
+	}
+	if link := c.Mail.LinkBaseURL; link != "" {
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("mail.link_base_url (MAIL_LINK_BASE_URL): ожидается адрес вида https://parking.example.com, получено %q", link)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.Gates.ListenAddr); err != nil {
+		fail("gates.listen_addr (GATE_LISTEN_ADDR): %v", err)
+	}
+
+	if path := c.Reports.PDFFontPath; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			fail("reports.pdf_font_path (PDF_FONT_PATH): %v", err)
+		}
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("log.level (LOG_LEVEL): ожидается debug, info, warn или error, получено %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		fail("log.format (LOG_FORMAT): ожидается json или text, получено %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			fail("tracing.endpoint (OTEL_EXPORTER_OTLP_ENDPOINT) обязателен для экспортера otlp")
+		} else if strings.Contains(c.Tracing.Endpoint, "://") {
+			fail("tracing.endpoint: ожидается host:port без схемы, получено %q", c.Tracing.Endpoint)
+		}
+		if c.Tracing.ServiceName == "" {
+			fail("tracing.service_name (OTEL_SERVICE_NAME) не задан")
+		}
+	default:
+		fail("tracing.exporter (TRACING_EXPORTER): ожидается none или otlp, получено %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio должен быть от 0 до 1")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("неверные настройки:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
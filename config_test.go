@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig настройки по умолчанию с тем, что обязательно задать для сервера
+func validConfig() Config {
+	cfg := defaultConfig()
+	cfg.Database.URL = "postgres://localhost/parking"
+	cfg.Auth.JWTSecret = "test-secret-0123456789"
+	cfg.Mail.CaptureDir = "/var/spool/parking-mail"
+	return cfg
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("server:\n  port: 9000\n  read_timeout: 3s\nlog:\n  level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unknown := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("server:\n  prot: 9000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+		check   func(t *testing.T, cfg Config, args []string)
+	}{
+		{name: "по умолчанию", check: func(t *testing.T, cfg Config, args []string) {
+			if cfg.Server.Port != 8080 || len(args) != 0 {
+				t.Errorf("порт %d, аргументы %q", cfg.Server.Port, args)
+			}
+		}},
+		// Файл перекрывает умолчания, окружение - файл, флаги - окружение
+		{name: "порядок источников", args: []string{"-config", file, "-port", "9002", "migrate", "-port", "1"},
+			env: map[string]string{"PORT": "9001", "READ_TIMEOUT": "4s"},
+			check: func(t *testing.T, cfg Config, args []string) {
+				if cfg.Server.Port != 9002 || cfg.Server.ReadTimeout != 4*time.Second || cfg.Log.Level != "debug" {
+					t.Errorf("порт %d, таймаут %s, уровень %s", cfg.Server.Port, cfg.Server.ReadTimeout, cfg.Log.Level)
+				}
+				// Флаги после команды принадлежат ей
+				if strings.Join(args, " ") != "migrate -port 1" {
+					t.Errorf("аргументы %q", args)
+				}
+			}},
+		{name: "файл из CONFIG_FILE", env: map[string]string{"CONFIG_FILE": file}, check: func(t *testing.T, cfg Config, args []string) {
+			if cfg.Server.Port != 9000 {
+				t.Errorf("порт %d, ожидался из файла", cfg.Server.Port)
+			}
+		}},
+		{name: "список из окружения", env: map[string]string{"CORS_ALLOWED_ORIGINS": " https://a.example.com, ,https://b.example.com"},
+			check: func(t *testing.T, cfg Config, args []string) {
+				if strings.Join(cfg.CORS.AllowedOrigins, " ") != "https://a.example.com https://b.example.com" {
+					t.Errorf("источники %q", cfg.CORS.AllowedOrigins)
+				}
+			}},
+		// С секретами из окружения пример годится для запуска сервера
+		{name: "пример настроек актуален", args: []string{"-config", "config.example.yaml"},
+			check: func(t *testing.T, cfg Config, args []string) {
+				cfg.Database.URL = "postgres://localhost/parking"
+				cfg.Auth.JWTSecret = "test-secret-0123456789"
+				if err := cfg.Validate(true); err != nil {
+					t.Error(err)
+				}
+			}},
+		{name: "опечатка в файле", args: []string{"-config", unknown}, wantErr: "field prot not found"},
+		{name: "нет файла", args: []string{"-config", filepath.Join(dir, "missing.yaml")}, wantErr: "файл настроек"},
+		// Все ошибки окружения сообщаются разом
+		{name: "неверные значения в окружении", env: map[string]string{"PORT": "http", "JWT_TTL": "день", "RATE_LIMIT_ENABLED": "да"},
+			wantErr: "PORT: ожидается число"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			for _, name := range []string{"PORT", "READ_TIMEOUT", "JWT_TTL", "RATE_LIMIT_ENABLED", "CORS_ALLOWED_ORIGINS"} {
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, args, err := loadConfig(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("%v, ожидалась ошибка с %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg, args)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		serving bool
+		change  func(cfg *Config)
+		wantErr string // Пусто - настройки верны
+	}{
+		{"готовые к запуску", true, func(cfg *Config) {}, ""},
+		{"без секрета JWT для команд", false, func(cfg *Config) { cfg.Auth.JWTSecret = "" }, ""},
+		{"без секрета JWT для сервера", true, func(cfg *Config) { cfg.Auth.JWTSecret = "" }, "auth.jwt_secret (JWT_SECRET) не задан"},
+		{"короткий секрет JWT", true, func(cfg *Config) { cfg.Auth.JWTSecret = "secret" }, "слишком короткий"},
+		{"без базы", false, func(cfg *Config) { cfg.Database.URL = "" }, "database.url"},
+		{"порт", true, func(cfg *Config) { cfg.Server.Port = 70000 }, "server.port"},
+		{"нулевой таймаут", true, func(cfg *Config) { cfg.Server.ShutdownTimeout = 0 }, "таймауты должны быть положительными"},
+		{"простаивающих соединений больше открытых", true, func(cfg *Config) { cfg.Database.MaxIdleConns = 50 }, "max_idle_conns"},
+		{"redis без адреса", true, func(cfg *Config) { cfg.RateLimit.Backend = "redis" }, "rate_limit.redis_url"},
+		{"ограничение без периода", true, func(cfg *Config) {
+			cfg.RateLimit.Partners = map[uint]RateLimit{7: {Requests: 10}}
+		}, "rate_limit.partners.7"},
+		{"ограничения выключены", true, func(cfg *Config) {
+			cfg.RateLimit.Enabled = false
+			cfg.RateLimit.Backend = "memcached"
+		}, ""},
+		{"блокировка короче первой", true, func(cfg *Config) { cfg.RateLimit.Lockout.Max = time.Second }, "rate_limit.lockout"},
+		{"дата отключения старых путей", true, func(cfg *Config) { cfg.API.LegacySunset = "01.04.2027" }, "api.legacy_sunset"},
+		{"источник CORS с путем", true, func(cfg *Config) {
+			cfg.CORS.AllowedOrigins = []string{"*", "https://app.example.com/", "https://app.example.com/login"}
+		}, `"https://app.example.com/login"`},
+		{"нулевая ставка", true, func(cfg *Config) { cfg.Pricing.DefaultHourlyRate = 0 }, "pricing.default_hourly_rate"},
+		{"публикуемый ключ Stripe", true, func(cfg *Config) { cfg.Payments.StripeSecretKey = "pk_test_123" }, "stripe_secret_key"},
+		{"ограниченный ключ Stripe", true, func(cfg *Config) { cfg.Payments.StripeSecretKey = "rk_test_123" }, ""},
+		{"валюта", true, func(cfg *Config) { cfg.Payments.Currency = "рубль" }, "payments.currency"},
+		{"скидка больше суток", true, func(cfg *Config) { cfg.Merchants.MaxDiscountMinutes = 1441 }, "merchants.max_discount_minutes"},
+		{"smtp без сервера", true, func(cfg *Config) { cfg.Mail.Driver = "smtp" }, "mail.smtp_host"},
+		{"неизвестный драйвер почты", true, func(cfg *Config) { cfg.Mail.Driver = "sendmail" }, "mail.driver"},
+		{"подтверждение email без отправки писем", true, func(cfg *Config) { cfg.Mail.CaptureDir = "" }, "auth.require_verified_email"},
+		{"письма без отправки, подтверждение выключено", true, func(cfg *Config) {
+			cfg.Mail.CaptureDir = ""
+			cfg.Auth.RequireVerifiedEmail = false
+		}, ""},
+		{"письма без отправки для команд", false, func(cfg *Config) { cfg.Mail.CaptureDir = "" }, ""},
+		{"подтверждение email через smtp", true, func(cfg *Config) {
+			cfg.Mail = MailConfig{Driver: "smtp", SMTPHost: "smtp.example.com", SMTPPort: 587}
+		}, ""},
+		{"ссылка в письмах без схемы", true, func(cfg *Config) { cfg.Mail.LinkBaseURL = "parking.example.com" }, "mail.link_base_url"},
+		{"адрес шлагбаумов", true, func(cfg *Config) { cfg.Gates.ListenAddr = "7070" }, "gates.listen_addr"},
+		{"нет шрифта", true, func(cfg *Config) { cfg.Reports.PDFFontPath = "/nonexistent/DejaVuSans.ttf" }, "reports.pdf_font_path"},
+		{"уровень логов", true, func(cfg *Config) { cfg.Log.Level = "trace" }, "log.level"},
+		{"коллектор со схемой", true, func(cfg *Config) {
+			cfg.Tracing.Exporter = "otlp"
+			cfg.Tracing.Endpoint = "http://localhost:4318"
+		}, "tracing.endpoint: ожидается host:port"},
+		{"доля трасс", true, func(cfg *Config) { cfg.Tracing.SampleRatio = 2 }, "tracing.sample_ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+			err := cfg.Validate(tt.serving)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("неожиданная ошибка: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("%v, ожидалась ошибка с %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Ошибки собираются все, а не только первая
+	cfg := validConfig()
+	cfg.Server.Port = 0
+	cfg.Log.Format = "xml"
+	err := cfg.Validate(true)
+	if err == nil || !strings.Contains(err.Error(), "server.port") || !strings.Contains(err.Error(), "log.format") {
+		t.Errorf("%v, ожидались обе ошибки", err)
+	}
+}
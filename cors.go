@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// originAllowed проверяет Origin запроса по списку из настроек
+func originAllowed(cfg CORSConfig, origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMiddleware отдает CORS-заголовки разрешенным источникам и отвечает на
+// preflight-запросы. Авторизация идет через заголовок Authorization, а не
+// cookie, поэтому credentials не разрешаются.
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !originAllowed(cfg, origin) {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			h.Set("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// webSocketOriginCheck для upgrader.CheckOrigin: без настроенного списка
+// принимаются подключения с любого источника
+func webSocketOriginCheck(cfg CORSConfig) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return len(cfg.AllowedOrigins) == 0 || origin == "" || originAllowed(cfg, origin)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+// Ошибки API отдаются в едином виде:
+//
+//	{"error": "Парковка не найдена", "code": "parking_not_found"}
+//
+// error - сообщение на языке из Accept-Language (ru по умолчанию), code -
+// стабильный код из errors_catalog.go, по которому клиент принимает решения.
+// Ошибки проверки входных данных дополнительно содержат details с кодом и
+// сообщением для каждого поля.
+
+// ErrorCode машиночитаемый код ошибки
+type ErrorCode string
+
+type localized map[string]string
+
+type errorSpec struct {
+	status   int
+	messages localized
+}
+
+// Поддерживаемые языки сообщений; первый - язык по умолчанию
+var (
+	defaultLanguage = "ru"
+	languageMatcher = language.NewMatcher([]language.Tag{language.Russian, language.English})
+)
+
+// APIError ошибка, отдаваемая клиенту
+type APIError struct {
+	Code    ErrorCode
+	Details []FieldError
+	// Extra дополнительные поля ответа, например статус выгрузки
+	Extra gin.H
+}
+
+// FieldError ошибка в одном поле запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	param string // Параметр правила валидатора для сообщения
+}
+
+// Error сообщение с ошибками полей на языке по умолчанию, для логов и CLI
+func (e *APIError) Error() string {
+	msg := e.message(defaultLanguage)
+	for _, d := range e.Details {
+		msg += "; "
+		if d.Field != "" {
+			msg += d.Field + ": "
+		}
+		msg += fieldMessage(d, defaultLanguage)
+	}
+	return msg
+}
+
+// Status HTTP-статус кода ошибки. Код без записи в каталоге - ошибка
+// программиста, клиенту он отдается как 500.
+func (e *APIError) Status() int {
+	if spec, ok := errorCatalog[e.Code]; ok {
+		return spec.status
+	}
+	return errorCatalog[CodeInternal].status
+}
+
+func (e *APIError) message(lang string) string {
+	spec, ok := errorCatalog[e.Code]
+	if !ok {
+		spec = errorCatalog[CodeInternal]
+	}
+	if msg, ok := spec.messages[lang]; ok {
+		return msg
+	}
+	return spec.messages[defaultLanguage]
+}
+
+// body тело ответа на языке lang
+func (e *APIError) body(lang string) gin.H {
+	body := gin.H{}
+	for k, v := range e.Extra {
+		body[k] = v
+	}
+	body["error"] = e.message(lang)
+	body["code"] = e.Code
+	if len(e.Details) > 0 {
+		details := make([]FieldError, len(e.Details))
+		for i, d := range e.Details {
+			d.Message = fieldMessage(d, lang)
+			details[i] = d
+		}
+		body["details"] = details
+	}
+	return body
+}
+
+// requestLanguage выбирает язык сообщений по Accept-Language
+func requestLanguage(c *gin.Context) string {
+	header := c.GetHeader("Accept-Language")
+	if header == "" {
+		return defaultLanguage
+	}
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return defaultLanguage
+	}
+	tag, _, confidence := languageMatcher.Match(tags...)
+	if confidence == language.No {
+		return defaultLanguage
+	}
+	base, _ := tag.Base()
+	return base.String()
+}
+
+// respondError отвечает ошибкой с кодом code
+func respondError(c *gin.Context, code ErrorCode) {
+	writeError(c, &APIError{Code: code})
+}
+
+// abortWithError то же, что respondError, но останавливает цепочку
+// обработчиков; для middleware
+func abortWithError(c *gin.Context, code ErrorCode) {
+	writeError(c, &APIError{Code: code})
+	c.Abort()
+}
+
+func writeError(c *gin.Context, e *APIError) {
+	lang := requestLanguage(c)
+	c.Header("Content-Language", lang)
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	c.JSON(e.Status(), e.body(lang))
+}
+
+// respondAPIError отвечает ошибкой err, если это *APIError, и кодом
+// fallback в остальных случаях
+func respondAPIError(c *gin.Context, err error, fallback ErrorCode) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &APIError{Code: fallback}
+	}
+	writeError(c, apiErr)
+}
+
+// respondValidationError отвечает 400 на ошибку ShouldBindJSON: ошибки
+// валидатора раскладываются по полям, текст ошибки разбора JSON клиенту
+// не отдается
+func respondValidationError(c *gin.Context, err error) {
+	c.Error(err)
+	writeError(c, &APIError{Code: CodeValidationFailed, Details: fieldErrors(err)})
+}
+
+func fieldErrors(err error) []FieldError {
+	var (
+		verrs     validator.ValidationErrors
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &verrs):
+		details := make([]FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			details = append(details, FieldError{
+				Field: fieldPath(fe.Namespace()),
+				Code:  fe.Tag(),
+				param: fe.Param(),
+			})
+		}
+		return details
+	case errors.As(err, &typeErr):
+		return []FieldError{{Field: typeErr.Field, Code: "type", param: typeErr.Type.String()}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return []FieldError{{Field: "", Code: "json"}}
+	}
+	return []FieldError{{Field: "", Code: "invalid"}}
+}
+
+// fieldPath убирает из пути валидатора имя структуры: "input.items[0].name"
+// становится "items[0].name"
+func fieldPath(namespace string) string {
+	if i := strings.IndexByte(namespace, '.'); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// fieldMessages сообщения для правил валидатора; %s - параметр правила
+var fieldMessages = map[string]localized{
+	"required":         {"ru": "обязательное поле", "en": "is required"},
+	"required_without": {"ru": "обязательное поле, если не задано %s", "en": "is required when %s is not set"},
+	"email":            {"ru": "неверный адрес почты", "en": "must be a valid email address"},
+	"min":              {"ru": "не меньше %s", "en": "must be at least %s"},
+	"max":              {"ru": "не больше %s", "en": "must be at most %s"},
+	"len":              {"ru": "длина должна быть %s", "en": "must have length %s"},
+	"gt":               {"ru": "должно быть больше %s", "en": "must be greater than %s"},
+	"gte":              {"ru": "должно быть не меньше %s", "en": "must be greater than or equal to %s"},
+	"lt":               {"ru": "должно быть меньше %s", "en": "must be less than %s"},
+	"lte":              {"ru": "должно быть не больше %s", "en": "must be less than or equal to %s"},
+	"gtfield":          {"ru": "должно быть больше поля %s", "en": "must be greater than %s"},
+	"gtefield":         {"ru": "должно быть не меньше поля %s", "en": "must be greater than or equal to %s"},
+	"oneof":            {"ru": "допустимые значения: %s", "en": "must be one of: %s"},
+	"datetime":         {"ru": "ожидается дата и время в формате %s", "en": "must be a date and time in %s format"},
+
+	// Ошибки разбора, не валидатора
+	"type":    {"ru": "неверный тип, ожидается %s", "en": "has wrong type, expected %s"},
+	"json":    {"ru": "тело запроса не является корректным JSON", "en": "request body is not valid JSON"},
+	"invalid": {"ru": "неверное значение", "en": "is invalid"},
+}
+
+// fieldMessage сообщение для поля на языке lang
+func fieldMessage(d FieldError, lang string) string {
+	messages, ok := fieldMessages[d.Code]
+	if !ok {
+		messages = fieldMessages["invalid"]
+	}
+	msg, ok := messages[lang]
+	if !ok {
+		msg = messages[defaultLanguage]
+	}
+	if strings.Contains(msg, "%s") {
+		return fmt.Sprintf(msg, d.param)
+	}
+	return msg
+}
+
+func init() {
+	// Имена полей в ошибках валидатора берутся из тегов json, как их видит
+	// клиент, а не из имен полей структур
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import "net/http"
+
+// Коды ошибок API. Коды - часть контракта с клиентами: их можно добавлять,
+// но не переименовывать. Тексты сообщений можно менять свободно.
+
+const (
+	// Общие
+	CodeInternal         ErrorCode = "internal_error"
+	CodeValidationFailed ErrorCode = "validation_failed"
+	CodeRateLimited      ErrorCode = "rate_limited"
+
+	// Авторизация и пользователи
+	CodeTokenMissing           ErrorCode = "token_missing"
+	CodeTokenInvalid           ErrorCode = "token_invalid"
+	CodeInvalidCredentials     ErrorCode = "invalid_credentials"
+	CodeEmailTaken             ErrorCode = "email_taken"
+	CodeEmailConflict          ErrorCode = "email_conflict"
+	CodePasswordHashFailed     ErrorCode = "password_hash_failed"
+	CodeUserCreateFailed       ErrorCode = "user_create_failed"
+	CodeTokenCreateFailed      ErrorCode = "token_create_failed"
+	CodeUserNotFound           ErrorCode = "user_not_found"
+	CodeLoginLocked            ErrorCode = "login_locked"
+	CodeTokenRevoked           ErrorCode = "token_revoked"
+	CodeEmailNotVerified       ErrorCode = "email_not_verified"
+	CodeConfirmationInvalid    ErrorCode = "confirmation_invalid"
+	CodeCurrentPasswordInvalid ErrorCode = "current_password_invalid"
+	CodeUserUpdateFailed       ErrorCode = "user_update_failed"
+	CodeMailSendFailed         ErrorCode = "mail_send_failed"
+	CodeRoleRequired           ErrorCode = "role_required"
+
+	// Парковки, места, въезды и выезды
+	CodeParkingNotFound     ErrorCode = "parking_not_found"
+	CodeParkingCreateFailed ErrorCode = "parking_create_failed"
+	CodeParkingsListFailed  ErrorCode = "parkings_list_failed"
+	CodeSpotNotFound        ErrorCode = "spot_not_found"
+	CodeSpotOccupied        ErrorCode = "spot_occupied"
+	CodeSpotReserved        ErrorCode = "spot_reserved"
+	CodeSpotAlreadyAssigned ErrorCode = "spot_already_assigned"
+	CodeSpotsListFailed     ErrorCode = "spots_list_failed"
+	CodeSpotCreateFailed    ErrorCode = "spot_create_failed"
+	CodeSpotUpdateFailed    ErrorCode = "spot_update_failed"
+	CodeRateFailed          ErrorCode = "rate_failed"
+	CodeEntryCreateFailed   ErrorCode = "entry_create_failed"
+	CodeEntryNotFound       ErrorCode = "entry_not_found"
+	CodeOpenEntryNotFound   ErrorCode = "open_entry_not_found"
+	CodeExitAlreadyRecorded ErrorCode = "exit_already_recorded"
+	CodeExitCreateFailed    ErrorCode = "exit_create_failed"
+	CodeWebSocketFailed     ErrorCode = "websocket_failed"
+
+	// Платежи
+	CodePaymentsNotConfigured ErrorCode = "payments_not_configured"
+	CodePaymentFailed         ErrorCode = "payment_failed"
+	CodePaymentIncomplete     ErrorCode = "payment_incomplete"
+	CodePaymentSaveFailed     ErrorCode = "payment_save_failed"
+	CodeWebhookInvalid        ErrorCode = "webhook_invalid"
+	CodePaymentNotFound       ErrorCode = "payment_not_found"
+
+	// Параметры периодов и фильтров
+	CodeInvalidStartTime            ErrorCode = "invalid_start_time"
+	CodeInvalidEndTime              ErrorCode = "invalid_end_time"
+	CodeTimeRangeRequired           ErrorCode = "time_range_required"
+	CodeTimeRangeInvalid            ErrorCode = "time_range_invalid"
+	CodeInvalidFrom                 ErrorCode = "invalid_from"
+	CodeInvalidMonth                ErrorCode = "invalid_month"
+	CodeMonthNotFinished            ErrorCode = "month_not_finished"
+	CodeInvalidDays                 ErrorCode = "invalid_days"
+	CodeUnknownTimezone             ErrorCode = "unknown_timezone"
+	CodeInvalidGranularity          ErrorCode = "invalid_granularity"
+	CodeInvalidOccupancyGranularity ErrorCode = "invalid_occupancy_granularity"
+	CodePeriodTooLong               ErrorCode = "period_too_long"
+	CodeInvalidForecastHours        ErrorCode = "invalid_forecast_hours"
+	CodeInvalidOccupancyThresholds  ErrorCode = "invalid_occupancy_thresholds"
+	CodeInvalidFrequency            ErrorCode = "invalid_frequency"
+
+	// Аналитика, цены, прогнозы и отчеты
+	CodeAnalyticsFailed         ErrorCode = "analytics_failed"
+	CodeAnalyticsComputeFailed  ErrorCode = "analytics_compute_failed"
+	CodeRollupsListFailed       ErrorCode = "rollups_list_failed"
+	CodePriceChangesListFailed  ErrorCode = "price_changes_list_failed"
+	CodePricingSaveFailed       ErrorCode = "pricing_save_failed"
+	CodeForecastFailed          ErrorCode = "forecast_failed"
+	CodeForecastAccuracyFailed  ErrorCode = "forecast_accuracy_failed"
+	CodeReportFailed            ErrorCode = "report_failed"
+	CodePDFFailed               ErrorCode = "pdf_failed"
+	CodeUnsupportedReportFormat ErrorCode = "unsupported_report_format"
+	CodeReportSendFailed        ErrorCode = "report_send_failed"
+	CodeScheduleNotFound        ErrorCode = "schedule_not_found"
+	CodeSchedulesListFailed     ErrorCode = "schedules_list_failed"
+	CodeScheduleCreateFailed    ErrorCode = "schedule_create_failed"
+	CodeScheduleDeleteFailed    ErrorCode = "schedule_delete_failed"
+	CodeHolidaysListFailed      ErrorCode = "holidays_list_failed"
+	CodeHolidayCreateFailed     ErrorCode = "holiday_create_failed"
+
+	// Выгрузки
+	CodeUnknownDataset          ErrorCode = "unknown_dataset"
+	CodeUnsupportedExportFormat ErrorCode = "unsupported_export_format"
+	CodeExportNotFound          ErrorCode = "export_not_found"
+	CodeExportNotReady          ErrorCode = "export_not_ready"
+	CodeExportCreateFailed      ErrorCode = "export_create_failed"
+
+	// Шлагбаумы и датчики
+	CodeLaneNotFound          ErrorCode = "lane_not_found"
+	CodeLanesListFailed       ErrorCode = "lanes_list_failed"
+	CodeLaneCreateFailed      ErrorCode = "lane_create_failed"
+	CodeLaneUpdateFailed      ErrorCode = "lane_update_failed"
+	CodeGateOffline           ErrorCode = "gate_offline"
+	CodeGateCommandFailed     ErrorCode = "gate_command_failed"
+	CodeLaneEventsListFailed  ErrorCode = "lane_events_list_failed"
+	CodeSensorsListFailed     ErrorCode = "sensors_list_failed"
+	CodeSensorCreateFailed    ErrorCode = "sensor_create_failed"
+	CodeMismatchNotFound      ErrorCode = "mismatch_not_found"
+	CodeMismatchResolved      ErrorCode = "mismatch_already_resolved"
+	CodeMismatchesListFailed  ErrorCode = "mismatches_list_failed"
+	CodeMismatchResolveFailed ErrorCode = "mismatch_resolve_failed"
+
+	// Шлюзы датчиков
+	CodeSensorGatewayUnauthorized ErrorCode = "sensor_gateway_unauthorized"
+	CodeSensorGatewayNotFound     ErrorCode = "sensor_gateway_not_found"
+	CodeSensorGatewayExists       ErrorCode = "sensor_gateway_exists"
+	CodeSensorGatewaysListFailed  ErrorCode = "sensor_gateways_list_failed"
+	CodeSensorGatewayCreateFailed ErrorCode = "sensor_gateway_create_failed"
+	CodeSensorGatewayUpdateFailed ErrorCode = "sensor_gateway_update_failed"
+
+	// Абонементы
+	CodePermitNotFound        ErrorCode = "permit_not_found"
+	CodePermitProductNotFound ErrorCode = "permit_product_not_found"
+	CodeSpotRequired          ErrorCode = "spot_required"
+	CodePermitsListFailed     ErrorCode = "permits_list_failed"
+	CodePermitCreateFailed    ErrorCode = "permit_create_failed"
+	CodePermitPurchaseFailed  ErrorCode = "permit_purchase_failed"
+	CodePermitRenewFailed     ErrorCode = "permit_renew_failed"
+	CodePermitPaymentPending  ErrorCode = "permit_payment_pending"
+
+	// Организации и автомобили
+	CodeVehicleNotFound            ErrorCode = "vehicle_not_found"
+	CodeVehicleNotOwned            ErrorCode = "vehicle_not_owned"
+	CodeVehicleInOtherOrganization ErrorCode = "vehicle_in_other_organization"
+	CodeVehicleOwnerNotMember      ErrorCode = "vehicle_owner_not_member"
+	CodeVehicleAddFailed           ErrorCode = "vehicle_add_failed"
+	CodeVehicleRemoveFailed        ErrorCode = "vehicle_remove_failed"
+	CodeOrganizationNotFound       ErrorCode = "organization_not_found"
+	CodeOrganizationForbidden      ErrorCode = "organization_forbidden"
+	CodeAlreadyMember              ErrorCode = "already_member"
+	CodeOrganizationCreateFailed   ErrorCode = "organization_create_failed"
+	CodeOrganizationUpdateFailed   ErrorCode = "organization_update_failed"
+	CodeMemberRemoveFailed         ErrorCode = "member_remove_failed"
+	CodeLastOrganizationAdmin      ErrorCode = "last_organization_admin"
+
+	// Продавцы, валидации и счета
+	CodeMerchantNotFound      ErrorCode = "merchant_not_found"
+	CodeMerchantCreateFailed  ErrorCode = "merchant_create_failed"
+	CodeCodesGenerateFailed   ErrorCode = "codes_generate_failed"
+	CodeCodesSaveFailed       ErrorCode = "codes_save_failed"
+	CodeValidationSaveFailed  ErrorCode = "validation_save_failed"
+	CodeValidationsListFailed ErrorCode = "validations_list_failed"
+	CodeValidationCodeInvalid ErrorCode = "validation_code_invalid"
+	CodeMerchantLimitReached  ErrorCode = "merchant_limit_reached"
+	CodeMerchantNotApproved   ErrorCode = "merchant_not_approved"
+	CodeMerchantsListFailed   ErrorCode = "merchants_list_failed"
+	CodeMerchantUpdateFailed  ErrorCode = "merchant_update_failed"
+	CodeDiscountTooLarge      ErrorCode = "discount_too_large"
+	CodeInvoiceNotFound       ErrorCode = "invoice_not_found"
+	CodeInvoicesListFailed    ErrorCode = "invoices_list_failed"
+	CodeInvoiceLinesFailed    ErrorCode = "invoice_lines_failed"
+	CodeInvoiceRenderFailed   ErrorCode = "invoice_render_failed"
+	CodeInvoiceIssueFailed    ErrorCode = "invoice_issue_failed"
+	CodeInvoiceExists         ErrorCode = "invoice_exists"
+)
+
+// errorCatalog HTTP-статус и сообщения на каждом языке для каждого кода
+var errorCatalog = map[ErrorCode]errorSpec{
+	CodeInternal:         {http.StatusInternalServerError, localized{"ru": "Внутренняя ошибка сервера", "en": "Internal server error"}},
+	CodeValidationFailed: {http.StatusBadRequest, localized{"ru": "Неверные данные запроса", "en": "Invalid request data"}},
+	CodeRateLimited:      {http.StatusTooManyRequests, localized{"ru": "Слишком много запросов, повторите позже", "en": "Too many requests, try again later"}},
+
+	CodeTokenMissing:           {http.StatusUnauthorized, localized{"ru": "Токен не предоставлен", "en": "Token not provided"}},
+	CodeTokenInvalid:           {http.StatusUnauthorized, localized{"ru": "Неверный токен", "en": "Invalid token"}},
+	CodeInvalidCredentials:     {http.StatusUnauthorized, localized{"ru": "Неверные учетные данные", "en": "Invalid credentials"}},
+	CodeEmailTaken:             {http.StatusBadRequest, localized{"ru": "Пользователь с таким email уже существует", "en": "A user with this email already exists"}},
+	CodeEmailConflict:          {http.StatusConflict, localized{"ru": "Этот email только что занял другой пользователь", "en": "This email has just been taken by another user"}},
+	CodePasswordHashFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось обработать пароль", "en": "Failed to process password"}},
+	CodeUserCreateFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось создать пользователя", "en": "Failed to create user"}},
+	CodeTokenCreateFailed:      {http.StatusInternalServerError, localized{"ru": "Не удалось создать токен", "en": "Failed to create token"}},
+	CodeUserNotFound:           {http.StatusBadRequest, localized{"ru": "Пользователь не найден", "en": "User not found"}},
+	CodeTokenRevoked:           {http.StatusUnauthorized, localized{"ru": "Сессия завершена после смены пароля или email, войдите заново", "en": "Session ended after a password or email change, please log in again"}},
+	CodeEmailNotVerified:       {http.StatusForbidden, localized{"ru": "Email не подтвержден, перейдите по ссылке из письма", "en": "Email is not verified, follow the link in the email"}},
+	CodeConfirmationInvalid:    {http.StatusBadRequest, localized{"ru": "Ссылка недействительна, устарела или уже использована", "en": "The link is invalid, expired or already used"}},
+	CodeCurrentPasswordInvalid: {http.StatusBadRequest, localized{"ru": "Неверный текущий пароль", "en": "Current password is incorrect"}},
+	CodeUserUpdateFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось обновить пользователя", "en": "Failed to update user"}},
+	CodeMailSendFailed:         {http.StatusInternalServerError, localized{"ru": "Не удалось отправить письмо", "en": "Failed to send email"}},
+	CodeRoleRequired:           {http.StatusForbidden, localized{"ru": "Недостаточно прав для этой операции", "en": "Insufficient permissions for this operation"}},
+	CodeLoginLocked:            {http.StatusTooManyRequests, localized{"ru": "Слишком много неудачных попыток входа, вход временно заблокирован", "en": "Too many failed login attempts, login is temporarily locked"}},
+
+	CodeParkingNotFound:     {http.StatusNotFound, localized{"ru": "Парковка не найдена", "en": "Parking not found"}},
+	CodeParkingCreateFailed: {http.StatusInternalServerError, localized{"ru": "Не удалось создать парковку", "en": "Failed to create parking"}},
+	CodeParkingsListFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось получить парковки", "en": "Failed to load parkings"}},
+	CodeSpotNotFound:        {http.StatusBadRequest, localized{"ru": "Место не найдено", "en": "Spot not found"}},
+	CodeSpotOccupied:        {http.StatusBadRequest, localized{"ru": "Место уже занято", "en": "Spot is already occupied"}},
+	CodeSpotReserved:        {http.StatusBadRequest, localized{"ru": "Место закреплено за абонементом", "en": "Spot is reserved for a permit"}},
+	CodeSpotAlreadyAssigned: {http.StatusBadRequest, localized{"ru": "Место уже закреплено за другим абонементом", "en": "Spot is already assigned to another permit"}},
+	CodeSpotsListFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось получить места", "en": "Failed to load spots"}},
+	CodeSpotCreateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось добавить место", "en": "Failed to add spot"}},
+	CodeSpotUpdateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось обновить статус места", "en": "Failed to update spot status"}},
+	CodeRateFailed:          {http.StatusInternalServerError, localized{"ru": "Не удалось определить тариф", "en": "Failed to determine the rate"}},
+	CodeEntryCreateFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось зафиксировать въезд", "en": "Failed to record entry"}},
+	CodeEntryNotFound:       {http.StatusBadRequest, localized{"ru": "Запись о въезде не найдена", "en": "Entry not found"}},
+	CodeOpenEntryNotFound:   {http.StatusBadRequest, localized{"ru": "Открытая стоянка не найдена", "en": "No open parking session found"}},
+	CodeExitAlreadyRecorded: {http.StatusBadRequest, localized{"ru": "Выезд уже зафиксирован", "en": "Exit has already been recorded"}},
+	CodeExitCreateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось зафиксировать выезд", "en": "Failed to record exit"}},
+	CodeWebSocketFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось установить WebSocket соединение", "en": "Failed to establish WebSocket connection"}},
+
+	CodePaymentsNotConfigured: {http.StatusInternalServerError, localized{"ru": "STRIPE_SECRET_KEY не установлен", "en": "Card payments are not configured"}},
+	CodePaymentFailed:         {http.StatusPaymentRequired, localized{"ru": "Ошибка при обработке платежа", "en": "Payment could not be processed"}},
+	CodePaymentIncomplete:     {http.StatusPaymentRequired, localized{"ru": "Платеж не завершен", "en": "Payment was not completed"}},
+	CodePaymentSaveFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось сохранить платеж", "en": "Failed to save payment"}},
+	CodeWebhookInvalid:        {http.StatusBadRequest, localized{"ru": "Неверная подпись или формат вебхука", "en": "Invalid webhook signature or payload"}},
+	CodePaymentNotFound:       {http.StatusNotFound, localized{"ru": "Платеж не найден", "en": "Payment not found"}},
+
+	CodeInvalidStartTime:            {http.StatusBadRequest, localized{"ru": "Неверный формат start_time", "en": "Invalid start_time format"}},
+	CodeInvalidEndTime:              {http.StatusBadRequest, localized{"ru": "Неверный формат end_time", "en": "Invalid end_time format"}},
+	CodeTimeRangeRequired:           {http.StatusBadRequest, localized{"ru": "Параметры start_time и end_time обязательны", "en": "start_time and end_time are required"}},
+	CodeTimeRangeInvalid:            {http.StatusBadRequest, localized{"ru": "end_time должен быть позже start_time", "en": "end_time must be after start_time"}},
+	CodeInvalidFrom:                 {http.StatusBadRequest, localized{"ru": "Неверный формат from", "en": "Invalid from format"}},
+	CodeInvalidMonth:                {http.StatusBadRequest, localized{"ru": "Неверный формат month, ожидается ГГГГ-ММ", "en": "Invalid month format, expected YYYY-MM"}},
+	CodeMonthNotFinished:            {http.StatusBadRequest, localized{"ru": "Месяц еще не закончился", "en": "The month has not ended yet"}},
+	CodeInvalidDays:                 {http.StatusBadRequest, localized{"ru": "Неверное значение days", "en": "Invalid days value"}},
+	CodeUnknownTimezone:             {http.StatusBadRequest, localized{"ru": "Неизвестный часовой пояс", "en": "Unknown time zone"}},
+	CodeInvalidGranularity:          {http.StatusBadRequest, localized{"ru": "granularity должен быть hour или day", "en": "granularity must be hour or day"}},
+	CodeInvalidOccupancyGranularity: {http.StatusBadRequest, localized{"ru": "granularity должен быть 15m, hour, day или week", "en": "granularity must be 15m, hour, day or week"}},
+	CodePeriodTooLong:               {http.StatusBadRequest, localized{"ru": "Слишком большой период для выбранной гранулярности", "en": "Period is too long for the selected granularity"}},
+	CodeInvalidForecastHours:        {http.StatusBadRequest, localized{"ru": "hours должен быть от 1 до 72", "en": "hours must be between 1 and 72"}},
+	CodeInvalidOccupancyThresholds:  {http.StatusBadRequest, localized{"ru": "low_occupancy должен быть меньше high_occupancy", "en": "low_occupancy must be less than high_occupancy"}},
+	CodeInvalidFrequency:            {http.StatusBadRequest, localized{"ru": "frequency должен быть daily, weekly или monthly", "en": "frequency must be daily, weekly or monthly"}},
+
+	CodeAnalyticsFailed:         {http.StatusInternalServerError, localized{"ru": "Не удалось получить аналитику", "en": "Failed to load analytics"}},
+	CodeAnalyticsComputeFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось посчитать аналитику", "en": "Failed to compute analytics"}},
+	CodeRollupsListFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось получить сводки", "en": "Failed to load rollups"}},
+	CodePriceChangesListFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось получить журнал цен", "en": "Failed to load price changes"}},
+	CodePricingSaveFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось сохранить настройки цены", "en": "Failed to save pricing settings"}},
+	CodeForecastFailed:          {http.StatusInternalServerError, localized{"ru": "Не удалось построить прогноз", "en": "Failed to build forecast"}},
+	CodeForecastAccuracyFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось посчитать точность прогноза", "en": "Failed to compute forecast accuracy"}},
+	CodeReportFailed:            {http.StatusInternalServerError, localized{"ru": "Не удалось построить отчет", "en": "Failed to build report"}},
+	CodePDFFailed:               {http.StatusInternalServerError, localized{"ru": "Не удалось сформировать PDF", "en": "Failed to render PDF"}},
+	CodeUnsupportedReportFormat: {http.StatusBadRequest, localized{"ru": "Поддерживаются форматы csv и pdf", "en": "Supported formats are csv and pdf"}},
+	CodeReportSendFailed:        {http.StatusBadGateway, localized{"ru": "Не удалось отправить отчет", "en": "Failed to send report"}},
+	CodeScheduleNotFound:        {http.StatusNotFound, localized{"ru": "Расписание не найдено", "en": "Report schedule not found"}},
+	CodeSchedulesListFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось получить расписания", "en": "Failed to load report schedules"}},
+	CodeScheduleCreateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось создать расписание", "en": "Failed to create report schedule"}},
+	CodeScheduleDeleteFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось удалить расписание", "en": "Failed to delete report schedule"}},
+	CodeHolidaysListFailed:      {http.StatusInternalServerError, localized{"ru": "Не удалось получить праздники", "en": "Failed to load holidays"}},
+	CodeHolidayCreateFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось добавить праздник", "en": "Failed to add holiday"}},
+
+	CodeUnknownDataset:          {http.StatusNotFound, localized{"ru": "Неизвестный набор данных", "en": "Unknown dataset"}},
+	CodeUnsupportedExportFormat: {http.StatusBadRequest, localized{"ru": "Поддерживаются форматы csv и xlsx", "en": "Supported formats are csv and xlsx"}},
+	CodeExportNotFound:          {http.StatusNotFound, localized{"ru": "Выгрузка не найдена", "en": "Export not found"}},
+	CodeExportNotReady:          {http.StatusConflict, localized{"ru": "Выгрузка еще не готова", "en": "Export is not ready yet"}},
+	CodeExportCreateFailed:      {http.StatusInternalServerError, localized{"ru": "Не удалось создать выгрузку", "en": "Failed to create export"}},
+
+	CodeLaneNotFound:          {http.StatusNotFound, localized{"ru": "Полоса не найдена", "en": "Lane not found"}},
+	CodeLanesListFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось получить полосы", "en": "Failed to load lanes"}},
+	CodeLaneCreateFailed:      {http.StatusInternalServerError, localized{"ru": "Не удалось добавить полосу", "en": "Failed to add lane"}},
+	CodeLaneUpdateFailed:      {http.StatusInternalServerError, localized{"ru": "Не удалось обновить полосу", "en": "Failed to update lane"}},
+	CodeGateOffline:           {http.StatusServiceUnavailable, localized{"ru": "Шлагбаум не подключен", "en": "Gate controller is not connected"}},
+	CodeGateCommandFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось отправить команду", "en": "Failed to send command"}},
+	CodeLaneEventsListFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось получить события", "en": "Failed to load lane events"}},
+	CodeSensorsListFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось получить датчики", "en": "Failed to load sensors"}},
+	CodeSensorCreateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось добавить датчик", "en": "Failed to add sensor"}},
+	CodeMismatchNotFound:      {http.StatusNotFound, localized{"ru": "Расхождение не найдено", "en": "Mismatch not found"}},
+	CodeMismatchResolved:      {http.StatusBadRequest, localized{"ru": "Расхождение уже закрыто", "en": "Mismatch is already resolved"}},
+	CodeMismatchesListFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось получить расхождения", "en": "Failed to load mismatches"}},
+	CodeMismatchResolveFailed: {http.StatusInternalServerError, localized{"ru": "Не удалось закрыть расхождение", "en": "Failed to resolve mismatch"}},
+
+	CodeSensorGatewayUnauthorized: {http.StatusUnauthorized, localized{"ru": "Неизвестный шлюз или неверный секрет", "en": "Unknown gateway or invalid secret"}},
+	CodeSensorGatewayNotFound:     {http.StatusNotFound, localized{"ru": "Шлюз датчиков не найден", "en": "Sensor gateway not found"}},
+	CodeSensorGatewayExists:       {http.StatusConflict, localized{"ru": "Шлюз с таким gateway_id уже есть", "en": "A gateway with this gateway_id already exists"}},
+	CodeSensorGatewaysListFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось получить шлюзы датчиков", "en": "Failed to load sensor gateways"}},
+	CodeSensorGatewayCreateFailed: {http.StatusInternalServerError, localized{"ru": "Не удалось добавить шлюз датчиков", "en": "Failed to add sensor gateway"}},
+	CodeSensorGatewayUpdateFailed: {http.StatusInternalServerError, localized{"ru": "Не удалось обновить шлюз датчиков", "en": "Failed to update sensor gateway"}},
+
+	CodePermitNotFound:        {http.StatusNotFound, localized{"ru": "Абонемент не найден", "en": "Permit not found"}},
+	CodePermitProductNotFound: {http.StatusBadRequest, localized{"ru": "Тариф абонемента не найден", "en": "Permit product not found"}},
+	CodeSpotRequired:          {http.StatusBadRequest, localized{"ru": "Для абонемента с закрепленным местом нужно указать spot_id", "en": "spot_id is required for a reserved-spot permit"}},
+	CodePermitsListFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось получить абонементы", "en": "Failed to load permits"}},
+	CodePermitCreateFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось создать абонемент", "en": "Failed to create permit"}},
+	CodePermitPurchaseFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось оформить абонемент", "en": "Failed to purchase permit"}},
+	CodePermitRenewFailed:     {http.StatusInternalServerError, localized{"ru": "Не удалось продлить абонемент", "en": "Failed to renew permit"}},
+	CodePermitPaymentPending:  {http.StatusConflict, localized{"ru": "Абонемент ожидает подтверждения оплаты", "en": "Permit is awaiting payment confirmation"}},
+
+	CodeVehicleNotFound:            {http.StatusBadRequest, localized{"ru": "Автомобиль не найден", "en": "Vehicle not found"}},
+	CodeVehicleNotOwned:            {http.StatusForbidden, localized{"ru": "Автомобиль принадлежит другому пользователю", "en": "Vehicle belongs to another user"}},
+	CodeVehicleInOtherOrganization: {http.StatusBadRequest, localized{"ru": "Автомобиль уже принадлежит другой организации", "en": "Vehicle already belongs to another organization"}},
+	CodeVehicleOwnerNotMember:      {http.StatusForbidden, localized{"ru": "Владелец автомобиля не состоит в организации", "en": "Vehicle owner is not a member of the organization"}},
+	CodeVehicleAddFailed:           {http.StatusInternalServerError, localized{"ru": "Не удалось добавить автомобиль", "en": "Failed to add vehicle"}},
+	CodeVehicleRemoveFailed:        {http.StatusInternalServerError, localized{"ru": "Не удалось удалить автомобиль", "en": "Failed to remove vehicle"}},
+	CodeOrganizationNotFound:       {http.StatusNotFound, localized{"ru": "Организация не найдена", "en": "Organization not found"}},
+	CodeOrganizationForbidden:      {http.StatusForbidden, localized{"ru": "Недостаточно прав в организации", "en": "Insufficient organization permissions"}},
+	CodeAlreadyMember:              {http.StatusBadRequest, localized{"ru": "Пользователь уже состоит в организации", "en": "User is already a member of the organization"}},
+	CodeOrganizationCreateFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось создать организацию", "en": "Failed to create organization"}},
+	CodeOrganizationUpdateFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось обновить организацию", "en": "Failed to update organization"}},
+	CodeMemberRemoveFailed:         {http.StatusInternalServerError, localized{"ru": "Не удалось удалить участника", "en": "Failed to remove member"}},
+	CodeLastOrganizationAdmin:      {http.StatusConflict, localized{"ru": "Нельзя удалить последнего администратора организации", "en": "Cannot remove the last organization admin"}},
+
+	CodeMerchantNotFound:      {http.StatusNotFound, localized{"ru": "Продавец не найден", "en": "Merchant not found"}},
+	CodeMerchantCreateFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось создать продавца", "en": "Failed to create merchant"}},
+	CodeCodesGenerateFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось сгенерировать коды", "en": "Failed to generate codes"}},
+	CodeCodesSaveFailed:       {http.StatusInternalServerError, localized{"ru": "Не удалось сохранить коды", "en": "Failed to save codes"}},
+	CodeValidationSaveFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось сохранить валидацию", "en": "Failed to save validation"}},
+	CodeValidationsListFailed: {http.StatusInternalServerError, localized{"ru": "Не удалось получить валидации", "en": "Failed to load validations"}},
+	CodeValidationCodeInvalid: {http.StatusBadRequest, localized{"ru": "Код валидации недействителен", "en": "Validation code is invalid"}},
+	CodeMerchantLimitReached:  {http.StatusForbidden, localized{"ru": "Продавец исчерпал лимит валидаций за месяц", "en": "Merchant has reached the monthly validation limit"}},
+	CodeMerchantNotApproved:   {http.StatusForbidden, localized{"ru": "Продавец еще не одобрен администратором", "en": "Merchant has not been approved yet"}},
+	CodeMerchantsListFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось получить продавцов", "en": "Failed to load merchants"}},
+	CodeMerchantUpdateFailed:  {http.StatusInternalServerError, localized{"ru": "Не удалось обновить продавца", "en": "Failed to update merchant"}},
+	CodeDiscountTooLarge:      {http.StatusBadRequest, localized{"ru": "Скидка больше допустимой", "en": "Discount exceeds the allowed maximum"}},
+	CodeInvoiceNotFound:       {http.StatusNotFound, localized{"ru": "Счет не найден", "en": "Invoice not found"}},
+	CodeInvoicesListFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось получить счета", "en": "Failed to load invoices"}},
+	CodeInvoiceLinesFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось получить строки счета", "en": "Failed to load invoice lines"}},
+	CodeInvoiceRenderFailed:   {http.StatusInternalServerError, localized{"ru": "Не удалось сформировать счет", "en": "Failed to render invoice"}},
+	CodeInvoiceIssueFailed:    {http.StatusInternalServerError, localized{"ru": "Не удалось выставить счет", "en": "Failed to issue invoice"}},
+	CodeInvoiceExists:         {http.StatusConflict, localized{"ru": "Счет за этот месяц уже выставлен", "en": "Invoice for this month has already been issued"}},
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "ru"},
+		{"en", "en"},
+		{"en-US,en;q=0.9", "en"},
+		{"ru-RU", "ru"},
+		{"de, en;q=0.5", "en"},
+		{"fr;q=1, ru;q=0.1", "ru"},
+		{"de", "ru"},
+		{"не заголовок;q=", "ru"},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set("Accept-Language", tt.header)
+		if got := requestLanguage(c); got != tt.want {
+			t.Errorf("%q: %q, ожидался %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// У каждой ошибки и каждого правила валидатора есть сообщения на всех
+// языках, а у переводов правил одинаковое число подстановок
+func TestErrorMessages(t *testing.T) {
+	for code, spec := range errorCatalog {
+		if spec.status < 400 || spec.messages["ru"] == "" || spec.messages["en"] == "" {
+			t.Errorf("%s: статус %d, сообщения %v", code, spec.status, spec.messages)
+		}
+	}
+	for rule, messages := range fieldMessages {
+		if messages["ru"] == "" || messages["en"] == "" ||
+			strings.Count(messages["ru"], "%s") != strings.Count(messages["en"], "%s") {
+			t.Errorf("правило %s: %v", rule, messages)
+		}
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+
+	tests := []struct {
+		name     string
+		language string
+		body     string
+		lang     string // Content-Language ответа
+		want     string
+		details  map[string]string // Сообщения по полям
+	}{
+		{"по умолчанию", "", `{"email": "не адрес"}`, "ru", "Неверные данные запроса",
+			map[string]string{"email": "неверный адрес почты", "password": "обязательное поле"}},
+		{"английский", "en-GB,en;q=0.8", `{"email": "не адрес"}`, "en", "Invalid request data",
+			map[string]string{"email": "must be a valid email address", "password": "is required"}},
+		{"неподдерживаемый язык", "de", `{"email": "не адрес"}`, "ru", "Неверные данные запроса",
+			map[string]string{"email": "неверный адрес почты", "password": "обязательное поле"}},
+		{"неверный тип", "en", `{"email": 1, "password": "x"}`, "en", "Invalid request data",
+			map[string]string{"email": "has wrong type, expected string"}},
+		{"не JSON", "en", `{`, "en", "Invalid request data",
+			map[string]string{"": "request body is not valid JSON"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.language != "" {
+				req.Header.Set("Accept-Language", tt.language)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+
+			var body struct {
+				Error   string       `json:"error"`
+				Code    ErrorCode    `json:"code"`
+				Details []FieldError `json:"details"`
+			}
+			s.expect(w, http.StatusBadRequest, &body)
+			if body.Code != CodeValidationFailed || body.Error != tt.want {
+				t.Errorf("%s %q, ожидалось %s %q", body.Code, body.Error, CodeValidationFailed, tt.want)
+			}
+			if lang := w.Header().Get("Content-Language"); lang != tt.lang {
+				t.Errorf("Content-Language %q, ожидался %q", lang, tt.lang)
+			}
+			if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Accept-Language") {
+				t.Errorf("Vary %q без Accept-Language", vary)
+			}
+			got := make(map[string]string)
+			for _, d := range body.Details {
+				got[d.Field] = d.Message
+			}
+			for field, want := range tt.details {
+				if got[field] != want {
+					t.Errorf("поле %q: %q, ожидалось %q", field, got[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIErrorText(t *testing.T) {
+	err := &APIError{Code: CodeValidationFailed, Details: []FieldError{
+		{Field: "capacity", Code: "min", param: "1"},
+		{Code: "json"},
+	}}
+	want := "Неверные данные запроса; capacity: не меньше 1; тело запроса не является корректным JSON"
+	if err.Error() != want {
+		t.Errorf("%q, ожидалось %q", err.Error(), want)
+	}
+	// Код без записи в каталоге отдается как внутренняя ошибка
+	unknown := &APIError{Code: "no_such_code"}
+	if unknown.Status() != http.StatusInternalServerError || unknown.message("en") != errorCatalog[CodeInternal].messages["en"] {
+		t.Errorf("%d %q", unknown.Status(), unknown.message("en"))
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// Форматы и статусы выгрузок
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+
+	ExportStatusQueued  = "queued"
+	ExportStatusRunning = "running"
+	ExportStatusDone    = "done"
+	ExportStatusFailed  = "failed"
+)
+
+// exportFlushEvery - через сколько строк CSV сбрасывается клиенту
+const exportFlushEvery = 1000
+
+// exportFilter общие фильтры выгрузок
+type exportFilter struct {
+	From      *time.Time
+	To        *time.Time
+	ParkingID string
+}
+
+// exportDataset описывает выгружаемый набор: заголовки и запрос, который
+// возвращает колонки в том же порядке
+type exportDataset struct {
+	Header []string
+	Query  func(f exportFilter) *gorm.DB
+}
+
+// applyRange добавляет фильтр по периоду на колонку column
+func (f exportFilter) applyRange(q *gorm.DB, column string) *gorm.DB {
+	if f.From != nil {
+		q = q.Where(column+" >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where(column+" < ?", *f.To)
+	}
+	return q
+}
+
+var exportDatasets = map[string]exportDataset{
+	"entries": {
+		Header: []string{"entry_id", "parking_id", "spot", "license_plate", "entry_time", "exit_time"},
+		Query: func(f exportFilter) *gorm.DB {
+			q := db.Table("entries").
+				Select("entries.id, spots.parking_id, spots.number, vehicles.license_plate, entries.entry_time, entries.exit_time").
+				Joins("JOIN spots ON spots.id = entries.spot_id").
+				Joins("LEFT JOIN vehicles ON vehicles.id = entries.vehicle_id").
+				Where("entries.deleted_at IS NULL").
+				Order("entries.entry_time")
+			if f.ParkingID != "" {
+				q = q.Where("spots.parking_id = ?", f.ParkingID)
+			}
+			return f.applyRange(q, "entries.entry_time")
+		},
+	},
+	"exits": {
+		Header: []string{"exit_id", "entry_id", "parking_id", "license_plate", "entry_time", "exit_time", "amount", "payment_method", "payment_status"},
+		Query: func(f exportFilter) *gorm.DB {
+			q := db.Table("exits").
+				Select("exits.id, exits.entry_id, spots.parking_id, vehicles.license_plate, entries.entry_time, exits.exit_time, payments.amount, payments.method, payments.status").
+				Joins("JOIN entries ON entries.id = exits.entry_id").
+				Joins("JOIN spots ON spots.id = entries.spot_id").
+				Joins("LEFT JOIN vehicles ON vehicles.id = entries.vehicle_id").
+				Joins("LEFT JOIN payments ON payments.id = exits.payment_id").
+				Where("exits.deleted_at IS NULL").
+				Order("exits.exit_time")
+			if f.ParkingID != "" {
+				q = q.Where("spots.parking_id = ?", f.ParkingID)
+			}
+			return f.applyRange(q, "exits.exit_time")
+		},
+	},
+	"payments": {
+		Header: []string{"payment_id", "created_at", "amount", "method", "status", "provider_id", "organization_id", "parking_id"},
+		Query: func(f exportFilter) *gorm.DB {
+			q := db.Table("payments").
+				Select("payments.id, payments.created_at, payments.amount, payments.method, payments.status, payments.provider_id, payments.organization_id, spots.parking_id").
+				Joins("LEFT JOIN exits ON exits.payment_id = payments.id").
+				Joins("LEFT JOIN entries ON entries.id = exits.entry_id").
+				Joins("LEFT JOIN spots ON spots.id = entries.spot_id").
+				Where("payments.deleted_at IS NULL").
+				Order("payments.created_at")
+			if f.ParkingID != "" {
+				q = q.Where("spots.parking_id = ?", f.ParkingID)
+			}
+			return f.applyRange(q, "payments.created_at")
+		},
+	},
+	"analytics": {
+		Header: []string{"parking_id", "hour", "count"},
+		Query: func(f exportFilter) *gorm.DB {
+			return hourlyEntriesQuery(f.From, f.To, false, f.ParkingID)
+		},
+	},
+}
+
+// exportDatasetNames имена наборов данных по алфавиту
+func exportDatasetNames() []string {
+	names := make([]string, 0, len(exportDatasets))
+	for name := range exportDatasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseExportFilter разбирает параметры from, to и parking_id
+func parseExportFilter(values url.Values) (exportFilter, error) {
+	var f exportFilter
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := values.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, &APIError{Code: CodeValidationFailed, Details: []FieldError{
+					{Field: p.name, Code: "datetime", param: "RFC 3339"},
+				}}
+			}
+			*p.dst = &t
+		}
+	}
+	f.ParkingID = values.Get("parking_id")
+	return f, nil
+}
+
+// tableWriter пишет таблицу построчно, не держа ее в памяти
+type tableWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+type csvTableWriter struct {
+	w       *csv.Writer
+	flusher http.Flusher
+	rows    int
+}
+
+func newCSVTableWriter(out io.Writer, header []string) (*csvTableWriter, error) {
+	w := &csvTableWriter{w: csv.NewWriter(out)}
+	w.flusher, _ = out.(http.Flusher)
+	return w, w.w.Write(header)
+}
+
+func (w *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatExportValue(v)
+		switch v.(type) {
+		case string, []byte:
+			record[i] = escapeCSVFormula(record[i])
+		}
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%exportFlushEvery == 0 {
+		w.w.Flush()
+		if w.flusher != nil {
+			w.flusher.Flush()
+		}
+	}
+	return nil
+}
+
+func (w *csvTableWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// xlsxTableWriter использует потоковую запись excelize: строки уходят во
+// временный файл, а не в память
+type xlsxTableWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXTableWriter(out io.Writer, header []string) (*xlsxTableWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return nil, err
+	}
+	w := &xlsxTableWriter{out: out, file: file, stream: stream, row: 1}
+
+	values := make([]interface{}, len(header))
+	for i, h := range header {
+		values[i] = h
+	}
+	return w, w.WriteRow(values)
+}
+
+func (w *xlsxTableWriter) WriteRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	w.row++
+
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			row[i] = string(v)
+		case time.Time:
+			row[i] = v.UTC()
+		default:
+			row[i] = v
+		}
+	}
+	return w.stream.SetRow(cell, row)
+}
+
+func (w *xlsxTableWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.out)
+}
+
+// escapeCSVFormula не дает табличному редактору принять текст из базы
+// (номер, имя, адрес) за формулу: перед = + - @ ставится апостроф.
+// Числа не экранируются, отрицательная сумма остается числом.
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatExportValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func newTableWriter(format string, out io.Writer, header []string) (tableWriter, error) {
+	if format == ExportFormatXLSX {
+		return newXLSXTableWriter(out, header)
+	}
+	return newCSVTableWriter(out, header)
+}
+
+// writeExport выполняет запрос набора и пишет строки по мере чтения из базы
+func writeExport(dataset exportDataset, filter exportFilter, format string, out io.Writer) (int, error) {
+	rows, err := dataset.Query(filter).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	w, err := newTableWriter(format, out, dataset.Header)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	values := make([]interface{}, len(dataset.Header))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		if err := w.WriteRow(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, w.Close()
+}
+
+func exportContentType(format string) string {
+	if format == ExportFormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ExportJobAccepted ответ на постановку выгрузки в очередь
+type ExportJobAccepted struct {
+	Job         ExportJob `json:"job"`
+	StatusURL   string    `json:"status_url"`
+	DownloadURL string    `json:"download_url"`
+}
+
+// Export отдает выгрузку потоком или ставит ее в очередь при async=true
+func (api *API) Export(c *gin.Context) {
+	name := c.Param("dataset")
+	dataset, ok := exportDatasets[name]
+	if !ok {
+		respondError(c, CodeUnknownDataset)
+		return
+	}
+
+	format := c.DefaultQuery("format", ExportFormatCSV)
+	if format != ExportFormatCSV && format != ExportFormatXLSX {
+		respondError(c, CodeUnsupportedExportFormat)
+		return
+	}
+
+	filter, err := parseExportFilter(c.Request.URL.Query())
+	if err != nil {
+		respondAPIError(c, err, CodeValidationFailed)
+		return
+	}
+
+	if c.Query("async") == "true" {
+		job := ExportJob{
+			UserID:  c.GetUint("user_id"),
+			Dataset: name,
+			Format:  format,
+			Query:   c.Request.URL.RawQuery,
+			Status:  ExportStatusQueued,
+		}
+		if err := db.Create(&job).Error; err != nil {
+			c.Error(err)
+			respondError(c, CodeExportCreateFailed)
+			return
+		}
+		goBackground(func() { runExportJob(exportDir(api.services.Export), job, dataset, filter) })
+
+		c.JSON(http.StatusAccepted, ExportJobAccepted{
+			Job:         job,
+			StatusURL:   fmt.Sprintf("/api/v1/export-jobs/%d", job.ID),
+			DownloadURL: fmt.Sprintf("/api/v1/export-jobs/%d/download", job.ID),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", exportContentType(format))
+
+	// Большая выгрузка пишется дольше server.write_timeout
+	if timeout := api.services.Export.StreamTimeout; timeout > 0 {
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			slog.WarnContext(c.Request.Context(), "Не удалось продлить срок записи выгрузки", "error", err)
+		}
+	}
+	c.Status(http.StatusOK)
+
+	if _, err := writeExport(dataset, filter, format, c.Writer); err != nil {
+		// Заголовки уже отправлены, сообщить клиенту об ошибке можно
+		// только оборвав соединение, иначе обрезанный файл сойдет за полный
+		slog.ErrorContext(c.Request.Context(), "Ошибка выгрузки", "dataset", name, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportDir возвращает каталог для файлов фоновых выгрузок
+func exportDir(cfg ExportConfig) string {
+	if dir := cfg.Dir; dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "parking-exports")
+}
+
+// runExportCleanup раз в час удаляет фоновые выгрузки старше cfg.Retention:
+// файлы завершенных задач вместе с задачами и осиротевшие файлы в каталоге
+// (например, оставшиеся после падения посреди выгрузки)
+func runExportCleanup(ctx context.Context, cfg ExportConfig) {
+	for now := range ticks(ctx, time.Hour) {
+		cleanupExports(exportDir(cfg), now.Add(-cfg.Retention))
+	}
+}
+
+func cleanupExports(dir string, before time.Time) {
+	var jobs []ExportJob
+	if err := db.Where("finished_at <= ?", before).Find(&jobs).Error; err != nil {
+		slog.Error("Не удалось получить устаревшие выгрузки", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		if job.FilePath != "" {
+			if err := os.Remove(job.FilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				slog.Error("Не удалось удалить файл выгрузки", "job_id", job.ID, "error", err)
+				continue
+			}
+		}
+		db.Delete(&job)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("Не удалось прочитать каталог выгрузок", "dir", dir, "error", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			slog.Error("Не удалось удалить файл выгрузки", "file", entry.Name(), "error", err)
+		}
+	}
+}
+
+func runExportJob(dir string, job ExportJob, dataset exportDataset, filter exportFilter) {
+	db.Model(&job).Update("status", ExportStatusRunning)
+
+	finish := func(rows int, err error) {
+		now := time.Now()
+		updates := map[string]interface{}{"status": ExportStatusDone, "rows": rows, "file_path": job.FilePath, "finished_at": now}
+		if err != nil {
+			slog.Error("Фоновая выгрузка не удалась", "job_id", job.ID, "error", err)
+			updates["status"] = ExportStatusFailed
+			updates["error"] = err.Error()
+		}
+		db.Model(&job).Updates(updates)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		finish(0, err)
+		return
+	}
+	job.FilePath = filepath.Join(dir, fmt.Sprintf("export-%d.%s", job.ID, job.Format))
+	file, err := os.Create(job.FilePath)
+	if err != nil {
+		finish(0, err)
+		return
+	}
+	defer file.Close()
+
+	rows, err := writeExport(dataset, filter, job.Format, file)
+	finish(rows, err)
+}
+
+func GetExportJob(c *gin.Context) {
+	var job ExportJob
+	if err := db.Where("user_id = ?", c.GetUint("user_id")).First(&job, c.Param("id")).Error; err != nil {
+		respondError(c, CodeExportNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func DownloadExportJob(c *gin.Context) {
+	var job ExportJob
+	if err := db.Where("user_id = ?", c.GetUint("user_id")).First(&job, c.Param("id")).Error; err != nil {
+		respondError(c, CodeExportNotFound)
+		return
+	}
+
+	if job.Status != ExportStatusDone {
+		writeError(c, &APIError{Code: CodeExportNotReady, Extra: gin.H{"status": job.Status}})
+		return
+	}
+
+	c.Header("Content-Type", exportContentType(job.Format))
+	c.FileAttachment(job.FilePath, fmt.Sprintf("%s-%d.%s", job.Dataset, job.ID, job.Format))
+}
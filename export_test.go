@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestEscapeCSVFormula(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"А123ВС77", "А123ВС77"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+7 900", "'+7 900"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := escapeCSVFormula(tt.in); got != tt.want {
+			t.Errorf("%q: %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatExportValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, ""},
+		{time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC), "2026-10-01T12:30:00Z"},
+		{[]byte("cash"), "cash"},
+		{150.5, "150.5"},
+		{-200.0, "-200"},
+		{int64(42), "42"},
+	}
+	for _, tt := range tests {
+		if got := formatExportValue(tt.in); got != tt.want {
+			t.Errorf("%#v: %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseExportFilter(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query     string
+		wantFrom  *time.Time
+		wantTo    bool
+		wantID    string
+		wantError bool
+	}{
+		{"", nil, false, "", false},
+		{"from=2026-10-01T00:00:00Z&parking_id=3", &from, false, "3", false},
+		{"to=2026-10-02T00:00:00%2B03:00", nil, true, "", false},
+		{"from=2026-10-01", nil, false, "", true},
+	}
+	for _, tt := range tests {
+		values, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parseExportFilter(values)
+		if (err != nil) != tt.wantError {
+			t.Errorf("%q: ошибка %v", tt.query, err)
+			continue
+		}
+		if tt.wantError {
+			continue
+		}
+		if (f.From == nil) != (tt.wantFrom == nil) || (f.From != nil && !f.From.Equal(*tt.wantFrom)) ||
+			(f.To != nil) != tt.wantTo || f.ParkingID != tt.wantID {
+			t.Errorf("%q: %+v", tt.query, f)
+		}
+	}
+}
+
+func TestTableWriters(t *testing.T) {
+	header := []string{"plate", "amount", "time", "note"}
+	rows := [][]interface{}{
+		{"=1+1", -150.5, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), nil},
+		{[]byte("@cmd"), int64(100), time.Date(2026, 10, 1, 15, 0, 0, 0, time.FixedZone("MSK", 3*60*60)), "ok"},
+	}
+	// Текст экранируется, числа - нет
+	want := [][]string{
+		header,
+		{"'=1+1", "-150.5", "2026-10-01T12:00:00Z", ""},
+		{"'@cmd", "100", "2026-10-01T15:00:00+03:00", "ok"},
+	}
+
+	tests := []struct {
+		format string
+		read   func(t *testing.T, data []byte) [][]string
+	}{
+		{ExportFormatCSV, func(t *testing.T, data []byte) [][]string {
+			records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return records
+		}},
+		{ExportFormatXLSX, func(t *testing.T, data []byte) [][]string {
+			file, err := excelize.OpenReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			records, err := file.GetRows("Sheet1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return records
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			w, err := newTableWriter(tt.format, &out, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				if err := w.WriteRow(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := tt.read(t, out.Bytes())
+			if len(got) != len(want) {
+				t.Fatalf("%d строк, ожидалось %d: %q", len(got), len(want), got)
+			}
+			// В XLSX текст не экранируется, а значения остаются типизированными
+			if tt.format == ExportFormatXLSX {
+				if got[1][0] != "=1+1" || got[1][1] != "-150.5" || got[2][1] != "100" {
+					t.Errorf("строки %q", got[1:])
+				}
+				return
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%q, ожидалось %q", got, want)
+			}
+		})
+	}
+}
+
+// exportFixture две парковки со стоянками, одна из них еще не закончена
+func exportFixture(t *testing.T) (Parking, time.Time) {
+	t.Helper()
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	user := User{Name: "Водитель", Email: "driver@example.com", Password: "x", Role: UserRoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	car := Vehicle{LicensePlate: "=А123ВС77", OwnerID: user.ID}
+	if err := db.Create(&car).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var first Parking
+	for i, entryTimes := range [][]time.Time{
+		{day.Add(9 * time.Hour), day.AddDate(0, 0, 1).Add(9 * time.Hour)},
+		{day.Add(10 * time.Hour)},
+	} {
+		parking := Parking{Name: fmt.Sprintf("Выгрузка %d", i), Capacity: 1}
+		if err := db.Create(&parking).Error; err != nil {
+			t.Fatal(err)
+		}
+		spot := Spot{ParkingID: parking.ID, Number: fmt.Sprintf("P%d", i)}
+		if err := db.Create(&spot).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, at := range entryTimes {
+			if err := db.Create(&Entry{SpotID: spot.ID, VehicleID: car.ID, EntryTime: at}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i == 0 {
+			first = parking
+		}
+	}
+	return first, day
+}
+
+func TestExport(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, nil)
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	parking, day := exportFixture(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantRows int
+	}{
+		{"все въезды", "", 3},
+		{"одна парковка", fmt.Sprintf("parking_id=%d", parking.ID), 2},
+		{"период", "from=" + url.QueryEscape(day.Format(time.RFC3339)) + "&to=" + url.QueryEscape(day.Add(24*time.Hour).Format(time.RFC3339)), 2},
+		{"парковка и период", fmt.Sprintf("parking_id=%d&from=%s", parking.ID, url.QueryEscape(day.Add(12*time.Hour).Format(time.RFC3339))), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodGet, "/api/v1/exports/entries?"+tt.query, admin, nil)
+			s.expect(w, http.StatusOK, nil)
+			if ct := w.Header().Get("Content-Type"); ct != exportContentType(ExportFormatCSV) {
+				t.Errorf("Content-Type %q", ct)
+			}
+			records, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.wantRows+1 || strings.Join(records[0], ",") != strings.Join(exportDatasets["entries"].Header, ",") {
+				t.Fatalf("%q, ожидалось %d строк с заголовком", records, tt.wantRows)
+			}
+			for _, r := range records[1:] {
+				if r[3] != "'=А123ВС77" || r[5] != "" {
+					t.Errorf("строка %q: номер не экранирован или выезд не пуст", r)
+				}
+			}
+		})
+	}
+
+	failures := []struct {
+		path   string
+		status int
+		code   ErrorCode
+	}{
+		{"/api/v1/exports/users", http.StatusNotFound, CodeUnknownDataset},
+		{"/api/v1/exports/entries?format=pdf", http.StatusBadRequest, CodeUnsupportedExportFormat},
+		{"/api/v1/exports/entries?from=yesterday", http.StatusBadRequest, CodeValidationFailed},
+	}
+	for _, tt := range failures {
+		s.expectError(s.do(http.MethodGet, tt.path, admin, nil), tt.status, tt.code)
+	}
+}
+
+// Фоновая выгрузка пишет файл в каталог выгрузок и отдается только автору
+func TestExportAsync(t *testing.T) {
+	testDB(t)
+	dir := t.TempDir()
+	s := newTestServer(t, nil, func(cfg *Config) { cfg.Export.Dir = dir })
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	s.createUser("other@example.com", "secret123", UserRoleAdmin)
+	other := s.login("other@example.com", "secret123")
+	exportFixture(t)
+
+	var accepted ExportJobAccepted
+	s.expect(s.do(http.MethodGet, "/api/v1/exports/entries?async=true&format=xlsx", admin, nil), http.StatusAccepted, &accepted)
+	background.Wait()
+
+	var job ExportJob
+	s.expect(s.do(http.MethodGet, accepted.StatusURL, admin, nil), http.StatusOK, &job)
+	if job.Status != ExportStatusDone || job.Rows != 3 || job.Format != ExportFormatXLSX {
+		t.Fatalf("задача %+v, ожидалась выполненная на 3 строки", job)
+	}
+	s.expectError(s.do(http.MethodGet, accepted.StatusURL, other, nil), http.StatusNotFound, CodeExportNotFound)
+	s.expectError(s.do(http.MethodGet, accepted.DownloadURL, other, nil), http.StatusNotFound, CodeExportNotFound)
+
+	w := s.do(http.MethodGet, accepted.DownloadURL, admin, nil)
+	s.expect(w, http.StatusOK, nil)
+	file, err := excelize.OpenReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if rows, _ := file.GetRows("Sheet1"); len(rows) != 4 {
+		t.Errorf("в файле %d строк, ожидалось 4", len(rows))
+	}
+
+	// Незаконченная задача не скачивается
+	queued := ExportJob{UserID: job.UserID, Dataset: "entries", Format: ExportFormatCSV, Status: ExportStatusQueued}
+	if err := db.Create(&queued).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.expectError(s.do(http.MethodGet, fmt.Sprintf("/api/v1/export-jobs/%d/download", queued.ID), admin, nil), http.StatusConflict, CodeExportNotReady)
+}
+
+func TestCleanupExports(t *testing.T) {
+	testDB(t)
+	dir := t.TempDir()
+	now := time.Now()
+	old, fresh := now.Add(-48*time.Hour), now.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		job         bool // Файл задачи, а не осиротевший
+		modified    time.Time
+		wantRemoved bool
+	}{
+		{"старая задача", true, old, true},
+		{"свежая задача", true, fresh, false},
+		{"старый осиротевший файл", false, old, true},
+		{"свежий осиротевший файл", false, fresh, false},
+	}
+	paths := make([]string, len(tests))
+	jobs := make([]ExportJob, len(tests))
+	for i, tt := range tests {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("export-%d.csv", i))
+		if err := os.WriteFile(paths[i], []byte("id\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(paths[i], tt.modified, tt.modified); err != nil {
+			t.Fatal(err)
+		}
+		if tt.job {
+			finished := tt.modified
+			jobs[i] = ExportJob{Dataset: "entries", Format: ExportFormatCSV, Status: ExportStatusDone, FilePath: paths[i], FinishedAt: &finished}
+			if err := db.Create(&jobs[i]).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cleanupExports(dir, now.Add(-24*time.Hour))
+
+	for i, tt := range tests {
+		_, err := os.Stat(paths[i])
+		if removed := os.IsNotExist(err); removed != tt.wantRemoved {
+			t.Errorf("%s: файл удален %v, ожидалось %v", tt.name, removed, tt.wantRemoved)
+		}
+		if tt.job {
+			var count int64
+			db.Model(&ExportJob{}).Where("id = ?", jobs[i].ID).Count(&count)
+			if removed := count == 0; removed != tt.wantRemoved {
+				t.Errorf("%s: задача удалена %v, ожидалось %v", tt.name, removed, tt.wantRemoved)
+			}
+		}
+	}
+}
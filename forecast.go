@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// forecastHistory - за какой период строится сезонный профиль (8 недель)
+	forecastHistory  = 8 * 7 * 24 * time.Hour
+	forecastMinHours = 24
+	forecastMaxHours = 72
+	// forecastTrendDecay - за сколько часов (постоянная затухания) текущее
+	// отклонение от профиля сходит на нет
+	forecastTrendDecay = 6.0
+	// holidayProfile - индекс профиля праздничных дней после семи дней недели
+	holidayProfile = 7
+)
+
+// forecastHorizons - горизонты, прогнозы на которые сохраняются для сверки с фактом
+var forecastHorizons = []int{1, 3, 6, 12, 24, 48, 72}
+
+// ForecastPoint прогноз на один час
+type ForecastPoint struct {
+	Time              time.Time `json:"time"`
+	PredictedFree     float64   `json:"predicted_free"`
+	PredictedOccupied float64   `json:"predicted_occupied"`
+}
+
+// occupancyProfile среднее число занятых мест по дню недели (и праздникам) и часу
+type occupancyProfile struct {
+	sum   [8][24]float64
+	count [8][24]int
+}
+
+func dayProfile(t time.Time, holidays map[string]bool) int {
+	if holidays[t.Format("2006-01-02")] {
+		return holidayProfile
+	}
+	return int(t.Weekday())
+}
+
+func (p *occupancyProfile) add(t time.Time, holidays map[string]bool, occupied float64) {
+	day := dayProfile(t, holidays)
+	p.sum[day][t.Hour()] += occupied
+	p.count[day][t.Hour()]++
+}
+
+// at возвращает ожидаемое число занятых мест в момент t. Пока праздников в
+// истории нет, праздник считается воскресеньем.
+func (p *occupancyProfile) at(t time.Time, holidays map[string]bool) (float64, bool) {
+	day, hour := dayProfile(t, holidays), t.Hour()
+	if day == holidayProfile && p.count[day][hour] == 0 {
+		day = int(time.Sunday)
+	}
+	if p.count[day][hour] == 0 {
+		return 0, false
+	}
+	return p.sum[day][hour] / float64(p.count[day][hour]), true
+}
+
+// loadHolidays возвращает праздники парковки (и общие) в виде множества дат
+func loadHolidays(parkingID uint) (map[string]bool, error) {
+	var holidays []Holiday
+	if err := db.Where("parking_id IS NULL OR parking_id = ?", parkingID).Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+	dates := make(map[string]bool, len(holidays))
+	for _, h := range holidays {
+		dates[h.Date] = true
+	}
+	return dates, nil
+}
+
+// forecastParking прогнозирует свободные места на hours часов вперед.
+// Основа прогноза - среднее по почасовым сводкам за forecastHistory для того
+// же дня недели и часа. Текущее отклонение от профиля переносится на
+// ближайшие часы и затухает экспоненциально.
+func forecastParking(parking Parking, now time.Time, hours int) ([]ForecastPoint, int, error) {
+	loc := parkingLocation(parking)
+
+	var spots int64
+	if err := db.Model(&Spot{}).Where("parking_id = ?", parking.ID).Count(&spots).Error; err != nil {
+		return nil, 0, err
+	}
+	var occupiedNow int64
+	if err := db.Model(&Spot{}).Where("parking_id = ? AND is_occupied = ?", parking.ID, true).Count(&occupiedNow).Error; err != nil {
+		return nil, 0, err
+	}
+
+	holidays, err := loadHolidays(parking.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rollups []HourlyRollup
+	if err := db.Where("parking_id = ? AND bucket_start >= ? AND bucket_start < ?", parking.ID, now.Add(-forecastHistory), now).
+		Find(&rollups).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var profile occupancyProfile
+	for _, r := range rollups {
+		profile.add(r.BucketStart.In(loc), holidays, r.OccupancyMinutes/60)
+	}
+
+	start := truncateToBucket(now, GranularityHour, loc)
+	deviation := 0.0
+	if baseline, ok := profile.at(start, holidays); ok {
+		deviation = float64(occupiedNow) - baseline
+	}
+
+	points := make([]ForecastPoint, 0, hours)
+	for h := 1; h <= hours; h++ {
+		t := start.Add(time.Duration(h) * time.Hour)
+		occupied, ok := profile.at(t, holidays)
+		if !ok {
+			// Истории нет - считаем, что заполненность не изменится
+			occupied = float64(occupiedNow)
+		} else {
+			occupied += deviation * math.Exp(-float64(h)/forecastTrendDecay)
+		}
+		occupied = math.Max(0, math.Min(float64(spots), occupied))
+
+		points = append(points, ForecastPoint{
+			Time:              t,
+			PredictedOccupied: math.Round(occupied*10) / 10,
+			PredictedFree:     math.Round((float64(spots)-occupied)*10) / 10,
+		})
+	}
+
+	return points, int(spots), nil
+}
+
+// ForecastResponse прогноз свободных мест по часам
+type ForecastResponse struct {
+	ParkingID   uint            `json:"parking_id"`
+	Spots       int             `json:"spots"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Points      []ForecastPoint `json:"points"`
+}
+
+func GetForecast(c *gin.Context) {
+	id := c.Param("id")
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(forecastMinHours)))
+	if err != nil || hours < 1 || hours > forecastMaxHours {
+		respondError(c, CodeInvalidForecastHours)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, id).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	now := time.Now()
+	points, spots, err := forecastParking(parking, now, hours)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeForecastFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, ForecastResponse{
+		ParkingID:   parking.ID,
+		Spots:       spots,
+		GeneratedAt: now,
+		Points:      points,
+	})
+}
+
+// ForecastAccuracy точность прогнозов с одним горизонтом
+type ForecastAccuracy struct {
+	HorizonHours int     `json:"horizon_hours"`
+	Samples      int     `json:"samples"`
+	MAE          float64 `json:"mae"`  // Средняя абсолютная ошибка, мест
+	Bias         float64 `json:"bias"` // Средняя ошибка со знаком: > 0 - прогноз завышает свободные места
+}
+
+// GetForecastAccuracy сравнивает сохраненные прогнозы с фактом по горизонтам
+func GetForecastAccuracy(c *gin.Context) {
+	id := c.Param("id")
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 {
+		respondError(c, CodeInvalidDays)
+		return
+	}
+
+	var results []ForecastAccuracy
+
+	if err := db.Model(&Forecast{}).
+		Select("horizon_hours, COUNT(*) AS samples, AVG(ABS(predicted_free - actual_free)) AS mae, AVG(predicted_free - actual_free) AS bias").
+		Where("parking_id = ? AND actual_free IS NOT NULL AND target_time >= ?", id, time.Now().AddDate(0, 0, -days)).
+		Group("horizon_hours").
+		Order("horizon_hours").
+		Scan(&results).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeForecastAccuracyFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+type CreateHolidayRequest struct {
+	Date      string `json:"date" binding:"required,datetime=2006-01-02"`
+	Name      string `json:"name" binding:"required"`
+	ParkingID *uint  `json:"parking_id"`
+}
+
+func CreateHoliday(c *gin.Context) {
+	var input CreateHolidayRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	holiday := Holiday{Date: input.Date, Name: input.Name, ParkingID: input.ParkingID}
+	if err := db.Create(&holiday).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeHolidayCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, holiday)
+}
+
+func GetHolidays(c *gin.Context) {
+	var holidays []Holiday
+	if err := db.Order("date").Find(&holidays).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeHolidaysListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, holidays)
+}
+
+// runForecastJobs раз в час сохраняет прогнозы на контрольные горизонты и
+// проставляет факт для прогнозов, чей час уже прошел и попал в сводки
+func runForecastJobs(ctx context.Context) {
+	for now := range ticks(ctx, time.Hour) {
+		var parkings []Parking
+		if err := db.Find(&parkings).Error; err != nil {
+			slog.Error("Не удалось получить парковки для прогноза", "error", err)
+			continue
+		}
+
+		for _, parking := range parkings {
+			if err := recordForecasts(parking, now); err != nil {
+				slog.Error("Не удалось сохранить прогноз", "parking_id", parking.ID, "error", err)
+			}
+			if err := fillForecastActuals(parking, now); err != nil {
+				slog.Error("Не удалось сверить прогноз", "parking_id", parking.ID, "error", err)
+			}
+		}
+	}
+}
+
+func recordForecasts(parking Parking, now time.Time) error {
+	points, _, err := forecastParking(parking, now, forecastMaxHours)
+	if err != nil {
+		return err
+	}
+
+	forecasts := make([]Forecast, 0, len(forecastHorizons))
+	for _, h := range forecastHorizons {
+		p := points[h-1]
+		forecasts = append(forecasts, Forecast{
+			ParkingID:     parking.ID,
+			TargetTime:    p.Time,
+			HorizonHours:  h,
+			PredictedFree: p.PredictedFree,
+		})
+	}
+	return db.Create(&forecasts).Error
+}
+
+func fillForecastActuals(parking Parking, now time.Time) error {
+	var spots int64
+	if err := db.Model(&Spot{}).Where("parking_id = ?", parking.ID).Count(&spots).Error; err != nil {
+		return err
+	}
+
+	// Час считается закрытым, когда фоновая агрегация гарантированно его пересчитала
+	var pending []Forecast
+	if err := db.Where("parking_id = ? AND actual_free IS NULL AND target_time <= ?", parking.ID, now.Add(-time.Hour-rollupLookback)).
+		Find(&pending).Error; err != nil {
+		return err
+	}
+
+	for _, f := range pending {
+		var rollup HourlyRollup
+		if err := db.Where("parking_id = ? AND bucket_start = ?", parking.ID, f.TargetTime).First(&rollup).Error; err != nil {
+			continue
+		}
+		actual := float64(spots) - rollup.OccupancyMinutes/60
+		if err := db.Model(&f).Update("actual_free", actual).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOccupancyProfile(t *testing.T) {
+	wednesday := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	sunday := time.Date(2026, 10, 11, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		history  map[time.Time]float64
+		holidays map[string]bool
+		want     float64
+		wantOK   bool
+	}{
+		{"среднее за тот же день недели и час", map[time.Time]float64{
+			wednesday.AddDate(0, 0, -7): 2, wednesday.AddDate(0, 0, -14): 4, sunday: 10,
+		}, nil, 3, true},
+		{"нет истории за этот час", map[time.Time]float64{wednesday.AddDate(0, 0, -7).Add(time.Hour): 2}, nil, 0, false},
+		{"праздник без истории праздников - как воскресенье", map[time.Time]float64{
+			wednesday.AddDate(0, 0, -7): 2, sunday: 10,
+		}, map[string]bool{"2026-10-14": true}, 10, true},
+		{"праздник по истории праздников", map[time.Time]float64{
+			wednesday.AddDate(0, 0, -7): 7, wednesday.AddDate(0, 0, -14): 2, sunday: 10,
+		}, map[string]bool{"2026-10-14": true, "2026-10-07": true}, 7, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var profile occupancyProfile
+			for at, occupied := range tt.history {
+				profile.add(at, tt.holidays, occupied)
+			}
+			got, ok := profile.at(wednesday, tt.holidays)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("%v, %v; ожидалось %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// forecastFixture парковка на 4 места, occupied из которых заняты сейчас, с
+// историей сводок за 8 недель: по средам в 10, 11 и 12 часов заняты 2, 3 и 1
+// место, по воскресеньям в 11 - ни одного
+func forecastFixture(t *testing.T, now time.Time, occupied int, holidays ...string) Parking {
+	t.Helper()
+	parking := Parking{Name: fmt.Sprintf("Прогноз %d", occupied), Capacity: 4, TimeZone: "UTC"}
+	if err := db.Create(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		spot := Spot{ParkingID: parking.ID, Number: fmt.Sprint(i), IsOccupied: i < occupied}
+		if err := db.Create(&spot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wednesday := truncateToBucket(now, GranularityDay, time.UTC)
+	var rollups []HourlyRollup
+	for week := 1; week <= 8; week++ {
+		day := wednesday.AddDate(0, 0, -7*week)
+		for hour, minutes := range map[int]float64{10: 120, 11: 180, 12: 60} {
+			rollups = append(rollups, HourlyRollup{ParkingID: parking.ID, BucketStart: day.Add(time.Duration(hour) * time.Hour), OccupancyMinutes: minutes})
+		}
+		rollups = append(rollups, HourlyRollup{ParkingID: parking.ID, BucketStart: day.AddDate(0, 0, -3).Add(11 * time.Hour)})
+	}
+	if err := db.Create(&rollups).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, date := range holidays {
+		if err := db.Create(&Holiday{Date: date, Name: "Праздник", ParkingID: &parking.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return parking
+}
+
+func TestForecastParking(t *testing.T) {
+	testDB(t)
+	now := time.Date(2026, 10, 14, 10, 20, 0, 0, time.UTC) // Среда
+
+	tests := []struct {
+		name     string
+		occupied int
+		holidays []string
+		want     []float64 // Свободных мест в 11, 12 и 13 часов
+	}{
+		// В 13 часов истории нет - заполненность как сейчас
+		{"как обычно", 2, nil, []float64{1, 3, 2}},
+		// Отклонение +2 затухает: в 11 - 3+1,69 мест, но не больше 4, в 12 - 1+1,43
+		{"загружена больше обычного", 4, nil, []float64{0, 1.6, 0}},
+		// Отклонение -2: в 12 - 1-1,43 мест, но не меньше нуля
+		{"загружена меньше обычного", 0, nil, []float64{2.7, 4, 4}},
+		// Праздник без истории праздников считается воскресеньем: в 11 пусто,
+		// в 12 и 13 истории нет
+		{"праздник", 2, []string{"2026-10-14"}, []float64{4, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parking := forecastFixture(t, now, tt.occupied, tt.holidays...)
+			points, spots, err := forecastParking(parking, now, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spots != 4 || len(points) != 3 {
+				t.Fatalf("%d мест и %d точек, ожидалось 4 и 3", spots, len(points))
+			}
+			for i, p := range points {
+				if want := now.Truncate(time.Hour).Add(time.Duration(i+1) * time.Hour); !p.Time.Equal(want) {
+					t.Errorf("точка %d на %s, ожидалось %s", i, p.Time, want)
+				}
+				if p.PredictedFree != tt.want[i] || p.PredictedFree+p.PredictedOccupied != 4 {
+					t.Errorf("%s: свободно %v, занято %v; ожидалось свободно %v", p.Time.Format("15:04"), p.PredictedFree, p.PredictedOccupied, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// Прогнозы сохраняются на контрольные горизонты, а факт проставляется,
+// когда час попал в сводки с запасом на поздние выезды
+func TestForecastActuals(t *testing.T) {
+	testDB(t)
+	now := time.Date(2026, 10, 14, 10, 20, 0, 0, time.UTC)
+	parking := forecastFixture(t, now, 2)
+	if err := recordForecasts(parking, now); err != nil {
+		t.Fatal(err)
+	}
+	var saved int64
+	db.Model(&Forecast{}).Where("parking_id = ?", parking.ID).Count(&saved)
+	if int(saved) != len(forecastHorizons) {
+		t.Fatalf("сохранено %d прогнозов, ожидалось %d", saved, len(forecastHorizons))
+	}
+
+	// Факт за 11 часов: занято 3 места
+	target := time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)
+	if err := db.Create(&HourlyRollup{ParkingID: parking.ID, BucketStart: target, OccupancyMinutes: 180}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want int64 // Прогнозов с фактом
+	}{
+		{target.Add(time.Hour + rollupLookback - time.Minute), 0},
+		{target.Add(time.Hour + rollupLookback), 1},
+		{target.Add(100 * time.Hour), 1}, // Сводок за остальные часы нет
+	}
+	for _, tt := range tests {
+		if err := fillForecastActuals(parking, tt.now); err != nil {
+			t.Fatal(err)
+		}
+		var filled []Forecast
+		db.Where("parking_id = ? AND actual_free IS NOT NULL", parking.ID).Find(&filled)
+		if int64(len(filled)) != tt.want {
+			t.Fatalf("в %s факт у %d прогнозов, ожидалось %d", tt.now.Format("15:04"), len(filled), tt.want)
+		}
+		for _, f := range filled {
+			if !f.TargetTime.Equal(target) || f.HorizonHours != 1 || *f.ActualFree != 1 {
+				t.Errorf("прогноз %+v, ожидался факт 1 на %s", f, target)
+			}
+		}
+	}
+}
+
+func TestGetForecastAccuracy(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, nil)
+	s.createUser("driver@example.com", "secret123", UserRoleUser)
+	token := s.login("driver@example.com", "secret123")
+
+	actual := func(v float64) *float64 { return &v }
+	recent := time.Now().Add(-time.Hour)
+	forecasts := []Forecast{
+		{ParkingID: 1, HorizonHours: 1, TargetTime: recent, PredictedFree: 3, ActualFree: actual(2)},
+		{ParkingID: 1, HorizonHours: 1, TargetTime: recent, PredictedFree: 1, ActualFree: actual(2)},
+		{ParkingID: 1, HorizonHours: 3, TargetTime: recent, PredictedFree: 4, ActualFree: actual(2)},
+		{ParkingID: 1, HorizonHours: 3, TargetTime: recent, PredictedFree: 4},                                          // Факта еще нет
+		{ParkingID: 1, HorizonHours: 3, TargetTime: recent.AddDate(0, 0, -8), PredictedFree: 0, ActualFree: actual(4)}, // Старше периода
+		{ParkingID: 2, HorizonHours: 1, TargetTime: recent, PredictedFree: 0, ActualFree: actual(4)},                   // Другая парковка
+	}
+	if err := db.Create(&forecasts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []ForecastAccuracy
+	s.expect(s.do(http.MethodGet, "/api/v1/parkings/1/forecast/accuracy", token, nil), http.StatusOK, &got)
+	want := []ForecastAccuracy{{HorizonHours: 1, Samples: 2, MAE: 1, Bias: 0}, {HorizonHours: 3, Samples: 1, MAE: 2, Bias: 2}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%+v, ожидалось %+v", got, want)
+	}
+
+	tests := []struct {
+		path string
+		code ErrorCode
+	}{
+		{"/api/v1/parkings/1/forecast?hours=0", CodeInvalidForecastHours},
+		{fmt.Sprintf("/api/v1/parkings/1/forecast?hours=%d", forecastMaxHours+1), CodeInvalidForecastHours},
+		{"/api/v1/parkings/1/forecast/accuracy?days=0", CodeInvalidDays},
+	}
+	for _, tt := range tests {
+		s.expectError(s.do(http.MethodGet, tt.path, token, nil), http.StatusBadRequest, tt.code)
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Протокол контроллеров шлагбаумов.
+//
+// Устройство подключается к серверу по TCP и обменивается кадрами GateFrame,
+// по одному JSON-объекту на строку. Первым кадром устройство отправляет
+// connect со своим device_id и секретом, выданным при создании полосы;
+// сервер отвечает connack с ID полосы. Дальше
+// сервер публикует команды (open, close, hold_open), а устройство отвечает
+// ack с тем же seq и присылает события (vehicle_present, vehicle_passed,
+// gate_stuck). ping/pong поддерживают соединение живым.
+
+// Типы кадров
+const (
+	gateFrameConnect = "connect"
+	gateFrameConnAck = "connack"
+	gateFrameCommand = "command"
+	gateFrameAck     = "ack"
+	gateFrameEvent   = "event"
+	gateFramePing    = "ping"
+	gateFramePong    = "pong"
+)
+
+// Команды шлагбауму
+const (
+	GateCommandOpen     = "open"
+	GateCommandClose    = "close"
+	GateCommandHoldOpen = "hold_open"
+)
+
+// События от шлагбаума
+const (
+	GateEventVehiclePresent = "vehicle_present"
+	GateEventVehiclePassed  = "vehicle_passed"
+	GateEventGateStuck      = "gate_stuck"
+)
+
+// Состояния полосы
+const (
+	LaneStatusOffline  = "offline"
+	LaneStatusClosed   = "closed"
+	LaneStatusOpen     = "open"
+	LaneStatusHeldOpen = "held_open"
+	LaneStatusStuck    = "stuck"
+)
+
+// gateKeepAlive - сколько сервер ждет кадра от устройства, прежде чем
+// считать его отключившимся
+const gateKeepAlive = 60 * time.Second
+
+// GateFrame кадр протокола шлагбаумов
+type GateFrame struct {
+	Type        string    `json:"type"`
+	DeviceID    string    `json:"device_id,omitempty"`
+	Secret      string    `json:"secret,omitempty"` // Только в connect
+	LaneID      uint      `json:"lane_id,omitempty"`
+	Seq         uint64    `json:"seq,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	HoldSeconds int       `json:"hold_seconds,omitempty"`
+	Event       string    `json:"event,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	OK          bool      `json:"ok,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+var (
+	errGateOffline        = errors.New("шлагбаум не подключен")
+	errGateUnknownCommand = errors.New("неизвестная команда шлагбаума")
+)
+
+// gateConn подключение одного контроллера
+type gateConn struct {
+	laneID uint
+	conn   net.Conn
+	mu     sync.Mutex
+	enc    *json.Encoder
+	seq    uint64
+}
+
+func (g *gateConn) send(frame GateFrame) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if frame.Type == gateFrameCommand {
+		g.seq++
+		frame.Seq = g.seq
+	}
+	frame.Time = time.Now()
+	return g.enc.Encode(frame)
+}
+
+// gateHub хранит подключенные контроллеры по ID полосы
+type gateHub struct {
+	mu    sync.Mutex
+	conns map[uint]*gateConn
+	// holds таймеры снятия удержания по ID полосы; новая команда полосе
+	// отменяет таймер прежней
+	holds  map[uint]*time.Timer
+	ln     net.Listener
+	closed bool
+}
+
+var gates = &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+
+// ListenAndServe принимает подключения контроллеров на addr
+func (h *gateHub) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	h.ln = ln
+	h.mu.Unlock()
+
+	slog.Info("Сервер шлагбаумов запущен", "addr", addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		goBackground(func() { h.handleConn(conn) })
+	}
+}
+
+// Close перестает принимать подключения и отключает контроллеры. Полосы
+// переходят в offline, после переподключения статус восстанавливается.
+func (h *gateHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.ln != nil {
+		h.ln.Close()
+	}
+	for _, gc := range h.conns {
+		gc.conn.Close()
+	}
+}
+
+func (h *gateHub) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewScanner(conn)
+	gc := &gateConn{conn: conn, enc: json.NewEncoder(conn)}
+
+	conn.SetReadDeadline(time.Now().Add(gateKeepAlive))
+	var hello GateFrame
+	if !reader.Scan() || json.Unmarshal(reader.Bytes(), &hello) != nil || hello.Type != gateFrameConnect {
+		slog.Warn("Шлагбаум: ожидался кадр connect", "remote_addr", conn.RemoteAddr().String())
+		return
+	}
+
+	// Неизвестному устройству и неверному секрету ответ одинаковый, чтобы
+	// по нему нельзя было подбирать device_id
+	var lane Lane
+	if err := db.Where("device_id = ?", hello.DeviceID).First(&lane).Error; err != nil || !lane.checkDeviceSecret(hello.Secret) {
+		gc.send(GateFrame{Type: gateFrameConnAck, OK: false, Detail: "неизвестное устройство или неверный секрет"})
+		slog.Warn("Шлагбаум: подключение отклонено", "remote_addr", conn.RemoteAddr().String(), "device_id", hello.DeviceID)
+		return
+	}
+	gc.laneID = lane.ID
+
+	h.mu.Lock()
+	if old, ok := h.conns[lane.ID]; ok {
+		old.conn.Close()
+	}
+	h.conns[lane.ID] = gc
+	h.mu.Unlock()
+
+	defer func() {
+		// После переподключения полосой владеет новое соединение: старое не
+		// должно переводить ее в offline
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.conns[lane.ID] == gc {
+			delete(h.conns, lane.ID)
+			h.stopHold(lane.ID)
+			updateLaneStatus(lane.ID, LaneStatusOffline)
+		}
+	}()
+
+	if err := gc.send(GateFrame{Type: gateFrameConnAck, OK: true, LaneID: lane.ID}); err != nil {
+		return
+	}
+	updateLaneStatus(lane.ID, LaneStatusClosed)
+	slog.Info("Шлагбаум подключен", "device_id", hello.DeviceID, "lane_id", lane.ID)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(gateKeepAlive))
+		if !reader.Scan() {
+			break
+		}
+		var frame GateFrame
+		if err := json.Unmarshal(reader.Bytes(), &frame); err != nil {
+			slog.Warn("Шлагбаум: некорректный кадр", "lane_id", lane.ID, "error", err)
+			continue
+		}
+		h.handleFrame(gc, frame)
+	}
+	slog.Info("Шлагбаум отключен", "device_id", hello.DeviceID, "lane_id", lane.ID)
+}
+
+func (h *gateHub) handleFrame(gc *gateConn, frame GateFrame) {
+	switch frame.Type {
+	case gateFramePing:
+		gc.send(GateFrame{Type: gateFramePong})
+		touchLane(gc.laneID)
+	case gateFrameAck:
+		if !frame.OK {
+			recordGateEvent(gc.laneID, gateFrameAck, fmt.Sprintf("команда %d не выполнена: %s", frame.Seq, frame.Detail))
+			return
+		}
+		switch frame.Command {
+		case GateCommandOpen:
+			updateLaneStatus(gc.laneID, LaneStatusOpen)
+		case GateCommandHoldOpen:
+			updateLaneStatus(gc.laneID, LaneStatusHeldOpen)
+		case GateCommandClose:
+			updateLaneStatus(gc.laneID, LaneStatusClosed)
+		}
+	case gateFrameEvent:
+		recordGateEvent(gc.laneID, frame.Event, frame.Detail)
+		switch frame.Event {
+		case GateEventVehiclePassed:
+			// Машина проехала - закрываем шлагбаум, если его не держат открытым
+			var lane Lane
+			if err := db.First(&lane, gc.laneID).Error; err == nil && lane.Status == LaneStatusOpen {
+				h.Send(gc.laneID, GateCommandClose, 0)
+			}
+		case GateEventGateStuck:
+			updateLaneStatus(gc.laneID, LaneStatusStuck)
+			slog.Warn("Шлагбаум заклинило", "lane_id", gc.laneID, "detail", frame.Detail)
+		}
+	}
+}
+
+// Send отправляет команду шлагбауму полосы
+func (h *gateHub) Send(laneID uint, command string, hold time.Duration) error {
+	switch command {
+	case GateCommandOpen, GateCommandClose, GateCommandHoldOpen:
+	default:
+		return errGateUnknownCommand
+	}
+
+	h.mu.Lock()
+	gc, ok := h.conns[laneID]
+	h.mu.Unlock()
+	if !ok {
+		return errGateOffline
+	}
+
+	frame := GateFrame{Type: gateFrameCommand, LaneID: laneID, Command: command}
+	if command == GateCommandHoldOpen {
+		frame.HoldSeconds = int(hold.Seconds())
+	}
+	if err := gc.send(frame); err != nil {
+		return err
+	}
+	recordGateEvent(laneID, "command", command)
+
+	// Удержание с таймаутом сервер снимает сам, чтобы статус полосы
+	// не расходился с состоянием устройства. Любая следующая команда
+	// заменяет удержание, и его таймер отменяется.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopHold(laneID)
+	if command == GateCommandHoldOpen && hold > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(hold, func() {
+			h.mu.Lock()
+			current := h.holds[laneID] == timer
+			if current {
+				delete(h.holds, laneID)
+			}
+			h.mu.Unlock()
+			if current {
+				h.Send(laneID, GateCommandClose, 0)
+			}
+		})
+		h.holds[laneID] = timer
+	}
+	return nil
+}
+
+// stopHold отменяет таймер снятия удержания полосы; вызывается под h.mu
+func (h *gateHub) stopHold(laneID uint) {
+	if timer, ok := h.holds[laneID]; ok {
+		timer.Stop()
+		delete(h.holds, laneID)
+	}
+}
+
+// disconnect отключает контроллер полосы, например после смены секрета
+func (h *gateHub) disconnect(laneID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if gc, ok := h.conns[laneID]; ok {
+		gc.conn.Close()
+	}
+}
+
+// checkDeviceSecret сверяет секрет из кадра connect с хешем полосы. Полоса
+// без секрета не принимает подключений, пока его не выдадут.
+func (l Lane) checkDeviceSecret(secret string) bool {
+	return secretMatchesHash(secret, l.DeviceSecretHash)
+}
+
+// issueDeviceSecret выдает полосе новый секрет устройства. В базе хранится
+// только хеш, сам секрет возвращается один раз в Lane.DeviceSecret.
+func issueDeviceSecret(lane *Lane) error {
+	secret, hash, err := newUserToken()
+	if err != nil {
+		return err
+	}
+	lane.DeviceSecretHash = hash
+	lane.DeviceSecret = secret
+	return nil
+}
+
+func updateLaneStatus(laneID uint, status string) {
+	now := time.Now()
+	db.Model(&Lane{}).Where("id = ?", laneID).Updates(map[string]interface{}{"status": status, "last_seen_at": now})
+}
+
+func touchLane(laneID uint) {
+	db.Model(&Lane{}).Where("id = ?", laneID).Update("last_seen_at", time.Now())
+}
+
+func recordGateEvent(laneID uint, eventType, detail string) {
+	event := GateEvent{LaneID: laneID, Type: eventType, Detail: detail}
+	if err := db.Create(&event).Error; err != nil {
+		slog.Error("Не удалось сохранить событие шлагбаума", "lane_id", laneID, "error", err)
+	}
+	touchLane(laneID)
+}
+
+// openLaneGate открывает шлагбаум после решения о въезде или выезде.
+// Ошибки только логируются: запись о въезде/выезде уже сохранена, и оператор
+// может открыть шлагбаум вручную.
+func openLaneGate(laneID, parkingID uint, direction string) {
+	var lane Lane
+	if err := db.First(&lane, laneID).Error; err != nil {
+		slog.Warn("Полоса не найдена", "lane_id", laneID)
+		return
+	}
+	if lane.ParkingID != parkingID || lane.Direction != direction {
+		slog.Warn("Полоса не относится к парковке", "lane_id", laneID, "direction", direction, "parking_id", parkingID)
+		return
+	}
+	if err := gates.Send(lane.ID, GateCommandOpen, 0); err != nil {
+		slog.Error("Не удалось открыть шлагбаум", "lane_id", lane.ID, "error", err)
+	}
+}
+
+type CreateLaneRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Direction string `json:"direction" binding:"required,oneof=entry exit"`
+	DeviceID  string `json:"device_id" binding:"required"`
+}
+
+func CreateLane(c *gin.Context) {
+	parkingID := c.Param("id")
+	var input CreateLaneRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, parkingID).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	lane := Lane{
+		ParkingID: parking.ID,
+		Name:      input.Name,
+		Direction: input.Direction,
+		DeviceID:  input.DeviceID,
+		Status:    LaneStatusOffline,
+	}
+	if err := issueDeviceSecret(&lane); err != nil {
+		c.Error(err)
+		respondError(c, CodeLaneCreateFailed)
+		return
+	}
+
+	if err := db.Create(&lane).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeLaneCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, lane)
+}
+
+// RotateLaneSecret выдает полосе новый секрет устройства и отключает
+// контроллер, подключенный со старым
+func RotateLaneSecret(c *gin.Context) {
+	var lane Lane
+	if err := db.First(&lane, c.Param("id")).Error; err != nil {
+		respondError(c, CodeLaneNotFound)
+		return
+	}
+
+	if err := issueDeviceSecret(&lane); err != nil {
+		c.Error(err)
+		respondError(c, CodeLaneUpdateFailed)
+		return
+	}
+	if err := db.Model(&lane).Update("device_secret_hash", lane.DeviceSecretHash).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeLaneUpdateFailed)
+		return
+	}
+	gates.disconnect(lane.ID)
+
+	c.JSON(http.StatusOK, lane)
+}
+
+func GetLanes(c *gin.Context) {
+	parkingID := c.Param("id")
+	var lanes []Lane
+	if err := db.Where("parking_id = ?", parkingID).Find(&lanes).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeLanesListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, lanes)
+}
+
+type SendLaneCommandRequest struct {
+	Command     string `json:"command" binding:"required,oneof=open close hold_open"`
+	HoldSeconds int    `json:"hold_seconds" binding:"min=0"`
+}
+
+func SendLaneCommand(c *gin.Context) {
+	laneID := c.Param("id")
+	var input SendLaneCommandRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var lane Lane
+	if err := db.First(&lane, laneID).Error; err != nil {
+		respondError(c, CodeLaneNotFound)
+		return
+	}
+
+	hold := time.Duration(input.HoldSeconds) * time.Second
+	if err := gates.Send(lane.ID, input.Command, hold); err != nil {
+		c.Error(err)
+		if errors.Is(err, errGateOffline) {
+			respondError(c, CodeGateOffline)
+			return
+		}
+		respondError(c, CodeGateCommandFailed)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Команда отправлена"})
+}
+
+func GetLaneEvents(c *gin.Context) {
+	laneID := c.Param("id")
+	var events []GateEvent
+	if err := db.Where("lane_id = ?", laneID).Order("created_at DESC").Limit(100).Find(&events).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeLaneEventsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
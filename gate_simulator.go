@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// gateSimulator программный контроллер шлагбаума для локальной проверки
+// всего цикла полосы: машина подъезжает (vehicle_present), сервер по
+// решению о въезде/выезде открывает шлагбаум, машина проезжает
+// (vehicle_passed) и сервер закрывает шлагбаум.
+type gateSimulator struct {
+	addr     string
+	deviceID string
+	secret   string
+	// arrivalEvery - как часто к шлагбауму подъезжает машина
+	arrivalEvery time.Duration
+	// passDelay - сколько машина проезжает открытый шлагбаум
+	passDelay time.Duration
+	// stuckChance - вероятность заклинивания при открытии
+	stuckChance float64
+
+	mu    sync.Mutex
+	enc   *json.Encoder
+	state string
+}
+
+// startGateSimulators запускает симуляторы для всех полос из базы. Секреты
+// устройств в базе хранятся только хешами, поэтому симулятор выдает полосам
+// новые: настоящие контроллеры после этого не подключатся, включать его
+// можно только на стенде.
+func startGateSimulators(addr string) {
+	var lanes []Lane
+	if err := db.Find(&lanes).Error; err != nil {
+		slog.Error("Симулятор шлагбаумов: не удалось получить полосы", "error", err)
+		return
+	}
+	for _, lane := range lanes {
+		if err := issueDeviceSecret(&lane); err != nil {
+			slog.Error("Симулятор шлагбаумов: не удалось выдать секрет", "lane_id", lane.ID, "error", err)
+			continue
+		}
+		if err := db.Model(&lane).Update("device_secret_hash", lane.DeviceSecretHash).Error; err != nil {
+			slog.Error("Симулятор шлагбаумов: не удалось выдать секрет", "lane_id", lane.ID, "error", err)
+			continue
+		}
+		sim := &gateSimulator{
+			addr:         addr,
+			deviceID:     lane.DeviceID,
+			secret:       lane.DeviceSecret,
+			arrivalEvery: 30 * time.Second,
+			passDelay:    3 * time.Second,
+			stuckChance:  0.02,
+		}
+		go sim.Run()
+	}
+}
+
+// Run подключается к серверу и переподключается при обрыве связи
+func (s *gateSimulator) Run() {
+	for {
+		if err := s.session(); err != nil {
+			slog.Warn("Симулятор шлагбаума отключился", "device_id", s.deviceID, "error", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (s *gateSimulator) session() error {
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.enc = json.NewEncoder(conn)
+	s.state = LaneStatusClosed
+	s.mu.Unlock()
+
+	if err := s.send(GateFrame{Type: gateFrameConnect, DeviceID: s.deviceID, Secret: s.secret}); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.tick(done)
+
+	reader := bufio.NewScanner(conn)
+	for reader.Scan() {
+		var frame GateFrame
+		if err := json.Unmarshal(reader.Bytes(), &frame); err != nil {
+			continue
+		}
+		switch frame.Type {
+		case gateFrameConnAck:
+			if !frame.OK {
+				return nil
+			}
+			slog.Info("Симулятор шлагбаума подключен", "device_id", s.deviceID, "lane_id", frame.LaneID)
+		case gateFrameCommand:
+			s.execute(frame)
+		}
+	}
+	return reader.Err()
+}
+
+// tick периодически шлет ping и имитирует подъезд машин
+func (s *gateSimulator) tick(done <-chan struct{}) {
+	ping := time.NewTicker(gateKeepAlive / 3)
+	arrival := time.NewTicker(s.arrivalEvery)
+	defer ping.Stop()
+	defer arrival.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			s.send(GateFrame{Type: gateFramePing})
+		case <-arrival.C:
+			// Новая машина подъезжает только к закрытому шлагбауму
+			if s.getState() == LaneStatusClosed {
+				s.send(GateFrame{Type: gateFrameEvent, Event: GateEventVehiclePresent})
+			}
+		}
+	}
+}
+
+func (s *gateSimulator) execute(frame GateFrame) {
+	ack := GateFrame{Type: gateFrameAck, Seq: frame.Seq, Command: frame.Command, OK: true}
+
+	switch frame.Command {
+	case GateCommandOpen, GateCommandHoldOpen:
+		if rand.Float64() < s.stuckChance {
+			ack.OK = false
+			ack.Detail = "привод не отвечает"
+			s.send(ack)
+			s.send(GateFrame{Type: gateFrameEvent, Event: GateEventGateStuck, Detail: "привод не отвечает"})
+			return
+		}
+		s.setState(LaneStatusOpen)
+		s.send(ack)
+		if frame.Command == GateCommandOpen {
+			time.AfterFunc(s.passDelay, func() {
+				s.send(GateFrame{Type: gateFrameEvent, Event: GateEventVehiclePassed})
+			})
+		}
+	case GateCommandClose:
+		s.setState(LaneStatusClosed)
+		s.send(ack)
+	default:
+		ack.OK = false
+		ack.Detail = "неизвестная команда"
+		s.send(ack)
+	}
+}
+
+func (s *gateSimulator) setState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *gateSimulator) getState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *gateSimulator) send(frame GateFrame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame.Time = time.Now()
+	return s.enc.Encode(frame)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckDeviceSecret(t *testing.T) {
+	lane := Lane{}
+	if err := issueDeviceSecret(&lane); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hash   string
+		secret string
+		want   bool
+	}{
+		{"верный секрет", lane.DeviceSecretHash, lane.DeviceSecret, true},
+		{"чужой секрет", lane.DeviceSecretHash, "wrong", false},
+		{"пустой секрет", lane.DeviceSecretHash, "", false},
+		{"полоса без секрета", "", lane.DeviceSecret, false},
+		{"оба пустые", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Lane{DeviceSecretHash: tt.hash}
+			if got := l.checkDeviceSecret(tt.secret); got != tt.want {
+				t.Errorf("checkDeviceSecret = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGateSendErrors(t *testing.T) {
+	h := &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+
+	tests := []struct {
+		command string
+		want    error
+	}{
+		{GateCommandOpen, errGateOffline},
+		{GateCommandClose, errGateOffline},
+		{GateCommandHoldOpen, errGateOffline},
+		{"explode", errGateUnknownCommand},
+	}
+	for _, tt := range tests {
+		if err := h.Send(1, tt.command, 0); !errors.Is(err, tt.want) {
+			t.Errorf("Send(%s) = %v, ожидалось %v", tt.command, err, tt.want)
+		}
+	}
+}
+
+// gateClient тестовое подключение контроллера к хабу
+type gateClient struct {
+	conn   net.Conn
+	reader *bufio.Scanner
+	enc    *json.Encoder
+}
+
+func dialGate(t *testing.T, h *gateHub) *gateClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err == nil {
+			h.handleConn(conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Обработчик пишет в db, поэтому ждем его до того, как testDB вернет
+	// прежнюю базу
+	t.Cleanup(func() { <-done })
+	t.Cleanup(func() { conn.Close() })
+	return &gateClient{conn: conn, reader: bufio.NewScanner(conn), enc: json.NewEncoder(conn)}
+}
+
+func (c *gateClient) send(t *testing.T, frame GateFrame) {
+	t.Helper()
+	if err := c.enc.Encode(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *gateClient) read(t *testing.T) GateFrame {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !c.reader.Scan() {
+		t.Fatalf("соединение закрыто: %v", c.reader.Err())
+	}
+	var frame GateFrame
+	if err := json.Unmarshal(c.reader.Bytes(), &frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// createTestLane создает полосу с выданным секретом устройства
+func createTestLane(t *testing.T, deviceID string) Lane {
+	t.Helper()
+	parking := Parking{Name: "Шлагбаум", Capacity: 10}
+	if err := db.Create(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	lane := Lane{ParkingID: parking.ID, Name: deviceID, Direction: "entry", DeviceID: deviceID, Status: LaneStatusOffline}
+	if err := issueDeviceSecret(&lane); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&lane).Error; err != nil {
+		t.Fatal(err)
+	}
+	return lane
+}
+
+// waitLaneStatus ждет, пока статус полосы в базе станет status
+func waitLaneStatus(t *testing.T, laneID uint, status string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var lane Lane
+		if err := db.First(&lane, laneID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if lane.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("статус полосы %q, ожидался %q", lane.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGateConnect(t *testing.T) {
+	testDB(t)
+	lane := createTestLane(t, "gate-connect")
+
+	tests := []struct {
+		name  string
+		hello GateFrame
+		ok    bool
+	}{
+		{"верный секрет", GateFrame{Type: gateFrameConnect, DeviceID: lane.DeviceID, Secret: lane.DeviceSecret}, true},
+		{"неверный секрет", GateFrame{Type: gateFrameConnect, DeviceID: lane.DeviceID, Secret: "wrong"}, false},
+		{"неизвестное устройство", GateFrame{Type: gateFrameConnect, DeviceID: "nobody", Secret: lane.DeviceSecret}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+			client := dialGate(t, h)
+			client.send(t, tt.hello)
+
+			ack := client.read(t)
+			if ack.Type != gateFrameConnAck || ack.OK != tt.ok {
+				t.Fatalf("ответ %+v, ожидался connack ok=%v", ack, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if ack.LaneID != lane.ID {
+				t.Errorf("lane_id = %d, ожидался %d", ack.LaneID, lane.ID)
+			}
+			waitLaneStatus(t, lane.ID, LaneStatusClosed)
+
+			client.conn.Close()
+			waitLaneStatus(t, lane.ID, LaneStatusOffline)
+		})
+	}
+}
+
+func TestGateNotConnectFirst(t *testing.T) {
+	h := &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+	client := dialGate(t, h)
+	client.send(t, GateFrame{Type: gateFramePing})
+
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if client.reader.Scan() {
+		t.Fatalf("ожидалось закрытие соединения, получено %s", client.reader.Text())
+	}
+}
+
+// Полный цикл полосы: команда, ack, проезд машины и закрытие сервером
+func TestGateCommandCycle(t *testing.T) {
+	testDB(t)
+	lane := createTestLane(t, "gate-cycle")
+	h := &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+	client := dialGate(t, h)
+	client.send(t, GateFrame{Type: gateFrameConnect, DeviceID: lane.DeviceID, Secret: lane.DeviceSecret})
+	if ack := client.read(t); !ack.OK {
+		t.Fatalf("подключение отклонено: %+v", ack)
+	}
+	waitLaneStatus(t, lane.ID, LaneStatusClosed)
+
+	client.send(t, GateFrame{Type: gateFramePing})
+	if pong := client.read(t); pong.Type != gateFramePong {
+		t.Fatalf("ответ на ping %+v", pong)
+	}
+
+	if err := h.Send(lane.ID, GateCommandOpen, 0); err != nil {
+		t.Fatal(err)
+	}
+	cmd := client.read(t)
+	if cmd.Type != gateFrameCommand || cmd.Command != GateCommandOpen || cmd.Seq != 1 {
+		t.Fatalf("команда %+v", cmd)
+	}
+	client.send(t, GateFrame{Type: gateFrameAck, Seq: cmd.Seq, Command: cmd.Command, OK: true})
+	waitLaneStatus(t, lane.ID, LaneStatusOpen)
+
+	client.send(t, GateFrame{Type: gateFrameEvent, Event: GateEventVehiclePassed})
+	cmd = client.read(t)
+	if cmd.Command != GateCommandClose || cmd.Seq != 2 {
+		t.Fatalf("после проезда ожидалась команда close с seq 2, получено %+v", cmd)
+	}
+	client.send(t, GateFrame{Type: gateFrameAck, Seq: cmd.Seq, Command: cmd.Command, OK: true})
+	waitLaneStatus(t, lane.ID, LaneStatusClosed)
+
+	// Удержание с таймаутом сервер снимает сам
+	if err := h.Send(lane.ID, GateCommandHoldOpen, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if cmd = client.read(t); cmd.Command != GateCommandHoldOpen {
+		t.Fatalf("команда %+v", cmd)
+	}
+	if cmd = client.read(t); cmd.Command != GateCommandClose {
+		t.Fatalf("после удержания ожидалась команда close, получено %+v", cmd)
+	}
+
+	client.send(t, GateFrame{Type: gateFrameEvent, Event: GateEventGateStuck, Detail: "привод"})
+	waitLaneStatus(t, lane.ID, LaneStatusStuck)
+
+	var events int64
+	db.Model(&GateEvent{}).Where("lane_id = ?", lane.ID).Count(&events)
+	if events == 0 {
+		t.Error("события полосы не сохранены")
+	}
+}
+
+func TestGateSimulatorExecute(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		stuckChance float64
+		wantOK      bool
+		wantState   string
+		wantEvent   string
+	}{
+		{"открытие", GateCommandOpen, 0, true, LaneStatusOpen, ""},
+		{"удержание", GateCommandHoldOpen, 0, true, LaneStatusOpen, ""},
+		{"закрытие", GateCommandClose, 0, true, LaneStatusClosed, ""},
+		{"заклинило", GateCommandOpen, 1, false, LaneStatusClosed, GateEventGateStuck},
+		{"неизвестная команда", "explode", 0, false, LaneStatusClosed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			s := &gateSimulator{stuckChance: tt.stuckChance, passDelay: time.Hour, enc: json.NewEncoder(&out), state: LaneStatusClosed}
+			s.execute(GateFrame{Type: gateFrameCommand, Seq: 7, Command: tt.command})
+
+			dec := json.NewDecoder(&out)
+			var ack GateFrame
+			if err := dec.Decode(&ack); err != nil {
+				t.Fatal(err)
+			}
+			if ack.Type != gateFrameAck || ack.Seq != 7 || ack.OK != tt.wantOK {
+				t.Errorf("ack %+v, ожидался seq 7 ok=%v", ack, tt.wantOK)
+			}
+			if got := s.getState(); got != tt.wantState {
+				t.Errorf("состояние %q, ожидалось %q", got, tt.wantState)
+			}
+
+			var event GateFrame
+			dec.Decode(&event)
+			if event.Event != tt.wantEvent {
+				t.Errorf("событие %q, ожидалось %q", event.Event, tt.wantEvent)
+			}
+		})
+	}
+}
+
+// Симулятор подключается к хабу, открывает шлагбаум по команде, через
+// passDelay сообщает о проезде, и сервер закрывает шлагбаум
+func TestGateSimulatorSession(t *testing.T) {
+	testDB(t)
+	lane := createTestLane(t, "gate-sim")
+
+	h := &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handlers sync.WaitGroup
+	t.Cleanup(handlers.Wait)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				h.handleConn(conn)
+			}()
+		}
+	}()
+
+	sim := &gateSimulator{
+		addr:         ln.Addr().String(),
+		deviceID:     lane.DeviceID,
+		secret:       lane.DeviceSecret,
+		arrivalEvery: time.Hour,
+		passDelay:    300 * time.Millisecond,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sim.session()
+	}()
+	t.Cleanup(func() {
+		h.disconnect(lane.ID)
+		<-done
+	})
+
+	waitLaneStatus(t, lane.ID, LaneStatusClosed)
+	if err := h.Send(lane.ID, GateCommandOpen, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitLaneStatus(t, lane.ID, LaneStatusOpen)
+	waitLaneStatus(t, lane.ID, LaneStatusClosed)
+	if sim.getState() != LaneStatusClosed {
+		t.Errorf("симулятор в состоянии %q", sim.getState())
+	}
+}
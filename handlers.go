@@ -1,149 +1,311 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 	"github.com/stripe/stripe-go/v72"
-	"github.com/stripe/stripe-go/v72/paymentintent"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Роли пользователей
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
 )
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID       uint `json:"user_id"`
+	TokenVersion int  `json:"ver"` // User.TokenVersion на момент выдачи
 	jwt.RegisteredClaims
 }
 
-func Register(c *gin.Context) {
-	var input struct {
-		Name     string `json:"name" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
+// API основные обработчики: пользователи, парковки, места, въезды, выезды и
+// платежи. Настройки токенов, хранилище, правила въезда, сервисы (тарифы,
+// оплата, почта), канал обновлений мест и лимиты запросов передаются
+// снаружи, поэтому обработчики можно проверять через httptest без базы:
+//
+//	store := newMemoryStore()
+//	cfg := defaultConfig()
+//	api := NewAPI(AuthConfig{JWTSecret: "test-secret-0123456789", TokenTTL: time.Hour},
+//		store, basicEntryPolicy{parkings: store.Parkings, pricing: cfg.Pricing},
+//		newServices(cfg), make(chan SpotUpdate, 100), nil)
+//
+// Без базы работают только маршруты учетных записей (/register, /login,
+// /email/..., /password/..., /account/...), парковок и мест (/parkings,
+// /parkings/:id, /parkings/:id/spots), /entries, /exits, /payments и
+// /payments/webhook, кроме платежей за абонементы. Абонементы, скидки
+// продавцов и счета организаций при выезде учитывает только
+// featureEntryPolicy. Остальные маршруты - аналитика, цены и прогноз,
+// отчеты, выгрузки, шлагбаумы, датчики, абонементы, организации, продавцы и
+// /readyz - пока обращаются к глобальному db и требуют Postgres.
+type API struct {
+	auth     AuthConfig
+	store    Store
+	policy   EntryPolicy
+	services Services
+	updates  chan<- SpotUpdate
+	limits   *RateLimiter
+}
+
+func NewAPI(auth AuthConfig, store Store, policy EntryPolicy, services Services, updates chan<- SpotUpdate, limits *RateLimiter) *API {
+	return &API{auth: auth, store: store, policy: policy, services: services, updates: updates, limits: limits}
+}
+
+// Services модули, которые собираются из настроек при запуске: тарифы,
+// оплата картой, почта, каталог фоновых выгрузок и шрифт для PDF
+type Services struct {
+	Pricing   Pricing
+	Payments  CardPayments
+	Mailer    Mailer
+	Mail      MailConfig
+	Merchants MerchantsConfig
+	Export    ExportConfig
+	Reports   ReportsConfig
+}
+
+func newServices(cfg Config) Services {
+	return Services{
+		Pricing:   newPricing(cfg.Pricing),
+		Payments:  newStripePayments(cfg.Payments),
+		Mailer:    newMailer(cfg.Mail),
+		Mail:      cfg.Mail,
+		Merchants: cfg.Merchants,
+		Export:    cfg.Export,
+		Reports:   cfg.Reports,
 	}
+}
+
+// paramID разбирает числовой параметр пути; некорректный ID дает 0, которому
+// не соответствует ни одна запись
+func paramID(c *gin.Context, name string) uint {
+	id, _ := strconv.ParseUint(c.Param(name), 10, 64)
+	return uint(id)
+}
+
+// MessageResponse ответ с текстом о выполненном действии
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+func (api *API) Register(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input RegisterRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	var existingUser User
-	if err := db.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Пользователь с таким email уже существует"})
+	if _, err := store.Users.GetByEmail(input.Email); err == nil {
+		respondError(c, CodeEmailTaken)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(input.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обработать пароль"})
+		c.Error(err)
+		respondError(c, CodePasswordHashFailed)
 		return
 	}
 
 	user := User{
 		Name:     input.Name,
 		Email:    input.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
 
-	if err := db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать пользователя"})
+	if err := store.Users.Create(&user); err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, CodeEmailConflict)
+			return
+		}
+		c.Error(err)
+		respondError(c, CodeUserCreateFailed)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Пользователь успешно зарегистрирован"})
+	// Если письмо не ушло, пользователь запросит его повторно
+	if err := api.sendUserToken(c.Request.Context(), user, tokenPurposeVerifyEmail, user.Email); err != nil {
+		c.Error(err)
+	}
+
+	c.JSON(http.StatusCreated, MessageResponse{Message: "Пользователь зарегистрирован, подтвердите email по ссылке из письма"})
 }
 
-func Login(c *gin.Context) {
-	var input struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
-	}
+// hashPassword возвращает bcrypt-хеш пароля для хранения в User.Password
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// TokenResponse JWT для заголовка Authorization: Bearer
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (api *API) Login(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input LoginRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	var user User
-	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
+	ctx := c.Request.Context()
+	if wait, code := api.limits.loginAllowed(ctx, input.Email); wait > 0 {
+		respondRateLimited(c, code, wait)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
+	user, err := store.Users.GetByEmail(input.Email)
+	if err != nil {
+		api.limits.loginFailed(ctx, input.Email)
+		respondError(c, CodeInvalidCredentials)
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: user.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "parking_api",
-		},
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		api.limits.loginFailed(ctx, input.Email)
+		respondError(c, CodeInvalidCredentials)
+		return
 	}
+	api.limits.loginSucceeded(ctx, input.Email)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT_SECRET не установлен"})
+	if api.auth.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		respondError(c, CodeEmailNotVerified)
 		return
 	}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := api.issueToken(user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+		c.Error(err)
+		respondError(c, CodeTokenCreateFailed)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, TokenResponse{Token: tokenString})
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// issueToken выдает JWT пользователю с текущей версией токенов
+func (api *API) issueToken(user User) (string, error) {
+	claims := &Claims{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(api.auth.TokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "parking_api",
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(api.auth.JWTSecret))
+}
+
+// AuthMiddleware проверяет JWT, подписанный секретом из настроек, и версию
+// токенов пользователя: после смены пароля или email выданные раньше токены
+// не действуют
+func (api *API) AuthMiddleware() gin.HandlerFunc {
+	jwtSecret := api.auth.JWTSecret
 	return func(c *gin.Context) {
+		// Принимается и "Bearer <токен>", как в OpenAPI (схема без учета
+		// регистра), и токен без схемы, как его отправляют старые клиенты
 		tokenString := c.GetHeader("Authorization")
+		if scheme, token, ok := strings.Cut(tokenString, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			tokenString = strings.TrimSpace(token)
+		}
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Токен не предоставлен"})
+			abortWithError(c, CodeTokenMissing)
 			return
 		}
 
 		claims := &Claims{}
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "JWT_SECRET не установлен"})
-			return
-		}
-
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			return []byte(jwtSecret), nil
 		})
 
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Неверный токен"})
+			abortWithError(c, CodeTokenInvalid)
+			return
+		}
+
+		user, err := api.store.WithContext(c.Request.Context()).Users.Get(claims.UserID)
+		switch {
+		case errors.Is(err, errNotFound):
+			abortWithError(c, CodeTokenInvalid)
+			return
+		case err != nil:
+			c.Error(err)
+			abortWithError(c, CodeInternal)
+			return
+		case user.TokenVersion != claims.TokenVersion:
+			abortWithError(c, CodeTokenRevoked)
 			return
 		}
 
 		c.Set("user_id", claims.UserID)
+		c.Set("user_role", user.Role)
 		c.Next()
 	}
 }
 
-func CreateParking(c *gin.Context) {
-	var input struct {
-		Name      string   `json:"name" binding:"required"`
-		Latitude  float64  `json:"latitude" binding:"required"`
-		Longitude float64  `json:"longitude" binding:"required"`
-		Capacity  int      `json:"capacity" binding:"required,min=1"`
-		Tariffs   []TariffInput `json:"tariffs" binding:"required,dive,required"`
+// RequireRole middleware после AuthMiddleware: пропускает только
+// пользователей с ролью role. Роль читается из базы при каждом запросе, так
+// что снятие роли действует сразу, без перевыпуска токенов.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_role") != role {
+			abortWithError(c, CodeRoleRequired)
+			return
+		}
+		c.Next()
 	}
+}
+
+type CreateParkingRequest struct {
+	Name      string        `json:"name" binding:"required"`
+	Latitude  float64       `json:"latitude" binding:"required"`
+	Longitude float64       `json:"longitude" binding:"required"`
+	Capacity  int           `json:"capacity" binding:"required,min=1"`
+	TimeZone  string        `json:"time_zone"`
+	Tariffs   []TariffInput `json:"tariffs" binding:"required,dive,required"`
+}
+
+func (api *API) CreateParking(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input CreateParkingRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
+		return
+	}
+
+	if input.TimeZone == "" {
+		input.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(input.TimeZone); err != nil {
+		respondError(c, CodeUnknownTimezone)
 		return
 	}
 
@@ -152,6 +314,7 @@ func CreateParking(c *gin.Context) {
 		Latitude:  input.Latitude,
 		Longitude: input.Longitude,
 		Capacity:  input.Capacity,
+		TimeZone:  input.TimeZone,
 	}
 
 	for _, t := range input.Tariffs {
@@ -161,8 +324,9 @@ func CreateParking(c *gin.Context) {
 		})
 	}
 
-	if err := db.Create(&parking).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать парковку"})
+	if err := store.Parkings.Create(&parking); err != nil {
+		c.Error(err)
+		respondError(c, CodeParkingCreateFailed)
 		return
 	}
 
@@ -174,329 +338,448 @@ type TariffInput struct {
 	Price float64 `json:"price" binding:"required,gt=0"`
 }
 
-func GetParkings(c *gin.Context) {
-	var parkings []Parking
-	if err := db.Preload("Tariffs").Preload("Spots").Find(&parkings).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить парковки"})
+func (api *API) GetParkings(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	parkings, err := store.Parkings.List()
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeParkingsListFailed)
 		return
 	}
 
 	c.JSON(http.StatusOK, parkings)
 }
 
-func GetParking(c *gin.Context) {
-	id := c.Param("id")
-	var parking Parking
-	if err := db.Preload("Tariffs").Preload("Spots").First(&parking, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Парковка не найдена"})
+func (api *API) GetParking(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	id := paramID(c, "id")
+	parking, err := store.Parkings.Get(id)
+	if err != nil {
+		respondError(c, CodeParkingNotFound)
 		return
 	}
 
 	c.JSON(http.StatusOK, parking)
 }
 
-func GetSpots(c *gin.Context) {
-	parkingID := c.Param("id")
-	var spots []Spot
-	if err := db.Where("parking_id = ?", parkingID).Find(&spots).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить места"})
+func (api *API) GetSpots(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	parkingID := paramID(c, "id")
+	spots, err := store.Spots.ListByParking(parkingID)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeSpotsListFailed)
 		return
 	}
 
 	c.JSON(http.StatusOK, spots)
 }
 
-func AddSpot(c *gin.Context) {
-	parkingID := c.Param("id")
-	var input struct {
-		Number string `json:"number" binding:"required"`
-	}
+type AddSpotRequest struct {
+	Number string `json:"number" binding:"required"`
+	Zone   string `json:"zone"`
+}
+
+func (api *API) AddSpot(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	parkingID := paramID(c, "id")
+	var input AddSpotRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	var parking Parking
-	if err := db.First(&parking, parkingID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Парковка не найдена"})
+	parking, err := store.Parkings.Get(parkingID)
+	if err != nil {
+		respondError(c, CodeParkingNotFound)
 		return
 	}
 
 	spot := Spot{
 		ParkingID:  parking.ID,
 		Number:     input.Number,
+		Zone:       input.Zone,
 		IsOccupied: false,
 	}
 
-	if err := db.Create(&spot).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось добавить место"})
+	if err := store.Spots.Create(&spot); err != nil {
+		c.Error(err)
+		respondError(c, CodeSpotCreateFailed)
 		return
 	}
 
-	notifySpotUpdate(parking.ID)
+	api.notifySpotUpdate(c.Request.Context(), parking.ID)
 
 	c.JSON(http.StatusCreated, spot)
 }
 
-func CreateEntry(c *gin.Context) {
-	var input struct {
-		SpotID    uint   `json:"spot_id" binding:"required"`
-		VehicleID uint   `json:"vehicle_id" binding:"required"`
-	}
+type CreateEntryRequest struct {
+	SpotID    uint `json:"spot_id" binding:"required"`
+	VehicleID uint `json:"vehicle_id" binding:"required"`
+	LaneID    uint `json:"lane_id"`
+}
+
+func (api *API) CreateEntry(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input CreateEntryRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	var spot Spot
-	if err := db.First(&spot, input.SpotID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Место не найдено"})
+	spot, err := store.Spots.Get(input.SpotID)
+	if err != nil {
+		respondError(c, CodeSpotNotFound)
 		return
 	}
 
 	if spot.IsOccupied {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Место уже занято"})
+		// Место могли пометить занятым датчики, когда машина встала без
+		// въезда. Регистрировать ее въезд задним числом можно.
+		if _, err := store.Entries.OpenForSpot(spot.ID); err == nil {
+			respondError(c, CodeSpotOccupied)
+			return
+		}
+	}
+
+	vehicle, err := store.Vehicles.Get(input.VehicleID)
+	if err != nil {
+		respondError(c, CodeVehicleNotFound)
 		return
 	}
 
-	var vehicle Vehicle
-	if err := db.First(&vehicle, input.VehicleID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Автомобиль не найден"})
+	now := time.Now()
+	// Цена фиксируется при въезде и не меняется до конца стоянки
+	rate, err := api.policy.EntryRate(c.Request.Context(), spot, vehicle, now)
+	if errors.Is(err, errSpotReserved) {
+		respondError(c, CodeSpotReserved)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeRateFailed)
 		return
 	}
 
 	entry := Entry{
-		SpotID:    spot.ID,
-		VehicleID: vehicle.ID,
-		EntryTime: time.Now(),
+		SpotID:     spot.ID,
+		VehicleID:  vehicle.ID,
+		EntryTime:  now,
+		LockedRate: &rate,
 	}
 
-	if err := db.Create(&entry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось зафиксировать въезд"})
+	if err := store.Entries.Create(&entry); err != nil {
+		c.Error(err)
+		respondError(c, CodeEntryCreateFailed)
 		return
 	}
 
 	spot.IsOccupied = true
-	if err := db.Save(&spot).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить статус места"})
+	if err := store.Spots.Save(&spot); err != nil {
+		c.Error(err)
+		respondError(c, CodeSpotUpdateFailed)
 		return
 	}
 
-	notifySpotUpdate(spot.ParkingID)
+	api.policy.AfterEntry(c.Request.Context(), entry, spot, input.LaneID)
+
+	entriesTotal.WithLabelValues(parkingLabel(spot.ParkingID)).Inc()
+	api.notifySpotUpdate(c.Request.Context(), spot.ParkingID)
 
 	c.JSON(http.StatusCreated, entry)
 }
 
-func CreateExit(c *gin.Context) {
-	var input struct {
-		EntryID        uint   `json:"entry_id" binding:"required"`
-		PaymentMethod  string `json:"payment_method" binding:"required"`
-	}
+type CreateExitRequest struct {
+	EntryID         uint     `json:"entry_id" binding:"required"`
+	PaymentMethod   string   `json:"payment_method" binding:"required"`
+	LaneID          uint     `json:"lane_id"`
+	ValidationCodes []string `json:"validation_codes"`
+}
+
+func (api *API) CreateExit(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input CreateExitRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	var entry Entry
-	if err := db.First(&entry, input.EntryID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Запись о въезде не найдена"})
+	entry, err := store.Entries.Get(input.EntryID)
+	if err != nil {
+		respondError(c, CodeEntryNotFound)
 		return
 	}
 
 	if entry.ExitTime != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Выезд уже зафиксирован"})
+		respondError(c, CodeExitAlreadyRecorded)
 		return
 	}
 
-	amount := calculatePayment(entry.EntryTime, time.Now())
-
-	payment := Payment{
-		Amount:   amount,
-		Method:   input.PaymentMethod,
-		Status:   "pending",
-		CreatedAt: time.Now(),
-	}
-
-	if err := db.Create(&payment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать платеж"})
+	exit, err := api.closeEntry(c.Request.Context(), entry, input.PaymentMethod, input.ValidationCodes, input.LaneID, time.Now())
+	if err != nil {
+		c.Error(err)
+		switch {
+		case errors.Is(err, errValidationCodeInvalid):
+			respondError(c, CodeValidationCodeInvalid)
+		case errors.Is(err, errMerchantLimitReached):
+			respondError(c, CodeMerchantLimitReached)
+		default:
+			respondError(c, CodeExitCreateFailed)
+		}
 		return
 	}
 
-	exit := Exit{
-		EntryID:   entry.ID,
-		ExitTime:  time.Now(),
-		PaymentID: payment.ID,
-	}
+	c.JSON(http.StatusCreated, exit)
+}
 
-	if err := db.Create(&exit).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось зафиксировать выезд"})
-		return
+// closeEntry фиксирует выезд: считает оплату, создает платеж и выезд,
+// освобождает место. Используется обработчиком выезда и командой
+// close-stale-entries.
+func (api *API) closeEntry(ctx context.Context, entry Entry, paymentMethod string, codes []string, laneID uint, now time.Time) (Exit, error) {
+	store := api.store.WithContext(ctx)
+	spot, err := store.Spots.Get(entry.SpotID)
+	if err != nil {
+		return Exit{}, fmt.Errorf("место %d: %w", entry.SpotID, err)
 	}
 
-	entry.ExitTime = &exit.ExitTime
-	if err := db.Save(&entry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить запись о въезде"})
-		return
+	quote, err := api.policy.QuoteExit(ctx, entry, spot, codes, now)
+	if err != nil {
+		return Exit{}, err
 	}
 
-	var spot Spot
-	if err := db.First(&spot, entry.SpotID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Место не найдено"})
-		return
-	}
+	payment := Payment{
+		Amount:    quote.Amount,
+		Method:    paymentMethod,
+		Status:    "pending",
+		CreatedAt: now,
+	}
+
+	if quote.OrganizationID != nil {
+		payment.Method = "invoice"
+		payment.Status = PaymentStatusInvoiced
+		payment.OrganizationID = quote.OrganizationID
+	}
+
+	// Платеж, выезд и учет валидаций сохраняются вместе: если код
+	// валидации успели учесть на другом выезде, выезд не фиксируется
+	exit := Exit{EntryID: entry.ID, ExitTime: now}
+	err = store.Transaction(func(tx Store) error {
+		// Сверх месячного лимита организации водитель платит сам, как
+		// обычный клиент
+		if payment.OrganizationID != nil {
+			err := tx.Organizations.ReserveSpending(*payment.OrganizationID, payment.Amount, monthStart(now))
+			switch {
+			case errors.Is(err, errSpendingLimitExceeded):
+				payment.Method, payment.Status, payment.OrganizationID = paymentMethod, "pending", nil
+				quote.OrganizationID = nil
+			case err != nil:
+				return fmt.Errorf("лимит организации: %w", err)
+			}
+		}
 
-	spot.IsOccupied = false
-	if err := db.Save(&spot).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить статус места"})
-		return
+		if err := tx.Payments.Create(&payment); err != nil {
+			return fmt.Errorf("платеж: %w", err)
+		}
+
+		exit.PaymentID = payment.ID
+		if err := tx.Entries.CreateExit(&exit); err != nil {
+			return fmt.Errorf("выезд: %w", err)
+		}
+
+		entry.ExitTime = &exit.ExitTime
+		if err := tx.Entries.Save(&entry); err != nil {
+			return fmt.Errorf("въезд %d: %w", entry.ID, err)
+		}
+
+		spot.IsOccupied = false
+		if err := tx.Spots.Save(&spot); err != nil {
+			return fmt.Errorf("место %d: %w", spot.ID, err)
+		}
+
+		if len(quote.Validations) > 0 {
+			applied := applyValidations(quote.Validations, entry.ID, payment.ID, quote.FullAmount-quote.Amount, now)
+			if err := tx.Validations.Apply(applied); err != nil {
+				return fmt.Errorf("валидации: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Exit{}, err
 	}
 
-	notifySpotUpdate(spot.ParkingID)
+	api.policy.AfterExit(ctx, quote, entry, payment, spot, laneID, now)
 
-	c.JSON(http.StatusCreated, exit)
+	exitsTotal.WithLabelValues(parkingLabel(spot.ParkingID)).Inc()
+	exitAmounts.Observe(quote.Amount)
+	api.notifySpotUpdate(ctx, spot.ParkingID)
+
+	return exit, nil
 }
 
-func GetAnalytics(c *gin.Context) {
-	startTimeStr := c.Query("start_time")
-	endTimeStr := c.Query("end_time")
+// HourlyEntries число въездов на парковку в данный час суток
+type HourlyEntries struct {
+	ParkingID uint `gorm:"column:parking_id" json:"parking_id"`
+	Count     int  `gorm:"column:count" json:"count"`
+	Hour      int  `gorm:"column:hour" json:"hour"`
+}
 
-	if startTimeStr == "" || endTimeStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Параметры start_time и end_time обязательны"})
+func GetAnalytics(c *gin.Context) {
+	startTime, endTime, ok := parseAnalyticsRange(c)
+	if !ok {
 		return
 	}
 
-	startTime, err := time.Parse(time.RFC3339, startTimeStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат start_time"})
-		return
-	}
+	var results []HourlyEntries
 
-	endTime, err := time.Parse(time.RFC3339, endTimeStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат end_time"})
+	// Полные часы берем из сводок, края периода - из сырых въездов. Час
+	// берем в часовом поясе парковки, а не сервера.
+	if err := hourlyEntriesQuery(&startTime, &endTime, true, "").
+		Scan(&results).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeAnalyticsFailed)
 		return
 	}
 
-	var results []struct {
-		ParkingID uint `gorm:"column:parking_id" json:"parking_id"`
-		Count     int  `gorm:"column:count" json:"count"`
-		Hour      int  `gorm:"column:hour" json:"hour"`
-	}
+	c.JSON(http.StatusOK, results)
+}
 
-	db.Table("entries").
-		Select("parkings.id as parking_id, EXTRACT(HOUR FROM entries.entry_time) as hour, COUNT(*) as count").
-		Joins("JOIN spots ON spots.id = entries.spot_id").
-		Joins("JOIN parkings ON parkings.id = spots.parking_id").
-		Where("entries.entry_time BETWEEN ? AND ?", startTime, endTime).
-		Group("parkings.id, hour").
-		Scan(&results)
+// PaymentResult результат оплаты картой
+type PaymentResult struct {
+	PaymentID uint   `json:"payment_id"`
+	Status    string `json:"status"`
+}
 
-	c.JSON(http.StatusOK, results)
+type ProcessPaymentRequest struct {
+	PaymentMethodID string `json:"payment_method_id" binding:"required"`
+	Amount          int64  `json:"amount" binding:"required,gt=0"` // В копейках
 }
 
-func ProcessPayment(c *gin.Context) {
-	var input struct {
-		PaymentMethodID string `json:"payment_method_id" binding:"required"`
-		Amount          int64  `json:"amount" binding:"required,gt=0"` // В копейках
-	}
+func (api *API) ProcessPayment(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+	var input ProcessPaymentRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondValidationError(c, err)
 		return
 	}
 
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	if stripe.Key == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "STRIPE_SECRET_KEY не установлен"})
+	pi, err := api.services.Payments.Charge(c.Request.Context(), input.Amount, input.PaymentMethodID)
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, errStripeNotConfigured) {
+			respondError(c, CodePaymentsNotConfigured)
+			return
+		}
+		respondError(c, CodePaymentFailed)
 		return
 	}
 
-	params := &stripe.PaymentIntentParams{
-		Amount:              stripe.Int64(input.Amount),
-		Currency:            stripe.String(string(stripe.CurrencyRub)),
-		PaymentMethod:       stripe.String(input.PaymentMethodID),
-		ConfirmationMethod:  stripe.String(string(stripe.PaymentIntentConfirmationMethodAutomatic)),
-		Confirm:             stripe.Bool(true),
-		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
-	}
-
-	pi, err := paymentintent.New(params)
+	payment, err := savePaymentIntent(store.Payments, pi)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обработке платежа"})
+		c.Error(err)
+		respondError(c, CodePaymentSaveFailed)
 		return
 	}
 
-	var payment Payment
-	if err := db.First(&payment, pi.ID).Error; err != nil {
+	c.JSON(http.StatusOK, PaymentResult{PaymentID: payment.ID, Status: payment.Status})
+}
+
+// savePaymentIntent создает или обновляет платеж по ID платежа в Stripe
+func savePaymentIntent(payments PaymentRepository, pi *stripe.PaymentIntent) (Payment, error) {
+	payment, err := payments.GetByProviderID(pi.ID)
+	if err != nil {
 		payment = Payment{
-			ID:     uint(pi.ID),
-			Amount: float64(pi.Amount) / 100, // Переводим из копеек в рубли
-			Method: "Stripe",
-			Status: string(pi.Status),
-		}
-		if err := db.Create(&payment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сохранить платеж"})
-			return
-		}
-	} else {
-		payment.Status = string(pi.Status)
-		if err := db.Save(&payment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить платеж"})
-			return
+			ProviderID: pi.ID,
+			Amount:     float64(pi.Amount) / 100, // Переводим из копеек в рубли
+			Method:     "Stripe",
+			Status:     string(pi.Status),
 		}
+		return payment, payments.Create(&payment)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"payment_id": payment.ID,
-		"status":     payment.Status,
-	})
+	payment.Status = string(pi.Status)
+	return payment, payments.Save(&payment)
 }
 
 func WebSocketHandler(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось установить WebSocket соединение"})
+		c.Error(err)
+		respondError(c, CodeWebSocketFailed)
 		return
 	}
 	defer conn.Close()
 
+	clientsMu.Lock()
 	clients[conn] = true
+	clientsMu.Unlock()
 
 	for {
 		var msg interface{}
 		if err := conn.ReadJSON(&msg); err != nil {
+			clientsMu.Lock()
 			delete(clients, conn)
+			clientsMu.Unlock()
 			break
 		}
 	}
 }
 
+// notifySpotUpdate рассылает по WebSocket число свободных мест парковки.
+// Используется модулями, которые работают с базой напрямую.
 func notifySpotUpdate(parkingID uint) {
 	var available int64
 	db.Model(&Spot{}).Where("parking_id = ? AND is_occupied = ?", parkingID, false).Count(&available)
 
-	update := SpotUpdate{
+	publishSpotUpdate(broadcast, SpotUpdate{
 		ParkingID: parkingID,
 		Available: int(available),
-	}
+	})
+}
 
-	broadcast <- update
+// publishSpotUpdate ставит обновление в очередь рассылки, не дожидаясь
+// места в ней: если очередь заполнена или рассылка уже остановлена,
+// обновление отбрасывается. Следующее обновление парковки все равно
+// принесет актуальное число мест, а запрос или задача не зависнут.
+func publishSpotUpdate(updates chan<- SpotUpdate, update SpotUpdate) {
+	select {
+	case updates <- update:
+	default:
+		broadcastDropped.Inc()
+		slog.Warn("Очередь рассылки WebSocket заполнена, обновление отброшено", "parking_id", update.ParkingID)
+	}
 }
 
-func calculatePayment(entryTime, exitTime time.Time) float64 {
-	duration := exitTime.Sub(entryTime)
-	hours := int(duration.Hours())
-	if duration.Minutes() > 0 && duration.Seconds()%3600 > 0 {
-		hours += 1
+func (api *API) notifySpotUpdate(ctx context.Context, parkingID uint) {
+	if api.updates == nil {
+		// Консольные команды работают без WebSocket-клиентов
+		return
 	}
 
-	var tariff Tariff
-	if err := db.Where("parking_id = ?", 1).Where("type = ?", "почасовой").First(&tariff).Error; err != nil {
-		return float64(hours) * 2.5
+	available, err := api.store.Spots.CountAvailable(parkingID)
+	if err != nil {
+		return
 	}
 
-	return float64(hours) * tariff.Price
+	publishSpotUpdate(api.updates, SpotUpdate{
+		ParkingID: parkingID,
+		Available: int(available),
+		origin:    trace.SpanContextFromContext(ctx),
+	})
+}
+
+// billableHours округляет продолжительность вверх до целых часов
+func billableHours(duration time.Duration) int {
+	if duration <= 0 {
+		return 0
+	}
+	hours := int(duration / time.Hour)
+	if duration%time.Hour > 0 {
+		hours += 1
+	}
+	return hours
 }
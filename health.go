@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Пробы для Kubernetes: /healthz (liveness) отвечает, пока процесс жив, и
+// не трогает зависимости, чтобы сбой базы не приводил к перезапуску подов;
+// /readyz (readiness) проверяет базу, версию схемы и платежного провайдера.
+// Обе отдают версию сборки и стоят вне авторизации.
+
+// Заполняются при сборке:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// Без ldflags коммит и время берутся из данных VCS, которые пишет go build.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+// readinessTimeout ограничивает все проверки /readyz вместе
+const readinessTimeout = 2 * time.Second
+
+var startedAt = time.Now()
+
+// BuildInfo версия и сборка сервера
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// Состояния проверок и сервера в целом
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"    // работает, но часть функций недоступна
+	healthUnavailable = "unavailable" // запросы обслуживать нельзя
+)
+
+// HealthCheck результат одной проверки /readyz
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// LivenessResponse ответ /healthz
+type LivenessResponse struct {
+	Status        string    `json:"status"`
+	Build         BuildInfo `json:"build"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// ReadinessResponse ответ /readyz
+type ReadinessResponse struct {
+	Status string                 `json:"status"` // ok, degraded или unavailable
+	Checks map[string]HealthCheck `json:"checks"`
+	Build  BuildInfo              `json:"build"`
+}
+
+// Healthz liveness-проба
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, LivenessResponse{
+		Status:        healthOK,
+		Build:         buildInfo(),
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+	})
+}
+
+// Readyz readiness-проба. Без базы или с неактуальной схемой отвечает 503,
+// и под выводится из балансировки. Без ключа Stripe сервер готов, но в
+// режиме degraded: все, кроме оплаты картой, работает.
+func (api *API) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{
+		"database": checkDatabase(ctx),
+		"payments": checkPayments(api.services.Payments),
+	}
+	if checks["database"].Status == healthOK {
+		checks["migrations"] = checkMigrations(ctx)
+	} else {
+		checks["migrations"] = HealthCheck{Status: healthUnavailable, Error: "база недоступна"}
+	}
+
+	status := healthOK
+	for _, check := range checks {
+		switch check.Status {
+		case healthUnavailable:
+			status = healthUnavailable
+		case healthDegraded:
+			if status == healthOK {
+				status = healthDegraded
+			}
+		}
+	}
+
+	code := http.StatusOK
+	if status == healthUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, ReadinessResponse{Status: status, Checks: checks, Build: buildInfo()})
+}
+
+func checkDatabase(ctx context.Context) HealthCheck {
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return HealthCheck{Status: healthUnavailable, Error: err.Error()}
+	}
+	return HealthCheck{Status: healthOK}
+}
+
+func checkMigrations(ctx context.Context) HealthCheck {
+	if err := checkSchemaVersion(db.WithContext(ctx)); err != nil {
+		return HealthCheck{Status: healthUnavailable, Error: err.Error()}
+	}
+	return HealthCheck{Status: healthOK}
+}
+
+// checkPayments проверяет только настройки: запрос к Stripe на каждую пробу
+// тратил бы лимиты API, а его недоступность не повод выводить под
+func checkPayments(payments CardPayments) HealthCheck {
+	if !payments.Configured() {
+		return HealthCheck{Status: healthDegraded, Error: errStripeNotConfigured.Error()}
+	}
+	return HealthCheck{Status: healthOK}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestHealthz(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	var resp LivenessResponse
+	s.expect(s.do(http.MethodGet, "/healthz", "", nil), http.StatusOK, &resp)
+	if resp.Status != healthOK || resp.Build.Version != version || resp.Build.GoVersion == "" {
+		t.Errorf("%+v", resp)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	// Пул без подключений: первый же запрос к базе не проходит
+	unreachable, err := gorm.Open(postgres.Open("postgres://localhost:1/readyz"), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		stripeKey string
+		setup     func(t *testing.T) // Готовит глобальный db
+		status    int
+		want      string
+		checks    map[string]string
+	}{
+		{"все готово", "sk_test_1", func(t *testing.T) { testDB(t) }, http.StatusOK, healthOK,
+			map[string]string{"database": healthOK, "migrations": healthOK, "payments": healthOK}},
+		{"без ключа Stripe", "", func(t *testing.T) { testDB(t) }, http.StatusOK, healthDegraded,
+			map[string]string{"database": healthOK, "migrations": healthOK, "payments": healthDegraded}},
+		{"схема отстает", "sk_test_1", func(t *testing.T) {
+			conn := testDB(t)
+			var last schemaMigration
+			if err := conn.Order("version DESC").First(&last).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.Delete(&last).Error; err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusServiceUnavailable, healthUnavailable,
+			map[string]string{"database": healthOK, "migrations": healthUnavailable, "payments": healthOK}},
+		{"база недоступна", "", func(t *testing.T) {
+			prev := db
+			db = unreachable
+			t.Cleanup(func() { db = prev })
+		}, http.StatusServiceUnavailable, healthUnavailable,
+			map[string]string{"database": healthUnavailable, "migrations": healthUnavailable, "payments": healthDegraded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			s := newTestServer(t, nil, func(cfg *Config) { cfg.Payments.StripeSecretKey = tt.stripeKey })
+
+			var resp ReadinessResponse
+			s.expect(s.do(http.MethodGet, "/readyz", "", nil), tt.status, &resp)
+			if resp.Status != tt.want || resp.Build.Version != version {
+				t.Errorf("состояние %q, сборка %+v; ожидалось %q", resp.Status, resp.Build, tt.want)
+			}
+			for name, want := range tt.checks {
+				if check := resp.Checks[name]; check.Status != want || (want == healthOK) != (check.Error == "") {
+					t.Errorf("проверка %s: %+v, ожидалось %q", name, check, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Логи пишутся через log/slog одной JSON-строкой на событие. Вызовы пакета
+// log (log.Fatal в main) тоже проходят через slog после setupLogging, поэтому
+// попадают в тот же поток с тем же форматом и маскированием.
+
+// requestIDHeader заголовок с ID запроса: берется от клиента или прокси,
+// если его нет - генерируется, и всегда возвращается в ответе
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// slowQueryThreshold - запросы к базе дольше этого пишутся с уровнем warn
+const slowQueryThreshold = 200 * time.Millisecond
+
+const redacted = "[скрыто]"
+
+// sensitiveKeys части имен полей, значения которых никогда не пишутся в лог
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "card", "cvc", "cvv", "payment_method", "api_key", "dsn", "database_url"}
+
+// cardNumberPattern кандидаты в номера карт: 13-19 цифр, допускаются пробелы
+// и дефисы между группами. Маскируются только строки, прошедшие проверку Луна.
+var cardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// setupLogging делает slog-логгер по умолчанию для приложения, gin и log
+func setupLogging(cfg LogConfig) {
+	setupLoggingTo(os.Stdout, cfg)
+}
+
+func setupLoggingTo(w io.Writer, cfg LogConfig) {
+	opts := &slog.HandlerOptions{Level: cfg.level(), ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+
+	gin.DefaultWriter = io.Discard
+	gin.DefaultErrorWriter = io.Discard
+}
+
+func (c LogConfig) level() slog.Level {
+	switch c.Level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// contextHandler добавляет к записи ID запроса и трассы из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	r.Message = maskCardNumbers(r.Message)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr скрывает значения чувствительных полей и номера карт в строках
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, maskCardNumbers(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, maskCardNumbers(err.Error()))
+		}
+	}
+	return a
+}
+
+func maskCardNumbers(s string) string {
+	return cardNumberPattern.ReplaceAllStringFunc(s, func(match string) string {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, match)
+		if !luhnValid(digits) {
+			return match
+		}
+		return "****" + digits[len(digits)-4:]
+	})
+}
+
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware кладет ID запроса в контекст запроса, откуда его берут
+// логи обработчиков и запросов к базе
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// probeRoutes маршруты проб, успешные ответы на которые пишутся с уровнем debug
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// RequestLogger пишет по строке на запрос вместе с ошибками, которые
+// обработчики передали через c.Error. Путь пишется без query-строки: в ней
+// бывают токены.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", strings.Join(c.Errors.Errors(), "; ")))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status < 400 && probeRoutes[c.FullPath()]:
+			// Пробы Kubernetes приходят каждые несколько секунд
+			level = slog.LevelDebug
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(c.Request.Context(), level, "HTTP-запрос", attrs...)
+	}
+}
+
+// RecoveryMiddleware отвечает 500 на панику в обработчике и пишет ее в лог
+// со стеком. http.ErrAbortHandler пробрасывается дальше: им обработчик
+// обрывает соединение, когда ответ уже начат.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		if recovered == http.ErrAbortHandler {
+			panic(http.ErrAbortHandler)
+		}
+		slog.ErrorContext(c.Request.Context(), "Паника в обработчике",
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
+		abortWithError(c, CodeInternal)
+	})
+}
+
+// gormLogger пишет ошибки и медленные запросы gorm через slog. Запросы
+// логируются с плейсхолдерами, без значений параметров.
+type gormLogger struct {
+	level gormlogger.LogLevel
+}
+
+// newGormLogger на уровне debug пишет все запросы, иначе только ошибки и
+// медленные
+func newGormLogger(cfg LogConfig) gormlogger.Interface {
+	if cfg.Level == "debug" {
+		return gormLogger{level: gormlogger.Info}
+	}
+	return gormLogger{level: gormlogger.Warn}
+}
+
+func (l gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	l.level = level
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "Ошибка запроса к базе", "error", err, "sql", sql, "rows", rows, "elapsed", elapsed)
+	case elapsed > slowQueryThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "Медленный запрос к базе", "sql", sql, "rows", rows, "elapsed", elapsed)
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		slog.DebugContext(ctx, "Запрос к базе", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
+
+// ParamsFilter не дает gorm подставлять значения параметров в текст запроса
+func (gormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// captureLogs направляет логи в буфер на время теста и возвращает функцию,
+// разбирающую записанные JSON-строки
+func captureLogs(t *testing.T, level string) func() []map[string]any {
+	t.Helper()
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var buf bytes.Buffer
+	setupLoggingTo(&buf, LogConfig{Level: level, Format: "json"})
+	return func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("не JSON: %s", line)
+			}
+			records = append(records, record)
+		}
+		buf.Reset()
+		return records
+	}
+}
+
+func TestMaskCardNumbers(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"карта 4242424242424242", "карта ****4242"},
+		{"карта 4242 4242 4242 4242 отклонена", "карта ****4242 отклонена"},
+		{"5555-5555-5555-4444", "****4444"},
+		// Не проходит проверку Луна - не номер карты
+		{"заказ 4242424242424241", "заказ 4242424242424241"},
+		{"телефон 79161234567", "телефон 79161234567"},
+		{"без цифр", "без цифр"},
+	}
+	for _, tt := range tests {
+		if got := maskCardNumbers(tt.in); got != tt.want {
+			t.Errorf("%q: %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	tests := []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("password", "secret123"), redacted},
+		{slog.String("Authorization", "Bearer abc"), redacted},
+		{slog.String("stripe_webhook_secret", "whsec_1"), redacted},
+		{slog.Int("card_last4", 4242), redacted},
+		{slog.String("error", "карта 4242424242424242 отклонена"), "карта ****4242 отклонена"},
+		{slog.Any("error", errors.New("карта 4000056655665556")), "карта ****5556"},
+		{slog.String("email", "driver@example.com"), "driver@example.com"},
+		{slog.Int("status", 200), "200"},
+	}
+	for _, tt := range tests {
+		if got := redactAttr(nil, tt.attr).Value.String(); got != tt.want {
+			t.Errorf("%s: %q, ожидалось %q", tt.attr.Key, got, tt.want)
+		}
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	logs := captureLogs(t, "debug")
+	router := gin.New()
+	router.Use(RecoveryMiddleware(), RequestIDMiddleware(), RequestLogger())
+	router.GET("/parkings/:id", func(c *gin.Context) {
+		slog.InfoContext(c.Request.Context(), "Обработчик")
+		if c.Query("fail") != "" {
+			c.Error(errors.New("база недоступна, пароль secret123 не пишется"))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/panic", func(c *gin.Context) { panic("сбой") })
+
+	tests := []struct {
+		name      string
+		path      string
+		requestID string
+		wantID    string // Пусто - сгенерированный
+		status    int
+		level     string // Уровень строки о запросе
+		wantError string
+	}{
+		{name: "ID от клиента", path: "/parkings/1?token=abc", requestID: "req-1", wantID: "req-1", status: 200, level: "INFO"},
+		{name: "ID генерируется", path: "/parkings/1", status: 200, level: "INFO"},
+		{name: "слишком длинный ID заменяется", path: "/parkings/1", requestID: strings.Repeat("x", 65), status: 200, level: "INFO"},
+		{name: "ошибка обработчика", path: "/parkings/1?fail=1", requestID: "req-2", wantID: "req-2", status: 500, level: "ERROR",
+			wantError: "база недоступна"},
+		{name: "проба", path: "/healthz", status: 200, level: "DEBUG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if tt.wantID != "" && id != tt.wantID || tt.wantID == "" && len(id) != 16 {
+				t.Errorf("ID запроса %q, ожидался %q", id, tt.wantID)
+			}
+			if w.Code != tt.status {
+				t.Errorf("ответ %d, ожидался %d", w.Code, tt.status)
+			}
+
+			records := logs()
+			if len(records) == 0 {
+				t.Fatal("нет записей в логе")
+			}
+			// ID запроса есть во всех записях, в том числе из обработчика
+			for _, r := range records {
+				if r["request_id"] != id {
+					t.Errorf("запись %v без ID запроса %s", r, id)
+				}
+			}
+			last := records[len(records)-1]
+			if last["level"] != tt.level || last["status"] != float64(tt.status) {
+				t.Errorf("строка запроса %v, ожидались уровень %s и статус %d", last, tt.level, tt.status)
+			}
+			if path, _ := last["path"].(string); strings.Contains(path, "?") {
+				t.Errorf("в логе query-строка: %s", path)
+			}
+			if errText, _ := last["error"].(string); !strings.Contains(errText, tt.wantError) {
+				t.Errorf("ошибка %q, ожидалась %q", errText, tt.wantError)
+			}
+		})
+	}
+
+	// Паника выходит за RequestLogger: в логе остается запись восстановления
+	// со стеком, а клиент получает обычную ошибку 500
+	t.Run("паника", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+		req.Header.Set(requestIDHeader, "req-3")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var body struct {
+			Code ErrorCode `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusInternalServerError || body.Code != CodeInternal {
+			t.Errorf("ответ %d %s, ожидался 500 %s", w.Code, w.Body, CodeInternal)
+		}
+		records := logs()
+		if len(records) != 1 || records[0]["level"] != "ERROR" || records[0]["panic"] != "сбой" ||
+			records[0]["request_id"] != "req-3" || records[0]["stack"] == "" {
+			t.Errorf("записи %v, ожидалась запись о панике со стеком", records)
+		}
+	})
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-db")
+	sql := func() (string, int64) { return "SELECT * FROM users WHERE email = $1", 1 }
+
+	tests := []struct {
+		name    string
+		level   string
+		elapsed time.Duration
+		err     error
+		want    string // Уровень записи; пусто - ничего не пишется
+	}{
+		{"ошибка", "info", 0, errors.New("connection refused"), "ERROR"},
+		{"запись не найдена", "info", 0, gorm.ErrRecordNotFound, ""},
+		{"медленный запрос", "info", slowQueryThreshold + time.Millisecond, nil, "WARN"},
+		{"обычный запрос", "info", 0, nil, ""},
+		{"обычный запрос на уровне debug", "debug", 0, nil, "DEBUG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t, tt.level)
+			newGormLogger(LogConfig{Level: tt.level}).Trace(ctx, time.Now().Add(-tt.elapsed), sql, tt.err)
+
+			records := logs()
+			if tt.want == "" {
+				if len(records) != 0 {
+					t.Errorf("лишние записи: %v", records)
+				}
+				return
+			}
+			if len(records) != 1 || records[0]["level"] != tt.want || records[0]["request_id"] != "req-db" {
+				t.Fatalf("%v, ожидалась запись %s с ID запроса", records, tt.want)
+			}
+			if records[0]["sql"] != "SELECT * FROM users WHERE email = $1" {
+				t.Errorf("запрос %v", records[0]["sql"])
+			}
+		})
+	}
+
+	// Значения параметров в текст запроса не попадают
+	if sql, params := (gormLogger{level: gormlogger.Info}).ParamsFilter(ctx, "SELECT $1", "secret"); sql != "SELECT $1" || params != nil {
+		t.Errorf("%q, %v", sql, params)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailAttachment вложение письма
+type MailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// MailMessage письмо с текстом и вложениями
+type MailMessage struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []MailAttachment
+}
+
+// Mailer отправляет письма. Реализация выбирается настройкой mail.driver
+// (MAIL_DRIVER): smtp - настоящая отправка, capture (по умолчанию) - последние
+// письма остаются в памяти, а если задан mail.capture_dir, еще и сохраняются
+// туда, чтобы их можно было посмотреть при разработке и в тестах.
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+func newMailer(cfg MailConfig) Mailer {
+	if cfg.Driver == "smtp" {
+		var auth smtp.Auth
+		if cfg.SMTPUser != "" {
+			auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPHost)
+		}
+		addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+		return &smtpMailer{addr: addr, from: cfg.From, auth: auth}
+	}
+
+	return &captureMailer{from: cfg.From, dir: cfg.CaptureDir}
+}
+
+// buildMIME собирает письмо в формате multipart/mixed
+func buildMIME(from string, msg MailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	body, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(body, []byte(msg.Body)); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 кодирует данные строками по 76 символов, как требует RFC 2045
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(msg MailMessage) error {
+	data, err := buildMIME(m.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, msg.To, data)
+}
+
+// captureKeep сколько последних писем captureMailer держит в памяти
+const captureKeep = 100
+
+// captureMailer ничего не отправляет: хранит последние captureKeep писем в
+// памяти и, если задан каталог, сохраняет все письма туда .eml-файлами
+type captureMailer struct {
+	from string
+	dir  string
+
+	mu    sync.Mutex
+	sent  []MailMessage // Кольцевой буфер, самое старое письмо - sent[total%captureKeep]
+	total int
+}
+
+func (m *captureMailer) Send(msg MailMessage) error {
+	m.mu.Lock()
+	if len(m.sent) < captureKeep {
+		m.sent = append(m.sent, msg)
+	} else {
+		m.sent[m.total%captureKeep] = msg
+	}
+	m.total++
+	n := m.total
+	m.mu.Unlock()
+
+	slog.Info("Письмо сохранено", "to", strings.Join(msg.To, ", "), "subject", msg.Subject, "attachments", len(msg.Attachments))
+	if m.dir == "" {
+		return nil
+	}
+
+	data, err := buildMIME(m.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), n)
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o640)
+}
+
+// Sent возвращает последние перехваченные письма, от старых к новым
+func (m *captureMailer) Sent() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldest := 0
+	if len(m.sent) == captureKeep {
+		oldest = m.total % captureKeep
+	}
+	return append(append([]MailMessage(nil), m.sent[oldest:]...), m.sent[:oldest]...)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaptureMailer(t *testing.T) {
+	tests := []struct {
+		name      string
+		sends     int
+		dir       bool
+		wantFirst int // Номер самого старого письма в памяти
+		wantKept  int
+	}{
+		{"несколько писем", 3, false, 0, 3},
+		{"ровно на размер буфера", captureKeep, false, 0, captureKeep},
+		// Старые письма вытесняются, порядок - от старых к новым
+		{"больше буфера", captureKeep*2 + 5, false, captureKeep + 5, captureKeep},
+		// В каталог попадают все письма, а не только последние
+		{"с каталогом", captureKeep + 1, true, 1, captureKeep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &captureMailer{from: "parking@localhost"}
+			if tt.dir {
+				m.dir = t.TempDir()
+			}
+			for i := 0; i < tt.sends; i++ {
+				if err := m.Send(MailMessage{To: []string{"owner@example.com"}, Subject: fmt.Sprint(i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sent := m.Sent()
+			if len(sent) != tt.wantKept {
+				t.Fatalf("в памяти %d писем, ожидалось %d", len(sent), tt.wantKept)
+			}
+			for i, msg := range sent {
+				if want := fmt.Sprint(tt.wantFirst + i); msg.Subject != want {
+					t.Fatalf("письмо %d - %q, ожидалось %q", i, msg.Subject, want)
+				}
+			}
+
+			if tt.dir {
+				files, err := os.ReadDir(m.dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(files) != tt.sends {
+					t.Errorf("в каталоге %d файлов, ожидалось %d", len(files), tt.sends)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMIME(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         MailMessage
+		wantSubject string
+	}{
+		{"без вложений", MailMessage{To: []string{"a@example.com"}, Subject: "Hello", Body: "Текст"}, "Hello"},
+		{"кириллица в теме и вложения", MailMessage{
+			To:      []string{"a@example.com", "b@example.com"},
+			Subject: "Отчет по парковке",
+			// Длиннее 76 символов в base64 - проверяет перенос строк
+			Body: strings.Repeat("Выручка за неделю. ", 10),
+			Attachments: []MailAttachment{
+				{Filename: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.3")},
+				{Filename: "отчет.csv", ContentType: "text/csv", Data: []byte("a,b\n1,2\n")},
+			},
+		}, "Отчет по парковке"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildMIME("parking@localhost", tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != tt.wantSubject {
+				t.Errorf("тема %q (%v), ожидалось %q", subject, err, tt.wantSubject)
+			}
+			if to := parsed.Header.Get("To"); to != strings.Join(tt.msg.To, ", ") {
+				t.Errorf("получатели %q", to)
+			}
+
+			_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parts, filenames []string
+			r := multipart.NewReader(parsed.Body, params["boundary"])
+			for {
+				part, err := r.NextRawPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				raw, err := io.ReadAll(part)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, line := range strings.Split(string(raw), "\r\n") {
+					if len(line) > 76 {
+						t.Fatalf("строка длиннее 76 символов: %q", line)
+					}
+				}
+				decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+				if err != nil {
+					t.Fatal(err)
+				}
+				parts = append(parts, string(decoded))
+				filenames = append(filenames, part.FileName())
+			}
+
+			want := []string{tt.msg.Body}
+			wantNames := []string{""}
+			for _, a := range tt.msg.Attachments {
+				want = append(want, string(a.Data))
+				wantNames = append(wantNames, a.Filename)
+			}
+			if fmt.Sprint(parts) != fmt.Sprint(want) || fmt.Sprint(filenames) != fmt.Sprint(wantNames) {
+				t.Errorf("части %q с файлами %q, ожидалось %q с %q", parts, filenames, want, wantNames)
+			}
+		})
+	}
+}
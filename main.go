@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -25,13 +36,19 @@ var (
 		},
 	}
 	clients   = make(map[*websocket.Conn]bool)
-	broadcast = make(chan SpotUpdate)
+	clientsMu sync.Mutex
+	// Буфер сглаживает всплески обновлений; его заполненность видна в
+	// метрике parking_broadcast_queue_depth
+	broadcast = make(chan SpotUpdate, 256)
 )
 
 // SpotUpdate структура для обновлений свободных мест
 type SpotUpdate struct {
 	ParkingID uint `json:"parking_id"`
 	Available int  `json:"available"`
+
+	// origin спан запроса, вызвавшего обновление; рассылка ссылается на него
+	origin trace.SpanContext
 }
 
 func main() {
@@ -39,72 +56,197 @@ func main() {
 	if err != nil {
 		log.Println("Нет .env файла, используются переменные окружения системы")
 	}
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("Переменная DATABASE_URL не установлена")
+
+	cfg, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) > 0 {
+		if cmd, ok := offlineCommands[args[0]]; ok {
+			if err := cmd(args[1:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	serving := len(args) == 0 || args[0] == "serve"
+	if err := cfg.Validate(serving); err != nil {
+		log.Fatal(err)
+	}
+	setupLogging(cfg.Log)
+
+	db, err = gorm.Open(postgres.Open(cfg.Database.URL), &gorm.Config{Logger: newGormLogger(cfg.Log), TranslateError: true})
+	if err != nil {
+		log.Fatal("Не удалось подключиться к базе данных:", err)
+	}
+	if err := db.Use(gormTracing{}); err != nil {
+		log.Fatal("Не удалось подключить трассировку запросов к базе:", err)
 	}
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := db.DB()
 	if err != nil {
 		log.Fatal("Не удалось подключиться к базе данных:", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+
+	if err := runCommand(cfg, args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve запускает HTTP-сервер, сервер шлагбаумов и фоновые задачи
+func serve(cfg Config) error {
+	// Схема меняется только подкомандой migrate, сервер ее лишь проверяет
+	if err := checkSchemaVersion(db); err != nil {
+		return err
+	}
+
+	// SIGINT/SIGTERM запускают плавную остановку, см. shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stopTracing, err := setupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
 
-	err = db.AutoMigrate(&Parking{}, &Spot{}, &Tariff{}, &Entry{}, &Exit{}, &Vehicle{}, &User{}, &Payment{})
+	limits, err := newRateLimiter(cfg.RateLimit)
 	if err != nil {
-		log.Fatal("Не удалось выполнить миграции:", err)
+		return err
 	}
+	defer limits.Close()
 
-	router := gin.Default()
-	router.POST("/register", Register)
-	router.POST("/login", Login)
-	router.GET("/ws", WebSocketHandler)
+	services := newServices(cfg)
+	api := NewAPI(cfg.Auth, newGormStore(db), featureEntryPolicy{pricing: services.Pricing}, services, broadcast, limits)
+	upgrader.CheckOrigin = webSocketOriginCheck(cfg.CORS)
 
-	authorized := router.Group("/")
-	authorized.Use(AuthMiddleware())
-	{
-		authorized.POST("/parkings", CreateParking)
-		authorized.GET("/parkings", GetParkings)
-		authorized.GET("/parkings/:id", GetParking)
-		authorized.GET("/parkings/:id/spots", GetSpots)
-		authorized.POST("/parkings/:id/spots", AddSpot)
-		authorized.POST("/entries", CreateEntry)
-		authorized.POST("/exits", CreateExit)
-		authorized.GET("/analytics", GetAnalytics)
-		authorized.POST("/payments", ProcessPayment)
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+	router.Use(RecoveryMiddleware(), TracingMiddleware(), RequestIDMiddleware(), RequestLogger(), MetricsMiddleware())
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		router.Use(CORSMiddleware(cfg.CORS))
 	}
+	setupRoutes(router, api, cfg.API)
+	router.GET("/openapi.json", OpenAPIHandler(apiRoutes(api)))
+	router.GET("/docs", SwaggerUI)
 
-	go handleMessages()
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+	hubDone := make(chan struct{})
+	go func() {
+		handleMessages(hubCtx)
+		close(hubDone)
+	}()
 
-	// Запуск сервера
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	goBackground(func() { runSensorMonitor(ctx) })
+	goBackground(func() { runPermitJobs(ctx, services.Mailer) })
+	goBackground(func() { runInvoiceJobs(ctx) })
+	goBackground(func() { runRollups(ctx) })
+	goBackground(func() { runForecastJobs(ctx) })
+	goBackground(func() { runReportJobs(ctx, services) })
+	goBackground(func() { runExportCleanup(ctx, services.Export) })
+	goBackground(func() { runDynamicPricing(ctx) })
+
+	// Сервер контроллеров шлагбаумов
+	go func() {
+		if err := gates.ListenAndServe(cfg.Gates.ListenAddr); err != nil {
+			slog.Error("Ошибка сервера шлагбаумов", "error", err)
+		}
+	}()
+	if cfg.Gates.Simulator {
+		_, gatePort, _ := net.SplitHostPort(cfg.Gates.ListenAddr)
+		go startGateSimulators(net.JoinHostPort("localhost", gatePort))
 	}
+
+	// Запуск сервера
+	port := cfg.Server.Port
 	srv := &http.Server{
-		Addr:           ":" + port,
+		Addr:           fmt.Sprintf(":%d", port),
 		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	log.Printf("Сервер запущен на порту %s", port)
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal("Ошибка запуска сервера:", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+	slog.Info("Сервер запущен", "port", port)
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("ошибка запуска сервера: %w", err)
+		}
+	case <-ctx.Done():
+		slog.Info("Получен сигнал остановки, завершаем текущие запросы")
 	}
+	stop()
+	return shutdown(srv, cfg.Server.ShutdownTimeout, stopHub, hubDone, stopTracing)
 }
 
-// handleMessages обрабатывает отправку обновлений через WebSocket
-func handleMessages() {
+// handleMessages обрабатывает отправку обновлений через WebSocket. При
+// отмене ctx отправляет клиентам кадр закрытия и завершается.
+func handleMessages(ctx context.Context) {
 	for {
-		update := <-broadcast
-
-		for client := range clients {
-			err := client.WriteJSON(update)
-			if err != nil {
-				log.Printf("Ошибка отправки сообщения клиенту: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
+		select {
+		case <-ctx.Done():
+			closeClients()
+			return
+		case update := <-broadcast:
+			sendUpdate(update)
+		}
+	}
+}
+
+// sendUpdate рассылает обновление всем клиентам. Спан рассылки - корень
+// своей трассы со ссылкой на спан запроса, который вызвал обновление.
+func sendUpdate(update SpotUpdate) {
+	_, span := tracer.Start(context.Background(), "websocket.broadcast",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(trace.Link{SpanContext: update.origin}),
+		trace.WithAttributes(attribute.Int64("parking.id", int64(update.ParkingID))),
+	)
+	defer span.End()
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	sent, failed := 0, 0
+	for client := range clients {
+		err := client.WriteJSON(update)
+		if err != nil {
+			slog.Warn("Ошибка отправки сообщения WebSocket-клиенту", "error", err)
+			client.Close()
+			delete(clients, client)
+			failed++
+			continue
 		}
+		sent++
+	}
+	span.SetAttributes(
+		attribute.Int("websocket.clients", sent),
+		attribute.Int("websocket.failed", failed),
+	)
+}
+
+// closeClients закрывает все WebSocket-соединения с кодом 1001 (going away),
+// чтобы клиенты переподключились к другому экземпляру, а не считали это сбоем
+func closeClients() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "сервер останавливается")
+	deadline := time.Now().Add(time.Second)
+	for client := range clients {
+		client.WriteControl(websocket.CloseMessage, msg, deadline)
+		client.Close()
+		delete(clients, client)
 	}
 }
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Статусы продавцов: новый продавец выдает скидки только после одобрения
+// администратором, иначе любой пользователь мог бы раздавать бесплатную
+// парковку на чужой парковке
+const (
+	MerchantStatusPending  = "pending"
+	MerchantStatusApproved = "approved"
+)
+
+// Статусы валидаций
+const (
+	ValidationStatusIssued    = "issued"    // код выдан, но еще не предъявлен
+	ValidationStatusValidated = "validated" // привязана к стоянке или номеру
+	ValidationStatusApplied   = "applied"   // учтена при оплате выезда
+)
+
+const (
+	// defaultDiscountMinutes - два бесплатных часа, как чаще всего просят арендаторы
+	defaultDiscountMinutes = 120
+	// maxValidationDiscountMinutes - предел скидки в запросах; настройка
+	// merchants.max_discount_minutes может ограничить сильнее
+	maxValidationDiscountMinutes = 24 * 60
+	// validationCodeLength и validationCodeAlphabet - без похожих символов 0/O и 1/I
+	validationCodeLength   = 8
+	validationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	errValidationCodeInvalid = errors.New("код валидации недействителен")
+	errMerchantLimitReached  = errors.New("продавец исчерпал лимит валидаций за месяц")
+)
+
+// merchantMonthlyUsage возвращает число валидаций продавца в текущем месяце
+func merchantMonthlyUsage(merchantID uint, now time.Time) int64 {
+	var used int64
+	db.Model(&Validation{}).
+		Where("merchant_id = ? AND validated_at >= ?", merchantID, monthStart(now)).
+		Count(&used)
+	return used
+}
+
+func merchantWithinLimit(merchant Merchant, now time.Time) bool {
+	return merchant.MonthlyLimit == 0 || merchantMonthlyUsage(merchant.ID, now) < int64(merchant.MonthlyLimit)
+}
+
+func generateValidationCode() (string, error) {
+	code := make([]byte, validationCodeLength)
+	max := big.NewInt(int64(len(validationCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = validationCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// collectValidations собирает скидки для выезда: валидации, привязанные к
+// стоянке или номеру автомобиля за время стоянки, и предъявленные коды.
+// Только читает: расчет суммы не расходует коды, их статус меняет
+// closeEntry вместе с сохранением выезда.
+func collectValidations(entry Entry, parkingID uint, codes []string, now time.Time) ([]Validation, error) {
+	var validations []Validation
+	db.Where("entry_id = ? AND status = ?", entry.ID, ValidationStatusValidated).Find(&validations)
+
+	var vehicle Vehicle
+	if err := db.First(&vehicle, entry.VehicleID).Error; err == nil {
+		var byPlate []Validation
+		db.Joins("JOIN merchants ON merchants.id = validations.merchant_id").
+			Where("validations.license_plate = ? AND validations.entry_id IS NULL AND validations.status = ?", vehicle.LicensePlate, ValidationStatusValidated).
+			Where("validations.validated_at BETWEEN ? AND ? AND merchants.parking_id = ?", entry.EntryTime, now, parkingID).
+			Find(&byPlate)
+		validations = append(validations, byPlate...)
+	}
+
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		var validation Validation
+		if err := db.Where("code = ? AND status = ?", code, ValidationStatusIssued).First(&validation).Error; err != nil {
+			return nil, errValidationCodeInvalid
+		}
+		if validation.ExpiresAt != nil && validation.ExpiresAt.Before(now) {
+			return nil, errValidationCodeInvalid
+		}
+
+		var merchant Merchant
+		if err := db.First(&merchant, validation.MerchantID).Error; err != nil ||
+			merchant.ParkingID != parkingID || merchant.Status != MerchantStatusApproved {
+			return nil, errValidationCodeInvalid
+		}
+		if !merchantWithinLimit(merchant, now) {
+			return nil, errMerchantLimitReached
+		}
+
+		validation.ValidatedAt = &now
+		validations = append(validations, validation)
+	}
+
+	return validations, nil
+}
+
+// validationDiscount суммирует скидку всех валидаций
+func validationDiscount(validations []Validation) time.Duration {
+	var minutes int
+	for _, v := range validations {
+		minutes += v.DiscountMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// applyValidations помечает валидации учтенными и распределяет сумму скидки
+// между продавцами пропорционально минутам, чтобы выставить им ее позже.
+// Сохраняет их closeEntry через ValidationRepository.
+func applyValidations(validations []Validation, entryID, paymentID uint, discountAmount float64, now time.Time) []Validation {
+	total := validationDiscount(validations)
+	applied := make([]Validation, 0, len(validations))
+	for _, v := range validations {
+		v.EntryID = &entryID
+		v.Status = ValidationStatusApplied
+		v.AppliedAt = &now
+		v.PaymentID = &paymentID
+		if total > 0 {
+			v.DiscountAmount = discountAmount * float64(v.DiscountMinutes) * float64(time.Minute) / float64(total)
+		}
+		applied = append(applied, v)
+	}
+	return applied
+}
+
+// merchantOwner загружает продавца текущего пользователя и сам отвечает клиенту
+func merchantOwner(c *gin.Context) (Merchant, bool) {
+	var merchant Merchant
+	if err := db.Where("owner_id = ?", c.GetUint("user_id")).First(&merchant, c.Param("id")).Error; err != nil {
+		respondError(c, CodeMerchantNotFound)
+		return merchant, false
+	}
+	return merchant, true
+}
+
+// approvedMerchant то же самое, но требует одобрения администратора
+func approvedMerchant(c *gin.Context) (Merchant, bool) {
+	merchant, ok := merchantOwner(c)
+	if ok && merchant.Status != MerchantStatusApproved {
+		respondError(c, CodeMerchantNotApproved)
+		return merchant, false
+	}
+	return merchant, ok
+}
+
+// discountAllowed проверяет скидку по настройке merchants.max_discount_minutes
+// и сам отвечает клиенту
+func (api *API) discountAllowed(c *gin.Context, minutes int) bool {
+	max := api.services.Merchants.MaxDiscountMinutes
+	if minutes > max {
+		writeError(c, &APIError{Code: CodeDiscountTooLarge, Extra: gin.H{"max_discount_minutes": max}})
+		return false
+	}
+	return true
+}
+
+type CreateMerchantRequest struct {
+	ParkingID       uint   `json:"parking_id" binding:"required"`
+	Name            string `json:"name" binding:"required"`
+	DiscountMinutes int    `json:"discount_minutes" binding:"gte=0,lte=1440"`
+	MonthlyLimit    int    `json:"monthly_limit" binding:"gte=0"`
+}
+
+// CreateMerchant регистрирует продавца. Выдавать скидки он сможет после
+// одобрения администратором, см. ApproveMerchant.
+func (api *API) CreateMerchant(c *gin.Context) {
+	var input CreateMerchantRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, input.ParkingID).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	merchant := Merchant{
+		ParkingID:       parking.ID,
+		OwnerID:         c.GetUint("user_id"),
+		Name:            input.Name,
+		DiscountMinutes: input.DiscountMinutes,
+		MonthlyLimit:    input.MonthlyLimit,
+		Status:          MerchantStatusPending,
+	}
+	if merchant.DiscountMinutes == 0 {
+		merchant.DiscountMinutes = min(defaultDiscountMinutes, api.services.Merchants.MaxDiscountMinutes)
+	}
+	if !api.discountAllowed(c, merchant.DiscountMinutes) {
+		return
+	}
+
+	if err := db.Create(&merchant).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeMerchantCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, merchant)
+}
+
+type GenerateValidationCodesRequest struct {
+	Count           int `json:"count" binding:"required,min=1,max=500"`
+	DiscountMinutes int `json:"discount_minutes" binding:"gte=0,lte=1440"`
+	ValidDays       int `json:"valid_days" binding:"gte=0"`
+}
+
+// GenerateValidationCodes выпускает коды, которые продавец раздает клиентам
+func (api *API) GenerateValidationCodes(c *gin.Context) {
+	merchant, ok := approvedMerchant(c)
+	if !ok {
+		return
+	}
+
+	var input GenerateValidationCodesRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	minutes := input.DiscountMinutes
+	if minutes == 0 {
+		minutes = merchant.DiscountMinutes
+	}
+	if !api.discountAllowed(c, minutes) {
+		return
+	}
+	var expiresAt *time.Time
+	if input.ValidDays > 0 {
+		t := time.Now().AddDate(0, 0, input.ValidDays)
+		expiresAt = &t
+	}
+
+	validations := make([]Validation, 0, input.Count)
+	for i := 0; i < input.Count; i++ {
+		code, err := generateValidationCode()
+		if err != nil {
+			c.Error(err)
+			respondError(c, CodeCodesGenerateFailed)
+			return
+		}
+		validations = append(validations, Validation{
+			MerchantID:      merchant.ID,
+			Code:            &code,
+			DiscountMinutes: minutes,
+			Status:          ValidationStatusIssued,
+			ExpiresAt:       expiresAt,
+		})
+	}
+
+	if err := db.Create(&validations).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeCodesSaveFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, validations)
+}
+
+type ValidateParkingRequest struct {
+	EntryID         uint   `json:"entry_id" binding:"required_without=LicensePlate"`
+	LicensePlate    string `json:"license_plate" binding:"required_without=EntryID"`
+	DiscountMinutes int    `json:"discount_minutes" binding:"gte=0,lte=1440"`
+}
+
+// ValidateParking валидирует стоянку по талону (ID въезда) или номеру автомобиля
+func (api *API) ValidateParking(c *gin.Context) {
+	merchant, ok := approvedMerchant(c)
+	if !ok {
+		return
+	}
+
+	var input ValidateParkingRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if !merchantWithinLimit(merchant, now) {
+		respondError(c, CodeMerchantLimitReached)
+		return
+	}
+
+	validation := Validation{
+		MerchantID:      merchant.ID,
+		LicensePlate:    input.LicensePlate,
+		DiscountMinutes: input.DiscountMinutes,
+		Status:          ValidationStatusValidated,
+		ValidatedAt:     &now,
+	}
+	if validation.DiscountMinutes == 0 {
+		validation.DiscountMinutes = merchant.DiscountMinutes
+	}
+	if !api.discountAllowed(c, validation.DiscountMinutes) {
+		return
+	}
+
+	// По номеру ищем открытую стоянку на парковке продавца; если машина еще
+	// не въехала, валидация дождется выезда по номеру
+	query := db.Joins("JOIN spots ON spots.id = entries.spot_id").
+		Where("entries.exit_time IS NULL AND spots.parking_id = ?", merchant.ParkingID)
+	if input.EntryID != 0 {
+		query = query.Where("entries.id = ?", input.EntryID)
+	} else {
+		query = query.Joins("JOIN vehicles ON vehicles.id = entries.vehicle_id").
+			Where("vehicles.license_plate = ?", input.LicensePlate)
+	}
+
+	var entry Entry
+	if err := query.First(&entry).Error; err == nil {
+		validation.EntryID = &entry.ID
+	} else if input.EntryID != 0 {
+		respondError(c, CodeOpenEntryNotFound)
+		return
+	}
+
+	if err := db.Create(&validation).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeValidationSaveFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, validation)
+}
+
+// GetMerchants список продавцов для администратора, ?status=pending -
+// ожидающие одобрения
+func GetMerchants(c *gin.Context) {
+	query := db.Order("created_at")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var merchants []Merchant
+	if err := query.Find(&merchants).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeMerchantsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchants)
+}
+
+// ApproveMerchant одобряет продавца: после этого он выдает скидки на своей
+// парковке
+func ApproveMerchant(c *gin.Context) {
+	var merchant Merchant
+	if err := db.First(&merchant, c.Param("id")).Error; err != nil {
+		respondError(c, CodeMerchantNotFound)
+		return
+	}
+
+	merchant.Status = MerchantStatusApproved
+	if err := db.Save(&merchant).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeMerchantUpdateFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchant)
+}
+
+// MerchantReport отчет продавца за месяц
+type MerchantReport struct {
+	MerchantID      uint         `json:"merchant_id"`
+	Month           string       `json:"month"` // ГГГГ-ММ
+	Validations     int          `json:"validations"`
+	Applied         int          `json:"applied"`
+	MonthlyLimit    int          `json:"monthly_limit"`
+	DiscountMinutes int          `json:"discount_minutes"`
+	DiscountAmount  float64      `json:"discount_amount"`
+	Items           []Validation `json:"items"`
+}
+
+// GetMerchantReport возвращает отчет продавца за месяц для выставления ему счета
+func GetMerchantReport(c *gin.Context) {
+	merchant, ok := merchantOwner(c)
+	if !ok {
+		return
+	}
+
+	start := monthStart(time.Now())
+	if month := c.Query("month"); month != "" {
+		parsed, err := time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			respondError(c, CodeInvalidMonth)
+			return
+		}
+		start = parsed
+	}
+	end := start.AddDate(0, 1, 0)
+
+	var validations []Validation
+	if err := db.Where("merchant_id = ? AND validated_at >= ? AND validated_at < ?", merchant.ID, start, end).
+		Order("validated_at").Find(&validations).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeValidationsListFailed)
+		return
+	}
+
+	var applied, minutes int
+	var amount float64
+	for _, v := range validations {
+		if v.Status != ValidationStatusApplied {
+			continue
+		}
+		applied++
+		minutes += v.DiscountMinutes
+		amount += v.DiscountAmount
+	}
+
+	c.JSON(http.StatusOK, MerchantReport{
+		MerchantID:      merchant.ID,
+		Month:           start.Format("2006-01"),
+		Validations:     len(validations),
+		Applied:         applied,
+		MonthlyLimit:    merchant.MonthlyLimit,
+		DiscountMinutes: minutes,
+		DiscountAmount:  amount,
+		Items:           validations,
+	})
+}
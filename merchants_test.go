@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateValidationCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := generateValidationCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != validationCodeLength {
+			t.Fatalf("код %q длиной %d, ожидалось %d", code, len(code), validationCodeLength)
+		}
+		for _, r := range code {
+			if !strings.ContainsRune(validationCodeAlphabet, r) {
+				t.Fatalf("код %q содержит %q", code, r)
+			}
+		}
+		if seen[code] {
+			t.Fatalf("код %q повторился", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestApplyValidations(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		minutes      []int
+		amount       float64
+		wantDiscount time.Duration
+		wantAmounts  []float64
+	}{
+		{"без валидаций", nil, 0, 0, nil},
+		{"один продавец", []int{120}, 200, 2 * time.Hour, []float64{200}},
+		{"пропорционально минутам", []int{30, 90}, 200, 2 * time.Hour, []float64{50, 150}},
+		{"нулевая скидка", []int{0}, 0, 0, []float64{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validations []Validation
+			for i, m := range tt.minutes {
+				validations = append(validations, Validation{ID: uint(i + 1), DiscountMinutes: m, Status: ValidationStatusIssued})
+			}
+			if got := validationDiscount(validations); got != tt.wantDiscount {
+				t.Errorf("скидка %s, ожидалось %s", got, tt.wantDiscount)
+			}
+
+			applied := applyValidations(validations, 7, 9, tt.amount, now)
+			for i, v := range applied {
+				if v.Status != ValidationStatusApplied || *v.EntryID != 7 || *v.PaymentID != 9 || !v.AppliedAt.Equal(now) {
+					t.Errorf("валидация %d не учтена: %+v", v.ID, v)
+				}
+				if v.DiscountAmount != tt.wantAmounts[i] {
+					t.Errorf("валидация %d компенсирует %v, ожидалось %v", v.ID, v.DiscountAmount, tt.wantAmounts[i])
+				}
+			}
+		})
+	}
+}
+
+// merchantFixture продавец парковки со статусом status и лимитом limit
+func merchantFixture(t *testing.T, parkingID uint, status string, limit int) Merchant {
+	t.Helper()
+	merchant := Merchant{ParkingID: parkingID, OwnerID: 1, Name: "Кафе", DiscountMinutes: 60, MonthlyLimit: limit, Status: status}
+	if err := db.Create(&merchant).Error; err != nil {
+		t.Fatal(err)
+	}
+	return merchant
+}
+
+func TestCollectValidations(t *testing.T) {
+	testDB(t)
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+
+	var parkings [2]Parking
+	for i := range parkings {
+		parkings[i] = Parking{Name: fmt.Sprintf("Парковка %d", i), Capacity: 1}
+		if err := db.Create(&parkings[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	approved := merchantFixture(t, parkings[0].ID, MerchantStatusApproved, 0)
+	pending := merchantFixture(t, parkings[0].ID, MerchantStatusPending, 0)
+	otherParking := merchantFixture(t, parkings[1].ID, MerchantStatusApproved, 0)
+	exhausted := merchantFixture(t, parkings[0].ID, MerchantStatusApproved, 1)
+
+	code := func(merchant Merchant, value string, minutes int, expiresAt *time.Time) {
+		v := Validation{MerchantID: merchant.ID, Code: &value, DiscountMinutes: minutes, Status: ValidationStatusIssued, ExpiresAt: expiresAt}
+		if err := db.Create(&v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	code(approved, "GOOD30", 30, nil)
+	code(approved, "GOOD60", 60, nil)
+	code(approved, "EXPIRED", 60, &expired)
+	code(pending, "PENDING", 60, nil)
+	code(otherParking, "OTHER", 60, nil)
+	code(exhausted, "LIMIT", 60, nil)
+	// Лимит продавца уже выбран валидацией в этом месяце
+	if err := db.Create(&Validation{MerchantID: exhausted.ID, DiscountMinutes: 60, Status: ValidationStatusApplied, ValidatedAt: &now}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	user := User{Name: "Водитель", Email: "driver@example.com", Password: "x", Role: UserRoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	car := Vehicle{LicensePlate: "А123ВС77", OwnerID: user.ID}
+	if err := db.Create(&car).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{VehicleID: car.ID, EntryTime: now.Add(-3 * time.Hour)}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Валидации по номеру: за время стоянки и до въезда
+	during, before := now.Add(-time.Hour), now.Add(-4*time.Hour)
+	for _, at := range []*time.Time{&during, &before} {
+		if err := db.Create(&Validation{MerchantID: approved.ID, LicensePlate: car.LicensePlate, DiscountMinutes: 15,
+			Status: ValidationStatusValidated, ValidatedAt: at}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		codes   []string
+		want    time.Duration
+		wantErr error
+	}{
+		{"только по номеру", nil, 15 * time.Minute, nil},
+		{"коды и номер", []string{"GOOD30", "GOOD60"}, 105 * time.Minute, nil},
+		{"повторный код учитывается один раз", []string{"GOOD30", "GOOD30"}, 45 * time.Minute, nil},
+		{"неизвестный код", []string{"NOPE"}, 0, errValidationCodeInvalid},
+		{"истекший код", []string{"EXPIRED"}, 0, errValidationCodeInvalid},
+		{"продавец не одобрен", []string{"PENDING"}, 0, errValidationCodeInvalid},
+		{"продавец другой парковки", []string{"OTHER"}, 0, errValidationCodeInvalid},
+		{"лимит продавца исчерпан", []string{"LIMIT"}, 0, errMerchantLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validations, err := collectValidations(entry, parkings[0].ID, tt.codes, now)
+			if err != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+			}
+			if got := validationDiscount(validations); got != tt.want {
+				t.Errorf("скидка %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerchantValidationCodes(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, func(cfg *Config) { cfg.Merchants.MaxDiscountMinutes = 180 })
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	s.createUser("cafe@example.com", "secret123", UserRoleUser)
+	owner := s.login("cafe@example.com", "secret123")
+	s.createUser("other@example.com", "secret123", UserRoleUser)
+	stranger := s.login("other@example.com", "secret123")
+
+	parking := Parking{Name: "ТЦ", Capacity: 1}
+	if err := db.Create(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectError(s.do(http.MethodPost, "/api/v1/merchants", owner, CreateMerchantRequest{ParkingID: parking.ID, Name: "Кафе", DiscountMinutes: 240}),
+		http.StatusBadRequest, CodeDiscountTooLarge)
+	var merchant Merchant
+	s.expect(s.do(http.MethodPost, "/api/v1/merchants", owner, CreateMerchantRequest{ParkingID: parking.ID, Name: "Кафе"}), http.StatusCreated, &merchant)
+	// Два часа по умолчанию, если их не запрещает настройка
+	if merchant.Status != MerchantStatusPending || merchant.DiscountMinutes != defaultDiscountMinutes {
+		t.Fatalf("продавец %s со скидкой %d, ожидался pending со скидкой %d", merchant.Status, merchant.DiscountMinutes, defaultDiscountMinutes)
+	}
+	codesPath := fmt.Sprintf("/api/v1/merchants/%d/codes", merchant.ID)
+
+	approve := func() {
+		s.expect(s.do(http.MethodPost, fmt.Sprintf("/api/v1/merchants/%d/approve", merchant.ID), admin, nil), http.StatusOK, nil)
+	}
+	tests := []struct {
+		name    string
+		before  func()
+		token   string
+		request GenerateValidationCodesRequest
+		status  int
+		code    ErrorCode
+		minutes int
+	}{
+		{"до одобрения", nil, owner, GenerateValidationCodesRequest{Count: 1}, http.StatusForbidden, CodeMerchantNotApproved, 0},
+		{"чужой продавец", approve, stranger, GenerateValidationCodesRequest{Count: 1}, http.StatusNotFound, CodeMerchantNotFound, 0},
+		{"скидка сверх настройки", nil, owner, GenerateValidationCodesRequest{Count: 1, DiscountMinutes: 181}, http.StatusBadRequest, CodeDiscountTooLarge, 0},
+		{"скидка продавца", nil, owner, GenerateValidationCodesRequest{Count: 3}, http.StatusCreated, "", defaultDiscountMinutes},
+		{"своя скидка", nil, owner, GenerateValidationCodesRequest{Count: 2, DiscountMinutes: 30, ValidDays: 7}, http.StatusCreated, "", 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			w := s.do(http.MethodPost, codesPath, tt.token, tt.request)
+			if tt.code != "" {
+				s.expectError(w, tt.status, tt.code)
+				return
+			}
+			var codes []Validation
+			s.expect(w, tt.status, &codes)
+			if len(codes) != tt.request.Count {
+				t.Fatalf("выпущено %d кодов, ожидалось %d", len(codes), tt.request.Count)
+			}
+			for _, v := range codes {
+				if v.Code == nil || v.DiscountMinutes != tt.minutes || v.Status != ValidationStatusIssued ||
+					(v.ExpiresAt != nil) != (tt.request.ValidDays > 0) {
+					t.Errorf("код %+v, ожидалась скидка %d", v, tt.minutes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Метрики Prometheus отдаются на GET /metrics. Метки parking_id берутся из
+// ID парковок, поэтому их число растет вместе с числом парковок, а не с
+// трафиком.
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "parking_http_request_duration_seconds",
+		Help:    "Время обработки HTTP-запросов по маршрутам",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_http_request_errors_total",
+		Help: "HTTP-ответы с кодом 4xx и 5xx по маршрутам",
+	}, []string{"method", "route", "status"})
+
+	legacyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_http_legacy_requests_total",
+		Help: "Запросы на устаревшие пути без префикса версии API",
+	}, []string{"method", "route"})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_rate_limited_total",
+		Help: "Запросы, отклоненные ограничением частоты, по ограничению",
+	}, []string{"limit"})
+
+	entriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_entries_total",
+		Help: "Зарегистрированные въезды",
+	}, []string{"parking_id"})
+
+	exitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_exits_total",
+		Help: "Зарегистрированные выезды",
+	}, []string{"parking_id"})
+
+	paymentResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "parking_payments_total",
+		Help: "Попытки оплаты у платежного провайдера по результату",
+	}, []string{"provider", "result"})
+
+	broadcastDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "parking_broadcast_dropped_total",
+		Help: "Обновления мест, отброшенные из-за заполненной очереди рассылки",
+	})
+
+	exitAmounts = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "parking_exit_amount_rubles",
+		Help:    "Сумма к оплате за выезд, рассчитанная calculatePayment, в рублях",
+		Buckets: []float64{0, 50, 100, 200, 300, 500, 750, 1000, 1500, 2500, 5000},
+	})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "parking_websocket_clients",
+		Help: "Подключенные WebSocket-клиенты",
+	}, func() float64 {
+		clientsMu.Lock()
+		defer clientsMu.Unlock()
+		return float64(len(clients))
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "parking_broadcast_queue_depth",
+		Help: "Обновления мест, ожидающие рассылки по WebSocket",
+	}, func() float64 {
+		return float64(len(broadcast))
+	})
+
+	prometheus.MustRegister(freeSpotsCollector{
+		desc: prometheus.NewDesc("parking_free_spots", "Свободные места по парковкам", []string{"parking_id"}, nil),
+	})
+}
+
+// freeSpotsCollector считает свободные места при каждом опросе, чтобы
+// значение не зависело от того, были ли события после перезапуска
+type freeSpotsCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c freeSpotsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c freeSpotsCollector) Collect(ch chan<- prometheus.Metric) {
+	if db == nil {
+		return
+	}
+
+	var rows []struct {
+		ParkingID uint
+		Free      int64
+	}
+	if err := db.Model(&Spot{}).
+		Select("parking_id, COUNT(*) FILTER (WHERE NOT is_occupied) AS free").
+		Group("parking_id").
+		Scan(&rows).Error; err != nil {
+		slog.Error("Не удалось посчитать свободные места для метрик", "error", err)
+		return
+	}
+	for _, row := range rows {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(row.Free), parkingLabel(row.ParkingID))
+	}
+}
+
+func parkingLabel(parkingID uint) string {
+	return strconv.FormatUint(uint64(parkingID), 10)
+}
+
+// MetricsMiddleware записывает время и ошибки запросов. Маршрут берется
+// шаблоном (/parkings/:id), чтобы ID не плодили ряды метрик.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		labels := []string{c.Request.Method, route, strconv.Itoa(status)}
+
+		httpRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		if status >= 400 {
+			httpRequestErrors.WithLabelValues(labels...).Inc()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// observations число наблюдений гистограммы
+func observations(t *testing.T, h prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		status := http.StatusOK
+		fmt.Sscan(c.Query("status"), &status)
+		c.Status(status)
+	})
+
+	tests := []struct {
+		path       string
+		route      string // Метка маршрута: шаблон, а не путь с ID
+		status     string
+		wantErrors float64
+	}{
+		{"/metrics-test/1", "/metrics-test/:id", "200", 0},
+		{"/metrics-test/2?status=404", "/metrics-test/:id", "404", 1},
+		{"/metrics-test/3?status=500", "/metrics-test/:id", "500", 1},
+		{"/metrics-test", "unmatched", "404", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			labels := []string{http.MethodGet, tt.route, tt.status}
+			requests := observations(t, httpRequestDuration.WithLabelValues(labels...))
+			errors := testutil.ToFloat64(httpRequestErrors.WithLabelValues(labels...))
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if got := observations(t, httpRequestDuration.WithLabelValues(labels...)) - requests; got != 1 {
+				t.Errorf("время записано %d раз, ожидалось 1", got)
+			}
+			if got := testutil.ToFloat64(httpRequestErrors.WithLabelValues(labels...)) - errors; got != tt.wantErrors {
+				t.Errorf("ошибок %v, ожидалось %v", got, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestEntryExitMetrics(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	driver := s.createUser("driver@example.com", "secret123", UserRoleUser)
+
+	var parking Parking
+	s.expect(s.do(http.MethodPost, "/api/v1/parkings", admin, CreateParkingRequest{Name: "Метрики", Latitude: 55.75, Longitude: 37.62, Capacity: 1,
+		Tariffs: []TariffInput{{Type: "почасовой", Price: 100}}}), http.StatusCreated, &parking)
+	var spot Spot
+	s.expect(s.do(http.MethodPost, fmt.Sprintf("/api/v1/parkings/%d/spots", parking.ID), admin, AddSpotRequest{Number: "1"}), http.StatusCreated, &spot)
+	car := Vehicle{LicensePlate: "М001ЕТ77", OwnerID: driver.ID}
+	if err := s.store.Vehicles.Create(&car); err != nil {
+		t.Fatal(err)
+	}
+
+	label := parkingLabel(parking.ID)
+	entries := testutil.ToFloat64(entriesTotal.WithLabelValues(label))
+	exits := testutil.ToFloat64(exitsTotal.WithLabelValues(label))
+	amounts := observations(t, exitAmounts)
+
+	entry := s.parkEntry(admin, spot.ID, car.ID, 2*time.Hour)
+	// Отклоненный выезд не считается
+	s.expectError(s.do(http.MethodPost, "/api/v1/exits", admin, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash", ValidationCodes: []string{"X"}}),
+		http.StatusBadRequest, CodeValidationCodeInvalid)
+	s.expect(s.do(http.MethodPost, "/api/v1/exits", admin, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash"}), http.StatusCreated, nil)
+
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"въезды", testutil.ToFloat64(entriesTotal.WithLabelValues(label)) - entries, 1},
+		{"выезды", testutil.ToFloat64(exitsTotal.WithLabelValues(label)) - exits, 1},
+		{"суммы выездов", float64(observations(t, exitAmounts) - amounts), 1},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %v, ожидалось %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// Эндпоинт отдает и HTTP-, и бизнес-метрики
+	w := s.do(http.MethodGet, "/metrics", "", nil)
+	body, _ := io.ReadAll(w.Body)
+	for _, name := range []string{"parking_entries_total", "parking_exits_total", "parking_exit_amount_rubles", "parking_broadcast_queue_depth", "parking_websocket_clients"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("в /metrics нет %s", name)
+		}
+	}
+}
+
+func TestFreeSpotsCollector(t *testing.T) {
+	testDB(t)
+	collector := freeSpotsCollector{desc: prometheus.NewDesc("parking_free_spots", "Свободные места по парковкам", []string{"parking_id"}, nil)}
+
+	tests := []struct {
+		name     string
+		occupied []bool // Места новой парковки
+	}{
+		{"есть свободные", []bool{false, true, false}},
+		{"все заняты", []bool{true, true}},
+	}
+	want := "# HELP parking_free_spots Свободные места по парковкам\n# TYPE parking_free_spots gauge\n"
+	for _, tt := range tests {
+		parking := Parking{Name: tt.name, Capacity: len(tt.occupied)}
+		create(t, &parking)
+		free := 0
+		for i, occupied := range tt.occupied {
+			create(t, &Spot{ParkingID: parking.ID, Number: fmt.Sprint(i), IsOccupied: occupied})
+			if !occupied {
+				free++
+			}
+		}
+		want += fmt.Sprintf("parking_free_spots{parking_id=\"%d\"} %d\n", parking.ID, free)
+	}
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Миграции схемы лежат в migrations/ парами NNNN_название.up.sql и
+// NNNN_название.down.sql и встраиваются в бинарник. Примененные версии
+// записываются в schema_migrations. Каждая миграция выполняется в своей
+// транзакции вместе с записью версии, поэтому половинчатых версий не бывает.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey - ключ pg_advisory_lock: мигрировать одновременно может
+// только один экземпляр, остальные ждут
+const migrationLockKey = 724019
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var errSchemaNotCurrent = errors.New("версия схемы базы не совпадает с ожидаемой")
+
+// migration одна версия схемы
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// schemaMigration строка таблицы schema_migrations
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// loadMigrations читает встроенные миграции, упорядоченные по версии
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("неверное имя файла миграции: %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("у миграции %d нет up или down скрипта", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// latestMigration возвращает версию последней известной миграции
+func latestMigration(migrations []migration) int64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// appliedMigrations возвращает примененные версии по возрастанию
+func appliedMigrations(tx *gorm.DB) ([]schemaMigration, error) {
+	if !tx.Migrator().HasTable(&schemaMigration{}) {
+		return nil, nil
+	}
+	var applied []schemaMigration
+	err := tx.Order("version").Find(&applied).Error
+	return applied, err
+}
+
+// withMigrationLock выполняет fn на одном соединении под advisory-блокировкой
+func withMigrationLock(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Connection(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		defer tx.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+
+		if err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// migrateUp применяет миграции до версии target включительно (0 - все)
+func migrateUp(db *gorm.DB, target int64) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(tx *gorm.DB) error {
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		done := make(map[int64]bool, len(applied))
+		for _, a := range applied {
+			done[a.Version] = true
+		}
+
+		for _, m := range migrations {
+			if done[m.Version] || (target != 0 && m.Version > target) {
+				continue
+			}
+			started := time.Now()
+			if err := tx.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(m.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			}); err != nil {
+				return fmt.Errorf("миграция %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("Применена миграция", "version", m.Version, "name", m.Name, "elapsed", time.Since(started))
+		}
+		return nil
+	})
+}
+
+// migrateDown откатывает последние steps примененных миграций
+func migrateDown(db *gorm.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	known := make(map[int64]migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	return withMigrationLock(db, func(tx *gorm.DB) error {
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && steps > 0; i, steps = i-1, steps-1 {
+			m, ok := known[applied[i].Version]
+			if !ok {
+				return fmt.Errorf("нет скрипта отката для версии %d", applied[i].Version)
+			}
+			if err := tx.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(m.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, m.Version).Error
+			}); err != nil {
+				return fmt.Errorf("откат %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("Откачена миграция", "version", m.Version, "name", m.Name)
+		}
+		return nil
+	})
+}
+
+// checkSchemaVersion не дает запуститься на базе, схема которой отстает от
+// кода или новее его (например, после отката бинарника)
+func checkSchemaVersion(db *gorm.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	var current int64
+	if len(applied) > 0 {
+		current = applied[len(applied)-1].Version
+	}
+	latest := latestMigration(migrations)
+
+	switch {
+	case current > latest:
+		return fmt.Errorf("%w: база на версии %d, код знает только до %d", errSchemaNotCurrent, current, latest)
+	case len(applied) < len(migrations):
+		return fmt.Errorf("%w: база на версии %d, нужна %d; выполните migrate up", errSchemaNotCurrent, current, latest)
+	}
+	return nil
+}
+
+// runMigrateCommand выполняет подкоманду migrate: up [версия], down [шагов], status
+func runMigrateCommand(db *gorm.DB, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	var n int64
+	if len(args) > 1 {
+		parsed, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("неверный аргумент: %s", args[1])
+		}
+		n = parsed
+	}
+
+	switch action {
+	case "up":
+		return migrateUp(db, n)
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		return migrateDown(db, int(n))
+	case "status":
+		migrations, err := loadMigrations()
+		if err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(db)
+		if err != nil {
+			return err
+		}
+		appliedAt := make(map[int64]time.Time, len(applied))
+		for _, a := range applied {
+			appliedAt[a.Version] = a.AppliedAt
+		}
+		for _, m := range migrations {
+			status := "не применена"
+			if t, ok := appliedAt[m.Version]; ok {
+				status = "применена " + t.Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%04d_%s\t%s\n", m.Version, m.Name, status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестное действие migrate: %s (up, down, status)", action)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("миграция %s: версия %d, ожидалась %d", m.Name, m.Version, i+1)
+		}
+	}
+}
+
+// testSchema открывает базу из TEST_DATABASE_URL в отдельной пустой схеме,
+// которая удаляется после теста. Без TEST_DATABASE_URL тест пропускается.
+func testSchema(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Одно соединение, чтобы search_path действовал на все запросы
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	schema := fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+	if err := conn.Exec(fmt.Sprintf(`CREATE SCHEMA %q`, schema)).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Exec(fmt.Sprintf(`DROP SCHEMA %q CASCADE`, schema)) })
+	if err := conn.Exec(fmt.Sprintf(`SET search_path TO %q`, schema)).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// schemaColumns возвращает колонки текущей схемы: таблица.колонка -> тип
+func schemaColumns(t *testing.T, conn *gorm.DB) map[string]string {
+	t.Helper()
+	var rows []struct {
+		TableName  string
+		ColumnName string
+		DataType   string
+	}
+	if err := conn.Raw(`SELECT table_name, column_name, data_type FROM information_schema.columns
+		WHERE table_schema = current_schema()`).Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]string, len(rows))
+	for _, r := range rows {
+		columns[r.TableName+"."+r.ColumnName] = r.DataType
+	}
+	return columns
+}
+
+// База, созданная AutoMigrate исходных моделей, после migrate up должна
+// получить ту же схему, что и новая
+func TestMigrateUpgradesBaselineSchema(t *testing.T) {
+	fresh := testSchema(t, "migrate_fresh")
+	if err := migrateUp(fresh, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := schemaColumns(t, fresh)
+
+	upgraded := testSchema(t, "migrate_upgrade")
+	baseline, err := os.ReadFile("testdata/baseline_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upgraded.Exec(string(baseline)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := upgraded.Exec(`INSERT INTO parkings (name, capacity) VALUES ('Старая', 10)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUp(upgraded, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := schemaColumns(t, upgraded); !reflect.DeepEqual(got, want) {
+		for column, typ := range want {
+			if got[column] != typ {
+				t.Errorf("%s: %q, ожидалось %q", column, got[column], typ)
+			}
+		}
+		for column := range got {
+			if _, ok := want[column]; !ok {
+				t.Errorf("%s: лишняя колонка", column)
+			}
+		}
+	}
+
+	var parking Parking
+	if err := upgraded.First(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	if parking.TimeZone != "UTC" {
+		t.Errorf("time_zone существующей парковки = %q, ожидалось UTC", parking.TimeZone)
+	}
+}
+
+// testDB накатывает миграции в отдельной схеме и подставляет ее в
+// глобальный db на время теста
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn := testSchema(t, "test")
+	if err := migrateUp(conn, 0); err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = conn
+	t.Cleanup(func() { db = prev })
+	return conn
+}
@@ -0,0 +1,28 @@
+DROP TABLE IF EXISTS "price_changes";
+DROP TABLE IF EXISTS "dynamic_pricings";
+DROP TABLE IF EXISTS "report_schedules";
+DROP TABLE IF EXISTS "export_jobs";
+DROP TABLE IF EXISTS "forecasts";
+DROP TABLE IF EXISTS "holidays";
+DROP TABLE IF EXISTS "rollup_states";
+DROP TABLE IF EXISTS "daily_rollups";
+DROP TABLE IF EXISTS "hourly_rollups";
+DROP TABLE IF EXISTS "validations";
+DROP TABLE IF EXISTS "merchants";
+DROP TABLE IF EXISTS "invoices";
+DROP TABLE IF EXISTS "organization_members";
+DROP TABLE IF EXISTS "organizations";
+DROP TABLE IF EXISTS "permits";
+DROP TABLE IF EXISTS "permit_products";
+DROP TABLE IF EXISTS "sensor_mismatches";
+DROP TABLE IF EXISTS "sensors";
+DROP TABLE IF EXISTS "gate_events";
+DROP TABLE IF EXISTS "lanes";
+DROP TABLE IF EXISTS "exits";
+DROP TABLE IF EXISTS "entries";
+DROP TABLE IF EXISTS "payments";
+DROP TABLE IF EXISTS "vehicles";
+DROP TABLE IF EXISTS "users";
+DROP TABLE IF EXISTS "tariffs";
+DROP TABLE IF EXISTS "spots";
+DROP TABLE IF EXISTS "parkings";
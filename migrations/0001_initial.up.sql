@@ -0,0 +1,416 @@
+-- Начальная схема. IF NOT EXISTS позволяет принять базу, созданную раньше
+-- через AutoMigrate: существующие таблицы остаются как есть, а колонки,
+-- которых в них могло не быть, добавляются через ADD COLUMN IF NOT EXISTS
+-- до создания индексов по ним.
+
+CREATE TABLE IF NOT EXISTS "parkings" (
+    "id" bigserial,
+    "name" text,
+    "latitude" decimal,
+    "longitude" decimal,
+    "capacity" bigint,
+    "time_zone" text DEFAULT 'UTC',
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "parkings" ADD COLUMN IF NOT EXISTS "time_zone" text DEFAULT 'UTC';
+CREATE INDEX IF NOT EXISTS "idx_parkings_deleted_at" ON "parkings" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "spots" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "number" text,
+    "zone" text,
+    "is_occupied" boolean,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_parkings_spots" FOREIGN KEY ("parking_id") REFERENCES "parkings"("id") ON DELETE CASCADE
+);
+ALTER TABLE "spots" ADD COLUMN IF NOT EXISTS "zone" text;
+CREATE INDEX IF NOT EXISTS "idx_spots_deleted_at" ON "spots" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "tariffs" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "type" text,
+    "price" decimal,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_parkings_tariffs" FOREIGN KEY ("parking_id") REFERENCES "parkings"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_tariffs_deleted_at" ON "tariffs" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" bigserial,
+    "name" text,
+    "email" text,
+    "password" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+
+CREATE TABLE IF NOT EXISTS "vehicles" (
+    "id" bigserial,
+    "license_plate" text,
+    "owner_id" bigint,
+    "organization_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_vehicles" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+ALTER TABLE "vehicles" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_vehicles_license_plate" ON "vehicles" ("license_plate");
+CREATE INDEX IF NOT EXISTS "idx_vehicles_deleted_at" ON "vehicles" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_vehicles_organization_id" ON "vehicles" ("organization_id");
+
+CREATE TABLE IF NOT EXISTS "payments" (
+    "id" bigserial,
+    "amount" decimal,
+    "method" text,
+    "status" text,
+    "provider_id" text,
+    "organization_id" bigint,
+    "invoice_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+ALTER TABLE "payments" ADD COLUMN IF NOT EXISTS "provider_id" text;
+ALTER TABLE "payments" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+ALTER TABLE "payments" ADD COLUMN IF NOT EXISTS "invoice_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_payments_deleted_at" ON "payments" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_payments_invoice_id" ON "payments" ("invoice_id");
+CREATE INDEX IF NOT EXISTS "idx_payments_organization_id" ON "payments" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_payments_provider_id" ON "payments" ("provider_id");
+
+CREATE TABLE IF NOT EXISTS "entries" (
+    "id" bigserial,
+    "spot_id" bigint,
+    "vehicle_id" bigint,
+    "entry_time" timestamptz,
+    "exit_time" timestamptz,
+    "locked_rate" decimal,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_spots_entries" FOREIGN KEY ("spot_id") REFERENCES "spots"("id") ON DELETE SET NULL
+);
+ALTER TABLE "entries" ADD COLUMN IF NOT EXISTS "locked_rate" decimal;
+CREATE INDEX IF NOT EXISTS "idx_entries_deleted_at" ON "entries" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "exits" (
+    "id" bigserial,
+    "entry_id" bigint,
+    "exit_time" timestamptz,
+    "payment_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_exits_payment" FOREIGN KEY ("payment_id") REFERENCES "payments"("id"),
+    CONSTRAINT "fk_entries_exit" FOREIGN KEY ("entry_id") REFERENCES "entries"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_exits_deleted_at" ON "exits" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "lanes" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "name" text,
+    "direction" text,
+    "device_id" text,
+    "status" text,
+    "last_seen_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_lanes_deleted_at" ON "lanes" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_lanes_device_id" ON "lanes" ("device_id");
+
+CREATE TABLE IF NOT EXISTS "gate_events" (
+    "id" bigserial,
+    "lane_id" bigint,
+    "type" text,
+    "detail" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_gate_events_lane_id" ON "gate_events" ("lane_id");
+
+CREATE TABLE IF NOT EXISTS "sensors" (
+    "id" bigserial,
+    "spot_id" bigint,
+    "external_id" text,
+    "kind" text,
+    "occupied" boolean,
+    "health" text,
+    "battery_level" bigint,
+    "error_count" bigint,
+    "last_seen_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sensors_external_id" ON "sensors" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_sensors_spot_id" ON "sensors" ("spot_id");
+CREATE INDEX IF NOT EXISTS "idx_sensors_deleted_at" ON "sensors" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "sensor_mismatches" (
+    "id" bigserial,
+    "spot_id" bigint,
+    "sensor_id" bigint,
+    "kind" text,
+    "entry_id" bigint,
+    "detected_at" timestamptz,
+    "resolved_at" timestamptz,
+    "resolution" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sensor_mismatches_spot_id" ON "sensor_mismatches" ("spot_id");
+
+CREATE TABLE IF NOT EXISTS "permit_products" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "name" text,
+    "period" text,
+    "window" text,
+    "spot_mode" text,
+    "price" decimal,
+    "overage_rate" decimal,
+    "active" boolean,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_permit_products_deleted_at" ON "permit_products" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_permit_products_parking_id" ON "permit_products" ("parking_id");
+
+CREATE TABLE IF NOT EXISTS "permits" (
+    "id" bigserial,
+    "product_id" bigint,
+    "vehicle_id" bigint,
+    "user_id" bigint,
+    "spot_id" bigint,
+    "starts_at" timestamptz,
+    "ends_at" timestamptz,
+    "status" text,
+    "last_payment_id" bigint,
+    "reminder_sent_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_permits_product" FOREIGN KEY ("product_id") REFERENCES "permit_products"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_permits_product_id" ON "permits" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_permits_deleted_at" ON "permits" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_permits_user_id" ON "permits" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_permits_vehicle_id" ON "permits" ("vehicle_id");
+
+CREATE TABLE IF NOT EXISTS "organizations" (
+    "id" bigserial,
+    "name" text,
+    "billing_email" text,
+    "billing_mode" text,
+    "spending_limit" decimal,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_organizations_deleted_at" ON "organizations" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "organization_members" (
+    "id" bigserial,
+    "organization_id" bigint,
+    "user_id" bigint,
+    "role" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_organization_members_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_organizations_members" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_org_member" ON "organization_members" ("organization_id","user_id");
+
+CREATE TABLE IF NOT EXISTS "invoices" (
+    "id" bigserial,
+    "organization_id" bigint,
+    "number" text,
+    "period_start" timestamptz,
+    "period_end" timestamptz,
+    "total" decimal,
+    "status" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_invoices_number" ON "invoices" ("number");
+CREATE INDEX IF NOT EXISTS "idx_invoices_organization_id" ON "invoices" ("organization_id");
+
+CREATE TABLE IF NOT EXISTS "merchants" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "owner_id" bigint,
+    "name" text,
+    "discount_minutes" bigint,
+    "monthly_limit" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_merchants_owner_id" ON "merchants" ("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_merchants_parking_id" ON "merchants" ("parking_id");
+CREATE INDEX IF NOT EXISTS "idx_merchants_deleted_at" ON "merchants" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "validations" (
+    "id" bigserial,
+    "merchant_id" bigint,
+    "code" text,
+    "entry_id" bigint,
+    "license_plate" text,
+    "discount_minutes" bigint,
+    "status" text,
+    "expires_at" timestamptz,
+    "validated_at" timestamptz,
+    "applied_at" timestamptz,
+    "payment_id" bigint,
+    "discount_amount" decimal,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_validations_license_plate" ON "validations" ("license_plate");
+CREATE INDEX IF NOT EXISTS "idx_validations_entry_id" ON "validations" ("entry_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_validations_code" ON "validations" ("code");
+CREATE INDEX IF NOT EXISTS "idx_validations_merchant_id" ON "validations" ("merchant_id");
+
+CREATE TABLE IF NOT EXISTS "hourly_rollups" (
+    "parking_id" bigint,
+    "bucket_start" timestamptz,
+    "entries" bigint,
+    "exits" bigint,
+    "occupancy_minutes" decimal,
+    "revenue" decimal,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("parking_id","bucket_start")
+);
+
+CREATE TABLE IF NOT EXISTS "daily_rollups" (
+    "parking_id" bigint,
+    "bucket_start" timestamptz,
+    "entries" bigint,
+    "exits" bigint,
+    "occupancy_minutes" decimal,
+    "revenue" decimal,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("parking_id","bucket_start")
+);
+
+CREATE TABLE IF NOT EXISTS "rollup_states" (
+    "id" bigserial,
+    "watermark" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "holidays" (
+    "id" bigserial,
+    "date" text,
+    "name" text,
+    "parking_id" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_holidays_date" ON "holidays" ("date");
+
+CREATE TABLE IF NOT EXISTS "forecasts" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "target_time" timestamptz,
+    "horizon_hours" bigint,
+    "predicted_free" decimal,
+    "actual_free" decimal,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_forecasts_target_time" ON "forecasts" ("target_time");
+CREATE INDEX IF NOT EXISTS "idx_forecasts_parking_id" ON "forecasts" ("parking_id");
+
+CREATE TABLE IF NOT EXISTS "export_jobs" (
+    "id" bigserial,
+    "user_id" bigint,
+    "dataset" text,
+    "format" text,
+    "query" text,
+    "status" text,
+    "rows" bigint,
+    "file_path" text,
+    "error" text,
+    "created_at" timestamptz,
+    "finished_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_export_jobs_user_id" ON "export_jobs" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "report_schedules" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "user_id" bigint,
+    "frequency" text,
+    "recipients" text,
+    "next_run_at" timestamptz,
+    "last_sent_at" timestamptz,
+    "last_error" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_report_schedules_deleted_at" ON "report_schedules" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_report_schedules_next_run_at" ON "report_schedules" ("next_run_at");
+CREATE INDEX IF NOT EXISTS "idx_report_schedules_user_id" ON "report_schedules" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_report_schedules_parking_id" ON "report_schedules" ("parking_id");
+
+CREATE TABLE IF NOT EXISTS "dynamic_pricings" (
+    "parking_id" bigint,
+    "enabled" boolean,
+    "floor_rate" decimal,
+    "ceiling_rate" decimal,
+    "step" decimal,
+    "low_occupancy" decimal,
+    "high_occupancy" decimal,
+    "current_rate" decimal,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("parking_id")
+);
+
+CREATE TABLE IF NOT EXISTS "price_changes" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "old_rate" decimal,
+    "new_rate" decimal,
+    "reason" text,
+    "occupancy" decimal,
+    "forecast_occupancy" decimal,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_price_changes_created_at" ON "price_changes" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_price_changes_parking_id" ON "price_changes" ("parking_id");
@@ -0,0 +1,21 @@
+-- Подтверждение email, сброс пароля и отзыв сессий. Пользователи,
+-- зарегистрированные до подтверждения email, считаются подтвержденными,
+-- чтобы не потерять вход.
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "email_verified_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "token_version" bigint DEFAULT 0;
+UPDATE "users" SET "email_verified_at" = "created_at" WHERE "email_verified_at" IS NULL;
+
+CREATE TABLE IF NOT EXISTS "user_tokens" (
+    "id" bigserial,
+    "user_id" bigint,
+    "purpose" text,
+    "token_hash" text,
+    "new_email" text,
+    "expires_at" timestamptz,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_tokens_token_hash" ON "user_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_user_tokens_user_id" ON "user_tokens" ("user_id");
@@ -0,0 +1 @@
+ALTER TABLE "lanes" DROP COLUMN IF EXISTS "device_secret_hash";
@@ -0,0 +1,3 @@
+-- Секрет устройства шлагбаума. У существующих полос его нет: они не
+-- подключатся, пока администратор не выдаст секрет (POST /lanes/:id/secret).
+ALTER TABLE "lanes" ADD COLUMN IF NOT EXISTS "device_secret_hash" text;
@@ -0,0 +1,5 @@
+-- Продавец выдает скидки только после одобрения администратором. Раньше
+-- регистрация ничем не проверялась, поэтому существующие продавцы тоже ждут
+-- одобрения: GET /merchants?status=pending, POST /merchants/:id/approve.
+ALTER TABLE "merchants" ADD COLUMN IF NOT EXISTS "status" text DEFAULT 'pending';
+UPDATE "merchants" SET "status" = 'pending' WHERE "status" IS NULL;
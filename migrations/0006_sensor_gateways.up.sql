@@ -0,0 +1,18 @@
+-- Шлюзы датчиков отправляют показания со своим секретом вместо JWT
+-- администратора. Существующие шлюзы перестанут приниматься, пока
+-- администратор не заведет их: POST /parkings/:id/sensor-gateways.
+CREATE TABLE IF NOT EXISTS "sensor_gateways" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "name" text,
+    "gateway_id" text,
+    "secret_hash" text,
+    "last_seen_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sensor_gateways_parking_id" ON "sensor_gateways" ("parking_id");
+CREATE INDEX IF NOT EXISTS "idx_sensor_gateways_deleted_at" ON "sensor_gateways" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sensor_gateways_gateway_id" ON "sensor_gateways" ("gateway_id");
@@ -0,0 +1 @@
+UPDATE "permits" SET "status" = 'expired' WHERE "status" = 'canceled';
@@ -0,0 +1,8 @@
+-- Абонементы, которые так и не были оплачены, раньше тоже получали статус
+-- expired. Теперь истекшие абонементы покрывают стоянки в пределах своего
+-- срока, поэтому неоплаченные переводятся в canceled: последний платеж по
+-- ним не прошел.
+UPDATE "permits" SET "status" = 'canceled'
+WHERE "status" = 'expired'
+  AND ("last_payment_id" IS NULL
+    OR "last_payment_id" IN (SELECT "id" FROM "payments" WHERE "status" <> 'succeeded'));
@@ -13,6 +13,7 @@ type Parking struct {
 	Latitude  float64        `json:"latitude"`
 	Longitude float64        `json:"longitude"`
 	Capacity  int            `json:"capacity"`
+	TimeZone  string         `json:"time_zone" gorm:"default:UTC"` // IANA-зона, в ней строится аналитика
 	Tariffs   []Tariff       `json:"tariffs" gorm:"foreignKey:ParkingID;constraint:OnDelete:CASCADE"`
 	Spots     []Spot         `json:"spots" gorm:"foreignKey:ParkingID;constraint:OnDelete:CASCADE"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -25,6 +26,7 @@ type Spot struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
 	ParkingID  uint           `json:"parking_id"`
 	Number     string         `json:"number"`
+	Zone       string         `json:"zone"` // Зона или уровень парковки
 	IsOccupied bool           `json:"is_occupied"`
 	Entries    []Entry        `json:"entries" gorm:"foreignKey:SpotID;constraint:OnDelete:SET NULL"`
 	CreatedAt  time.Time      `json:"created_at"`
@@ -45,15 +47,16 @@ type Tariff struct {
 
 // Въезд автомобиля (Entry)
 type Entry struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	SpotID    uint           `json:"spot_id"`
-	VehicleID uint           `json:"vehicle_id"`
-	EntryTime time.Time      `json:"entry_time"`
-	ExitTime  *time.Time     `json:"exit_time,omitempty"`
-	Exit      *Exit          `json:"exit,omitempty" gorm:"foreignKey:EntryID"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	SpotID     uint           `json:"spot_id"`
+	VehicleID  uint           `json:"vehicle_id"`
+	EntryTime  time.Time      `json:"entry_time"`
+	ExitTime   *time.Time     `json:"exit_time,omitempty"`
+	LockedRate *float64       `json:"locked_rate,omitempty"` // Почасовая ставка, зафиксированная при въезде
+	Exit       *Exit          `json:"exit,omitempty" gorm:"foreignKey:EntryID"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // Выезд автомобиля (Exit)
@@ -70,36 +73,337 @@ type Exit struct {
 
 // Автомобиль (Vehicle)
 type Vehicle struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	LicensePlate string         `json:"license_plate" gorm:"uniqueIndex"`
-	OwnerID      uint           `json:"owner_id"`
-	Owner        User           `json:"owner" gorm:"foreignKey:OwnerID"`
-	Entries      []Entry        `json:"entries" gorm:"foreignKey:VehicleID;constraint:OnDelete:SET NULL"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	LicensePlate   string         `json:"license_plate" gorm:"uniqueIndex"`
+	OwnerID        uint           `json:"owner_id"`
+	Owner          User           `json:"owner" gorm:"foreignKey:OwnerID"`
+	OrganizationID *uint          `json:"organization_id,omitempty" gorm:"index"` // Корпоративный автопарк
+	Entries        []Entry        `json:"entries" gorm:"foreignKey:VehicleID;constraint:OnDelete:SET NULL"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Пользователь (User)
+type User struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email" gorm:"uniqueIndex"`
+	Password        string     `json:"-"`                        // Хранится хеш пароля
+	Role            string     `json:"role" gorm:"default:user"` // user или admin
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// TokenVersion растет при смене пароля и email; JWT с другой версией
+	// отклоняются, так что смена завершает все сессии
+	TokenVersion int            `json:"-" gorm:"default:0"`
+	Vehicles     []Vehicle      `json:"vehicles" gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-// Пользователь (User)
-type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `json:"name"`
-	Email     string         `json:"email" gorm:"uniqueIndex"`
-	Password  string         `json:"-"` // Хранится хеш пароля
-	Vehicles  []Vehicle      `json:"vehicles" gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
-	Entries   []Entry        `json:"entries" gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+// Одноразовый токен из письма (UserToken): подтверждение email, сброс
+// пароля или смена email. Хранится только SHA-256 токена, сам токен есть
+// лишь в письме.
+type UserToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Purpose   string     `json:"purpose"` // verify_email, reset_password или change_email
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	NewEmail  string     `json:"new_email,omitempty"` // Новый адрес для change_email
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 // Платеж (Payment)
 type Payment struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Amount    float64        `json:"amount"`
-	Method    string         `json:"method"` // Например, кредитная карта, PayPal
-	Status    string         `json:"status"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Amount         float64        `json:"amount"`
+	Method         string         `json:"method"` // Например, кредитная карта, PayPal
+	Status         string         `json:"status"`
+	ProviderID     string         `json:"provider_id,omitempty" gorm:"index"`     // ID платежа в Stripe
+	OrganizationID *uint          `json:"organization_id,omitempty" gorm:"index"` // Постоплата организацией
+	InvoiceID      *uint          `json:"invoice_id,omitempty" gorm:"index"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Полоса въезда/выезда со шлагбаумом (Lane)
+type Lane struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ParkingID uint   `json:"parking_id"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"` // entry или exit
+	DeviceID  string `json:"device_id" gorm:"uniqueIndex"`
+	Status    string `json:"status"` // offline, closed, open, held_open, stuck
+	// DeviceSecretHash SHA-256 секрета, которым устройство подтверждает
+	// device_id; DeviceSecret - сам секрет, только в ответе на создание
+	// полосы и смену секрета
+	DeviceSecretHash string         `json:"-"`
+	DeviceSecret     string         `json:"device_secret,omitempty" gorm:"-"`
+	LastSeenAt       *time.Time     `json:"last_seen_at,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Событие шлагбаума (GateEvent)
+type GateEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	LaneID    uint      `json:"lane_id" gorm:"index"`
+	Type      string    `json:"type"` // vehicle_present, vehicle_passed, gate_stuck, command, ack
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Датчик занятости места (Sensor)
+type Sensor struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	SpotID       uint           `json:"spot_id" gorm:"index"`
+	ExternalID   string         `json:"external_id" gorm:"uniqueIndex"`
+	Kind         string         `json:"kind"`               // ground или overhead
+	Occupied     *bool          `json:"occupied,omitempty"` // Последнее устойчивое состояние
+	Health       string         `json:"health"`             // ok, low_battery, faulty, offline
+	BatteryLevel *int           `json:"battery_level,omitempty"`
+	ErrorCount   int            `json:"error_count"`
+	LastSeenAt   *time.Time     `json:"last_seen_at,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Шлюз датчиков парковки (SensorGateway): присылает показания датчиков
+// ее мест пакетами
+type SensorGateway struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ParkingID uint   `json:"parking_id" gorm:"index"`
+	Name      string `json:"name"`
+	GatewayID string `json:"gateway_id" gorm:"uniqueIndex"`
+	// SecretHash SHA-256 секрета шлюза; Secret - сам секрет, только в
+	// ответе на создание шлюза и смену секрета
+	SecretHash string         `json:"-"`
+	Secret     string         `json:"secret,omitempty" gorm:"-"`
+	LastSeenAt *time.Time     `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Расхождение показаний датчика с записями о въезде (SensorMismatch)
+type SensorMismatch struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	SpotID     uint       `json:"spot_id" gorm:"index"`
+	SensorID   uint       `json:"sensor_id"`
+	Kind       string     `json:"kind"` // unregistered_vehicle или missed_exit
+	EntryID    *uint      `json:"entry_id,omitempty"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+}
+
+// Вид абонемента на парковке (PermitProduct)
+type PermitProduct struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	ParkingID   uint           `json:"parking_id" gorm:"index"`
+	Name        string         `json:"name"`
+	Period      string         `json:"period"`    // monthly или annual
+	Window      string         `json:"window"`    // any, day или night
+	SpotMode    string         `json:"spot_mode"` // reserved или floating
+	Price       float64        `json:"price"`
+	OverageRate float64        `json:"overage_rate"` // Почасовая ставка вне окна абонемента
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Абонемент водителя (Permit)
+type Permit struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	ProductID      uint           `json:"product_id" gorm:"index"`
+	Product        PermitProduct  `json:"product" gorm:"foreignKey:ProductID"`
+	VehicleID      uint           `json:"vehicle_id" gorm:"index"`
+	UserID         uint           `json:"user_id" gorm:"index"`
+	SpotID         *uint          `json:"spot_id,omitempty"` // Только для закрепленного места
+	StartsAt       time.Time      `json:"starts_at"`
+	EndsAt         time.Time      `json:"ends_at"`
+	Status         string         `json:"status"` // pending, active, expired, canceled
+	LastPaymentID  *uint          `json:"last_payment_id,omitempty"`
+	ReminderSentAt *time.Time     `json:"reminder_sent_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Организация с корпоративным автопарком (Organization)
+type Organization struct {
+	ID            uint                 `gorm:"primaryKey" json:"id"`
+	Name          string               `json:"name"`
+	BillingEmail  string               `json:"billing_email"`
+	BillingMode   string               `json:"billing_mode"`   // postpaid
+	SpendingLimit float64              `json:"spending_limit"` // Лимит расходов в месяц, 0 - без лимита
+	Members       []OrganizationMember `json:"members,omitempty" gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE"`
+	Vehicles      []Vehicle            `json:"vehicles,omitempty" gorm:"foreignKey:OrganizationID;constraint:OnDelete:SET NULL"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt       `gorm:"index" json:"-"`
+}
+
+// Участник организации (OrganizationMember)
+type OrganizationMember struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_org_member"`
+	UserID         uint      `json:"user_id" gorm:"uniqueIndex:idx_org_member"`
+	User           User      `json:"user" gorm:"foreignKey:UserID"`
+	Role           string    `json:"role"` // admin или member
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Счет организации за месяц (Invoice)
+type Invoice struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `json:"organization_id" gorm:"index"`
+	Number         string    `json:"number" gorm:"uniqueIndex"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	Total          float64   `json:"total"`
+	Status         string    `json:"status"` // issued или paid
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Продавец, оплачивающий парковку своим клиентам (Merchant)
+type Merchant struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	ParkingID       uint           `json:"parking_id" gorm:"index"`
+	OwnerID         uint           `json:"owner_id" gorm:"index"`
+	Name            string         `json:"name"`
+	DiscountMinutes int            `json:"discount_minutes"` // Скидка по умолчанию
+	MonthlyLimit    int            `json:"monthly_limit"`    // Валидаций в месяц, 0 - без лимита
+	Status          string         `json:"status"`           // pending или approved
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Валидация парковки продавцом (Validation)
+type Validation struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	MerchantID      uint       `json:"merchant_id" gorm:"index"`
+	Code            *string    `json:"code,omitempty" gorm:"uniqueIndex"`
+	EntryID         *uint      `json:"entry_id,omitempty" gorm:"index"`
+	LicensePlate    string     `json:"license_plate,omitempty" gorm:"index"`
+	DiscountMinutes int        `json:"discount_minutes"`
+	Status          string     `json:"status"` // issued, validated, applied
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	ValidatedAt     *time.Time `json:"validated_at,omitempty"`
+	AppliedAt       *time.Time `json:"applied_at,omitempty"`
+	PaymentID       *uint      `json:"payment_id,omitempty"`
+	DiscountAmount  float64    `json:"discount_amount"` // Сколько продавец компенсирует парковке
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Почасовая сводка по парковке (HourlyRollup)
+type HourlyRollup struct {
+	ParkingID        uint      `gorm:"primaryKey;autoIncrement:false" json:"parking_id"`
+	BucketStart      time.Time `gorm:"primaryKey" json:"bucket_start"`
+	Entries          int       `json:"entries"`
+	Exits            int       `json:"exits"`
+	OccupancyMinutes float64   `json:"occupancy_minutes"` // Сумма занятых место-минут
+	Revenue          float64   `json:"revenue"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Дневная сводка по парковке, день - в часовом поясе парковки (DailyRollup)
+type DailyRollup struct {
+	ParkingID        uint      `gorm:"primaryKey;autoIncrement:false" json:"parking_id"`
+	BucketStart      time.Time `gorm:"primaryKey" json:"bucket_start"`
+	Entries          int       `json:"entries"`
+	Exits            int       `json:"exits"`
+	OccupancyMinutes float64   `json:"occupancy_minutes"`
+	Revenue          float64   `json:"revenue"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Состояние фоновой агрегации (RollupState)
+type RollupState struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Watermark time.Time `json:"watermark"` // До этого момента сводки посчитаны
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Праздничный день, влияющий на прогноз (Holiday)
+type Holiday struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Date      string    `json:"date" gorm:"index"` // ГГГГ-ММ-ДД
+	Name      string    `json:"name"`
+	ParkingID *uint     `json:"parking_id,omitempty"` // Пусто - для всех парковок
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Сохраненный прогноз свободных мест для сверки с фактом (Forecast)
+type Forecast struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ParkingID     uint      `json:"parking_id" gorm:"index"`
+	TargetTime    time.Time `json:"target_time" gorm:"index"`
+	HorizonHours  int       `json:"horizon_hours"`
+	PredictedFree float64   `json:"predicted_free"`
+	ActualFree    *float64  `json:"actual_free,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Фоновая выгрузка (ExportJob)
+type ExportJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Dataset    string     `json:"dataset"`
+	Format     string     `json:"format"`
+	Query      string     `json:"query"`  // Параметры выгрузки в виде query-строки
+	Status     string     `json:"status"` // queued, running, done, failed
+	Rows       int        `json:"rows"`
+	FilePath   string     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Расписание рассылки отчетов по парковке (ReportSchedule)
+type ReportSchedule struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	ParkingID  uint           `json:"parking_id" gorm:"index"`
+	UserID     uint           `json:"user_id" gorm:"index"`
+	Frequency  string         `json:"frequency"`  // daily, weekly или monthly
+	Recipients string         `json:"recipients"` // Адреса через запятую; пусто - почта пользователя
+	NextRunAt  time.Time      `json:"next_run_at" gorm:"index"`
+	LastSentAt *time.Time     `json:"last_sent_at,omitempty"`
+	LastError  string         `json:"last_error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Настройки динамической цены парковки (DynamicPricing)
+type DynamicPricing struct {
+	ParkingID     uint      `gorm:"primaryKey;autoIncrement:false" json:"parking_id"`
+	Enabled       bool      `json:"enabled"`
+	FloorRate     float64   `json:"floor_rate"`   // Минимальная почасовая ставка
+	CeilingRate   float64   `json:"ceiling_rate"` // Максимальная почасовая ставка
+	Step          float64   `json:"step"`         // Шаг изменения ставки за один пересчет
+	LowOccupancy  float64   `json:"low_occupancy"`
+	HighOccupancy float64   `json:"high_occupancy"`
+	CurrentRate   float64   `json:"current_rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Изменение динамической цены (PriceChange)
+type PriceChange struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	ParkingID         uint      `json:"parking_id" gorm:"index"`
+	OldRate           float64   `json:"old_rate"`
+	NewRate           float64   `json:"new_rate"`
+	Reason            string    `json:"reason"` // demand, config, enabled или disabled
+	Occupancy         float64   `json:"occupancy"`
+	ForecastOccupancy float64   `json:"forecast_occupancy"`
+	CreatedAt         time.Time `json:"created_at" gorm:"index"`
 }
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Спецификация OpenAPI 3.0 строится из apiRoutes: схемы тел запросов и
+// ответов выводятся отражением из тех же типов, что биндят обработчики,
+// ограничения - из тегов binding. Отдается на /openapi.json, Swagger UI -
+// на /docs. Та же спецификация печатается командой openapi.
+
+const openAPIVersion = "3.0.3"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// buildOpenAPI собирает спецификацию по маршрутам
+func buildOpenAPI(routes []Route) gin.H {
+	b := &schemaBuilder{schemas: gin.H{}}
+
+	codes := make([]string, 0, len(errorCatalog))
+	for code := range errorCatalog {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+	b.schemas["Error"] = gin.H{
+		"type":     "object",
+		"required": []string{"error", "code"},
+		"properties": gin.H{
+			"error":   gin.H{"type": "string", "description": "Сообщение на языке из Accept-Language"},
+			"code":    gin.H{"type": "string", "enum": codes},
+			"details": gin.H{"type": "array", "items": b.schema(reflect.TypeOf(FieldError{}))},
+		},
+	}
+
+	paths := gin.H{}
+	for _, r := range routes {
+		path := openAPIPath(r.Path)
+		item, _ := paths[path].(gin.H)
+		if item == nil {
+			item = gin.H{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = b.operation(r)
+	}
+
+	return gin.H{
+		"openapi": openAPIVersion,
+		"info": gin.H{
+			"title":       "Parking Manager API",
+			"version":     version,
+			"description": "Ошибки отдаются в схеме Error; язык сообщений выбирается по Accept-Language (ru, en).",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": b.schemas,
+			"securitySchemes": gin.H{
+				"bearerAuth":    gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"gatewayID":     gin.H{"type": "apiKey", "in": "header", "name": headerGatewayID},
+				"gatewaySecret": gin.H{"type": "apiKey", "in": "header", "name": headerGatewaySecret},
+			},
+		},
+	}
+}
+
+func (b *schemaBuilder) operation(r Route) gin.H {
+	op := gin.H{
+		"operationId": r.Name,
+		"summary":     r.Summary,
+		"tags":        []string{r.Tag},
+	}
+	if r.Auth {
+		op["security"] = []gin.H{{"bearerAuth": []string{}}}
+	}
+	if r.Gateway {
+		op["security"] = []gin.H{{"gatewayID": []string{}, "gatewaySecret": []string{}}}
+	}
+	if r.Role != "" {
+		op["description"] = "Требуется роль " + r.Role + "."
+		op["x-required-role"] = r.Role
+	}
+
+	var params []gin.H
+	for _, p := range routeParams(r) {
+		schema := gin.H{"type": p.Type}
+		if p.Format != "" {
+			schema["format"] = p.Format
+		}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		param := gin.H{"name": p.Name, "in": p.In, "required": p.Required, "schema": schema}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if r.Request != nil {
+		op["requestBody"] = gin.H{
+			"required": true,
+			"content":  gin.H{"application/json": gin.H{"schema": b.schema(reflect.TypeOf(r.Request))}},
+		}
+	}
+
+	responses := gin.H{
+		"default": gin.H{
+			"description": "Ошибка",
+			"content":     gin.H{"application/json": gin.H{"schema": schemaRef("Error")}},
+		},
+	}
+	success := gin.H{"description": http.StatusText(r.Status)}
+	switch {
+	case r.Produces != "":
+		success["content"] = gin.H{r.Produces: gin.H{"schema": gin.H{"type": "string", "format": "binary"}}}
+	case r.Response != nil:
+		success["content"] = gin.H{"application/json": gin.H{"schema": b.schema(reflect.TypeOf(r.Response))}}
+	}
+	responses[strconv.Itoa(r.Status)] = success
+	if r.Auth || r.LimitByIP {
+		responses[strconv.Itoa(http.StatusTooManyRequests)] = gin.H{
+			"description": "Превышено ограничение частоты запросов или вход заблокирован",
+			"headers": gin.H{
+				"Retry-After": gin.H{"description": "Через сколько секунд повторить", "schema": gin.H{"type": "integer"}},
+			},
+			"content": gin.H{"application/json": gin.H{"schema": schemaRef("Error")}},
+		}
+	}
+	if r.Role != "" {
+		responses[strconv.Itoa(http.StatusForbidden)] = gin.H{
+			"description": "Нет роли " + r.Role,
+			"content":     gin.H{"application/json": gin.H{"schema": schemaRef("Error")}},
+		}
+	}
+	if r.Accepted != nil {
+		responses[strconv.Itoa(http.StatusAccepted)] = gin.H{
+			"description": http.StatusText(http.StatusAccepted),
+			"content":     gin.H{"application/json": gin.H{"schema": b.schema(reflect.TypeOf(r.Accepted))}},
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// routeParams параметры пути из Path, дополненные и переопределенные Params
+func routeParams(r Route) []Param {
+	declared := map[string]bool{}
+	for _, p := range r.Params {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+
+	var params []Param
+	for _, segment := range strings.Split(r.Path, "/") {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		if declared[name] {
+			continue
+		}
+		typ := "string"
+		if name == "id" || strings.HasSuffix(name, "ID") {
+			typ = "integer"
+		}
+		params = append(params, Param{Name: name, In: "path", Type: typ, Required: true})
+	}
+	return append(params, r.Params...)
+}
+
+// openAPIPath переводит /parkings/:id в /parkings/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func schemaRef(name string) gin.H {
+	return gin.H{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaBuilder выводит JSON-схемы из типов Go. Именованные структуры
+// попадают в components/schemas и подставляются ссылками.
+type schemaBuilder struct {
+	schemas gin.H
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) gin.H {
+	if t == timeType {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schema(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			return s
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+		return gin.H{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = gin.H{} // Заглушка на случай рекурсивных типов
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return schemaRef(t.Name())
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return gin.H{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	}
+	return gin.H{}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) gin.H {
+	properties := gin.H{}
+	var required []string
+	b.addFields(t, properties, &required)
+
+	s := gin.H{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties gin.H, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addFields(f.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := b.schema(f.Type)
+		if applyBinding(s, f.Type, f.Tag.Get("binding")) {
+			*required = append(*required, name)
+		}
+		properties[name] = s
+	}
+}
+
+// applyBinding переносит правила валидатора в схему поля и сообщает, есть ли
+// среди них required. Правила после dive относятся к элементам и
+// пропускаются.
+func applyBinding(s gin.H, t reflect.Type, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+	if _, ok := s["$ref"]; ok {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		number, numErr := strconv.ParseFloat(param, 64)
+		switch name {
+		case "dive":
+			return required
+		case "required":
+			required = true
+		case "email":
+			s["format"] = "email"
+		case "oneof":
+			values := strings.Fields(param)
+			if s["type"] == "string" {
+				s["enum"] = values
+			} else {
+				enum := make([]float64, 0, len(values))
+				for _, v := range values {
+					if n, err := strconv.ParseFloat(v, 64); err == nil {
+						enum = append(enum, n)
+					}
+				}
+				s["enum"] = enum
+			}
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			if numErr != nil {
+				continue
+			}
+			applyBound(s, t, name, number)
+		}
+	}
+	return required
+}
+
+func applyBound(s gin.H, t reflect.Type, rule string, n float64) {
+	switch t.Kind() {
+	case reflect.String:
+		switch rule {
+		case "min":
+			s["minLength"] = n
+		case "max":
+			s["maxLength"] = n
+		case "len":
+			s["minLength"], s["maxLength"] = n, n
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		switch rule {
+		case "min":
+			s["minItems"] = n
+		case "max":
+			s["maxItems"] = n
+		case "len":
+			s["minItems"], s["maxItems"] = n, n
+		}
+	default:
+		switch rule {
+		case "min", "gte":
+			s["minimum"] = n
+		case "max", "lte":
+			s["maximum"] = n
+		case "gt":
+			s["minimum"], s["exclusiveMinimum"] = n, true
+		case "lt":
+			s["maximum"], s["exclusiveMaximum"] = n, true
+		case "len":
+			s["minimum"], s["maximum"] = n, n
+		}
+	}
+}
+
+// OpenAPIHandler отдает спецификацию, собранную один раз при запуске
+func OpenAPIHandler(routes []Route) gin.HandlerFunc {
+	spec, err := json.Marshal(buildOpenAPI(routes))
+	if err != nil {
+		panic(err) // Спецификация строится из статических типов
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
+	}
+}
+
+// SwaggerUI страница Swagger UI для /openapi.json. Скрипты грузятся с CDN,
+// чтобы не вкладывать их в бинарник.
+func SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8">
+  <title>Parking Manager API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
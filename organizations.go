@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Режим оплаты и роли участников организации. Выезды автопарка оплачиваются
+// только постоплатой по месячным счетам.
+const (
+	BillingPostpaid = "postpaid"
+
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Статусы платежей и счетов постоплаты
+const (
+	PaymentStatusInvoiced = "invoiced"
+	InvoiceStatusIssued   = "issued"
+)
+
+// invoiceGrace - сколько после конца месяца ждать, прежде чем выставлять
+// счет автоматически: выезды, сохраненные в последние секунды месяца,
+// успевают записаться
+const invoiceGrace = time.Hour
+
+var (
+	errSpendingLimitExceeded = errors.New("превышен месячный лимит расходов организации")
+	errLastOrganizationAdmin = errors.New("последний администратор организации")
+)
+
+// invoiceLine строка счета - один оплаченный организацией выезд
+type invoiceLine struct {
+	PaymentID    uint      `json:"payment_id"`
+	LicensePlate string    `json:"license_plate"`
+	ParkingName  string    `json:"parking_name"`
+	EntryTime    time.Time `json:"entry_time"`
+	ExitTime     time.Time `json:"exit_time"`
+	Amount       float64   `json:"amount"`
+}
+
+// organizationMember проверяет, что текущий пользователь состоит в организации
+func organizationMember(c *gin.Context, orgID string) (OrganizationMember, bool) {
+	var member OrganizationMember
+	err := db.Where("organization_id = ? AND user_id = ?", orgID, c.GetUint("user_id")).First(&member).Error
+	return member, err == nil
+}
+
+// organizationAdmin то же самое, но требует роль администратора и сам отвечает клиенту
+func organizationAdmin(c *gin.Context, orgID string) (OrganizationMember, bool) {
+	member, ok := organizationMember(c, orgID)
+	if !ok {
+		respondError(c, CodeOrganizationNotFound)
+		return member, false
+	}
+	if member.Role != OrgRoleAdmin {
+		respondError(c, CodeOrganizationForbidden)
+		return member, false
+	}
+	return member, true
+}
+
+// billingLocation часовой пояс расчетных месяцев: по нему режутся периоды
+// счетов и считается месячный лимит расходов. Выезды организации бывают на
+// парковках в разных поясах, поэтому берется UTC, а не пояс сервера.
+var billingLocation = time.UTC
+
+// monthStart возвращает начало расчетного месяца, в котором находится t
+func monthStart(t time.Time) time.Time {
+	t = t.In(billingLocation)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, billingLocation)
+}
+
+// organizationPayer возвращает организацию с постоплатой, на которую
+// относится выезд автомобиля. Месячный лимит проверяется при сохранении
+// выезда, см. OrganizationRepository.ReserveSpending.
+func organizationPayer(vehicleID uint) (*Organization, bool) {
+	var vehicle Vehicle
+	if err := db.First(&vehicle, vehicleID).Error; err != nil || vehicle.OrganizationID == nil {
+		return nil, false
+	}
+
+	var org Organization
+	if err := db.First(&org, *vehicle.OrganizationID).Error; err != nil || org.BillingMode != BillingPostpaid {
+		return nil, false
+	}
+	return &org, true
+}
+
+type CreateOrganizationRequest struct {
+	Name          string  `json:"name" binding:"required"`
+	BillingEmail  string  `json:"billing_email" binding:"required,email"`
+	BillingMode   string  `json:"billing_mode" binding:"omitempty,oneof=postpaid"`
+	SpendingLimit float64 `json:"spending_limit" binding:"gte=0"`
+}
+
+func CreateOrganization(c *gin.Context) {
+	var input CreateOrganizationRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	org := Organization{
+		Name:          input.Name,
+		BillingEmail:  input.BillingEmail,
+		BillingMode:   input.BillingMode,
+		SpendingLimit: input.SpendingLimit,
+	}
+	if org.BillingMode == "" {
+		org.BillingMode = BillingPostpaid
+	}
+
+	// Создатель становится администратором организации
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		member := OrganizationMember{OrganizationID: org.ID, UserID: c.GetUint("user_id"), Role: OrgRoleAdmin}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeOrganizationCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationMember(c, id); !ok {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	var org Organization
+	if err := db.Preload("Members.User").Preload("Vehicles").First(&org, id).Error; err != nil {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+type UpdateOrganizationRequest struct {
+	BillingEmail  *string  `json:"billing_email" binding:"omitempty,email"`
+	BillingMode   *string  `json:"billing_mode" binding:"omitempty,oneof=postpaid"`
+	SpendingLimit *float64 `json:"spending_limit" binding:"omitempty,gte=0"`
+}
+
+func UpdateOrganization(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationAdmin(c, id); !ok {
+		return
+	}
+
+	var input UpdateOrganizationRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var org Organization
+	if err := db.First(&org, id).Error; err != nil {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	if input.BillingEmail != nil {
+		org.BillingEmail = *input.BillingEmail
+	}
+	if input.BillingMode != nil {
+		org.BillingMode = *input.BillingMode
+	}
+	if input.SpendingLimit != nil {
+		org.SpendingLimit = *input.SpendingLimit
+	}
+
+	if err := db.Save(&org).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeOrganizationUpdateFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+type AddOrganizationMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member"`
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationAdmin(c, id); !ok {
+		return
+	}
+
+	var input AddOrganizationMemberRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var user User
+	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		respondError(c, CodeUserNotFound)
+		return
+	}
+
+	orgID, _ := strconv.ParseUint(id, 10, 64)
+	member := OrganizationMember{OrganizationID: uint(orgID), UserID: user.ID, Role: input.Role}
+	if member.Role == "" {
+		member.Role = OrgRoleMember
+	}
+
+	if err := db.Create(&member).Error; err != nil {
+		respondError(c, CodeAlreadyMember)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveOrganizationMember удаляет участника. Автомобили, которыми он
+// владеет, уходят из автопарка: их стоянки больше не оплачивает организация.
+// Последнего администратора удалить нельзя, иначе организацией некому
+// будет управлять.
+func RemoveOrganizationMember(c *gin.Context) {
+	id := c.Param("id")
+	admin, ok := organizationAdmin(c, id)
+	if !ok {
+		return
+	}
+	userID := c.Param("userID")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Блокировка организации не дает двум администраторам одновременно
+		// удалить друг друга
+		var org Organization
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, admin.OrganizationID).Error; err != nil {
+			return err
+		}
+
+		var member OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id = ?", org.ID, userID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if member.Role == OrgRoleAdmin {
+			var admins int64
+			if err := tx.Model(&OrganizationMember{}).
+				Where("organization_id = ? AND role = ?", org.ID, OrgRoleAdmin).
+				Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errLastOrganizationAdmin
+			}
+		}
+
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Vehicle{}).
+			Where("organization_id = ? AND owner_id = ?", org.ID, member.UserID).
+			Update("organization_id", nil).Error
+	})
+	if errors.Is(err, errLastOrganizationAdmin) {
+		respondError(c, CodeLastOrganizationAdmin)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeMemberRemoveFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type AddOrganizationVehicleRequest struct {
+	LicensePlate string `json:"license_plate" binding:"required"`
+}
+
+// AddOrganizationVehicle добавляет автомобиль в автопарк организации.
+// Незнакомый номер регистрируется на администратора, который его добавил.
+func AddOrganizationVehicle(c *gin.Context) {
+	id := c.Param("id")
+	admin, ok := organizationAdmin(c, id)
+	if !ok {
+		return
+	}
+
+	var input AddOrganizationVehicleRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	// Чужой автомобиль можно взять в автопарк, только если его владелец
+	// состоит в организации, иначе любой мог бы перевести на себя оплату
+	// стоянок по номеру
+	var vehicle Vehicle
+	if err := db.Where("license_plate = ?", input.LicensePlate).First(&vehicle).Error; err != nil {
+		vehicle = Vehicle{LicensePlate: input.LicensePlate, OwnerID: admin.UserID}
+	} else if vehicle.OrganizationID != nil && *vehicle.OrganizationID != admin.OrganizationID {
+		respondError(c, CodeVehicleInOtherOrganization)
+		return
+	} else if vehicle.OwnerID != admin.UserID {
+		var owners int64
+		if err := db.Model(&OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", admin.OrganizationID, vehicle.OwnerID).
+			Count(&owners).Error; err != nil {
+			c.Error(err)
+			respondError(c, CodeVehicleAddFailed)
+			return
+		}
+		if owners == 0 {
+			respondError(c, CodeVehicleOwnerNotMember)
+			return
+		}
+	}
+
+	vehicle.OrganizationID = &admin.OrganizationID
+	if err := db.Save(&vehicle).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeVehicleAddFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, vehicle)
+}
+
+func RemoveOrganizationVehicle(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationAdmin(c, id); !ok {
+		return
+	}
+
+	if err := db.Model(&Vehicle{}).
+		Where("id = ? AND organization_id = ?", c.Param("vehicleID"), id).
+		Update("organization_id", nil).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeVehicleRemoveFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type CreateInvoiceRequest struct {
+	Month string `json:"month" binding:"required"` // ГГГГ-ММ, месяц по UTC
+}
+
+// CreateInvoice выставляет организации счет за месяц по всем выездам
+// с постоплатой, которые еще не попали в счет
+func CreateInvoice(c *gin.Context) {
+	id := c.Param("id")
+	admin, ok := organizationAdmin(c, id)
+	if !ok {
+		return
+	}
+
+	var input CreateInvoiceRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01", input.Month, billingLocation)
+	if err != nil {
+		respondError(c, CodeInvalidMonth)
+		return
+	}
+	if start.AddDate(0, 1, 0).After(time.Now()) {
+		respondError(c, CodeMonthNotFinished)
+		return
+	}
+
+	invoice, err := issueInvoice(admin.OrganizationID, start)
+	if isUniqueViolation(err) {
+		respondError(c, CodeInvoiceExists)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeInvoiceIssueFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invoice)
+}
+
+// issueInvoice выставляет организации счет за месяц, начинающийся в start,
+// по выездам с постоплатой, которые еще не попали в счет. Номер счета
+// уникален, поэтому повторный счет за тот же месяц дает ошибку уникальности.
+func issueInvoice(orgID uint, start time.Time) (Invoice, error) {
+	end := start.AddDate(0, 1, 0)
+	invoice := Invoice{
+		OrganizationID: orgID,
+		Number:         fmt.Sprintf("INV-%d-%s", orgID, start.Format("200601")),
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Status:         InvoiceStatusIssued,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+		payments := tx.Model(&Payment{}).
+			Where("organization_id = ? AND invoice_id IS NULL AND created_at >= ? AND created_at < ?", orgID, start, end)
+		if err := payments.Update("invoice_id", invoice.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Payment{}).Where("invoice_id = ?", invoice.ID).
+			Select("COALESCE(SUM(amount), 0)").Scan(&invoice.Total).Error; err != nil {
+			return err
+		}
+		return tx.Save(&invoice).Error
+	})
+	return invoice, err
+}
+
+// issueMonthlyInvoices выставляет счета за прошлый месяц организациям, у
+// которых в нем есть выезды вне счетов. Организации, которым счет уже
+// выставлен вручную или прошлым проходом, пропускаются, так что каждая
+// получает один счет за месяц.
+func issueMonthlyInvoices(now time.Time) {
+	start := monthStart(now.Add(-invoiceGrace)).AddDate(0, -1, 0)
+	end := start.AddDate(0, 1, 0)
+
+	var orgIDs []uint
+	if err := db.Model(&Payment{}).
+		Where("organization_id IS NOT NULL AND invoice_id IS NULL AND created_at >= ? AND created_at < ?", start, end).
+		Where("organization_id NOT IN (?)", db.Model(&Invoice{}).Select("organization_id").Where("period_start = ?", start)).
+		Distinct().Pluck("organization_id", &orgIDs).Error; err != nil {
+		slog.Error("Не удалось получить организации для счетов", "error", err)
+		return
+	}
+
+	for _, orgID := range orgIDs {
+		invoice, err := issueInvoice(orgID, start)
+		if isUniqueViolation(err) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Не удалось выставить счет", "organization_id", orgID, "month", start.Format("2006-01"), "error", err)
+			continue
+		}
+		slog.Info("Счет выставлен", "organization_id", orgID, "number", invoice.Number, "total", invoice.Total)
+	}
+}
+
+// runInvoiceJobs раз в час выставляет счета за закончившийся месяц
+func runInvoiceJobs(ctx context.Context) {
+	for now := range ticks(ctx, time.Hour) {
+		issueMonthlyInvoices(now)
+	}
+}
+
+func GetInvoices(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationMember(c, id); !ok {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	var invoices []Invoice
+	if err := db.Where("organization_id = ?", id).Order("period_start DESC").Find(&invoices).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeInvoicesListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+// DownloadInvoice отдает счет в CSV или PDF в зависимости от :format
+func (api *API) DownloadInvoice(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := organizationMember(c, id); !ok {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	var invoice Invoice
+	if err := db.Where("organization_id = ?", id).First(&invoice, c.Param("invoiceID")).Error; err != nil {
+		respondError(c, CodeInvoiceNotFound)
+		return
+	}
+
+	var org Organization
+	if err := db.First(&org, invoice.OrganizationID).Error; err != nil {
+		respondError(c, CodeOrganizationNotFound)
+		return
+	}
+
+	var lines []invoiceLine
+	if err := db.Table("payments").
+		Select("payments.id AS payment_id, vehicles.license_plate, parkings.name AS parking_name, entries.entry_time, exits.exit_time, payments.amount").
+		Joins("JOIN exits ON exits.payment_id = payments.id").
+		Joins("JOIN entries ON entries.id = exits.entry_id").
+		Joins("JOIN vehicles ON vehicles.id = entries.vehicle_id").
+		Joins("JOIN spots ON spots.id = entries.spot_id").
+		Joins("JOIN parkings ON parkings.id = spots.parking_id").
+		Where("payments.invoice_id = ?", invoice.ID).
+		Order("exits.exit_time").
+		Scan(&lines).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeInvoiceLinesFailed)
+		return
+	}
+
+	switch c.Param("format") {
+	case "csv":
+		data, err := renderInvoiceCSV(lines)
+		if err != nil {
+			c.Error(err)
+			respondError(c, CodeInvoiceRenderFailed)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", invoice.Number))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	case "pdf":
+		data, err := renderInvoicePDF(api.services.Reports, org, invoice, lines)
+		if err != nil {
+			c.Error(err)
+			respondError(c, CodeInvoiceRenderFailed)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", invoice.Number))
+		c.Data(http.StatusOK, "application/pdf", data)
+	default:
+		respondError(c, CodeUnsupportedReportFormat)
+	}
+}
+
+func renderInvoiceCSV(lines []invoiceLine) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"payment_id", "license_plate", "parking", "entry_time", "exit_time", "amount"})
+	for _, l := range lines {
+		w.Write([]string{
+			strconv.FormatUint(uint64(l.PaymentID), 10),
+			l.LicensePlate,
+			l.ParkingName,
+			l.EntryTime.Format(time.RFC3339),
+			l.ExitTime.Format(time.RFC3339),
+			strconv.FormatFloat(l.Amount, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func renderInvoicePDF(cfg ReportsConfig, org Organization, invoice Invoice, lines []invoiceLine) ([]byte, error) {
+	doc := newPDFDocument(cfg, "Счет "+invoice.Number)
+	doc.Text("Организация: " + org.Name)
+	doc.Text(fmt.Sprintf("Период: %s - %s", invoice.PeriodStart.Format("02.01.2006"), invoice.PeriodEnd.AddDate(0, 0, -1).Format("02.01.2006")))
+
+	rows := make([][]string, 0, len(lines))
+	for _, l := range lines {
+		rows = append(rows, []string{
+			l.LicensePlate,
+			l.ParkingName,
+			l.EntryTime.Format("02.01.2006 15:04"),
+			l.ExitTime.Format("02.01.2006 15:04"),
+			strconv.FormatFloat(l.Amount, 'f', 2, 64),
+		})
+	}
+	doc.Table(
+		[]string{"Номер", "Парковка", "Въезд", "Выезд", "Сумма"},
+		[]float64{30, 55, 35, 35, 25},
+		rows,
+	)
+	doc.Text(fmt.Sprintf("Итого: %.2f руб.", invoice.Total))
+
+	return doc.Bytes()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMonthStart(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		at   time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		// 1 ноября 2:00 по Москве - еще октябрь по UTC
+		{time.Date(2026, 11, 1, 2, 0, 0, 0, moscow), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := monthStart(tt.at); !got.Equal(tt.want) {
+			t.Errorf("%s: %s, ожидалось %s", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestReserveSpending(t *testing.T) {
+	store := newMemoryStore()
+	month := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	unlimited := Organization{Name: "Без лимита", BillingMode: BillingPostpaid}
+	limited := Organization{Name: "С лимитом", BillingMode: BillingPostpaid, SpendingLimit: 500}
+	for _, org := range []*Organization{&unlimited, &limited} {
+		if err := store.Organizations.Create(org); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []Payment{
+		{Amount: 300, OrganizationID: &limited.ID, CreatedAt: month.Add(time.Hour)},
+		{Amount: 1000, OrganizationID: &limited.ID, CreatedAt: month.Add(-time.Hour)}, // Прошлый месяц
+		{Amount: 1000, CreatedAt: month.Add(time.Hour)},                               // Не организации
+	} {
+		if err := store.Payments.Create(&p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		orgID  uint
+		amount float64
+		want   error
+	}{
+		{"без лимита", unlimited.ID, 100000, nil},
+		{"в пределах лимита", limited.ID, 200, nil},
+		{"сверх лимита", limited.ID, 201, errSpendingLimitExceeded},
+		{"неизвестная организация", 999, 100, errNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Organizations.ReserveSpending(tt.orgID, tt.amount, month); err != tt.want {
+				t.Errorf("%v, ожидалось %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// orgPolicy относит все выезды на счет организации orgID
+type orgPolicy struct {
+	basicEntryPolicy
+	orgID uint
+}
+
+func (p orgPolicy) QuoteExit(ctx context.Context, entry Entry, spot Spot, codes []string, at time.Time) (ExitQuote, error) {
+	quote, err := p.basicEntryPolicy.QuoteExit(ctx, entry, spot, codes, at)
+	quote.OrganizationID = &p.orgID
+	return quote, err
+}
+
+// Выезд, с которым расходы организации превысили бы лимит, водитель
+// оплачивает сам
+func TestCloseEntrySpendingLimit(t *testing.T) {
+	policy := &orgPolicy{}
+	s := newTestServer(t, func(basic basicEntryPolicy) EntryPolicy {
+		policy.basicEntryPolicy = basic
+		return policy
+	}, nil)
+
+	org := Organization{Name: "Автопарк", BillingMode: BillingPostpaid, SpendingLimit: 300}
+	if err := s.store.Organizations.Create(&org); err != nil {
+		t.Fatal(err)
+	}
+	policy.orgID = org.ID
+
+	driver := s.createUser("driver@example.com", "secret123", UserRoleUser)
+	token := s.login("driver@example.com", "secret123")
+	parking := Parking{Name: "Центр", Capacity: 1, Tariffs: []Tariff{{Type: "почасовой", Price: 100}}, Spots: []Spot{{Number: "A1"}}}
+	if err := s.store.Parkings.Create(&parking); err != nil {
+		t.Fatal(err)
+	}
+	car := Vehicle{LicensePlate: "А123ВС77", OwnerID: driver.ID, OrganizationID: &org.ID}
+	if err := s.store.Vehicles.Create(&car); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stay       time.Duration
+		wantMethod string
+		wantStatus string
+		wantOrg    bool
+	}{
+		{90 * time.Minute, "invoice", PaymentStatusInvoiced, true}, // 200 из 300
+		{90 * time.Minute, "cash", "pending", false},               // 400 > 300
+		{30 * time.Minute, "invoice", PaymentStatusInvoiced, true}, // 300 из 300
+	}
+	for i, tt := range tests {
+		entry := s.parkEntry(token, parking.Spots[0].ID, car.ID, tt.stay)
+		var exit Exit
+		s.expect(s.do(http.MethodPost, "/api/v1/exits", token, CreateExitRequest{EntryID: entry.ID, PaymentMethod: "cash"}), http.StatusCreated, &exit)
+
+		payment := s.memory().payments[exit.PaymentID]
+		if payment.Method != tt.wantMethod || payment.Status != tt.wantStatus || (payment.OrganizationID != nil) != tt.wantOrg {
+			t.Errorf("выезд %d: %s %s, организация %v; ожидалось %s %s, %v",
+				i, payment.Method, payment.Status, payment.OrganizationID, tt.wantMethod, tt.wantStatus, tt.wantOrg)
+		}
+	}
+}
+
+// orgFixture организация с администраторами и участниками в базе
+func orgFixture(t *testing.T, s *testServer, admins, members []User) Organization {
+	t.Helper()
+	org := Organization{Name: "Автопарк", BillingMode: BillingPostpaid}
+	if err := db.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	for role, users := range map[string][]User{OrgRoleAdmin: admins, OrgRoleMember: members} {
+		for _, u := range users {
+			if err := db.Create(&OrganizationMember{OrganizationID: org.ID, UserID: u.ID, Role: role}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return org
+}
+
+func TestRemoveOrganizationMember(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, nil)
+	first := s.createUser("first@example.com", "secret123", UserRoleUser)
+	second := s.createUser("second@example.com", "secret123", UserRoleUser)
+	driver := s.createUser("driver@example.com", "secret123", UserRoleUser)
+	// Организации живут в базе, пользователи API - в памяти: участникам и
+	// автомобилям нужны те же пользователи в базе
+	for _, u := range []User{first, second, driver} {
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	firstToken := s.login("first@example.com", "secret123")
+	secondToken := s.login("second@example.com", "secret123")
+
+	tests := []struct {
+		name    string
+		admins  []User
+		token   string
+		remove  User
+		status  int
+		code    ErrorCode
+		removed bool
+	}{
+		{"последний администратор", []User{first}, firstToken, first, http.StatusConflict, CodeLastOrganizationAdmin, false},
+		{"один из администраторов", []User{first, second}, firstToken, second, http.StatusNoContent, "", true},
+		{"администратор удаляет себя", []User{first, second}, secondToken, second, http.StatusNoContent, "", true},
+		{"водитель", []User{first}, firstToken, driver, http.StatusNoContent, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := orgFixture(t, s, tt.admins, []User{driver})
+			own := Vehicle{LicensePlate: fmt.Sprintf("О%03dОО77", org.ID), OwnerID: tt.remove.ID, OrganizationID: &org.ID}
+			if err := db.Create(&own).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := s.do(http.MethodDelete, fmt.Sprintf("/api/v1/organizations/%d/members/%d", org.ID, tt.remove.ID), tt.token, nil)
+			if tt.code != "" {
+				s.expectError(w, tt.status, tt.code)
+			} else {
+				s.expect(w, tt.status, nil)
+			}
+
+			var members int64
+			db.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", org.ID, tt.remove.ID).Count(&members)
+			if removed := members == 0; removed != tt.removed {
+				t.Errorf("участник удален: %v, ожидалось %v", removed, tt.removed)
+			}
+			// Автомобили удаленного участника уходят из автопарка
+			var vehicle Vehicle
+			db.First(&vehicle, own.ID)
+			if detached := vehicle.OrganizationID == nil; detached != tt.removed {
+				t.Errorf("автомобиль отвязан: %v, ожидалось %v", detached, tt.removed)
+			}
+		})
+	}
+}
+
+// Каждая организация получает ровно один счет за прошлый месяц, даже если
+// задача проходит несколько раз или счет уже выставлен вручную
+func TestIssueMonthlyInvoices(t *testing.T) {
+	testDB(t)
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	orgs := make([]Organization, 3)
+	for i := range orgs {
+		orgs[i] = Organization{Name: fmt.Sprintf("Автопарк %d", i), BillingMode: BillingPostpaid}
+		if err := db.Create(&orgs[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []Payment{
+		{Amount: 100, OrganizationID: &orgs[0].ID, CreatedAt: october.Add(time.Hour)},
+		{Amount: 200, OrganizationID: &orgs[0].ID, CreatedAt: october.AddDate(0, 1, 0).Add(-time.Second)},
+		{Amount: 300, OrganizationID: &orgs[0].ID, CreatedAt: october.AddDate(0, 1, 0)}, // Уже ноябрь
+		{Amount: 400, OrganizationID: &orgs[1].ID, CreatedAt: october.Add(time.Hour)},
+		{Amount: 500, OrganizationID: &orgs[2].ID, CreatedAt: october.Add(-time.Hour)}, // Сентябрь
+	} {
+		p.Method, p.Status = "invoice", PaymentStatusInvoiced
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Вторая организация выставила счет за октябрь сама
+	if _, err := issueInvoice(orgs[1].ID, october); err != nil {
+		t.Fatal(err)
+	}
+
+	// До конца льготного часа октябрь еще не закрыт
+	issueMonthlyInvoices(october.AddDate(0, 1, 0).Add(30 * time.Minute))
+	for _, now := range []time.Time{october.AddDate(0, 1, 0).Add(2 * time.Hour), october.AddDate(0, 1, 1)} {
+		issueMonthlyInvoices(now)
+	}
+
+	tests := []struct {
+		org   Organization
+		count int64
+		total float64
+	}{
+		{orgs[0], 1, 300},
+		{orgs[1], 1, 400},
+		{orgs[2], 1, 500}, // Сентябрь выставлен проходом 1 ноября 0:30
+	}
+	for _, tt := range tests {
+		var invoices []Invoice
+		db.Where("organization_id = ?", tt.org.ID).Find(&invoices)
+		if int64(len(invoices)) != tt.count || invoices[0].Total != tt.total {
+			t.Errorf("%s: счета %+v, ожидался один на %v", tt.org.Name, invoices, tt.total)
+		}
+	}
+}
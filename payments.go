@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/paymentintent"
+	"github.com/stripe/stripe-go/v72/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errStripeNotConfigured        = errors.New("STRIPE_SECRET_KEY не установлен")
+	errStripeWebhookNotConfigured = errors.New("STRIPE_WEBHOOK_SECRET не установлен")
+)
+
+// maxWebhookBody ограничивает тело вебхука; события Stripe намного меньше
+const maxWebhookBody = 64 << 10
+
+// CardPayments оплата картой. Настоящая реализация ходит в Stripe, тесты
+// подставляют свою.
+type CardPayments interface {
+	// Charge списывает amount копеек с карты
+	Charge(ctx context.Context, amount int64, paymentMethodID string) (*stripe.PaymentIntent, error)
+	// Configured сообщает, задан ли ключ; без него Charge всегда отказывает
+	Configured() bool
+	// ParseWebhook проверяет подпись вебхука и разбирает событие
+	ParseWebhook(payload []byte, signature string) (stripe.Event, error)
+}
+
+// stripePayments списывает деньги через Stripe с ключом из настроек.
+// Ключ передается в каждый запрос, глобальный stripe.Key не меняется.
+type stripePayments struct {
+	cfg    PaymentsConfig
+	client paymentintent.Client
+}
+
+func newStripePayments(cfg PaymentsConfig) *stripePayments {
+	return &stripePayments{
+		cfg:    cfg,
+		client: paymentintent.Client{B: stripe.GetBackend(stripe.APIBackend), Key: cfg.StripeSecretKey},
+	}
+}
+
+func (p *stripePayments) Configured() bool {
+	return p.cfg.StripeSecretKey != ""
+}
+
+func (p *stripePayments) Charge(ctx context.Context, amount int64, paymentMethodID string) (pi *stripe.PaymentIntent, err error) {
+	_, span := tracer.Start(ctx, "stripe.PaymentIntent.create",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("payment.provider", "stripe"),
+			attribute.Int64("payment.amount_minor", amount),
+			attribute.String("payment.currency", p.cfg.Currency),
+		),
+	)
+	defer func() {
+		if pi != nil {
+			span.SetAttributes(attribute.String("payment.status", string(pi.Status)))
+		}
+		endSpan(span, err)
+	}()
+
+	if !p.Configured() {
+		return nil, errStripeNotConfigured
+	}
+
+	params := &stripe.PaymentIntentParams{
+		Amount:             stripe.Int64(amount),
+		Currency:           stripe.String(p.cfg.Currency),
+		PaymentMethod:      stripe.String(paymentMethodID),
+		ConfirmationMethod: stripe.String(string(stripe.PaymentIntentConfirmationMethodAutomatic)),
+		Confirm:            stripe.Bool(true),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+	}
+
+	pi, err = p.client.New(params)
+	if err != nil {
+		paymentResults.WithLabelValues("stripe", "failed").Inc()
+		return nil, err
+	}
+	paymentResults.WithLabelValues("stripe", string(pi.Status)).Inc()
+	return pi, nil
+}
+
+func (p *stripePayments) ParseWebhook(payload []byte, signature string) (stripe.Event, error) {
+	if p.cfg.StripeWebhookSecret == "" {
+		return stripe.Event{}, errStripeWebhookNotConfigured
+	}
+	return webhook.ConstructEvent(payload, signature, p.cfg.StripeWebhookSecret)
+}
+
+// PaymentWebhook принимает события Stripe о платежах, завершившихся уже после
+// ответа клиенту (например, после 3-D Secure): обновляет статус платежа и
+// активирует или снимает ожидающие его абонементы. Повторная доставка того же
+// события ничего не меняет. На неизвестный платеж отвечает 404, и Stripe
+// повторит доставку, когда платеж будет сохранен.
+func (api *API) PaymentWebhook(c *gin.Context) {
+	store := api.store.WithContext(c.Request.Context())
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		respondError(c, CodeWebhookInvalid)
+		return
+	}
+	event, err := api.services.Payments.ParseWebhook(payload, c.GetHeader("Stripe-Signature"))
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, errStripeWebhookNotConfigured) {
+			respondError(c, CodePaymentsNotConfigured)
+			return
+		}
+		respondError(c, CodeWebhookInvalid)
+		return
+	}
+
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+	default:
+		c.JSON(http.StatusOK, MessageResponse{Message: "Событие пропущено"})
+		return
+	}
+
+	var pi stripe.PaymentIntent
+	if event.Data == nil || json.Unmarshal(event.Data.Raw, &pi) != nil || pi.ID == "" {
+		respondError(c, CodeWebhookInvalid)
+		return
+	}
+	payment, err := store.Payments.GetByProviderID(pi.ID)
+	if err != nil {
+		respondError(c, CodePaymentNotFound)
+		return
+	}
+	if payment.Status == string(pi.Status) {
+		c.JSON(http.StatusOK, MessageResponse{Message: "Событие уже обработано"})
+		return
+	}
+
+	// Сначала абонементы, потом статус платежа: если абонементы не
+	// сохранятся, Stripe повторит доставку и застанет платеж прежним
+	if event.Type == "payment_intent.succeeded" {
+		err = activatePermitPayment(payment, time.Now())
+	} else {
+		err = cancelPermitPayment(payment)
+	}
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodePermitRenewFailed)
+		return
+	}
+
+	payment.Status = string(pi.Status)
+	if err := store.Payments.Save(&payment); err != nil {
+		c.Error(err)
+		respondError(c, CodePaymentSaveFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Событие обработано"})
+}
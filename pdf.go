@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfDocument обертка над gofpdf для счетов и отчетов.
+//
+// Встроенные шрифты PDF не умеют кириллицу, поэтому для русского текста
+// нужен TTF-шрифт, например DejaVuSans.ttf, из reports.pdf_font_path
+// (PDF_FONT_PATH). Без него документ строится встроенным Helvetica, а
+// неподдерживаемые символы заменяются.
+type pdfDocument struct {
+	pdf    *gofpdf.Fpdf
+	family string
+	tr     func(string) string
+}
+
+func newPDFDocument(cfg ReportsConfig, title string) *pdfDocument {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	doc := &pdfDocument{pdf: pdf, family: "Helvetica", tr: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	if path := cfg.PDFFontPath; path != "" {
+		pdf.AddUTF8Font("main", "", path)
+		pdf.AddUTF8Font("main", "B", path)
+		doc.family = "main"
+		doc.tr = func(s string) string { return s }
+	}
+
+	pdf.SetTitle(title, true)
+	pdf.AddPage()
+	doc.Heading(title)
+	return doc
+}
+
+// Heading выводит заголовок
+func (d *pdfDocument) Heading(text string) {
+	d.pdf.SetFont(d.family, "B", 14)
+	d.pdf.CellFormat(0, 10, d.tr(text), "", 1, "L", false, 0, "")
+	d.pdf.Ln(2)
+}
+
+// Text выводит строку обычного текста
+func (d *pdfDocument) Text(text string) {
+	d.pdf.SetFont(d.family, "", 10)
+	d.pdf.CellFormat(0, 6, d.tr(text), "", 1, "L", false, 0, "")
+}
+
+// Table выводит таблицу. Ширины колонок задаются в миллиметрах.
+func (d *pdfDocument) Table(headers []string, widths []float64, rows [][]string) {
+	d.pdf.Ln(2)
+	d.pdf.SetFont(d.family, "B", 9)
+	for i, h := range headers {
+		d.pdf.CellFormat(widths[i], 7, d.tr(h), "1", 0, "C", false, 0, "")
+	}
+	d.pdf.Ln(-1)
+
+	d.pdf.SetFont(d.family, "", 9)
+	for _, row := range rows {
+		for i, cell := range row {
+			d.pdf.CellFormat(widths[i], 6, d.tr(cell), "1", 0, "L", false, 0, "")
+		}
+		d.pdf.Ln(-1)
+	}
+	d.pdf.Ln(2)
+}
+
+// Bytes возвращает готовый PDF
+func (d *pdfDocument) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
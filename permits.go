@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v72"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Периоды, окна и режимы мест абонементов
+const (
+	PermitPeriodMonthly = "monthly"
+	PermitPeriodAnnual  = "annual"
+
+	PermitWindowAny   = "any"
+	PermitWindowDay   = "day"
+	PermitWindowNight = "night"
+
+	PermitSpotReserved = "reserved"
+	PermitSpotFloating = "floating"
+
+	PermitStatusPending  = "pending"
+	PermitStatusActive   = "active"
+	PermitStatusExpired  = "expired"
+	PermitStatusCanceled = "canceled" // Оплата не прошла, абонемент не действовал
+)
+
+// Дневное окно абонемента - с 7:00 до 20:00, ночное - остальное время
+const (
+	permitDayStartHour = 7
+	permitDayEndHour   = 20
+)
+
+// permitReminderLead - за сколько до окончания абонемента напоминаем о продлении
+const permitReminderLead = 7 * 24 * time.Hour
+
+// permitPaymentTimeout - сколько абонемент ждет подтверждения оплаты, прежде
+// чем освободить место
+const permitPaymentTimeout = 24 * time.Hour
+
+// sendPermitReminder доставляет владельцу напоминание об окончании абонемента
+func sendPermitReminder(mailer Mailer, user User, permit Permit) error {
+	return mailer.Send(MailMessage{
+		To:      []string{user.Email},
+		Subject: "Абонемент на парковку скоро закончится",
+		Body: fmt.Sprintf("Здравствуйте!\n\nАбонемент №%d действует до %s. Продлите его, чтобы сохранить место.\n",
+			permit.ID, permit.EndsAt.Format("02.01.2006")),
+	})
+}
+
+// periodEnd возвращает окончание периода абонемента, начатого в start
+func (p PermitProduct) periodEnd(start time.Time) time.Time {
+	if p.Period == PermitPeriodAnnual {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// inWindow проверяет, попадает ли момент t в суточное окно абонемента.
+// Часы окна считаются по местному времени парковки loc.
+func (p PermitProduct) inWindow(t time.Time, loc *time.Location) bool {
+	hour := t.In(loc).Hour()
+	switch p.Window {
+	case PermitWindowDay:
+		return hour >= permitDayStartHour && hour < permitDayEndHour
+	case PermitWindowNight:
+		return hour >= permitDayEndHour || hour < permitDayStartHour
+	default:
+		return true
+	}
+}
+
+// covers проверяет, покрывает ли абонемент момент t
+func (p Permit) covers(t time.Time, loc *time.Location) bool {
+	return !t.Before(p.StartsAt) && t.Before(p.EndsAt) && p.Product.inWindow(t, loc)
+}
+
+// uncoveredDuration возвращает, сколько времени из [from, to) не покрывает
+// ни один из абонементов
+func uncoveredDuration(permits []Permit, from, to time.Time, loc *time.Location) time.Duration {
+	var uncovered time.Duration
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		step := time.Minute
+		if rest := to.Sub(t); rest < step {
+			step = rest
+		}
+		covered := false
+		for _, p := range permits {
+			if p.covers(t, loc) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			uncovered += step
+		}
+	}
+	return uncovered
+}
+
+// findStayPermits ищет абонементы автомобиля на парковке, срок которых
+// пересекается со стоянкой [from, to), последний по окончанию - первым.
+// Истекшие тоже учитываются: абонемент, закончившийся посреди стоянки,
+// покрывает ее часть до своего окончания.
+func findStayPermits(vehicleID, parkingID uint, from, to time.Time) ([]Permit, error) {
+	var permits []Permit
+	err := db.Preload("Product").
+		Joins("JOIN permit_products ON permit_products.id = permits.product_id").
+		Where("permits.vehicle_id = ? AND permit_products.parking_id = ?", vehicleID, parkingID).
+		Where("permits.status IN ? AND permits.starts_at < ? AND permits.ends_at > ?", []string{PermitStatusActive, PermitStatusExpired}, to, from).
+		Order("permits.ends_at DESC").
+		Find(&permits).Error
+	return permits, err
+}
+
+// spotReservation возвращает абонемент, за которым закреплено место в момент at
+func spotReservation(spotID uint, at time.Time) (Permit, bool) {
+	var permit Permit
+	err := db.Where("spot_id = ? AND status = ? AND starts_at <= ? AND ends_at > ?", spotID, PermitStatusActive, at, at).
+		First(&permit).Error
+	return permit, err == nil
+}
+
+var errSpotTaken = errors.New("место уже закреплено за другим абонементом")
+
+// reservePermitSpot проверяет в транзакции tx, что закрепленное место
+// абонемента свободно на весь его срок. Строка места блокируется до конца
+// транзакции, поэтому две покупки одного места не проходят проверку
+// одновременно. Место держат и действующие, и ожидающие оплаты абонементы.
+func reservePermitSpot(tx *gorm.DB, permit Permit) error {
+	if permit.SpotID == nil {
+		return nil
+	}
+	var spot Spot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&spot, *permit.SpotID).Error; err != nil {
+		return err
+	}
+	var taken int64
+	if err := tx.Model(&Permit{}).
+		Where("spot_id = ? AND id <> ? AND status IN ?", spot.ID, permit.ID, []string{PermitStatusPending, PermitStatusActive}).
+		Where("starts_at < ? AND ends_at > ?", permit.EndsAt, permit.StartsAt).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return errSpotTaken
+	}
+	return nil
+}
+
+// payForPermit проводит оплату абонемента через обычный платежный поток
+func payForPermit(ctx context.Context, payments CardPayments, product PermitProduct, paymentMethodID string) (Payment, error) {
+	pi, err := payments.Charge(ctx, int64(math.Round(product.Price*100)), paymentMethodID)
+	if err != nil {
+		return Payment{}, err
+	}
+	return savePaymentIntent(gormPaymentRepository{db}, pi)
+}
+
+func paymentErrorResponse(c *gin.Context, err error) {
+	c.Error(err)
+	if errors.Is(err, errStripeNotConfigured) {
+		respondError(c, CodePaymentsNotConfigured)
+		return
+	}
+	respondError(c, CodePaymentFailed)
+}
+
+type CreatePermitProductRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Period      string  `json:"period" binding:"required,oneof=monthly annual"`
+	Window      string  `json:"window" binding:"required,oneof=any day night"`
+	SpotMode    string  `json:"spot_mode" binding:"required,oneof=reserved floating"`
+	Price       float64 `json:"price" binding:"required,gt=0"`
+	OverageRate float64 `json:"overage_rate" binding:"gte=0"`
+}
+
+func CreatePermitProduct(c *gin.Context) {
+	parkingID := c.Param("id")
+	var input CreatePermitProductRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, parkingID).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	product := PermitProduct{
+		ParkingID:   parking.ID,
+		Name:        input.Name,
+		Period:      input.Period,
+		Window:      input.Window,
+		SpotMode:    input.SpotMode,
+		Price:       input.Price,
+		OverageRate: input.OverageRate,
+		Active:      true,
+	}
+
+	if err := db.Create(&product).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePermitCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func GetPermitProducts(c *gin.Context) {
+	parkingID := c.Param("id")
+	var products []PermitProduct
+	if err := db.Where("parking_id = ? AND active = ?", parkingID, true).Find(&products).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePermitsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
+}
+
+func GetPermits(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var permits []Permit
+	if err := db.Preload("Product").Where("user_id = ?", userID).Order("ends_at DESC").Find(&permits).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePermitsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, permits)
+}
+
+type PurchasePermitRequest struct {
+	ProductID       uint   `json:"product_id" binding:"required"`
+	VehicleID       uint   `json:"vehicle_id" binding:"required"`
+	SpotID          *uint  `json:"spot_id"`
+	PaymentMethodID string `json:"payment_method_id" binding:"required"`
+}
+
+// PurchasePermit оформляет абонемент и списывает оплату
+func (api *API) PurchasePermit(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var input PurchasePermitRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var product PermitProduct
+	if err := db.Where("active = ?", true).First(&product, input.ProductID).Error; err != nil {
+		respondError(c, CodePermitProductNotFound)
+		return
+	}
+
+	var vehicle Vehicle
+	if err := db.First(&vehicle, input.VehicleID).Error; err != nil {
+		respondError(c, CodeVehicleNotFound)
+		return
+	}
+	if vehicle.OwnerID != userID {
+		respondError(c, CodeVehicleNotOwned)
+		return
+	}
+
+	now := time.Now()
+	permit := Permit{
+		ProductID: product.ID,
+		VehicleID: vehicle.ID,
+		UserID:    userID,
+		StartsAt:  now,
+		EndsAt:    product.periodEnd(now),
+		Status:    PermitStatusPending,
+	}
+
+	if product.SpotMode == PermitSpotReserved {
+		if input.SpotID == nil {
+			respondError(c, CodeSpotRequired)
+			return
+		}
+		var spot Spot
+		if err := db.First(&spot, *input.SpotID).Error; err != nil || spot.ParkingID != product.ParkingID {
+			respondError(c, CodeSpotNotFound)
+			return
+		}
+		permit.SpotID = &spot.ID
+	}
+
+	// Абонемент создается до оплаты: ожидающий оплаты абонемент уже держит
+	// место, поэтому вторая покупка того же места не пройдет проверку
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := reservePermitSpot(tx, permit); err != nil {
+			return err
+		}
+		return tx.Create(&permit).Error
+	})
+	if errors.Is(err, errSpotTaken) {
+		respondError(c, CodeSpotAlreadyAssigned)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodePermitPurchaseFailed)
+		return
+	}
+
+	payment, err := payForPermit(c.Request.Context(), api.services.Payments, product, input.PaymentMethodID)
+	if err != nil {
+		db.Delete(&permit)
+		paymentErrorResponse(c, err)
+		return
+	}
+
+	permit.Product = product
+	permit.LastPaymentID = &payment.ID
+	if payment.Status == string(stripe.PaymentIntentStatusSucceeded) {
+		permit.applyPayment(now)
+	}
+	if err := db.Save(&permit).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePermitPurchaseFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, permit)
+}
+
+type RenewPermitRequest struct {
+	PaymentMethodID string `json:"payment_method_id" binding:"required"`
+}
+
+// RenewPermit продлевает абонемент на следующий период
+func (api *API) RenewPermit(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id := c.Param("id")
+	var input RenewPermitRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var permit Permit
+	if err := db.Preload("Product").Where("user_id = ?", userID).First(&permit, id).Error; err != nil {
+		respondError(c, CodePermitNotFound)
+		return
+	}
+	if permit.Status == PermitStatusPending {
+		respondError(c, CodePermitPaymentPending)
+		return
+	}
+
+	// Истекший или неоплаченный абонемент начинается заново с текущего
+	// момента. За время простоя закрепленное место могли купить, поэтому оно
+	// проверяется и занимается до оплаты так же, как при покупке.
+	now := time.Now()
+	previous := permit
+	if permit.Status == PermitStatusCanceled || !permit.EndsAt.After(now) {
+		permit.StartsAt = now
+		permit.EndsAt = permit.Product.periodEnd(now)
+		permit.Status = PermitStatusPending
+		permit.ReminderSentAt = nil
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := reservePermitSpot(tx, permit); err != nil {
+				return err
+			}
+			return tx.Save(&permit).Error
+		})
+		if errors.Is(err, errSpotTaken) {
+			respondError(c, CodeSpotAlreadyAssigned)
+			return
+		}
+		if err != nil {
+			c.Error(err)
+			respondError(c, CodePermitRenewFailed)
+			return
+		}
+	}
+
+	payment, err := payForPermit(c.Request.Context(), api.services.Payments, permit.Product, input.PaymentMethodID)
+	if err != nil {
+		if permit.Status == PermitStatusPending {
+			db.Save(&previous)
+		}
+		paymentErrorResponse(c, err)
+		return
+	}
+
+	permit.LastPaymentID = &payment.ID
+	if payment.Status != string(stripe.PaymentIntentStatusSucceeded) {
+		if err := db.Save(&permit).Error; err != nil {
+			c.Error(err)
+			respondError(c, CodePermitRenewFailed)
+			return
+		}
+		writeError(c, &APIError{Code: CodePaymentIncomplete, Extra: gin.H{"payment_status": payment.Status}})
+		return
+	}
+
+	permit.applyPayment(now)
+	if err := db.Save(&permit).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePermitRenewFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, permit)
+}
+
+// applyPayment учитывает успешную оплату: ожидающий оплаты абонемент
+// начинает действовать, действующий продлевается на период с конца текущего
+func (p *Permit) applyPayment(now time.Time) {
+	if p.Status != PermitStatusPending {
+		start := p.EndsAt
+		if start.Before(now) {
+			start = now
+			p.StartsAt = now
+		}
+		p.EndsAt = p.Product.periodEnd(start)
+	}
+	p.Status = PermitStatusActive
+	p.ReminderSentAt = nil
+}
+
+// activatePermitPayment применяет к абонементам платеж, подтвержденный
+// вебхуком после ответа клиенту (например, после 3-D Secure)
+func activatePermitPayment(payment Payment, now time.Time) error {
+	var permits []Permit
+	if err := db.Preload("Product").Where("last_payment_id = ?", payment.ID).Find(&permits).Error; err != nil {
+		return err
+	}
+	for _, permit := range permits {
+		if permit.Status == PermitStatusCanceled {
+			// Ожидание оплаты истекло, место могло уйти другому
+			slog.Warn("Оплата пришла после отмены абонемента", "permit_id", permit.ID, "payment_id", payment.ID)
+			continue
+		}
+		permit.applyPayment(now)
+		if err := db.Save(&permit).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelPermitPayment снимает абонементы, ожидавшие отклоненного платежа:
+// место освобождается
+func cancelPermitPayment(payment Payment) error {
+	return db.Model(&Permit{}).
+		Where("last_payment_id = ? AND status = ?", payment.ID, PermitStatusPending).
+		Update("status", PermitStatusCanceled).Error
+}
+
+// runPermitJobs раз в час закрывает истекшие абонементы и рассылает
+// напоминания о скором окончании
+func runPermitJobs(ctx context.Context, mailer Mailer) {
+	for now := range ticks(ctx, time.Hour) {
+		db.Model(&Permit{}).
+			Where("status = ? AND ends_at <= ?", PermitStatusActive, now).
+			Update("status", PermitStatusExpired)
+		// Неподтвержденная оплата не держит место дольше permitPaymentTimeout
+		db.Model(&Permit{}).
+			Where("status = ? AND updated_at <= ?", PermitStatusPending, now.Add(-permitPaymentTimeout)).
+			Update("status", PermitStatusCanceled)
+
+		var permits []Permit
+		if err := db.Preload("Product").
+			Where("status = ? AND ends_at <= ? AND reminder_sent_at IS NULL", PermitStatusActive, now.Add(permitReminderLead)).
+			Find(&permits).Error; err != nil {
+			slog.Error("Не удалось получить абонементы для напоминаний", "error", err)
+			continue
+		}
+
+		for _, permit := range permits {
+			var user User
+			if err := db.First(&user, permit.UserID).Error; err != nil {
+				continue
+			}
+			if err := sendPermitReminder(mailer, user, permit); err != nil {
+				slog.Error("Не удалось отправить напоминание по абонементу", "permit_id", permit.ID, "error", err)
+				continue
+			}
+			db.Model(&permit).Update("reminder_sent_at", now)
+		}
+	}
+}
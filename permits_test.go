@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPermitInWindow(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		window string
+		at     time.Time
+		loc    *time.Location
+		want   bool
+	}{
+		{PermitWindowAny, time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC), time.UTC, true},
+		{PermitWindowDay, time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC), time.UTC, true},
+		{PermitWindowDay, time.Date(2026, 10, 1, 19, 59, 0, 0, time.UTC), time.UTC, true},
+		{PermitWindowDay, time.Date(2026, 10, 1, 20, 0, 0, 0, time.UTC), time.UTC, false},
+		{PermitWindowDay, time.Date(2026, 10, 1, 6, 59, 0, 0, time.UTC), time.UTC, false},
+		{PermitWindowNight, time.Date(2026, 10, 1, 20, 0, 0, 0, time.UTC), time.UTC, true},
+		{PermitWindowNight, time.Date(2026, 10, 1, 6, 59, 0, 0, time.UTC), time.UTC, true},
+		{PermitWindowNight, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), time.UTC, false},
+		// 5:00 UTC - 8:00 по Москве: уже день
+		{PermitWindowDay, time.Date(2026, 10, 1, 5, 0, 0, 0, time.UTC), moscow, true},
+		{PermitWindowNight, time.Date(2026, 10, 1, 5, 0, 0, 0, time.UTC), moscow, false},
+	}
+	for _, tt := range tests {
+		product := PermitProduct{Window: tt.window}
+		if got := product.inWindow(tt.at, tt.loc); got != tt.want {
+			t.Errorf("%s в %s (%s): %v, ожидалось %v", tt.window, tt.at.Format(time.RFC3339), tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestUncoveredDuration(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2026, 10, 1, h, m, 0, 0, time.UTC) }
+	permit := func(window string, from, to time.Time) Permit {
+		return Permit{StartsAt: from, EndsAt: to, Product: PermitProduct{Window: window}}
+	}
+
+	tests := []struct {
+		name     string
+		permits  []Permit
+		from, to time.Time
+		want     time.Duration
+	}{
+		{"без абонемента", nil, day(10, 0), day(12, 30), 2*time.Hour + 30*time.Minute},
+		{"весь срок покрыт", []Permit{permit(PermitWindowAny, day(0, 0), day(23, 0))}, day(10, 0), day(12, 0), 0},
+		{"абонемент закончился посреди стоянки", []Permit{permit(PermitWindowAny, day(0, 0), day(11, 0))}, day(10, 0), day(12, 30), 90 * time.Minute},
+		{"абонемент начался посреди стоянки", []Permit{permit(PermitWindowAny, day(11, 0), day(23, 0))}, day(10, 0), day(12, 0), time.Hour},
+		{"дневной абонемент вечером", []Permit{permit(PermitWindowDay, day(0, 0), day(23, 59))}, day(19, 0), day(21, 0), time.Hour},
+		{"ночной абонемент днем", []Permit{permit(PermitWindowNight, day(0, 0), day(23, 59))}, day(6, 0), day(8, 0), time.Hour},
+		{"истекший и новый абонементы подряд", []Permit{
+			permit(PermitWindowAny, day(11, 30), day(23, 0)),
+			permit(PermitWindowAny, day(0, 0), day(11, 0)),
+		}, day(10, 0), day(12, 0), 30 * time.Minute},
+		{"неполная минута", nil, day(10, 0), day(10, 0).Add(90 * time.Second), 90 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uncoveredDuration(tt.permits, tt.from, tt.to, time.UTC); got != tt.want {
+				t.Errorf("%s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermitApplyPayment(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	monthly := PermitProduct{Period: PermitPeriodMonthly}
+
+	tests := []struct {
+		name       string
+		permit     Permit
+		wantStarts time.Time
+		wantEnds   time.Time
+	}{
+		{"оплата покупки", Permit{Status: PermitStatusPending, StartsAt: now, EndsAt: now.AddDate(0, 1, 0), Product: monthly},
+			now, now.AddDate(0, 1, 0)},
+		{"продление действующего", Permit{Status: PermitStatusActive, StartsAt: now.AddDate(0, -1, 5), EndsAt: now.AddDate(0, 0, 5), Product: monthly},
+			now.AddDate(0, -1, 5), now.AddDate(0, 1, 5)},
+		{"продление истекшего", Permit{Status: PermitStatusExpired, StartsAt: now.AddDate(0, -2, 0), EndsAt: now.AddDate(0, -1, 0), Product: monthly},
+			now, now.AddDate(0, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.permit
+			p.applyPayment(now)
+			if p.Status != PermitStatusActive || !p.StartsAt.Equal(tt.wantStarts) || !p.EndsAt.Equal(tt.wantEnds) {
+				t.Errorf("%s %s - %s, ожидалось active %s - %s", p.Status, p.StartsAt, p.EndsAt, tt.wantStarts, tt.wantEnds)
+			}
+		})
+	}
+}
+
+// Стоянка оплачивается только за время вне срока абонемента, в том числе
+// когда абонемент истек посреди стоянки. Неоплаченные абонементы не
+// учитываются.
+func TestCalculatePaymentWithPermit(t *testing.T) {
+	testDB(t)
+	pricing := newPricing(PricingConfig{DefaultHourlyRate: 100})
+	exit := time.Now().Truncate(time.Minute)
+	entry := exit.Add(-3 * time.Hour)
+
+	tests := []struct {
+		status  string
+		ends    time.Time
+		overage float64
+		want    float64
+	}{
+		{PermitStatusActive, exit.Add(time.Hour), 0, 0},
+		{PermitStatusExpired, entry.Add(90 * time.Minute), 0, 200},  // 1,5 ч вне срока -> 2 ч
+		{PermitStatusExpired, entry.Add(90 * time.Minute), 50, 100}, // по ставке перерасхода
+		{PermitStatusCanceled, exit.Add(time.Hour), 0, 300},
+		{PermitStatusPending, exit.Add(time.Hour), 0, 300},
+	}
+	for i, tt := range tests {
+		parking := Parking{Name: "Абонементы", Capacity: 1, TimeZone: "UTC"}
+		if err := db.Create(&parking).Error; err != nil {
+			t.Fatal(err)
+		}
+		product := PermitProduct{ParkingID: parking.ID, Name: "Месяц", Period: PermitPeriodMonthly, Window: PermitWindowAny,
+			SpotMode: PermitSpotFloating, Price: 1000, OverageRate: tt.overage, Active: true}
+		if err := db.Create(&product).Error; err != nil {
+			t.Fatal(err)
+		}
+		vehicleID := uint(100 + i)
+		permit := Permit{ProductID: product.ID, VehicleID: vehicleID, UserID: 1, StartsAt: entry.Add(-24 * time.Hour), EndsAt: tt.ends, Status: tt.status}
+		if err := db.Create(&permit).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		got := pricing.calculatePayment(Entry{VehicleID: vehicleID, EntryTime: entry}, parking.ID, exit, 0)
+		if got != tt.want {
+			t.Errorf("%s до %s, перерасход %v: %v, ожидалось %v", tt.status, tt.ends.Sub(entry), tt.overage, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errSpotReserved = errors.New("место закреплено за абонементом")
+
+// ExitQuote расчет оплаты выезда
+type ExitQuote struct {
+	Amount         float64
+	FullAmount     float64      // Сумма без скидок продавцов
+	OrganizationID *uint        // Организация, которой выставляется счет
+	Validations    []Validation // Учитываются при сохранении выезда, см. closeEntry
+}
+
+// EntryPolicy правила въезда и выезда, которые живут в отдельных модулях:
+// абонементы, динамические цены, валидации продавцов, счета организаций,
+// датчики и шлагбаумы. Основные обработчики знают о них только через этот
+// интерфейс.
+type EntryPolicy interface {
+	// EntryRate проверяет, можно ли поставить автомобиль на место, и
+	// возвращает ставку, которая фиксируется на время стоянки
+	EntryRate(ctx context.Context, spot Spot, vehicle Vehicle, at time.Time) (float64, error)
+	// AfterEntry вызывается после регистрации въезда
+	AfterEntry(ctx context.Context, entry Entry, spot Spot, laneID uint)
+	// QuoteExit считает сумму к оплате и определяет плательщика
+	QuoteExit(ctx context.Context, entry Entry, spot Spot, codes []string, at time.Time) (ExitQuote, error)
+	// AfterExit вызывается после создания платежа за выезд
+	AfterExit(ctx context.Context, quote ExitQuote, entry Entry, payment Payment, spot Spot, laneID uint, at time.Time)
+}
+
+// featureEntryPolicy правила со всеми модулями. Абонементы, валидации,
+// организации, динамическая цена и шлагбаумы читаются из глобального db, а
+// не из Store, поэтому эти правила требуют Postgres; с хранилищем в памяти
+// используется basicEntryPolicy.
+//
+// Модули обращаются к базе без контекста запроса, поэтому каждый шаг
+// завернут в свой спан: в трассе видно, сколько времени ушло на правила.
+type featureEntryPolicy struct {
+	pricing Pricing
+}
+
+func (p featureEntryPolicy) EntryRate(ctx context.Context, spot Spot, vehicle Vehicle, at time.Time) (float64, error) {
+	_, span := tracer.Start(ctx, "policy.EntryRate", spanSpotAttrs(spot)...)
+	defer span.End()
+
+	if permit, ok := spotReservation(spot.ID, at); ok && permit.VehicleID != vehicle.ID {
+		return 0, errSpotReserved
+	}
+	return p.pricing.currentRate(spot.ParkingID), nil
+}
+
+func (featureEntryPolicy) AfterEntry(ctx context.Context, entry Entry, spot Spot, laneID uint) {
+	_, span := tracer.Start(ctx, "policy.AfterEntry", spanSpotAttrs(spot)...)
+	defer span.End()
+
+	resolveSpotMismatches(spot.ID, "entry_created")
+	if laneID != 0 {
+		openLaneGate(laneID, spot.ParkingID, "entry")
+	}
+}
+
+func (p featureEntryPolicy) QuoteExit(ctx context.Context, entry Entry, spot Spot, codes []string, at time.Time) (quote ExitQuote, err error) {
+	_, span := tracer.Start(ctx, "policy.QuoteExit", spanSpotAttrs(spot)...)
+	defer func() {
+		span.SetAttributes(attribute.Float64("payment.amount", quote.Amount))
+		endSpan(span, err)
+	}()
+
+	validations, err := collectValidations(entry, spot.ParkingID, codes, at)
+	if err != nil {
+		return ExitQuote{}, err
+	}
+
+	quote = ExitQuote{
+		Amount:      p.pricing.calculatePayment(entry, spot.ParkingID, at, validationDiscount(validations)),
+		Validations: validations,
+	}
+	quote.FullAmount = quote.Amount
+	if len(validations) > 0 {
+		quote.FullAmount = p.pricing.calculatePayment(entry, spot.ParkingID, at, 0)
+	}
+
+	// Выезды корпоративных автомобилей с постоплатой попадают в счет
+	// организации, если укладываются в лимит (см. closeEntry)
+	if org, ok := organizationPayer(entry.VehicleID); ok {
+		quote.OrganizationID = &org.ID
+	}
+	return quote, nil
+}
+
+func (featureEntryPolicy) AfterExit(ctx context.Context, quote ExitQuote, entry Entry, payment Payment, spot Spot, laneID uint, at time.Time) {
+	_, span := tracer.Start(ctx, "policy.AfterExit", spanSpotAttrs(spot)...)
+	defer span.End()
+
+	if laneID != 0 {
+		openLaneGate(laneID, spot.ParkingID, "exit")
+	}
+}
+
+// basicEntryPolicy только почасовой тариф из хранилища, без остальных
+// модулей. Не обращается к базе, поэтому подходит для хранилища в памяти.
+type basicEntryPolicy struct {
+	parkings ParkingRepository
+	pricing  PricingConfig
+}
+
+func (p basicEntryPolicy) rate(parkingID uint) float64 {
+	tariff, err := p.parkings.Tariff(parkingID, "почасовой")
+	if err != nil {
+		return p.pricing.DefaultHourlyRate
+	}
+	return tariff.Price
+}
+
+func (p basicEntryPolicy) EntryRate(ctx context.Context, spot Spot, vehicle Vehicle, at time.Time) (float64, error) {
+	return p.rate(spot.ParkingID), nil
+}
+
+func (basicEntryPolicy) AfterEntry(ctx context.Context, entry Entry, spot Spot, laneID uint) {}
+
+func (p basicEntryPolicy) QuoteExit(ctx context.Context, entry Entry, spot Spot, codes []string, at time.Time) (ExitQuote, error) {
+	if len(codes) > 0 {
+		return ExitQuote{}, errValidationCodeInvalid
+	}
+
+	rate := p.rate(spot.ParkingID)
+	if entry.LockedRate != nil {
+		rate = *entry.LockedRate
+	}
+	amount := float64(billableHours(at.Sub(entry.EntryTime))) * rate
+	return ExitQuote{Amount: amount, FullAmount: amount}, nil
+}
+
+func (basicEntryPolicy) AfterExit(ctx context.Context, quote ExitQuote, entry Entry, payment Payment, spot Spot, laneID uint, at time.Time) {
+}
+
+// spanSpotAttrs атрибуты спана с местом и парковкой
+func spanSpotAttrs(spot Spot) []trace.SpanStartOption {
+	return []trace.SpanStartOption{trace.WithAttributes(
+		attribute.Int64("parking.id", int64(spot.ParkingID)),
+		attribute.Int64("spot.id", int64(spot.ID)),
+	)}
+}
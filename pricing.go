@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// pricingInterval - как часто пересматривается динамическая цена
+	pricingInterval = 5 * time.Minute
+	// pricingForecastHours - на сколько часов вперед учитывается прогноз спроса
+	pricingForecastHours = 3
+	// Пороги заполненности по умолчанию: выше верхнего цена растет на шаг,
+	// ниже нижнего - снижается
+	defaultPricingLowOccupancy  = 0.5
+	defaultPricingHighOccupancy = 0.85
+)
+
+// Причины изменения цены
+const (
+	PriceChangeConfig   = "config"
+	PriceChangeDemand   = "demand"
+	PriceChangeEnabled  = "enabled"  // Тариф сменился динамической ставкой
+	PriceChangeDisabled = "disabled" // Динамическая ставка сменилась тарифом
+)
+
+// Pricing ставки парковок. DefaultHourlyRate из настроек действует, пока у
+// парковки нет почасового тарифа.
+type Pricing struct {
+	cfg PricingConfig
+}
+
+func newPricing(cfg PricingConfig) Pricing {
+	return Pricing{cfg: cfg}
+}
+
+// hourlyRate возвращает почасовой тариф парковки
+func (p Pricing) hourlyRate(parkingID uint) float64 {
+	var tariff Tariff
+	if err := db.Where("parking_id = ?", parkingID).Where("type = ?", "почасовой").First(&tariff).Error; err != nil {
+		return p.cfg.DefaultHourlyRate
+	}
+	return tariff.Price
+}
+
+// currentRate возвращает почасовую ставку, которую водитель видит сейчас:
+// динамическую, если режим включен, иначе из тарифа
+func (p Pricing) currentRate(parkingID uint) float64 {
+	var pricing DynamicPricing
+	if err := db.Where("parking_id = ? AND enabled = ?", parkingID, true).First(&pricing).Error; err == nil {
+		return pricing.CurrentRate
+	}
+	return p.hourlyRate(parkingID)
+}
+
+// calculatePayment считает стоимость стоянки по почасовому тарифу парковки.
+// Время в окне и сроке абонемента бесплатно, остальное оплачивается по
+// ставке перерасхода последнего абонемента. discount - бесплатное время от
+// валидаций продавцов, вычитается до округления до часов.
+func (p Pricing) calculatePayment(entry Entry, parkingID uint, exitTime time.Time, discount time.Duration) float64 {
+	rate := p.hourlyRate(parkingID)
+	if entry.LockedRate != nil {
+		rate = *entry.LockedRate
+	}
+	billable := exitTime.Sub(entry.EntryTime)
+
+	permits, err := findStayPermits(entry.VehicleID, parkingID, entry.EntryTime, exitTime)
+	if err != nil {
+		slog.Error("Не удалось получить абонементы", "vehicle_id", entry.VehicleID, "error", err)
+	}
+	if len(permits) > 0 {
+		var parking Parking
+		db.First(&parking, parkingID)
+		billable = uncoveredDuration(permits, entry.EntryTime, exitTime, parkingLocation(parking))
+		if overage := permits[0].Product.OverageRate; overage > 0 {
+			rate = overage
+		}
+	}
+
+	return float64(billableHours(billable-discount)) * rate
+}
+
+// clampRate ограничивает ставку полом и потолком и округляет до копеек
+func (p DynamicPricing) clampRate(rate float64) float64 {
+	rate = math.Max(p.FloorRate, math.Min(p.CeilingRate, rate))
+	return math.Round(rate*100) / 100
+}
+
+// demandOccupancy возвращает текущую заполненность парковки и наибольшую
+// ожидаемую в ближайшие pricingForecastHours часов, в долях
+func demandOccupancy(parking Parking, now time.Time) (float64, float64, error) {
+	var spots, occupied int64
+	if err := db.Model(&Spot{}).Where("parking_id = ?", parking.ID).Count(&spots).Error; err != nil {
+		return 0, 0, err
+	}
+	if spots == 0 {
+		return 0, 0, nil
+	}
+	if err := db.Model(&Spot{}).Where("parking_id = ? AND is_occupied = ?", parking.ID, true).Count(&occupied).Error; err != nil {
+		return 0, 0, err
+	}
+
+	points, _, err := forecastParking(parking, now, pricingForecastHours)
+	if err != nil {
+		return 0, 0, err
+	}
+	forecast := 0.0
+	for _, p := range points {
+		forecast = math.Max(forecast, p.PredictedOccupied)
+	}
+
+	return float64(occupied) / float64(spots), forecast / float64(spots), nil
+}
+
+// setRate сохраняет новую ставку и пишет изменение в журнал
+func setRate(tx *gorm.DB, pricing *DynamicPricing, rate float64, change PriceChange) error {
+	change.ParkingID = pricing.ParkingID
+	change.OldRate = pricing.CurrentRate
+	change.NewRate = rate
+
+	pricing.CurrentRate = rate
+	if err := tx.Save(pricing).Error; err != nil {
+		return err
+	}
+	return tx.Create(&change).Error
+}
+
+// adjustPrice сдвигает ставку на шаг в сторону спроса. Учитывается большая из
+// текущей и прогнозной заполненности, чтобы цена росла до наплыва, а не после.
+func adjustPrice(pricing DynamicPricing, now time.Time) error {
+	var parking Parking
+	if err := db.First(&parking, pricing.ParkingID).Error; err != nil {
+		return err
+	}
+
+	occupancy, forecast, err := demandOccupancy(parking, now)
+	if err != nil {
+		return err
+	}
+	demand := math.Max(occupancy, forecast)
+
+	rate := pricing.CurrentRate
+	switch {
+	case demand >= pricing.HighOccupancy:
+		rate += pricing.Step
+	case demand < pricing.LowOccupancy:
+		rate -= pricing.Step
+	}
+	rate = pricing.clampRate(rate)
+	if rate == pricing.CurrentRate {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return setRate(tx, &pricing, rate, PriceChange{
+			Reason:            PriceChangeDemand,
+			Occupancy:         occupancy,
+			ForecastOccupancy: forecast,
+		})
+	})
+}
+
+// runDynamicPricing пересматривает цены парковок с динамическим режимом
+func runDynamicPricing(ctx context.Context) {
+	for now := range ticks(ctx, pricingInterval) {
+		var configs []DynamicPricing
+		if err := db.Where("enabled = ?", true).Find(&configs).Error; err != nil {
+			slog.Error("Не удалось получить настройки динамических цен", "error", err)
+			continue
+		}
+
+		for _, pricing := range configs {
+			if err := adjustPrice(pricing, now); err != nil {
+				slog.Error("Не удалось пересчитать цену", "parking_id", pricing.ParkingID, "error", err)
+			}
+		}
+	}
+}
+
+// PricingResponse действующая ставка парковки
+type PricingResponse struct {
+	ParkingID uint            `json:"parking_id"`
+	Rate      float64         `json:"rate"`
+	Dynamic   bool            `json:"dynamic"`
+	Config    *DynamicPricing `json:"config,omitempty"`
+}
+
+// GetPricing возвращает действующую ставку парковки и настройки динамического режима
+func (api *API) GetPricing(c *gin.Context) {
+	var parking Parking
+	if err := db.First(&parking, c.Param("id")).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	response := PricingResponse{ParkingID: parking.ID, Rate: api.services.Pricing.currentRate(parking.ID)}
+	var pricing DynamicPricing
+	if err := db.Where("parking_id = ?", parking.ID).First(&pricing).Error; err == nil {
+		response.Dynamic = pricing.Enabled
+		response.Config = &pricing
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdatePricingRequest настройки динамической цены. Пороги заполненности
+// необязательны: без них действуют 0.5 и 0.85, а low_occupancy 0 значит, что
+// цена никогда не снижается.
+type UpdatePricingRequest struct {
+	Enabled       bool     `json:"enabled"`
+	FloorRate     float64  `json:"floor_rate" binding:"gt=0"`
+	CeilingRate   float64  `json:"ceiling_rate" binding:"gtefield=FloorRate"`
+	Step          float64  `json:"step" binding:"gt=0"`
+	LowOccupancy  *float64 `json:"low_occupancy" binding:"omitempty,gte=0,lte=1"`
+	HighOccupancy *float64 `json:"high_occupancy" binding:"omitempty,gte=0,lte=1"`
+}
+
+// UpdatePricing включает, выключает или настраивает динамическую цену
+func (api *API) UpdatePricing(c *gin.Context) {
+	var input UpdatePricingRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	low, high := defaultPricingLowOccupancy, defaultPricingHighOccupancy
+	if input.LowOccupancy != nil {
+		low = *input.LowOccupancy
+	}
+	if input.HighOccupancy != nil {
+		high = *input.HighOccupancy
+	}
+	if low >= high {
+		respondError(c, CodeInvalidOccupancyThresholds)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, c.Param("id")).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	tariffRate := api.services.Pricing.hourlyRate(parking.ID)
+	pricing := DynamicPricing{ParkingID: parking.ID}
+	db.Where("parking_id = ?", parking.ID).First(&pricing)
+	if pricing.CurrentRate == 0 {
+		// При первом включении стартуем с цены из тарифа
+		pricing.CurrentRate = tariffRate
+	}
+	wasEnabled := pricing.Enabled
+
+	pricing.Enabled = input.Enabled
+	pricing.FloorRate = input.FloorRate
+	pricing.CeilingRate = input.CeilingRate
+	pricing.Step = input.Step
+	pricing.LowOccupancy = low
+	pricing.HighOccupancy = high
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if rate := pricing.clampRate(pricing.CurrentRate); rate != pricing.CurrentRate {
+			if err := setRate(tx, &pricing, rate, PriceChange{Reason: PriceChangeConfig}); err != nil {
+				return err
+			}
+		} else if err := tx.Save(&pricing).Error; err != nil {
+			return err
+		}
+
+		// Включение и выключение меняют ставку, которую видят водители:
+		// тариф на динамическую или обратно
+		switch {
+		case pricing.Enabled && !wasEnabled:
+			return tx.Create(&PriceChange{ParkingID: parking.ID, OldRate: tariffRate, NewRate: pricing.CurrentRate, Reason: PriceChangeEnabled}).Error
+		case !pricing.Enabled && wasEnabled:
+			return tx.Create(&PriceChange{ParkingID: parking.ID, OldRate: pricing.CurrentRate, NewRate: tariffRate, Reason: PriceChangeDisabled}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodePricingSaveFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, pricing)
+}
+
+// GetPriceChanges возвращает журнал изменений цены
+func GetPriceChanges(c *gin.Context) {
+	query := db.Where("parking_id = ?", c.Param("id"))
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			respondError(c, CodeInvalidFrom)
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+
+	var changes []PriceChange
+	if err := query.Order("created_at DESC").Limit(500).Find(&changes).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodePriceChangesListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBillableHours(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     int
+	}{
+		{-time.Minute, 0},
+		{0, 0},
+		{time.Second, 1},
+		{time.Hour, 1},
+		{time.Hour + time.Nanosecond, 2},
+		{150 * time.Minute, 3},
+	}
+	for _, tt := range tests {
+		if got := billableHours(tt.duration); got != tt.want {
+			t.Errorf("%s: %d ч, ожидалось %d", tt.duration, got, tt.want)
+		}
+	}
+}
+
+func TestClampRate(t *testing.T) {
+	pricing := DynamicPricing{FloorRate: 2, CeilingRate: 5}
+	tests := []struct {
+		rate, want float64
+	}{
+		{3, 3},
+		{1.5, 2},
+		{7, 5},
+		{2.345, 2.35},
+		{4.999, 5},
+	}
+	for _, tt := range tests {
+		if got := pricing.clampRate(tt.rate); got != tt.want {
+			t.Errorf("%v: %v, ожидалось %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestAdjustPrice(t *testing.T) {
+	testDB(t)
+	now := time.Date(2026, 10, 14, 10, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		occupied int // Из 4 мест; истории нет, так что прогноз равен текущей заполненности
+		rate     float64
+		want     float64
+	}{
+		{"высокий спрос", 4, 3, 3.5},
+		{"верхний порог включительно", 3, 3, 3.5},
+		{"нижний порог не снижает цену", 2, 3, 3},
+		{"низкий спрос", 1, 3, 2.5},
+		{"потолок", 4, 4.8, 5},
+		{"пол", 0, 2, 2},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parking := Parking{Name: fmt.Sprintf("Спрос %d", i), Capacity: 4, TimeZone: "UTC"}
+			create(t, &parking)
+			for n := 0; n < 4; n++ {
+				create(t, &Spot{ParkingID: parking.ID, Number: fmt.Sprint(n), IsOccupied: n < tt.occupied})
+			}
+			pricing := DynamicPricing{
+				ParkingID: parking.ID, Enabled: true, FloorRate: 2, CeilingRate: 5, Step: 0.5,
+				LowOccupancy: 0.5, HighOccupancy: 0.75, CurrentRate: tt.rate,
+			}
+			create(t, &pricing)
+
+			if err := adjustPrice(pricing, now); err != nil {
+				t.Fatal(err)
+			}
+			var saved DynamicPricing
+			db.First(&saved, "parking_id = ?", parking.ID)
+			if saved.CurrentRate != tt.want {
+				t.Errorf("ставка %v, ожидалось %v", saved.CurrentRate, tt.want)
+			}
+
+			var changes []PriceChange
+			db.Where("parking_id = ?", parking.ID).Find(&changes)
+			if tt.want == tt.rate && len(changes) != 0 {
+				t.Errorf("ставка не менялась, а в журнале %+v", changes)
+			}
+			if tt.want != tt.rate && (len(changes) != 1 || changes[0].Reason != PriceChangeDemand ||
+				changes[0].OldRate != tt.rate || changes[0].NewRate != tt.want) {
+				t.Errorf("журнал %+v, ожидалось изменение %v -> %v по спросу", changes, tt.rate, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePricing(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, nil)
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	parking := Parking{Name: "Динамическая", Capacity: 4}
+	create(t, &parking)
+	path := fmt.Sprintf("/api/v1/parkings/%d/pricing", parking.ID)
+	share := func(v float64) *float64 { return &v }
+
+	// Шаги выполняются по порядку: каждый видит настройки предыдущего
+	tests := []struct {
+		name      string
+		input     UpdatePricingRequest
+		code      ErrorCode
+		low, high float64
+		rate      float64
+		change    *PriceChange // Новая запись в журнале
+	}{
+		{name: "включение с порогами по умолчанию",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 1, CeilingRate: 10, Step: 0.5},
+			low:   defaultPricingLowOccupancy, high: defaultPricingHighOccupancy, rate: 2.5,
+			change: &PriceChange{OldRate: 2.5, NewRate: 2.5, Reason: PriceChangeEnabled}},
+		{name: "нулевой нижний порог не заменяется умолчанием",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 1, CeilingRate: 10, Step: 0.5, LowOccupancy: share(0), HighOccupancy: share(0.9)},
+			low:   0, high: 0.9, rate: 2.5},
+		{name: "пол выше текущей ставки",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 3, CeilingRate: 10, Step: 0.5},
+			low:   defaultPricingLowOccupancy, high: defaultPricingHighOccupancy, rate: 3,
+			change: &PriceChange{OldRate: 2.5, NewRate: 3, Reason: PriceChangeConfig}},
+		{name: "выключение",
+			input: UpdatePricingRequest{FloorRate: 3, CeilingRate: 10, Step: 0.5},
+			low:   defaultPricingLowOccupancy, high: defaultPricingHighOccupancy, rate: 3,
+			change: &PriceChange{OldRate: 3, NewRate: 2.5, Reason: PriceChangeDisabled}},
+		{name: "нижний порог не ниже верхнего",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 1, CeilingRate: 10, Step: 0.5, LowOccupancy: share(0.9)},
+			code:  CodeInvalidOccupancyThresholds},
+		{name: "нулевой верхний порог",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 1, CeilingRate: 10, Step: 0.5, LowOccupancy: share(0), HighOccupancy: share(0)},
+			code:  CodeInvalidOccupancyThresholds},
+		{name: "порог больше единицы",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 1, CeilingRate: 10, Step: 0.5, HighOccupancy: share(1.5)},
+			code:  CodeValidationFailed},
+		{name: "потолок ниже пола",
+			input: UpdatePricingRequest{Enabled: true, FloorRate: 5, CeilingRate: 4, Step: 0.5},
+			code:  CodeValidationFailed},
+	}
+	var logged int64
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPut, path, admin, tt.input)
+			if tt.code != "" {
+				s.expectError(w, http.StatusBadRequest, tt.code)
+				return
+			}
+			var pricing DynamicPricing
+			s.expect(w, http.StatusOK, &pricing)
+			if pricing.Enabled != tt.input.Enabled || pricing.LowOccupancy != tt.low || pricing.HighOccupancy != tt.high || pricing.CurrentRate != tt.rate {
+				t.Errorf("%+v, ожидались пороги %v и %v и ставка %v", pricing, tt.low, tt.high, tt.rate)
+			}
+
+			var changes []PriceChange
+			db.Where("parking_id = ?", parking.ID).Order("id").Offset(int(logged)).Find(&changes)
+			logged += int64(len(changes))
+			switch {
+			case tt.change == nil && len(changes) != 0:
+				t.Errorf("лишние записи в журнале: %+v", changes)
+			case tt.change != nil && (len(changes) != 1 || changes[0].OldRate != tt.change.OldRate ||
+				changes[0].NewRate != tt.change.NewRate || changes[0].Reason != tt.change.Reason):
+				t.Errorf("журнал %+v, ожидалось %+v", changes, *tt.change)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Ограничение частоты запросов - token bucket: в ведре до Requests
+// жетонов, каждый запрос забирает один, ведро пополняется на Requests
+// жетонов за Per. Ограничения:
+//   - login и register с одного IP (rate_limit.auth_per_ip);
+//   - попытки входа в одну учетную запись (login_per_account) и
+//     блокировка после серии неудачных паролей, каждый раз вдвое дольше;
+//   - авторизованные запросы одного пользователя (api_per_token), для
+//     партнерских интеграций квота задается отдельно по ID пользователя.
+//
+// Счетчики хранятся в памяти процесса или в Redis, если серверов несколько.
+// Ошибка Redis не должна отключать API, поэтому при ней запрос пропускается.
+
+// RateLimit Requests запросов за Per; Requests <= 0 - без ограничения
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// RateStore хранилище ведер и счетчиков неудачных входов
+type RateStore interface {
+	// Take забирает жетон из ведра key. Возвращает 0, если жетон был, иначе
+	// время до появления следующего.
+	Take(ctx context.Context, key string, limit RateLimit) (time.Duration, error)
+	// Incr увеличивает счетчик key, который живет ttl с первого увеличения
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Lock блокирует key на ttl, LockedFor - сколько еще длится блокировка
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	Reset(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// RateLimiter ограничения частоты запросов. Нулевой указатель ничего не
+// ограничивает: так работают консольные команды.
+type RateLimiter struct {
+	cfg   RateLimitConfig
+	store RateStore
+}
+
+func newRateLimiter(cfg RateLimitConfig) (*RateLimiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Backend == "redis" {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limit.redis_url: %w", err)
+		}
+		return &RateLimiter{cfg: cfg, store: &redisRateStore{client: redis.NewClient(opts)}}, nil
+	}
+	return &RateLimiter{cfg: cfg, store: newMemoryRateStore()}, nil
+}
+
+// Close закрывает подключение к Redis
+func (l *RateLimiter) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.store.Close()
+}
+
+// LimitByIP middleware: ограничение rate_limit.auth_per_ip по адресу клиента
+func (l *RateLimiter) LimitByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			return
+		}
+		if wait := l.take(c.Request.Context(), "auth_ip", "ip:"+c.ClientIP(), l.cfg.AuthPerIP); wait > 0 {
+			respondRateLimited(c, CodeRateLimited, wait)
+			c.Abort()
+		}
+	}
+}
+
+// LimitByToken middleware для группы с AuthMiddleware: квота запросов
+// пользователя из токена. Все токены пользователя делят одну квоту, чтобы ее
+// нельзя было обойти, получив новый токен.
+func (l *RateLimiter) LimitByToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			return
+		}
+		userID := c.GetUint("user_id")
+		limit, ok := l.cfg.Partners[userID]
+		if !ok {
+			limit = l.cfg.APIPerToken
+		}
+		if wait := l.take(c.Request.Context(), "api_token", "user:"+strconv.FormatUint(uint64(userID), 10), limit); wait > 0 {
+			respondRateLimited(c, CodeRateLimited, wait)
+			c.Abort()
+		}
+	}
+}
+
+// loginAllowed проверяет блокировку учетной записи и ее ведро попыток.
+// Возвращает 0 или время, через которое можно повторить, и код ошибки.
+func (l *RateLimiter) loginAllowed(ctx context.Context, email string) (time.Duration, ErrorCode) {
+	if l == nil {
+		return 0, ""
+	}
+	account := accountKey(email)
+	locked, err := l.store.LockedFor(ctx, "lock:"+account)
+	if err != nil {
+		slog.WarnContext(ctx, "Не удалось проверить блокировку входа", "error", err)
+	}
+	if locked > 0 {
+		rateLimitedTotal.WithLabelValues("login_lockout").Inc()
+		return locked, CodeLoginLocked
+	}
+	if wait := l.take(ctx, "login_account", account, l.cfg.LoginPerAccount); wait > 0 {
+		return wait, CodeRateLimited
+	}
+	return 0, ""
+}
+
+// loginFailed учитывает неудачный пароль. Начиная с Threshold-й неудачи
+// подряд вход блокируется на Base, и каждая следующая неудача удваивает
+// блокировку, но не больше Max.
+func (l *RateLimiter) loginFailed(ctx context.Context, email string) {
+	if l == nil || l.cfg.Lockout.Threshold <= 0 {
+		return
+	}
+	lockout := l.cfg.Lockout
+	account := accountKey(email)
+	failures, err := l.store.Incr(ctx, "failures:"+account, lockout.Window)
+	if err != nil {
+		slog.WarnContext(ctx, "Не удалось учесть неудачный вход", "error", err)
+		return
+	}
+	if failures < int64(lockout.Threshold) {
+		return
+	}
+
+	lockFor := lockout.Max
+	if shift := failures - int64(lockout.Threshold); shift < 32 {
+		lockFor = min(lockout.Base<<shift, lockout.Max)
+	}
+	if err := l.store.Lock(ctx, "lock:"+account, lockFor); err != nil {
+		slog.WarnContext(ctx, "Не удалось заблокировать вход", "error", err)
+		return
+	}
+	slog.WarnContext(ctx, "Вход заблокирован после неудачных попыток", "failures", failures, "duration", lockFor)
+}
+
+// loginSucceeded сбрасывает счетчик неудач после успешного входа
+func (l *RateLimiter) loginSucceeded(ctx context.Context, email string) {
+	if l == nil {
+		return
+	}
+	account := accountKey(email)
+	if err := l.store.Reset(ctx, "failures:"+account, "lock:"+account); err != nil {
+		slog.WarnContext(ctx, "Не удалось сбросить счетчик неудачных входов", "error", err)
+	}
+}
+
+// take забирает жетон; при ошибке хранилища запрос пропускается
+func (l *RateLimiter) take(ctx context.Context, name, key string, limit RateLimit) time.Duration {
+	if !limit.enabled() {
+		return 0
+	}
+	wait, err := l.store.Take(ctx, "bucket:"+name+":"+key, limit)
+	if err != nil {
+		slog.WarnContext(ctx, "Хранилище ограничений недоступно, запрос пропущен", "limit", name, "error", err)
+		return 0
+	}
+	if wait > 0 {
+		rateLimitedTotal.WithLabelValues(name).Inc()
+	}
+	return wait
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// respondRateLimited отвечает 429 с Retry-After в целых секундах
+func respondRateLimited(c *gin.Context, code ErrorCode, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	writeError(c, &APIError{Code: code, Extra: gin.H{"retry_after": seconds}})
+}
+
+// memoryRateStore счетчики в памяти одного процесса
+type memoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	counters  map[string]expiringCounter
+	locks     map[string]time.Time
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // Когда ведро наполнится, если его не трогать
+}
+
+type expiringCounter struct {
+	n       int64
+	expires time.Time
+}
+
+// memorySweepInterval как часто удаляются полные ведра и истекшие счетчики
+const memorySweepInterval = time.Minute
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{
+		buckets:   map[string]*tokenBucket{},
+		counters:  map[string]expiringCounter{},
+		locks:     map[string]time.Time{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryRateStore) Take(_ context.Context, key string, limit RateLimit) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Per / time.Duration(limit.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.updated))/float64(perToken))
+	b.updated = now
+
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	b.full = now.Add(time.Duration((capacity - b.tokens) * float64(perToken)))
+	return wait, nil
+}
+
+func (s *memoryRateStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	counter := s.counters[key]
+	if now.After(counter.expires) {
+		counter = expiringCounter{expires: now.Add(ttl)}
+	}
+	counter.n++
+	s.counters[key] = counter
+	return counter.n, nil
+}
+
+func (s *memoryRateStore) Lock(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryRateStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until, ok := s.locks[key]; ok {
+		return max(time.Until(until), 0), nil
+	}
+	return 0, nil
+}
+
+func (s *memoryRateStore) Reset(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.counters, key)
+		delete(s.locks, key)
+	}
+	return nil
+}
+
+func (s *memoryRateStore) Close() error {
+	return nil
+}
+
+// sweep удаляет записи, которые ничего не ограничивают; вызывается под mu
+func (s *memoryRateStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.After(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, counter := range s.counters {
+		if now.After(counter.expires) {
+			delete(s.counters, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// redisRateStore счетчики в Redis, общие для всех экземпляров сервера
+type redisRateStore struct {
+	client *redis.Client
+}
+
+// redisKeyPrefix отделяет ключи ограничителя от других данных в Redis
+const redisKeyPrefix = "parking:ratelimit:"
+
+// tokenBucketScript атомарно пополняет ведро и забирает жетон. Время
+// берется из Redis, чтобы расхождение часов серверов не влияло на ведра.
+// ARGV: емкость, миллисекунд на жетон. Возвращает миллисекунды ожидания.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local per_token = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + (now - updated) / per_token)
+
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) * per_token)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) * per_token) + 1000)
+return wait
+`)
+
+func (s *redisRateStore) Take(ctx context.Context, key string, limit RateLimit) (time.Duration, error) {
+	perToken := float64(limit.Per.Milliseconds()) / float64(limit.Requests)
+	wait, err := tokenBucketScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, limit.Requests, perToken).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// incrScript увеличивает счетчик и задает срок жизни при первом увеличении
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (s *redisRateStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *redisRateStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, redisKeyPrefix+key, 1, ttl).Err()
+}
+
+func (s *redisRateStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, redisKeyPrefix+key).Result()
+	if err != nil || ttl < 0 { // -2: ключа нет, -1: без срока (не бывает)
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *redisRateStore) Reset(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisKeyPrefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+func (s *redisRateStore) Close() error {
+	return s.client.Close()
+}
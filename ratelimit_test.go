@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingRateStore хранилище, которое всегда недоступно
+type failingRateStore struct{}
+
+var errStoreDown = errors.New("хранилище недоступно")
+
+func (failingRateStore) Take(context.Context, string, RateLimit) (time.Duration, error) {
+	return 0, errStoreDown
+}
+func (failingRateStore) Incr(context.Context, string, time.Duration) (int64, error) {
+	return 0, errStoreDown
+}
+func (failingRateStore) Lock(context.Context, string, time.Duration) error { return errStoreDown }
+func (failingRateStore) LockedFor(context.Context, string) (time.Duration, error) {
+	return 0, errStoreDown
+}
+func (failingRateStore) Reset(context.Context, ...string) error { return errStoreDown }
+func (failingRateStore) Close() error                           { return nil }
+
+func TestMemoryRateStoreTake(t *testing.T) {
+	ctx := context.Background()
+	limit := RateLimit{Requests: 2, Per: time.Hour}
+
+	tests := []struct {
+		name    string
+		advance time.Duration // На сколько состарить ведро перед запросом
+		want    time.Duration // Ожидание; округляется до минуты
+	}{
+		{"первый жетон", 0, 0},
+		{"второй жетон", 0, 0},
+		{"ведро пусто", 0, 30 * time.Minute},
+		{"прошло четверть часа", 15 * time.Minute, 15 * time.Minute},
+		{"пополнилось на жетон", 15 * time.Minute, 0},
+		// Ведро не копит больше Requests жетонов
+		{"простой дольше периода", 3 * time.Hour, 0},
+		{"второй после простоя", 0, 0},
+		{"третий после простоя", 0, 30 * time.Minute},
+	}
+	store := newMemoryRateStore()
+	for _, tt := range tests {
+		if b, ok := store.buckets["key"]; ok {
+			b.updated = b.updated.Add(-tt.advance)
+		}
+		wait, err := store.Take(ctx, "key", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := wait.Round(time.Minute); got != tt.want {
+			t.Errorf("%s: ожидание %s, ожидалось %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockoutBackoff(t *testing.T) {
+	lockout := LockoutConfig{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute, Window: time.Hour}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		// Сдвиг на 32 и больше бит не переполняет длительность
+		{40, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		l := &RateLimiter{cfg: RateLimitConfig{Lockout: lockout}, store: newMemoryRateStore()}
+		ctx := context.Background()
+		for i := 0; i < tt.failures; i++ {
+			l.loginFailed(ctx, " Driver@Example.com")
+		}
+		// Ключ учетной записи не зависит от регистра и пробелов
+		locked, code := l.loginAllowed(ctx, "driver@example.com")
+		if got := locked.Round(time.Minute); got != tt.want {
+			t.Errorf("%d неудач: блокировка %s, ожидалось %s", tt.failures, got, tt.want)
+		}
+		if (tt.want > 0) != (code == CodeLoginLocked) {
+			t.Errorf("%d неудач: код %q", tt.failures, code)
+		}
+
+		l.loginSucceeded(ctx, "driver@example.com")
+		if locked, _ := l.loginAllowed(ctx, "driver@example.com"); locked != 0 {
+			t.Errorf("%d неудач: после успешного входа блокировка %s", tt.failures, locked)
+		}
+	}
+}
+
+func TestLimitByToken(t *testing.T) {
+	cfg := RateLimitConfig{
+		APIPerToken: RateLimit{Requests: 1, Per: time.Hour},
+		Partners:    map[uint]RateLimit{7: {Requests: 3, Per: time.Hour}},
+	}
+	tests := []struct {
+		name    string
+		limiter *RateLimiter
+		userID  uint
+		allowed int // Сколько запросов подряд проходит из четырех
+	}{
+		{"обычный пользователь", &RateLimiter{cfg: cfg, store: newMemoryRateStore()}, 1, 1},
+		{"партнер со своей квотой", &RateLimiter{cfg: cfg, store: newMemoryRateStore()}, 7, 3},
+		{"ограничения выключены", nil, 1, 4},
+		// Сбой хранилища не отключает API
+		{"хранилище недоступно", &RateLimiter{cfg: cfg, store: failingRateStore{}}, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) { c.Set("user_id", tt.userID) }, tt.limiter.LimitByToken(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			allowed := 0
+			for i := 0; i < 4; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if w.Code == http.StatusOK {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("прошло %d запросов, ожидалось %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRespondRateLimited(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{10 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1200 * time.Millisecond, "2"},
+		{90 * time.Minute, "5400"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		respondRateLimited(c, CodeRateLimited, tt.wait)
+		if got := w.Header().Get("Retry-After"); got != tt.want || w.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: %d, Retry-After %q; ожидалось 429 и %q", tt.wait, w.Code, got, tt.want)
+		}
+	}
+}
+
+// Полные ведра и истекшие счетчики удаляются, чтобы память не росла с
+// числом клиентов
+func TestMemoryRateStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryRateStore()
+	store.Take(ctx, "full", RateLimit{Requests: 1, Per: time.Second})
+	store.Take(ctx, "empty", RateLimit{Requests: 1, Per: time.Hour})
+	store.Incr(ctx, "counter", time.Millisecond)
+	store.Lock(ctx, "lock", time.Hour)
+
+	time.Sleep(10 * time.Millisecond)
+	store.buckets["full"].full = time.Now().Add(-time.Millisecond)
+	store.lastSweep = time.Now().Add(-memorySweepInterval)
+	store.Take(ctx, "other", RateLimit{Requests: 1, Per: time.Hour})
+
+	if _, ok := store.buckets["full"]; ok {
+		t.Error("полное ведро не удалено")
+	}
+	if _, ok := store.buckets["empty"]; !ok {
+		t.Error("удалено ведро, которое еще ограничивает")
+	}
+	if _, ok := store.counters["counter"]; ok {
+		t.Error("истекший счетчик не удален")
+	}
+	if _, ok := store.locks["lock"]; !ok {
+		t.Error("удалена действующая блокировка")
+	}
+}
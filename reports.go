@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Периодичность отчетов
+const (
+	ReportDaily   = "daily"
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+const (
+	// reportSendHour - в котором часу по времени парковки уходит отчет
+	reportSendHour = 7
+	// reportJobInterval - как часто проверяются расписания
+	reportJobInterval = 15 * time.Minute
+	// reportTopStays - сколько самых долгих стоянок попадает в отчет
+	reportTopStays = 10
+	// reportLongStay - открытые стоянки дольше этого считаются аномалией
+	reportLongStay = 72 * time.Hour
+	// reportFullShare - доля времени без свободных мест, при которой день выделяется
+	reportFullShare = 0.25
+)
+
+// reportStay одна из самых долгих стоянок периода
+type reportStay struct {
+	EntryID      uint
+	LicensePlate string
+	EntryTime    time.Time
+	ExitTime     *time.Time
+	Minutes      float64
+}
+
+// parkingReport данные отчета по парковке за период
+type parkingReport struct {
+	Parking   Parking
+	Start     time.Time
+	End       time.Time
+	Occupancy OccupancyReport
+	TopStays  []reportStay
+	Anomalies []string
+}
+
+func validReportFrequency(frequency string) bool {
+	return frequency == ReportDaily || frequency == ReportWeekly || frequency == ReportMonthly
+}
+
+// reportPeriodStart возвращает начало периода отчета, в котором находится t
+func reportPeriodStart(frequency string, t time.Time, loc *time.Location) time.Time {
+	switch frequency {
+	case ReportWeekly:
+		return truncateToBucket(t, GranularityWeek, loc)
+	case ReportMonthly:
+		t = t.In(loc)
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return truncateToBucket(t, GranularityDay, loc)
+	}
+}
+
+func nextReportPeriod(frequency string, start time.Time) time.Time {
+	switch frequency {
+	case ReportWeekly:
+		return start.AddDate(0, 0, 7)
+	case ReportMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// lastReportPeriod возвращает последний завершившийся к моменту t период
+func lastReportPeriod(frequency string, t time.Time, loc *time.Location) (time.Time, time.Time) {
+	end := reportPeriodStart(frequency, t, loc)
+	switch frequency {
+	case ReportWeekly:
+		return end.AddDate(0, 0, -7), end
+	case ReportMonthly:
+		return end.AddDate(0, -1, 0), end
+	default:
+		return end.AddDate(0, 0, -1), end
+	}
+}
+
+// nextReportRun возвращает ближайшее после after время отправки отчета:
+// reportSendHour часов по местному времени в первый день нового периода
+func nextReportRun(frequency string, after time.Time, loc *time.Location) time.Time {
+	start := reportPeriodStart(frequency, after, loc)
+	// В день перевода часов полночь и 7 утра разделяют не 7 часов
+	run := time.Date(start.Year(), start.Month(), start.Day(), reportSendHour, 0, 0, 0, loc)
+	if !run.After(after) {
+		next := nextReportPeriod(frequency, start)
+		run = time.Date(next.Year(), next.Month(), next.Day(), reportSendHour, 0, 0, 0, loc)
+	}
+	return run
+}
+
+// buildParkingReport собирает выручку, заполненность, самые долгие стоянки и
+// аномалии парковки за [start, end)
+func buildParkingReport(parking Parking, start, end time.Time) (parkingReport, error) {
+	report := parkingReport{Parking: parking, Start: start, End: end}
+
+	occupancy, err := buildOccupancyReport(parking, start, end, GranularityDay)
+	if err != nil {
+		return report, err
+	}
+	report.Occupancy = occupancy
+
+	if err := db.Table("entries").
+		Select("entries.id AS entry_id, vehicles.license_plate, entries.entry_time, entries.exit_time, "+
+			"EXTRACT(EPOCH FROM (COALESCE(entries.exit_time, ?) - entries.entry_time)) / 60 AS minutes", end).
+		Joins("JOIN spots ON spots.id = entries.spot_id").
+		Joins("LEFT JOIN vehicles ON vehicles.id = entries.vehicle_id").
+		Where("spots.parking_id = ? AND entries.deleted_at IS NULL", parking.ID).
+		Where("entries.entry_time < ? AND (entries.exit_time IS NULL OR entries.exit_time >= ?)", end, start).
+		Order("minutes DESC").
+		Limit(reportTopStays).
+		Scan(&report.TopStays).Error; err != nil {
+		return report, err
+	}
+
+	anomalies, err := reportAnomalies(parking, occupancy, start, end)
+	if err != nil {
+		return report, err
+	}
+	report.Anomalies = anomalies
+	return report, nil
+}
+
+// reportAnomalies ищет то, на что владельцу стоит обратить внимание: дни с
+// выручкой вдвое ниже или выше средней, дни без свободных мест, проблемы
+// датчиков и шлагбаумов, забытые открытые стоянки
+func reportAnomalies(parking Parking, occupancy OccupancyReport, start, end time.Time) ([]string, error) {
+	var anomalies []string
+	loc := parkingLocation(parking)
+
+	if days := len(occupancy.Buckets); days >= 3 {
+		mean := occupancy.Summary.Revenue / float64(days)
+		for _, b := range occupancy.Buckets {
+			day := b.Start.In(loc).Format("02.01")
+			if mean > 0 && (b.Revenue < mean/2 || b.Revenue > mean*2) {
+				anomalies = append(anomalies, fmt.Sprintf("%s: выручка %.2f при средней %.2f за день", day, b.Revenue, mean))
+			}
+		}
+	}
+	for _, b := range occupancy.Buckets {
+		if b.FullShare >= reportFullShare {
+			anomalies = append(anomalies, fmt.Sprintf("%s: свободных мест не было %.0f%% времени", b.Start.In(loc).Format("02.01"), b.FullShare*100))
+		}
+	}
+
+	var mismatches []struct {
+		Kind  string
+		Count int
+	}
+	if err := db.Table("sensor_mismatches").
+		Select("sensor_mismatches.kind, COUNT(*) AS count").
+		Joins("JOIN spots ON spots.id = sensor_mismatches.spot_id").
+		Where("spots.parking_id = ? AND sensor_mismatches.detected_at >= ? AND sensor_mismatches.detected_at < ?", parking.ID, start, end).
+		Group("sensor_mismatches.kind").
+		Scan(&mismatches).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range mismatches {
+		kind := "въезд открыт, а место свободно"
+		if m.Kind == MismatchUnregisteredVehicle {
+			kind = "место занято без въезда"
+		}
+		anomalies = append(anomalies, fmt.Sprintf("Расхождения датчиков (%s): %d", kind, m.Count))
+	}
+
+	var unhealthy int64
+	if err := db.Model(&Sensor{}).
+		Joins("JOIN spots ON spots.id = sensors.spot_id").
+		Where("spots.parking_id = ? AND sensors.health IN ?", parking.ID, []string{SensorHealthFaulty, SensorHealthOffline}).
+		Count(&unhealthy).Error; err != nil {
+		return nil, err
+	}
+	if unhealthy > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("Неисправных или отключенных датчиков: %d", unhealthy))
+	}
+
+	var stuck int64
+	if err := db.Model(&GateEvent{}).
+		Joins("JOIN lanes ON lanes.id = gate_events.lane_id").
+		Where("lanes.parking_id = ? AND gate_events.type = ? AND gate_events.created_at >= ? AND gate_events.created_at < ?", parking.ID, GateEventGateStuck, start, end).
+		Count(&stuck).Error; err != nil {
+		return nil, err
+	}
+	if stuck > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("Шлагбаум заклинивало: %d раз", stuck))
+	}
+
+	var longStays int64
+	if err := db.Model(&Entry{}).
+		Joins("JOIN spots ON spots.id = entries.spot_id").
+		Where("spots.parking_id = ? AND entries.exit_time IS NULL AND entries.entry_time < ?", parking.ID, end.Add(-reportLongStay)).
+		Count(&longStays).Error; err != nil {
+		return nil, err
+	}
+	if longStays > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("Открытых стоянок дольше %.0f ч: %d", reportLongStay.Hours(), longStays))
+	}
+
+	return anomalies, nil
+}
+
+// title заголовок отчета вида "Парковка: 01.05.2024 - 07.05.2024"
+func (r parkingReport) title() string {
+	loc := parkingLocation(r.Parking)
+	return fmt.Sprintf("%s: %s - %s", r.Parking.Name,
+		r.Start.In(loc).Format("02.01.2006"), r.End.In(loc).Add(-time.Second).Format("02.01.2006"))
+}
+
+func renderReportPDF(cfg ReportsConfig, r parkingReport) ([]byte, error) {
+	loc := parkingLocation(r.Parking)
+	s := r.Occupancy.Summary
+
+	doc := newPDFDocument(cfg, "Отчет по парковке "+r.title())
+	doc.Text(fmt.Sprintf("Выручка: %.2f", s.Revenue))
+	doc.Text(fmt.Sprintf("Въездов: %d, выездов: %d", s.Entries, s.Exits))
+	doc.Text(fmt.Sprintf("Средняя заполненность: %.1f%%, пик: %d из %d мест", s.OccupancyRate*100, s.PeakOccupancy, r.Occupancy.Spots))
+	doc.Text(fmt.Sprintf("Стоянка в среднем %.0f мин, медиана %.0f мин", s.AvgDwellMinutes, s.MedianDwellMinutes))
+
+	days := make([][]string, 0, len(r.Occupancy.Buckets))
+	for _, b := range r.Occupancy.Buckets {
+		days = append(days, []string{
+			b.Start.In(loc).Format("02.01.2006"),
+			fmt.Sprint(b.Entries),
+			fmt.Sprint(b.Exits),
+			fmt.Sprintf("%.1f%%", b.OccupancyRate*100),
+			fmt.Sprint(b.PeakOccupancy),
+			fmt.Sprintf("%.2f", b.Revenue),
+		})
+	}
+	doc.Heading("По дням")
+	doc.Table([]string{"Дата", "Въезды", "Выезды", "Заполненность", "Пик", "Выручка"}, []float64{30, 25, 25, 35, 25, 40}, days)
+
+	stays := make([][]string, 0, len(r.TopStays))
+	for _, st := range r.TopStays {
+		exit := "на парковке"
+		if st.ExitTime != nil {
+			exit = st.ExitTime.In(loc).Format("02.01 15:04")
+		}
+		stays = append(stays, []string{
+			st.LicensePlate,
+			st.EntryTime.In(loc).Format("02.01 15:04"),
+			exit,
+			fmt.Sprintf("%.1f", st.Minutes/60),
+		})
+	}
+	doc.Heading("Самые долгие стоянки")
+	doc.Table([]string{"Номер", "Въезд", "Выезд", "Часов"}, []float64{45, 45, 45, 30}, stays)
+
+	doc.Heading("Аномалии")
+	if len(r.Anomalies) == 0 {
+		doc.Text("Не обнаружено")
+	}
+	for _, a := range r.Anomalies {
+		doc.Text("- " + a)
+	}
+
+	return doc.Bytes()
+}
+
+// reportRecipients возвращает адреса расписания или почту его владельца
+func reportRecipients(schedule ReportSchedule) ([]string, error) {
+	var recipients []string
+	for _, r := range strings.Split(schedule.Recipients, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) > 0 {
+		return recipients, nil
+	}
+
+	var user User
+	if err := db.First(&user, schedule.UserID).Error; err != nil {
+		return nil, err
+	}
+	return []string{user.Email}, nil
+}
+
+// deliverReport строит отчет за последний завершившийся период и отправляет его
+func deliverReport(services Services, schedule ReportSchedule, now time.Time) error {
+	var parking Parking
+	if err := db.First(&parking, schedule.ParkingID).Error; err != nil {
+		return err
+	}
+	start, end := lastReportPeriod(schedule.Frequency, now, parkingLocation(parking))
+
+	report, err := buildParkingReport(parking, start, end)
+	if err != nil {
+		return err
+	}
+	pdf, err := renderReportPDF(services.Reports, report)
+	if err != nil {
+		return err
+	}
+	recipients, err := reportRecipients(schedule)
+	if err != nil {
+		return err
+	}
+
+	return services.Mailer.Send(MailMessage{
+		To:      recipients,
+		Subject: "Отчет по парковке " + report.title(),
+		Body: fmt.Sprintf("Здравствуйте!\n\nВыручка: %.2f, въездов: %d, средняя заполненность: %.1f%%. Аномалий: %d.\nПодробности во вложении.\n",
+			report.Occupancy.Summary.Revenue, report.Occupancy.Summary.Entries, report.Occupancy.Summary.OccupancyRate*100, len(report.Anomalies)),
+		Attachments: []MailAttachment{{
+			Filename:    fmt.Sprintf("report-%d-%s.pdf", parking.ID, start.Format("2006-01-02")),
+			ContentType: "application/pdf",
+			Data:        pdf,
+		}},
+	})
+}
+
+// runReportJobs рассылает отчеты, время которых подошло. Пропущенные во
+// время простоя периоды не досылаются: уходит отчет за последний период.
+func runReportJobs(ctx context.Context, services Services) {
+	for now := range ticks(ctx, reportJobInterval) {
+		var schedules []ReportSchedule
+		if err := db.Where("next_run_at <= ?", now).Find(&schedules).Error; err != nil {
+			slog.Error("Не удалось получить расписания отчетов", "error", err)
+			continue
+		}
+
+		for _, schedule := range schedules {
+			updates := map[string]interface{}{"last_error": ""}
+			if err := deliverReport(services, schedule, now); err != nil {
+				slog.Error("Не удалось отправить отчет по расписанию", "schedule_id", schedule.ID, "error", err)
+				updates["last_error"] = err.Error()
+			} else {
+				updates["last_sent_at"] = now
+			}
+
+			var parking Parking
+			db.First(&parking, schedule.ParkingID)
+			updates["next_run_at"] = nextReportRun(schedule.Frequency, now, parkingLocation(parking))
+			db.Model(&schedule).Updates(updates)
+		}
+	}
+}
+
+type CreateReportScheduleRequest struct {
+	Frequency  string   `json:"frequency" binding:"required"`
+	Recipients []string `json:"recipients" binding:"dive,email"`
+}
+
+func CreateReportSchedule(c *gin.Context) {
+	var input CreateReportScheduleRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if !validReportFrequency(input.Frequency) {
+		respondError(c, CodeInvalidFrequency)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, c.Param("id")).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	schedule := ReportSchedule{
+		ParkingID:  parking.ID,
+		UserID:     c.GetUint("user_id"),
+		Frequency:  input.Frequency,
+		Recipients: strings.Join(input.Recipients, ","),
+		NextRunAt:  nextReportRun(input.Frequency, time.Now(), parkingLocation(parking)),
+	}
+	if err := db.Create(&schedule).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeScheduleCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func GetReportSchedules(c *gin.Context) {
+	var schedules []ReportSchedule
+	if err := db.Where("parking_id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		Find(&schedules).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeSchedulesListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+func DeleteReportSchedule(c *gin.Context) {
+	result := db.Where("user_id = ?", c.GetUint("user_id")).Delete(&ReportSchedule{}, c.Param("id"))
+	if result.Error != nil {
+		c.Error(result.Error)
+		respondError(c, CodeScheduleDeleteFailed)
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondError(c, CodeScheduleNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Расписание удалено"})
+}
+
+// SendReportNow отправляет отчет по расписанию вне очереди
+func (api *API) SendReportNow(c *gin.Context) {
+	var schedule ReportSchedule
+	if err := db.Where("user_id = ?", c.GetUint("user_id")).First(&schedule, c.Param("id")).Error; err != nil {
+		respondError(c, CodeScheduleNotFound)
+		return
+	}
+
+	if err := deliverReport(api.services, schedule, time.Now()); err != nil {
+		respondError(c, CodeReportSendFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Отчет отправлен"})
+}
+
+// GetParkingReport отдает PDF за последний завершившийся период без отправки
+func (api *API) GetParkingReport(c *gin.Context) {
+	frequency := c.DefaultQuery("frequency", ReportWeekly)
+	if !validReportFrequency(frequency) {
+		respondError(c, CodeInvalidFrequency)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, c.Param("id")).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	start, end := lastReportPeriod(frequency, time.Now(), parkingLocation(parking))
+	report, err := buildParkingReport(parking, start, end)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodeReportFailed)
+		return
+	}
+	pdf, err := renderReportPDF(api.services.Reports, report)
+	if err != nil {
+		c.Error(err)
+		respondError(c, CodePDFFailed)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=report-%d-%s.pdf", parking.ID, start.Format("2006-01-02")))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportPeriods(t *testing.T) {
+	loc := berlin(t)
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		frequency  string
+		now        time.Time
+		start, end time.Time // Последний завершившийся период
+		next       time.Time // Ближайшая отправка
+	}{
+		{ReportDaily, at(10, 14, 10), at(10, 13, 0), at(10, 14, 0), at(10, 15, 7)},
+		{ReportDaily, at(10, 14, 6), at(10, 13, 0), at(10, 14, 0), at(10, 14, 7)},
+		// В день перевода часов отчет все равно уходит в 7 утра по местному времени
+		{ReportDaily, at(3, 29, 1), at(3, 28, 0), at(3, 29, 0), at(3, 29, 7)},
+		{ReportDaily, at(10, 25, 1), at(10, 24, 0), at(10, 25, 0), at(10, 25, 7)},
+		{ReportWeekly, at(10, 14, 10), at(10, 5, 0), at(10, 12, 0), at(10, 19, 7)},
+		{ReportWeekly, at(3, 30, 8), at(3, 23, 0), at(3, 30, 0), at(4, 6, 7)},
+		{ReportMonthly, at(10, 14, 10), at(9, 1, 0), at(10, 1, 0), at(11, 1, 7)},
+		{ReportMonthly, at(11, 1, 6), at(10, 1, 0), at(11, 1, 0), at(11, 1, 7)},
+	}
+	for _, tt := range tests {
+		start, end := lastReportPeriod(tt.frequency, tt.now, loc)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s в %s: период %s - %s, ожидалось %s - %s", tt.frequency, tt.now, start, end, tt.start, tt.end)
+		}
+		if next := nextReportRun(tt.frequency, tt.now, loc); !next.Equal(tt.next) {
+			t.Errorf("%s в %s: отправка %s, ожидалось %s", tt.frequency, tt.now, next, tt.next)
+		}
+	}
+}
+
+func TestReportAnomalies(t *testing.T) {
+	testDB(t)
+	start := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	day := func(i int, revenue, fullShare float64) OccupancyBucket {
+		return OccupancyBucket{Start: start.AddDate(0, 0, i), Revenue: revenue, FullShare: fullShare}
+	}
+	occupancy := func(buckets ...OccupancyBucket) OccupancyReport {
+		report := OccupancyReport{Buckets: buckets}
+		for _, b := range buckets {
+			report.Summary.Revenue += b.Revenue
+		}
+		return report
+	}
+
+	tests := []struct {
+		name      string
+		occupancy OccupancyReport
+		setup     func(parking Parking, spot Spot)
+		want      []string
+	}{
+		{"все спокойно", occupancy(day(0, 100, 0), day(1, 110, 0.2), day(2, 90, 0)), nil, nil},
+		{"выручка и заполненность", occupancy(day(0, 100, 0), day(1, 100, 0.5), day(2, 10, 0), day(3, 290, 0)), nil, []string{
+			"07.10: выручка 10.00 при средней 125.00 за день",
+			"08.10: выручка 290.00 при средней 125.00 за день",
+			"06.10: свободных мест не было 50% времени",
+		}},
+		// За два дня средняя выручка ничего не говорит
+		{"слишком короткий период", occupancy(day(0, 100, 0), day(1, 1, 0)), nil, nil},
+		{"датчики, шлагбаум и забытая стоянка", occupancy(), func(parking Parking, spot Spot) {
+			create(t, &SensorMismatch{SpotID: spot.ID, Kind: MismatchUnregisteredVehicle, DetectedAt: start.Add(time.Hour)})
+			create(t, &SensorMismatch{SpotID: spot.ID, Kind: MismatchUnregisteredVehicle, DetectedAt: start.AddDate(0, 0, -1)}) // До периода
+			create(t, &Sensor{SpotID: spot.ID, ExternalID: parking.Name + "-faulty", Health: SensorHealthFaulty})
+			create(t, &Sensor{SpotID: spot.ID, ExternalID: parking.Name + "-ok", Health: "ok"})
+			lane := Lane{ParkingID: parking.ID, Name: "Въезд", DeviceID: parking.Name}
+			create(t, &lane)
+			create(t, &GateEvent{LaneID: lane.ID, Type: GateEventGateStuck, CreatedAt: start.Add(time.Hour)})
+			create(t, &Entry{SpotID: spot.ID, VehicleID: 1, EntryTime: end.Add(-reportLongStay - time.Hour)})
+			create(t, &Entry{SpotID: spot.ID, VehicleID: 1, EntryTime: end.Add(-time.Hour)})
+		}, []string{
+			"Расхождения датчиков (место занято без въезда): 1",
+			"Неисправных или отключенных датчиков: 1",
+			"Шлагбаум заклинивало: 1 раз",
+			"Открытых стоянок дольше 72 ч: 1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parking := Parking{Name: tt.name, Capacity: 1, TimeZone: "UTC"}
+			create(t, &parking)
+			spot := Spot{ParkingID: parking.ID, Number: tt.name}
+			create(t, &spot)
+			if tt.setup != nil {
+				tt.setup(parking, spot)
+			}
+
+			got, err := reportAnomalies(parking, tt.occupancy, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("%q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// create сохраняет запись или останавливает тест
+func create(t *testing.T, value any) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderReportPDF(t *testing.T) {
+	exitTime := time.Date(2026, 10, 6, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	report := parkingReport{
+		Parking:   Parking{ID: 1, Name: "Центр", TimeZone: "UTC"},
+		Start:     start,
+		End:       start.AddDate(0, 0, 7),
+		Occupancy: OccupancyReport{Spots: 10, Buckets: []OccupancyBucket{{Start: start, Entries: 3, Revenue: 150}}},
+		TopStays:  []reportStay{{LicensePlate: "A123BC", EntryTime: start, ExitTime: &exitTime, Minutes: 36 * 60}, {LicensePlate: "B456CD", EntryTime: start}},
+		Anomalies: []string{"Шлагбаум заклинивало: 1 раз"},
+	}
+	if title := report.title(); title != "Центр: 05.10.2026 - 11.10.2026" {
+		t.Errorf("заголовок %q", title)
+	}
+
+	tests := []struct {
+		name      string
+		anomalies []string
+	}{
+		{"с аномалиями", report.Anomalies},
+		{"без аномалий", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := report
+			r.Anomalies = tt.anomalies
+			pdf, err := renderReportPDF(ReportsConfig{}, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+				t.Errorf("не PDF: %.16q", pdf)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errNotFound возвращают хранилища, когда запись не найдена
+var errNotFound = errors.New("запись не найдена")
+
+// isUniqueViolation сообщает, что запись нарушила уникальный индекс. Код
+// Postgres 23505 gorm переводит в gorm.ErrDuplicatedKey, потому что база
+// открывается с TranslateError (см. main).
+func isUniqueViolation(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// ParkingRepository хранилище парковок и их тарифов
+type ParkingRepository interface {
+	Create(parking *Parking) error
+	// List и Get возвращают парковки вместе с тарифами и местами
+	List() ([]Parking, error)
+	Get(id uint) (Parking, error)
+	Tariff(parkingID uint, tariffType string) (Tariff, error)
+}
+
+// SpotRepository хранилище мест
+type SpotRepository interface {
+	Create(spot *Spot) error
+	Get(id uint) (Spot, error)
+	ListByParking(parkingID uint) ([]Spot, error)
+	Save(spot *Spot) error
+	CountAvailable(parkingID uint) (int64, error)
+}
+
+// EntryRepository хранилище въездов и выездов
+type EntryRepository interface {
+	Create(entry *Entry) error
+	Get(id uint) (Entry, error)
+	Save(entry *Entry) error
+	// OpenForSpot возвращает въезд на место, по которому еще нет выезда
+	OpenForSpot(spotID uint) (Entry, error)
+	CreateExit(exit *Exit) error
+}
+
+// PaymentRepository хранилище платежей
+type PaymentRepository interface {
+	Create(payment *Payment) error
+	Save(payment *Payment) error
+	GetByProviderID(providerID string) (Payment, error)
+}
+
+// UserRepository хранилище пользователей
+type UserRepository interface {
+	Create(user *User) error
+	Get(id uint) (User, error)
+	GetByEmail(email string) (User, error)
+	Save(user *User) error
+}
+
+// UserTokenRepository одноразовые токены из писем
+type UserTokenRepository interface {
+	Create(token *UserToken) error
+	// Consume помечает использованным действующий токен с хешем hash и
+	// назначением purpose и возвращает его. Использованный или истекший
+	// токен - errNotFound, поэтому токен срабатывает только один раз.
+	Consume(purpose, hash string) (UserToken, error)
+	// Revoke помечает использованными неиспользованные токены пользователя
+	// с назначением purpose
+	Revoke(userID uint, purpose string) error
+}
+
+// VehicleRepository хранилище автомобилей
+type VehicleRepository interface {
+	Create(vehicle *Vehicle) error
+	Get(id uint) (Vehicle, error)
+}
+
+// ValidationRepository валидации продавцов
+type ValidationRepository interface {
+	// Apply сохраняет валидации, учтенные при оплате выезда. Валидация,
+	// которую уже учли при другом выезде, дает errValidationCodeInvalid.
+	Apply(validations []Validation) error
+}
+
+// OrganizationRepository организации с постоплатой
+type OrganizationRepository interface {
+	Create(org *Organization) error
+	// ReserveSpending проверяет, что выезд на amount укладывается в
+	// месячный лимит организации вместе с платежами с since. Сверх лимита
+	// возвращает errSpendingLimitExceeded. Вызывается в транзакции перед
+	// созданием платежа: организация блокируется до ее конца, чтобы два
+	// выезда одновременно не превысили лимит.
+	ReserveSpending(orgID uint, amount float64, since time.Time) error
+}
+
+// Store объединяет хранилища, с которыми работают основные обработчики
+type Store struct {
+	Parkings    ParkingRepository
+	Spots       SpotRepository
+	Entries     EntryRepository
+	Payments    PaymentRepository
+	Users       UserRepository
+	UserTokens  UserTokenRepository
+	Vehicles    VehicleRepository
+	Validations ValidationRepository
+
+	Organizations OrganizationRepository
+
+	// bind возвращает те же хранилища, чьи запросы несут ctx
+	bind func(ctx context.Context) Store
+	// transaction выполняет fn в транзакции базы
+	transaction func(fn func(tx Store) error) error
+}
+
+// WithContext возвращает хранилища для запроса: ID запроса из ctx попадает
+// в логи обращений к базе. Хранилищу в памяти контекст не нужен.
+func (s Store) WithContext(ctx context.Context) Store {
+	if s.bind == nil {
+		return s
+	}
+	return s.bind(ctx)
+}
+
+// Transaction выполняет fn с хранилищами, изменения которых сохраняются
+// вместе: ошибка fn откатывает все. Хранилище в памяти изменения не
+// откатывает.
+func (s Store) Transaction(fn func(tx Store) error) error {
+	if s.transaction == nil {
+		return fn(s)
+	}
+	return s.transaction(fn)
+}
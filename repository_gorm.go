@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newGormStore возвращает хранилища поверх Postgres
+func newGormStore(db *gorm.DB) Store {
+	return Store{
+		Parkings:    gormParkingRepository{db},
+		Spots:       gormSpotRepository{db},
+		Entries:     gormEntryRepository{db},
+		Payments:    gormPaymentRepository{db},
+		Users:       gormUserRepository{db},
+		UserTokens:  gormUserTokenRepository{db},
+		Vehicles:    gormVehicleRepository{db},
+		Validations: gormValidationRepository{db},
+
+		Organizations: gormOrganizationRepository{db},
+		bind: func(ctx context.Context) Store {
+			return newGormStore(db.WithContext(ctx))
+		},
+		transaction: func(fn func(tx Store) error) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				return fn(newGormStore(tx))
+			})
+		},
+	}
+}
+
+// notFound переводит ошибку gorm об отсутствии записи в errNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+type gormParkingRepository struct{ db *gorm.DB }
+
+func (r gormParkingRepository) Create(parking *Parking) error {
+	return r.db.Create(parking).Error
+}
+
+func (r gormParkingRepository) List() ([]Parking, error) {
+	var parkings []Parking
+	err := r.db.Preload("Tariffs").Preload("Spots").Find(&parkings).Error
+	return parkings, err
+}
+
+func (r gormParkingRepository) Get(id uint) (Parking, error) {
+	var parking Parking
+	err := r.db.Preload("Tariffs").Preload("Spots").First(&parking, id).Error
+	return parking, notFound(err)
+}
+
+func (r gormParkingRepository) Tariff(parkingID uint, tariffType string) (Tariff, error) {
+	var tariff Tariff
+	err := r.db.Where("parking_id = ? AND type = ?", parkingID, tariffType).First(&tariff).Error
+	return tariff, notFound(err)
+}
+
+type gormSpotRepository struct{ db *gorm.DB }
+
+func (r gormSpotRepository) Create(spot *Spot) error {
+	return r.db.Create(spot).Error
+}
+
+func (r gormSpotRepository) Get(id uint) (Spot, error) {
+	var spot Spot
+	err := r.db.First(&spot, id).Error
+	return spot, notFound(err)
+}
+
+func (r gormSpotRepository) ListByParking(parkingID uint) ([]Spot, error) {
+	var spots []Spot
+	err := r.db.Where("parking_id = ?", parkingID).Find(&spots).Error
+	return spots, err
+}
+
+func (r gormSpotRepository) Save(spot *Spot) error {
+	return r.db.Save(spot).Error
+}
+
+func (r gormSpotRepository) CountAvailable(parkingID uint) (int64, error) {
+	var available int64
+	err := r.db.Model(&Spot{}).Where("parking_id = ? AND is_occupied = ?", parkingID, false).Count(&available).Error
+	return available, err
+}
+
+type gormEntryRepository struct{ db *gorm.DB }
+
+func (r gormEntryRepository) Create(entry *Entry) error {
+	return r.db.Create(entry).Error
+}
+
+func (r gormEntryRepository) Get(id uint) (Entry, error) {
+	var entry Entry
+	err := r.db.First(&entry, id).Error
+	return entry, notFound(err)
+}
+
+func (r gormEntryRepository) Save(entry *Entry) error {
+	return r.db.Save(entry).Error
+}
+
+func (r gormEntryRepository) OpenForSpot(spotID uint) (Entry, error) {
+	var entry Entry
+	err := r.db.Where("spot_id = ? AND exit_time IS NULL", spotID).First(&entry).Error
+	return entry, notFound(err)
+}
+
+func (r gormEntryRepository) CreateExit(exit *Exit) error {
+	return r.db.Create(exit).Error
+}
+
+type gormPaymentRepository struct{ db *gorm.DB }
+
+func (r gormPaymentRepository) Create(payment *Payment) error {
+	return r.db.Create(payment).Error
+}
+
+func (r gormPaymentRepository) Save(payment *Payment) error {
+	return r.db.Save(payment).Error
+}
+
+func (r gormPaymentRepository) GetByProviderID(providerID string) (Payment, error) {
+	var payment Payment
+	err := r.db.Where("provider_id = ?", providerID).First(&payment).Error
+	return payment, notFound(err)
+}
+
+type gormUserRepository struct{ db *gorm.DB }
+
+func (r gormUserRepository) Create(user *User) error {
+	return r.db.Create(user).Error
+}
+
+func (r gormUserRepository) Get(id uint) (User, error) {
+	var user User
+	err := r.db.First(&user, id).Error
+	return user, notFound(err)
+}
+
+func (r gormUserRepository) GetByEmail(email string) (User, error) {
+	var user User
+	err := r.db.Where("email = ?", email).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r gormUserRepository) Save(user *User) error {
+	return r.db.Save(user).Error
+}
+
+type gormUserTokenRepository struct{ db *gorm.DB }
+
+func (r gormUserTokenRepository) Create(token *UserToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r gormUserTokenRepository) Consume(purpose, hash string) (UserToken, error) {
+	// Один UPDATE с RETURNING: из двух одновременных запросов с одним
+	// токеном строку обновит только первый
+	var tokens []UserToken
+	err := r.db.Model(&tokens).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, time.Now()).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		return UserToken{}, err
+	}
+	if len(tokens) == 0 {
+		return UserToken{}, errNotFound
+	}
+	return tokens[0], nil
+}
+
+func (r gormUserTokenRepository) Revoke(userID uint, purpose string) error {
+	return r.db.Model(&UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+type gormVehicleRepository struct{ db *gorm.DB }
+
+func (r gormVehicleRepository) Create(vehicle *Vehicle) error {
+	return r.db.Create(vehicle).Error
+}
+
+func (r gormVehicleRepository) Get(id uint) (Vehicle, error) {
+	var vehicle Vehicle
+	err := r.db.First(&vehicle, id).Error
+	return vehicle, notFound(err)
+}
+
+type gormValidationRepository struct{ db *gorm.DB }
+
+// Apply меняет статус только у еще не учтенных валидаций: если тот же код
+// предъявили на двух выездах одновременно, второй выезд откатится
+func (r gormValidationRepository) Apply(validations []Validation) error {
+	for _, v := range validations {
+		result := r.db.Model(&Validation{}).
+			Where("id = ? AND status IN ?", v.ID, []string{ValidationStatusIssued, ValidationStatusValidated}).
+			Updates(map[string]interface{}{
+				"entry_id":        v.EntryID,
+				"status":          v.Status,
+				"validated_at":    v.ValidatedAt,
+				"applied_at":      v.AppliedAt,
+				"payment_id":      v.PaymentID,
+				"discount_amount": v.DiscountAmount,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errValidationCodeInvalid
+		}
+	}
+	return nil
+}
+
+type gormOrganizationRepository struct{ db *gorm.DB }
+
+func (r gormOrganizationRepository) Create(org *Organization) error {
+	return r.db.Create(org).Error
+}
+
+func (r gormOrganizationRepository) ReserveSpending(orgID uint, amount float64, since time.Time) error {
+	var org Organization
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, orgID).Error; err != nil {
+		return notFound(err)
+	}
+	if org.SpendingLimit <= 0 {
+		return nil
+	}
+
+	var spent float64
+	if err := r.db.Model(&Payment{}).
+		Where("organization_id = ? AND created_at >= ?", orgID, since).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&spent).Error; err != nil {
+		return err
+	}
+	if spent+amount > org.SpendingLimit {
+		return errSpendingLimitExceeded
+	}
+	return nil
+}
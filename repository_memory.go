@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errDuplicateEmail оборачивает gorm.ErrDuplicatedKey, как уникальный индекс
+// в Postgres, чтобы isUniqueViolation одинаково работал с обоими хранилищами
+var errDuplicateEmail = fmt.Errorf("пользователь с таким email уже существует: %w", gorm.ErrDuplicatedKey)
+
+// memoryDB общие данные хранилищ в памяти. Нужны для тестов через httptest и
+// локальной разработки без Postgres; между перезапусками ничего не сохраняется.
+type memoryDB struct {
+	mu     sync.Mutex
+	nextID map[string]uint
+
+	parkings map[uint]Parking
+	tariffs  map[uint]Tariff
+	spots    map[uint]Spot
+	entries  map[uint]Entry
+	exits    map[uint]Exit
+	payments map[uint]Payment
+	users    map[uint]User
+	tokens   map[uint]UserToken
+	vehicles map[uint]Vehicle
+
+	validations   map[uint]Validation
+	organizations map[uint]Organization
+}
+
+// newMemoryStore возвращает хранилища в памяти
+func newMemoryStore() Store {
+	m := &memoryDB{
+		nextID:   make(map[string]uint),
+		parkings: make(map[uint]Parking),
+		tariffs:  make(map[uint]Tariff),
+		spots:    make(map[uint]Spot),
+		entries:  make(map[uint]Entry),
+		exits:    make(map[uint]Exit),
+		payments: make(map[uint]Payment),
+		users:    make(map[uint]User),
+		tokens:   make(map[uint]UserToken),
+		vehicles: make(map[uint]Vehicle),
+
+		validations: make(map[uint]Validation),
+
+		organizations: make(map[uint]Organization),
+	}
+	return Store{
+		Parkings:    memoryParkingRepository{m},
+		Spots:       memorySpotRepository{m},
+		Entries:     memoryEntryRepository{m},
+		Payments:    memoryPaymentRepository{m},
+		Users:       memoryUserRepository{m},
+		UserTokens:  memoryUserTokenRepository{m},
+		Vehicles:    memoryVehicleRepository{m},
+		Validations: memoryValidationRepository{m},
+
+		Organizations: memoryOrganizationRepository{m},
+	}
+}
+
+// id выдает следующий ID таблицы, как автоинкремент в базе
+func (m *memoryDB) id(table string) uint {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+// stamp проставляет время создания и изменения, как это делает gorm
+func stamp(createdAt, updatedAt *time.Time) {
+	now := time.Now()
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	*updatedAt = now
+}
+
+func sortedIDs[T any](rows map[uint]T) []uint {
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+type memoryParkingRepository struct{ m *memoryDB }
+
+func (r memoryParkingRepository) Create(parking *Parking) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	parking.ID = r.m.id("parkings")
+	stamp(&parking.CreatedAt, &parking.UpdatedAt)
+	for i := range parking.Tariffs {
+		t := &parking.Tariffs[i]
+		t.ID = r.m.id("tariffs")
+		t.ParkingID = parking.ID
+		stamp(&t.CreatedAt, &t.UpdatedAt)
+		r.m.tariffs[t.ID] = *t
+	}
+	for i := range parking.Spots {
+		s := &parking.Spots[i]
+		s.ID = r.m.id("spots")
+		s.ParkingID = parking.ID
+		stamp(&s.CreatedAt, &s.UpdatedAt)
+		r.m.spots[s.ID] = *s
+	}
+
+	stored := *parking
+	stored.Tariffs, stored.Spots = nil, nil
+	r.m.parkings[parking.ID] = stored
+	return nil
+}
+
+// withRelations дополняет парковку тарифами и местами, как Preload
+func (r memoryParkingRepository) withRelations(parking Parking) Parking {
+	parking.Tariffs, parking.Spots = []Tariff{}, []Spot{}
+	for _, id := range sortedIDs(r.m.tariffs) {
+		if t := r.m.tariffs[id]; t.ParkingID == parking.ID {
+			parking.Tariffs = append(parking.Tariffs, t)
+		}
+	}
+	for _, id := range sortedIDs(r.m.spots) {
+		if s := r.m.spots[id]; s.ParkingID == parking.ID {
+			parking.Spots = append(parking.Spots, s)
+		}
+	}
+	return parking
+}
+
+func (r memoryParkingRepository) List() ([]Parking, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	parkings := make([]Parking, 0, len(r.m.parkings))
+	for _, id := range sortedIDs(r.m.parkings) {
+		parkings = append(parkings, r.withRelations(r.m.parkings[id]))
+	}
+	return parkings, nil
+}
+
+func (r memoryParkingRepository) Get(id uint) (Parking, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	parking, ok := r.m.parkings[id]
+	if !ok {
+		return Parking{}, errNotFound
+	}
+	return r.withRelations(parking), nil
+}
+
+func (r memoryParkingRepository) Tariff(parkingID uint, tariffType string) (Tariff, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, id := range sortedIDs(r.m.tariffs) {
+		if t := r.m.tariffs[id]; t.ParkingID == parkingID && t.Type == tariffType {
+			return t, nil
+		}
+	}
+	return Tariff{}, errNotFound
+}
+
+type memorySpotRepository struct{ m *memoryDB }
+
+func (r memorySpotRepository) Create(spot *Spot) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	spot.ID = r.m.id("spots")
+	stamp(&spot.CreatedAt, &spot.UpdatedAt)
+	r.m.spots[spot.ID] = *spot
+	return nil
+}
+
+func (r memorySpotRepository) Get(id uint) (Spot, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	spot, ok := r.m.spots[id]
+	if !ok {
+		return Spot{}, errNotFound
+	}
+	return spot, nil
+}
+
+func (r memorySpotRepository) ListByParking(parkingID uint) ([]Spot, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	spots := []Spot{}
+	for _, id := range sortedIDs(r.m.spots) {
+		if s := r.m.spots[id]; s.ParkingID == parkingID {
+			spots = append(spots, s)
+		}
+	}
+	return spots, nil
+}
+
+func (r memorySpotRepository) Save(spot *Spot) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if spot.ID == 0 {
+		spot.ID = r.m.id("spots")
+	}
+	stamp(&spot.CreatedAt, &spot.UpdatedAt)
+	r.m.spots[spot.ID] = *spot
+	return nil
+}
+
+func (r memorySpotRepository) CountAvailable(parkingID uint) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var available int64
+	for _, s := range r.m.spots {
+		if s.ParkingID == parkingID && !s.IsOccupied {
+			available++
+		}
+	}
+	return available, nil
+}
+
+type memoryEntryRepository struct{ m *memoryDB }
+
+func (r memoryEntryRepository) Create(entry *Entry) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	entry.ID = r.m.id("entries")
+	stamp(&entry.CreatedAt, &entry.UpdatedAt)
+	r.m.entries[entry.ID] = *entry
+	return nil
+}
+
+func (r memoryEntryRepository) Get(id uint) (Entry, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	entry, ok := r.m.entries[id]
+	if !ok {
+		return Entry{}, errNotFound
+	}
+	return entry, nil
+}
+
+func (r memoryEntryRepository) Save(entry *Entry) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if entry.ID == 0 {
+		entry.ID = r.m.id("entries")
+	}
+	stamp(&entry.CreatedAt, &entry.UpdatedAt)
+	r.m.entries[entry.ID] = *entry
+	return nil
+}
+
+func (r memoryEntryRepository) OpenForSpot(spotID uint) (Entry, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, id := range sortedIDs(r.m.entries) {
+		if e := r.m.entries[id]; e.SpotID == spotID && e.ExitTime == nil {
+			return e, nil
+		}
+	}
+	return Entry{}, errNotFound
+}
+
+func (r memoryEntryRepository) CreateExit(exit *Exit) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	exit.ID = r.m.id("exits")
+	stamp(&exit.CreatedAt, &exit.UpdatedAt)
+	r.m.exits[exit.ID] = *exit
+	return nil
+}
+
+type memoryPaymentRepository struct{ m *memoryDB }
+
+func (r memoryPaymentRepository) Create(payment *Payment) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	payment.ID = r.m.id("payments")
+	stamp(&payment.CreatedAt, &payment.UpdatedAt)
+	r.m.payments[payment.ID] = *payment
+	return nil
+}
+
+func (r memoryPaymentRepository) Save(payment *Payment) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if payment.ID == 0 {
+		payment.ID = r.m.id("payments")
+	}
+	stamp(&payment.CreatedAt, &payment.UpdatedAt)
+	r.m.payments[payment.ID] = *payment
+	return nil
+}
+
+func (r memoryPaymentRepository) GetByProviderID(providerID string) (Payment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, p := range r.m.payments {
+		if p.ProviderID != "" && p.ProviderID == providerID {
+			return p, nil
+		}
+	}
+	return Payment{}, errNotFound
+}
+
+type memoryUserRepository struct{ m *memoryDB }
+
+func (r memoryUserRepository) Create(user *User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, u := range r.m.users {
+		if u.Email == user.Email {
+			return errDuplicateEmail
+		}
+	}
+	user.ID = r.m.id("users")
+	if user.Role == "" {
+		user.Role = UserRoleUser
+	}
+	stamp(&user.CreatedAt, &user.UpdatedAt)
+	r.m.users[user.ID] = *user
+	return nil
+}
+
+func (r memoryUserRepository) Get(id uint) (User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	user, ok := r.m.users[id]
+	if !ok {
+		return User{}, errNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUserRepository) GetByEmail(email string) (User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, u := range r.m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return User{}, errNotFound
+}
+
+func (r memoryUserRepository) Save(user *User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, u := range r.m.users {
+		if u.ID != user.ID && u.Email == user.Email {
+			return errDuplicateEmail
+		}
+	}
+	stamp(&user.CreatedAt, &user.UpdatedAt)
+	r.m.users[user.ID] = *user
+	return nil
+}
+
+type memoryUserTokenRepository struct{ m *memoryDB }
+
+func (r memoryUserTokenRepository) Create(token *UserToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	token.ID = r.m.id("user_tokens")
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	r.m.tokens[token.ID] = *token
+	return nil
+}
+
+func (r memoryUserTokenRepository) Consume(purpose, hash string) (UserToken, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range r.m.tokens {
+		if t.TokenHash == hash && t.Purpose == purpose && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			t.UsedAt = &now
+			r.m.tokens[id] = t
+			return t, nil
+		}
+	}
+	return UserToken{}, errNotFound
+}
+
+func (r memoryUserTokenRepository) Revoke(userID uint, purpose string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range r.m.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+			r.m.tokens[id] = t
+		}
+	}
+	return nil
+}
+
+type memoryVehicleRepository struct{ m *memoryDB }
+
+func (r memoryVehicleRepository) Create(vehicle *Vehicle) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	vehicle.ID = r.m.id("vehicles")
+	stamp(&vehicle.CreatedAt, &vehicle.UpdatedAt)
+	r.m.vehicles[vehicle.ID] = *vehicle
+	return nil
+}
+
+func (r memoryVehicleRepository) Get(id uint) (Vehicle, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	vehicle, ok := r.m.vehicles[id]
+	if !ok {
+		return Vehicle{}, errNotFound
+	}
+	return vehicle, nil
+}
+
+type memoryValidationRepository struct{ m *memoryDB }
+
+func (r memoryValidationRepository) Apply(validations []Validation) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, v := range validations {
+		if prev, ok := r.m.validations[v.ID]; ok && prev.Status == ValidationStatusApplied {
+			return errValidationCodeInvalid
+		}
+	}
+	for _, v := range validations {
+		r.m.validations[v.ID] = v
+	}
+	return nil
+}
+
+type memoryOrganizationRepository struct{ m *memoryDB }
+
+func (r memoryOrganizationRepository) Create(org *Organization) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	org.ID = r.m.id("organizations")
+	stamp(&org.CreatedAt, &org.UpdatedAt)
+	r.m.organizations[org.ID] = *org
+	return nil
+}
+
+func (r memoryOrganizationRepository) ReserveSpending(orgID uint, amount float64, since time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	org, ok := r.m.organizations[orgID]
+	if !ok {
+		return errNotFound
+	}
+	if org.SpendingLimit <= 0 {
+		return nil
+	}
+
+	var spent float64
+	for _, p := range r.m.payments {
+		if p.OrganizationID != nil && *p.OrganizationID == orgID && !p.CreatedAt.Before(since) {
+			spent += p.Amount
+		}
+	}
+	if spent+amount > org.SpendingLimit {
+		return errSpendingLimitExceeded
+	}
+	return nil
+}
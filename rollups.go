@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// rollupInterval - как часто фоновая задача обновляет сводки
+	rollupInterval = 10 * time.Minute
+	// rollupLookback - сколько часов до отметки пересчитываем повторно:
+	// выезды и оплаты могут прийти с задержкой
+	rollupLookback = 2 * time.Hour
+	// rollupChunk - размер порции пересчета почасовых сводок
+	rollupChunk = 7 * 24 * time.Hour
+	// rollupStateID - единственная строка состояния агрегации
+	rollupStateID = 1
+)
+
+// rollupMu не дает фоновой задаче и ручному пересчету писать сводки одновременно
+var rollupMu sync.Mutex
+
+// recomputeRollups пересчитывает почасовые и дневные сводки парковки за [from, to)
+func recomputeRollups(parking Parking, from, to time.Time) error {
+	loc := parkingLocation(parking)
+	from = truncateToBucket(from, GranularityHour, loc)
+
+	for chunkStart := from; chunkStart.Before(to); chunkStart = chunkStart.Add(rollupChunk) {
+		chunkEnd := chunkStart.Add(rollupChunk)
+		if chunkEnd.After(to) {
+			chunkEnd = to
+		}
+
+		report, err := buildOccupancyReport(parking, chunkStart, chunkEnd, GranularityHour)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]HourlyRollup, 0, len(report.Buckets))
+		for _, b := range report.Buckets {
+			rows = append(rows, HourlyRollup{
+				ParkingID:        parking.ID,
+				BucketStart:      b.Start,
+				Entries:          b.Entries,
+				Exits:            b.Exits,
+				OccupancyMinutes: b.occupiedMinutes,
+				Revenue:          b.Revenue,
+			})
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if err := db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	// Дневные сводки пересчитываем целиком за затронутые дни
+	report, err := buildOccupancyReport(parking, truncateToBucket(from, GranularityDay, loc), to, GranularityDay)
+	if err != nil {
+		return err
+	}
+	rows := make([]DailyRollup, 0, len(report.Buckets))
+	for _, b := range report.Buckets {
+		rows = append(rows, DailyRollup{
+			ParkingID:        parking.ID,
+			BucketStart:      b.Start,
+			Entries:          b.Entries,
+			Exits:            b.Exits,
+			OccupancyMinutes: b.occupiedMinutes,
+			Revenue:          b.Revenue,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 500).Error
+}
+
+// recomputeAllRollups пересчитывает сводки всех парковок или одной, если parkingID задан
+func recomputeAllRollups(from, to time.Time, parkingID uint) error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+
+	query := db.Model(&Parking{})
+	if parkingID != 0 {
+		query = query.Where("id = ?", parkingID)
+	}
+	var parkings []Parking
+	if err := query.Find(&parkings).Error; err != nil {
+		return err
+	}
+
+	for _, parking := range parkings {
+		if err := recomputeRollups(parking, from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRollups поддерживает сводки в актуальном состоянии. Каждый проход
+// пересчитывает время от отметки (с запасом rollupLookback) до конца
+// текущего часа, поэтому после простоя задача сама догоняет пропущенное.
+// Первый проход без отметки считает всю историю въездов.
+func runRollups(ctx context.Context) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := updateRollups(time.Now()); err != nil {
+			slog.Error("Не удалось обновить сводки аналитики", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func updateRollups(now time.Time) error {
+	state := RollupState{ID: rollupStateID}
+	if err := db.FirstOrCreate(&state, RollupState{ID: rollupStateID}).Error; err != nil {
+		return err
+	}
+
+	from := state.Watermark.Add(-rollupLookback)
+	if state.Watermark.IsZero() {
+		// Первый запуск: догружаем всю историю с самого раннего въезда
+		var first sql.NullTime
+		if err := db.Model(&Entry{}).Select("MIN(entry_time)").Scan(&first).Error; err != nil {
+			return err
+		}
+		from = now.Add(-rollupLookback)
+		if first.Valid && first.Time.Before(from) {
+			from = first.Time
+		}
+	}
+	to := now.Truncate(time.Hour).Add(time.Hour)
+
+	if err := recomputeAllRollups(from, to, 0); err != nil {
+		return err
+	}
+
+	state.Watermark = now.Truncate(time.Hour)
+	return db.Save(&state).Error
+}
+
+// rollupWatermark возвращает отметку агрегации или нулевое время, если
+// сводки еще не считались
+func rollupWatermark() time.Time {
+	var state RollupState
+	if err := db.Where("id = ?", rollupStateID).Limit(1).Find(&state).Error; err != nil {
+		slog.Warn("Не удалось прочитать отметку сводок", "error", err)
+		return time.Time{}
+	}
+	return state.Watermark
+}
+
+// rollupBucketExpr - начало часа въезда в часовом поясе парковки, как в hourly_rollups
+const rollupBucketExpr = "(date_trunc('hour', entries.entry_time AT TIME ZONE parkings.time_zone) AT TIME ZONE parkings.time_zone)"
+
+// hourlyEntriesQuery считает въезды по часам суток (parking_id, hour, count)
+// за период по времени въезда. Пустые границы период не ограничивают,
+// toInclusive включает в период сам момент to. Часы, целиком лежащие внутри
+// периода и до отметки агрегации, берутся из hourly_rollups, а неполные
+// первый и последний час и еще не агрегированное время - из сырых въездов,
+// поэтому результат совпадает с подсчетом по entries.
+func hourlyEntriesQuery(from, to *time.Time, toInclusive bool, parkingID string) *gorm.DB {
+	limit := rollupWatermark()
+	if to != nil && to.Before(limit) {
+		limit = *to
+	}
+
+	rollups := db.Table("hourly_rollups").
+		Select("hourly_rollups.parking_id, hourly_rollups.bucket_start AS ts, hourly_rollups.entries AS cnt").
+		Where("hourly_rollups.bucket_start + interval '1 hour' <= ?", limit)
+	covered := rollupBucketExpr + " + interval '1 hour' <= ?"
+	coveredArgs := []interface{}{limit}
+	if from != nil {
+		rollups = rollups.Where("hourly_rollups.bucket_start >= ?", *from)
+		covered = rollupBucketExpr + " >= ? AND " + covered
+		coveredArgs = append([]interface{}{*from}, coveredArgs...)
+	}
+
+	raw := db.Table("entries").
+		Select("parkings.id AS parking_id, entries.entry_time AS ts, 1 AS cnt").
+		Joins("JOIN spots ON spots.id = entries.spot_id").
+		Joins("JOIN parkings ON parkings.id = spots.parking_id").
+		Where("entries.deleted_at IS NULL").
+		Where("NOT ("+covered+")", coveredArgs...)
+	if from != nil {
+		raw = raw.Where("entries.entry_time >= ?", *from)
+	}
+	if to != nil {
+		if toInclusive {
+			raw = raw.Where("entries.entry_time <= ?", *to)
+		} else {
+			raw = raw.Where("entries.entry_time < ?", *to)
+		}
+	}
+	if parkingID != "" {
+		rollups = rollups.Where("hourly_rollups.parking_id = ?", parkingID)
+		raw = raw.Where("parkings.id = ?", parkingID)
+	}
+
+	return db.Table("(? UNION ALL ?) AS hourly", rollups, raw).
+		Select("parkings.id AS parking_id, EXTRACT(HOUR FROM hourly.ts AT TIME ZONE parkings.time_zone) AS hour, SUM(hourly.cnt) AS count").
+		Joins("JOIN parkings ON parkings.id = hourly.parking_id").
+		Group("parkings.id, hour").
+		Order("parkings.id, hour")
+}
+
+type RecomputeRollupsRequest struct {
+	From      time.Time `json:"from" binding:"required"`
+	To        time.Time `json:"to" binding:"required,gtfield=From"`
+	ParkingID uint      `json:"parking_id"`
+}
+
+// RecomputeRollups запускает пересчет или догрузку сводок за период
+func RecomputeRollups(c *gin.Context) {
+	var input RecomputeRollupsRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	goBackground(func() {
+		started := time.Now()
+		if err := recomputeAllRollups(input.From, input.To, input.ParkingID); err != nil {
+			slog.Error("Пересчет сводок не удался", "from", input.From, "to", input.To, "error", err)
+			return
+		}
+		slog.Info("Сводки пересчитаны", "from", input.From, "to", input.To, "elapsed", time.Since(started))
+	})
+
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Пересчет запущен"})
+}
+
+// GetRollups отдает сводки по часам или дням
+func GetRollups(c *gin.Context) {
+	startTime, endTime, ok := parseAnalyticsRange(c)
+	if !ok {
+		return
+	}
+
+	query := db.Model(&HourlyRollup{})
+	var rows interface{} = &[]HourlyRollup{}
+	switch c.DefaultQuery("granularity", GranularityHour) {
+	case GranularityHour:
+	case GranularityDay:
+		query = db.Model(&DailyRollup{})
+		rows = &[]DailyRollup{}
+	default:
+		respondError(c, CodeInvalidGranularity)
+		return
+	}
+
+	query = query.Where("bucket_start >= ? AND bucket_start < ?", startTime, endTime)
+	if parkingID := c.Query("parking_id"); parkingID != "" {
+		query = query.Where("parking_id = ?", parkingID)
+	}
+
+	if err := query.Order("parking_id, bucket_start").Find(rows).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeRollupsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, rows)
+}
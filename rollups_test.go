@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// rollupFixture парковка с одним местом и стоянками stays (въезд, длительность)
+func rollupFixture(t *testing.T, name, timeZone string, stays map[time.Time]time.Duration) Parking {
+	t.Helper()
+	parking := Parking{Name: name, Capacity: 1, TimeZone: timeZone}
+	if err := db.Create(&parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	spot := Spot{ParkingID: parking.ID, Number: name + "-1"}
+	if err := db.Create(&spot).Error; err != nil {
+		t.Fatal(err)
+	}
+	for entryTime, d := range stays {
+		addStay(t, spot, entryTime, d, 100)
+	}
+	return parking
+}
+
+// addStay сохраняет закрытую стоянку с оплатой amount
+func addStay(t *testing.T, spot Spot, entryTime time.Time, d time.Duration, amount float64) {
+	t.Helper()
+	exitTime := entryTime.Add(d)
+	payment := Payment{Amount: amount, Method: "cash", Status: "succeeded"}
+	if err := db.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{SpotID: spot.ID, VehicleID: 1, EntryTime: entryTime, ExitTime: &exitTime}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Exit{EntryID: entry.ID, ExitTime: exitTime, PaymentID: payment.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rollupTotals суммы сводок парковки
+type rollupTotals struct {
+	Buckets          int
+	Entries          int
+	Exits            int
+	OccupancyMinutes float64
+	Revenue          float64
+}
+
+func sumRollups(t *testing.T, model any, parkingID uint) rollupTotals {
+	t.Helper()
+	var totals rollupTotals
+	if err := db.Model(model).Where("parking_id = ?", parkingID).
+		Select("COUNT(*) AS buckets, COALESCE(SUM(entries), 0) AS entries, COALESCE(SUM(exits), 0) AS exits, " +
+			"COALESCE(SUM(occupancy_minutes), 0) AS occupancy_minutes, COALESCE(SUM(revenue), 0) AS revenue").
+		Scan(&totals).Error; err != nil {
+		t.Fatal(err)
+	}
+	return totals
+}
+
+func TestRecomputeRollups(t *testing.T) {
+	testDB(t)
+	loc := berlin(t)
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	dst := time.Date(2026, 3, 29, 0, 0, 0, 0, loc)
+
+	tests := []struct {
+		name       string
+		timeZone   string
+		from, to   time.Time
+		stays      map[time.Time]time.Duration
+		wantHourly rollupTotals
+		wantDaily  rollupTotals
+	}{
+		{
+			// Период длиннее порции пересчета: сводки за все часы, без пропусков на стыках
+			name: "несколько порций", timeZone: "UTC",
+			from: start, to: start.AddDate(0, 0, 10),
+			stays: map[time.Time]time.Duration{
+				start.Add(10 * time.Hour):                  90 * time.Minute,
+				start.Add(rollupChunk - 30*time.Minute):    time.Hour, // Через стык порций
+				start.AddDate(0, 0, 9).Add(23 * time.Hour): 30 * time.Minute,
+				start.AddDate(0, 0, 10).Add(2 * time.Hour): time.Hour, // После периода
+				start.Add(-30 * time.Minute):               time.Hour, // Въезд до периода
+			},
+			wantHourly: rollupTotals{Buckets: 240, Entries: 3, Exits: 4, OccupancyMinutes: 90 + 60 + 30 + 30, Revenue: 400},
+			wantDaily:  rollupTotals{Buckets: 10, Entries: 3, Exits: 4, OccupancyMinutes: 90 + 60 + 30 + 30, Revenue: 400},
+		},
+		{
+			// День перевода часов: 23 почасовые сводки и одна дневная
+			name: "переход на летнее время", timeZone: "Europe/Berlin",
+			from: dst, to: nextBucket(dst, GranularityDay),
+			stays: map[time.Time]time.Duration{
+				time.Date(2026, 3, 29, 1, 30, 0, 0, loc): time.Hour,
+			},
+			wantHourly: rollupTotals{Buckets: 23, Entries: 1, Exits: 1, OccupancyMinutes: 60, Revenue: 100},
+			wantDaily:  rollupTotals{Buckets: 1, Entries: 1, Exits: 1, OccupancyMinutes: 60, Revenue: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parking := rollupFixture(t, tt.name, tt.timeZone, tt.stays)
+			// Повторный пересчет перезаписывает сводки, а не дублирует
+			for i := 0; i < 2; i++ {
+				if err := recomputeRollups(parking, tt.from, tt.to); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := sumRollups(t, &HourlyRollup{}, parking.ID); got != tt.wantHourly {
+				t.Errorf("почасовые сводки %+v, ожидалось %+v", got, tt.wantHourly)
+			}
+			if got := sumRollups(t, &DailyRollup{}, parking.ID); got != tt.wantDaily {
+				t.Errorf("дневные сводки %+v, ожидалось %+v", got, tt.wantDaily)
+			}
+		})
+	}
+}
+
+// Первый проход догружает всю историю, следующие - только время от отметки
+// с запасом на поздние выезды
+func TestUpdateRollupsBackfill(t *testing.T) {
+	testDB(t)
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	parking := rollupFixture(t, "история", "UTC", map[time.Time]time.Duration{
+		start.Add(9 * time.Hour):                   time.Hour,
+		start.AddDate(0, 0, 2).Add(14 * time.Hour): 2 * time.Hour,
+	})
+	var spot Spot
+	db.Where("parking_id = ?", parking.ID).First(&spot)
+
+	now := start.AddDate(0, 0, 3).Add(30 * time.Minute)
+	if err := updateRollups(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := rollupWatermark(); !got.Equal(now.Truncate(time.Hour)) {
+		t.Fatalf("отметка %s, ожидалось %s", got, now.Truncate(time.Hour))
+	}
+	if got := sumRollups(t, &HourlyRollup{}, parking.ID); got.Buckets != 64 || got.Entries != 2 || got.OccupancyMinutes != 180 {
+		t.Fatalf("после догрузки %+v, ожидалось 64 часа, 2 въезда и 180 минут", got)
+	}
+
+	tests := []struct {
+		name      string
+		entryTime time.Time
+		wantAdded bool // Попадет ли стоянка в сводки без ручного пересчета
+	}{
+		{"стоянка в пределах запаса", now.Truncate(time.Hour).Add(-rollupLookback + time.Minute), true},
+		{"стоянка до запаса", now.AddDate(0, 0, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := sumRollups(t, &HourlyRollup{}, parking.ID)
+			addStay(t, spot, tt.entryTime, time.Minute, 50)
+			now = now.Add(rollupInterval)
+			if err := updateRollups(now); err != nil {
+				t.Fatal(err)
+			}
+			after := sumRollups(t, &HourlyRollup{}, parking.ID)
+			if added := after.Entries == before.Entries+1; added != tt.wantAdded {
+				t.Errorf("въездов в сводках %d -> %d, стоянка учтена: %v, ожидалось %v", before.Entries, after.Entries, added, tt.wantAdded)
+			}
+		})
+	}
+
+	// Ручной пересчет подбирает то, что пришло позже запаса
+	if err := recomputeAllRollups(start, now, parking.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := sumRollups(t, &HourlyRollup{}, parking.ID); got.Entries != 4 {
+		t.Errorf("после пересчета %d въездов, ожидалось 4", got.Entries)
+	}
+}
+
+// Подсчет въездов по часам суток из сводок и сырых въездов совпадает с
+// подсчетом только по въездам, где бы ни стояла отметка агрегации
+func TestHourlyEntriesQuery(t *testing.T) {
+	testDB(t)
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	stays := make(map[time.Time]time.Duration)
+	for i := 0; i < 48; i += 5 {
+		stays[start.Add(time.Duration(i)*time.Hour+17*time.Minute)] = 20 * time.Minute
+	}
+	parking := rollupFixture(t, "по часам", "Europe/Moscow", stays)
+	parkingID := fmt.Sprint(parking.ID)
+
+	count := func(from, to *time.Time) map[int]int {
+		t.Helper()
+		var rows []HourlyEntries
+		if err := hourlyEntriesQuery(from, to, false, parkingID).Scan(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[int]int)
+		for _, r := range rows {
+			counts[r.Hour] = r.Count
+		}
+		return counts
+	}
+	from, to := start.Add(3*time.Hour+30*time.Minute), start.Add(40*time.Hour+30*time.Minute)
+	want := count(&from, &to) // Сводок еще нет
+
+	tests := []struct {
+		name      string
+		watermark time.Time
+	}{
+		{"отметка внутри периода", start.Add(20 * time.Hour)},
+		{"отметка после периода", start.Add(72 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := recomputeRollups(parking, start, tt.watermark); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Save(&RollupState{ID: rollupStateID, Watermark: tt.watermark}).Error; err != nil {
+				t.Fatal(err)
+			}
+			got := count(&from, &to)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%v, ожидалось %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRollupsParams(t *testing.T) {
+	testDB(t)
+	s := newTestServer(t, nil, nil)
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		code   ErrorCode
+	}{
+		{"неизвестная гранулярность", http.MethodGet,
+			"/api/v1/analytics/rollups?start_time=2026-10-01T00:00:00Z&end_time=2026-10-02T00:00:00Z&granularity=week", nil, CodeInvalidGranularity},
+		{"пересчет задом наперед", http.MethodPost, "/api/v1/analytics/rollups/recompute",
+			RecomputeRollupsRequest{From: from, To: from.Add(-time.Hour)}, CodeValidationFailed},
+		{"пересчет без периода", http.MethodPost, "/api/v1/analytics/rollups/recompute", RecomputeRollupsRequest{}, CodeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.expectError(s.do(tt.method, tt.path, admin, tt.body), http.StatusBadRequest, tt.code)
+		})
+	}
+}
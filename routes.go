@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Route описание маршрута API. По apiVersions и systemRoutes регистрируются
+// обработчики, по apiRoutes строится спецификация OpenAPI (/openapi.json) и генерируется
+// клиент в client/. Request и Response - значения тех же типов, которые
+// биндит и отдает обработчик, поэтому спецификация не расходится с кодом.
+type Route struct {
+	Name    string // operationId и имя метода клиента
+	Method  string
+	Path    string // В синтаксисе gin: /parkings/:id
+	Handler gin.HandlerFunc
+	Auth    bool // Нужен JWT в заголовке Authorization; запросы идут в квоту пользователя
+	// Role роль, без которой маршрут отвечает 403 (только с Auth): операции
+	// с оборудованием, настройки парковок и выгрузки персональных данных
+	Role string
+	// LimitByIP ограничение частоты запросов с одного IP, для входа и
+	// регистрации
+	LimitByIP bool
+	// Gateway запрос от шлюза датчиков: вместо JWT секрет шлюза в
+	// X-Gateway-ID и X-Gateway-Secret
+	Gateway bool
+	Tag     string
+	Summary string
+
+	Params   []Param
+	Request  any    // Тело запроса; nil - без тела
+	Status   int    // Код успешного ответа
+	Response any    // Тело успешного ответа; nil - без тела
+	Produces string // MIME-тип ответа, если это не JSON, а файл или текст
+	// Accepted тело ответа 202, если обработчик может поставить работу в
+	// очередь вместо ответа 200
+	Accepted any
+}
+
+// Param параметр пути или query-строки. Параметры пути, не описанные явно,
+// выводятся из Path: :id и :xxxID - целые, остальные - строки.
+type Param struct {
+	Name        string
+	In          string // path или query
+	Type        string // string, integer, boolean
+	Format      string // date-time, date и т.п.
+	Enum        []string
+	Required    bool
+	Description string
+}
+
+func queryParam(name, typ, description string) Param {
+	return Param{Name: name, In: "query", Type: typ, Description: description}
+}
+
+// Общие параметры аналитики
+var (
+	paramStartTime = Param{Name: "start_time", In: "query", Type: "string", Format: "date-time", Required: true, Description: "Начало периода, RFC 3339"}
+	paramEndTime   = Param{Name: "end_time", In: "query", Type: "string", Format: "date-time", Required: true, Description: "Конец периода, RFC 3339"}
+	paramParkingID = queryParam("parking_id", "integer", "Только эта парковка")
+)
+
+// API версионируется префиксом пути: /api/v1/parkings. Версии живут рядом,
+// каждая со своим списком маршрутов; v2 может взять маршруты v1 и заменить
+// только изменившиеся, переиспользуя обработчики. Имена маршрутов (Name)
+// должны быть уникальны по всем версиям: это operationId и имена методов
+// клиента.
+//
+// До появления версий API было доступно от корня (/parkings). Эти пути
+// оставлены синонимами v1 для развернутых киосков: отвечают так же, но с
+// заголовками Deprecation, Sunset и Link на путь в /api/v1.
+
+// APIVersion версия API
+type APIVersion struct {
+	Prefix string // /api/v1
+	Routes []Route
+	// LegacySince не нулевое - маршруты версии доступны и без префикса,
+	// как устаревшие с этой даты
+	LegacySince time.Time
+}
+
+// v1LegacySince дата, с которой пути без /api/v1 считаются устаревшими
+var v1LegacySince = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// apiVersions версии API в порядке появления
+func apiVersions(api *API) []APIVersion {
+	return []APIVersion{
+		{Prefix: "/api/v1", Routes: v1Routes(api), LegacySince: v1LegacySince},
+	}
+}
+
+// apiRoutes все маршруты сервера с полными путями, кроме /openapi.json и
+// /docs, которые описывают сам этот список. Синонимы без префикса версии в
+// список не входят.
+func apiRoutes(api *API) []Route {
+	routes := systemRoutes(api)
+	for _, v := range apiVersions(api) {
+		for _, r := range v.Routes {
+			r.Path = v.Prefix + r.Path
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// systemRoutes служебные маршруты вне версий: на их пути настроены
+// Kubernetes и Prometheus
+func systemRoutes(api *API) []Route {
+	return []Route{
+		{Name: "Healthz", Method: http.MethodGet, Path: "/healthz", Handler: Healthz, Tag: "system",
+			Summary: "Liveness-проба", Status: http.StatusOK, Response: LivenessResponse{}},
+		{Name: "Readyz", Method: http.MethodGet, Path: "/readyz", Handler: api.Readyz, Tag: "system",
+			Summary: "Readiness-проба: база, миграции, платежи; 503, если сервер не готов", Status: http.StatusOK, Response: ReadinessResponse{}},
+		{Name: "Metrics", Method: http.MethodGet, Path: "/metrics", Handler: gin.WrapH(promhttp.Handler()), Tag: "system",
+			Summary: "Метрики Prometheus", Status: http.StatusOK, Produces: "text/plain"},
+	}
+}
+
+// v1Routes маршруты /api/v1, пути без префикса
+func v1Routes(api *API) []Route {
+	return []Route{
+		{Name: "WebSocket", Method: http.MethodGet, Path: "/ws", Handler: WebSocketHandler, Tag: "system",
+			Summary: "WebSocket с обновлениями свободных мест (сообщения SpotUpdate)", Status: http.StatusSwitchingProtocols, Response: SpotUpdate{}},
+
+		// Пользователи
+		{Name: "Register", Method: http.MethodPost, Path: "/register", Handler: api.Register, Tag: "auth", LimitByIP: true,
+			Summary: "Регистрация", Request: RegisterRequest{}, Status: http.StatusCreated, Response: MessageResponse{}},
+		{Name: "Login", Method: http.MethodPost, Path: "/login", Handler: api.Login, Tag: "auth", LimitByIP: true,
+			Summary: "Вход, возвращает JWT", Request: LoginRequest{}, Status: http.StatusOK, Response: TokenResponse{}},
+		{Name: "VerifyEmail", Method: http.MethodPost, Path: "/email/verify", Handler: api.VerifyEmail, Tag: "auth", LimitByIP: true,
+			Summary: "Подтвердить email по токену из письма", Request: VerifyEmailRequest{}, Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "ResendVerification", Method: http.MethodPost, Path: "/email/verify/resend", Handler: api.ResendVerification, Tag: "auth", LimitByIP: true,
+			Summary: "Повторно отправить письмо для подтверждения email", Request: EmailRequest{}, Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "ConfirmEmailChange", Method: http.MethodPost, Path: "/email/change/confirm", Handler: api.ConfirmEmailChange, Tag: "auth", LimitByIP: true,
+			Summary: "Подтвердить новый email по токену из письма; завершает все сессии", Request: ConfirmEmailChangeRequest{}, Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "ForgotPassword", Method: http.MethodPost, Path: "/password/forgot", Handler: api.ForgotPassword, Tag: "auth", LimitByIP: true,
+			Summary: "Отправить ссылку для сброса пароля", Request: EmailRequest{}, Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "ResetPassword", Method: http.MethodPost, Path: "/password/reset", Handler: api.ResetPassword, Tag: "auth", LimitByIP: true,
+			Summary: "Задать пароль по токену из письма; завершает все сессии", Request: ResetPasswordRequest{}, Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "ChangePassword", Method: http.MethodPost, Path: "/account/password", Handler: api.ChangePassword, Auth: true, Tag: "auth",
+			Summary: "Сменить пароль; остальные сессии завершаются, в ответе новый JWT", Request: ChangePasswordRequest{}, Status: http.StatusOK, Response: TokenResponse{}},
+		{Name: "ChangeEmail", Method: http.MethodPost, Path: "/account/email", Handler: api.ChangeEmail, Auth: true, Tag: "auth",
+			Summary: "Сменить email: отправляет ссылку подтверждения на новый адрес", Request: ChangeEmailRequest{}, Status: http.StatusAccepted, Response: MessageResponse{}},
+
+		// Парковки, въезды и выезды
+		{Name: "CreateParking", Method: http.MethodPost, Path: "/parkings", Handler: api.CreateParking, Auth: true, Role: UserRoleAdmin, Tag: "parkings",
+			Summary: "Создать парковку", Request: CreateParkingRequest{}, Status: http.StatusCreated, Response: Parking{}},
+		{Name: "GetParkings", Method: http.MethodGet, Path: "/parkings", Handler: api.GetParkings, Auth: true, Tag: "parkings",
+			Summary: "Список парковок", Status: http.StatusOK, Response: []Parking{}},
+		{Name: "GetParking", Method: http.MethodGet, Path: "/parkings/:id", Handler: api.GetParking, Auth: true, Tag: "parkings",
+			Summary: "Парковка", Status: http.StatusOK, Response: Parking{}},
+		{Name: "GetSpots", Method: http.MethodGet, Path: "/parkings/:id/spots", Handler: api.GetSpots, Auth: true, Tag: "parkings",
+			Summary: "Места парковки", Status: http.StatusOK, Response: []Spot{}},
+		{Name: "AddSpot", Method: http.MethodPost, Path: "/parkings/:id/spots", Handler: api.AddSpot, Auth: true, Role: UserRoleAdmin, Tag: "parkings",
+			Summary: "Добавить место", Request: AddSpotRequest{}, Status: http.StatusCreated, Response: Spot{}},
+		{Name: "CreateEntry", Method: http.MethodPost, Path: "/entries", Handler: api.CreateEntry, Auth: true, Tag: "parkings",
+			Summary: "Зафиксировать въезд", Request: CreateEntryRequest{}, Status: http.StatusCreated, Response: Entry{}},
+		{Name: "CreateExit", Method: http.MethodPost, Path: "/exits", Handler: api.CreateExit, Auth: true, Tag: "parkings",
+			Summary: "Зафиксировать выезд и оплату", Request: CreateExitRequest{}, Status: http.StatusCreated, Response: Exit{}},
+		{Name: "ProcessPayment", Method: http.MethodPost, Path: "/payments", Handler: api.ProcessPayment, Auth: true, Tag: "parkings",
+			Summary: "Оплата картой через Stripe", Request: ProcessPaymentRequest{}, Status: http.StatusOK, Response: PaymentResult{}},
+		{Name: "PaymentWebhook", Method: http.MethodPost, Path: "/payments/webhook", Handler: api.PaymentWebhook, Tag: "parkings",
+			Summary: "Вебхук Stripe: подтверждение платежей после 3-D Secure, подпись в Stripe-Signature", Status: http.StatusOK, Response: MessageResponse{}},
+
+		// Аналитика
+		{Name: "GetAnalytics", Method: http.MethodGet, Path: "/analytics", Handler: GetAnalytics, Auth: true, Tag: "analytics",
+			Summary: "Въезды по часам суток", Params: []Param{paramStartTime, paramEndTime},
+			Status: http.StatusOK, Response: []HourlyEntries{}},
+		{Name: "GetOccupancyAnalytics", Method: http.MethodGet, Path: "/analytics/occupancy", Handler: GetOccupancyAnalytics, Auth: true, Tag: "analytics",
+			Summary: "Загрузка парковок по интервалам", Params: []Param{paramStartTime, paramEndTime,
+				{Name: "granularity", In: "query", Type: "string", Enum: []string{Granularity15m, GranularityHour, GranularityDay, GranularityWeek}},
+				paramParkingID,
+			}, Status: http.StatusOK, Response: []OccupancyReport{}},
+		{Name: "GetRollups", Method: http.MethodGet, Path: "/analytics/rollups", Handler: GetRollups, Auth: true, Tag: "analytics",
+			Summary: "Почасовые или дневные сводки", Params: []Param{paramStartTime, paramEndTime,
+				{Name: "granularity", In: "query", Type: "string", Enum: []string{GranularityHour, GranularityDay}},
+				paramParkingID,
+			}, Status: http.StatusOK, Response: []HourlyRollup{}},
+		{Name: "RecomputeRollups", Method: http.MethodPost, Path: "/analytics/rollups/recompute", Handler: RecomputeRollups, Auth: true, Role: UserRoleAdmin, Tag: "analytics",
+			Summary: "Пересчитать сводки за период", Request: RecomputeRollupsRequest{}, Status: http.StatusAccepted, Response: MessageResponse{}},
+
+		// Цены и прогнозы
+		{Name: "GetPricing", Method: http.MethodGet, Path: "/parkings/:id/pricing", Handler: api.GetPricing, Auth: true, Tag: "pricing",
+			Summary: "Действующая ставка", Status: http.StatusOK, Response: PricingResponse{}},
+		{Name: "UpdatePricing", Method: http.MethodPut, Path: "/parkings/:id/pricing", Handler: api.UpdatePricing, Auth: true, Role: UserRoleAdmin, Tag: "pricing",
+			Summary: "Настройки динамической цены", Request: UpdatePricingRequest{}, Status: http.StatusOK, Response: DynamicPricing{}},
+		{Name: "GetPriceChanges", Method: http.MethodGet, Path: "/parkings/:id/pricing/changes", Handler: GetPriceChanges, Auth: true, Tag: "pricing",
+			Summary: "Журнал изменений цены", Params: []Param{{Name: "from", In: "query", Type: "string", Format: "date-time"}},
+			Status: http.StatusOK, Response: []PriceChange{}},
+		{Name: "GetForecast", Method: http.MethodGet, Path: "/parkings/:id/forecast", Handler: GetForecast, Auth: true, Tag: "pricing",
+			Summary: "Прогноз свободных мест", Params: []Param{queryParam("hours", "integer", "Горизонт, от 1 до 72 часов")},
+			Status: http.StatusOK, Response: ForecastResponse{}},
+		{Name: "GetForecastAccuracy", Method: http.MethodGet, Path: "/parkings/:id/forecast/accuracy", Handler: GetForecastAccuracy, Auth: true, Tag: "pricing",
+			Summary: "Точность прогнозов", Params: []Param{queryParam("days", "integer", "За сколько последних дней, по умолчанию 7")},
+			Status: http.StatusOK, Response: []ForecastAccuracy{}},
+		{Name: "GetHolidays", Method: http.MethodGet, Path: "/holidays", Handler: GetHolidays, Auth: true, Tag: "pricing",
+			Summary: "Праздники", Status: http.StatusOK, Response: []Holiday{}},
+		{Name: "CreateHoliday", Method: http.MethodPost, Path: "/holidays", Handler: CreateHoliday, Auth: true, Role: UserRoleAdmin, Tag: "pricing",
+			Summary: "Добавить праздник", Request: CreateHolidayRequest{}, Status: http.StatusCreated, Response: Holiday{}},
+
+		// Отчеты и выгрузки
+		{Name: "GetParkingReport", Method: http.MethodGet, Path: "/parkings/:id/report", Handler: api.GetParkingReport, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Отчет по парковке в PDF", Params: []Param{{Name: "frequency", In: "query", Type: "string", Enum: []string{ReportDaily, ReportWeekly, ReportMonthly}}},
+			Status: http.StatusOK, Produces: "application/pdf"},
+		{Name: "GetReportSchedules", Method: http.MethodGet, Path: "/parkings/:id/report-schedules", Handler: GetReportSchedules, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Расписания рассылки отчетов", Status: http.StatusOK, Response: []ReportSchedule{}},
+		{Name: "CreateReportSchedule", Method: http.MethodPost, Path: "/parkings/:id/report-schedules", Handler: CreateReportSchedule, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Создать расписание", Request: CreateReportScheduleRequest{}, Status: http.StatusCreated, Response: ReportSchedule{}},
+		{Name: "DeleteReportSchedule", Method: http.MethodDelete, Path: "/report-schedules/:id", Handler: DeleteReportSchedule, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Удалить расписание", Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "SendReportNow", Method: http.MethodPost, Path: "/report-schedules/:id/send", Handler: api.SendReportNow, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Отправить отчет сейчас", Status: http.StatusOK, Response: MessageResponse{}},
+		{Name: "Export", Method: http.MethodGet, Path: "/exports/:dataset", Handler: api.Export, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Выгрузка набора данных; с async=true ставится в очередь", Params: []Param{
+				{Name: "dataset", In: "path", Type: "string", Enum: exportDatasetNames(), Required: true},
+				{Name: "format", In: "query", Type: "string", Enum: []string{ExportFormatCSV, ExportFormatXLSX}},
+				queryParam("async", "boolean", "Поставить в очередь и вернуть задание"),
+				{Name: "from", In: "query", Type: "string", Format: "date-time"},
+				{Name: "to", In: "query", Type: "string", Format: "date-time"},
+				paramParkingID,
+			}, Status: http.StatusOK, Produces: "application/octet-stream", Accepted: ExportJobAccepted{}},
+		{Name: "GetExportJob", Method: http.MethodGet, Path: "/export-jobs/:id", Handler: GetExportJob, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Состояние фоновой выгрузки", Status: http.StatusOK, Response: ExportJob{}},
+		{Name: "DownloadExportJob", Method: http.MethodGet, Path: "/export-jobs/:id/download", Handler: DownloadExportJob, Auth: true, Role: UserRoleAdmin, Tag: "reports",
+			Summary: "Скачать готовую выгрузку", Status: http.StatusOK, Produces: "application/octet-stream"},
+
+		// Шлагбаумы и датчики
+		{Name: "GetLanes", Method: http.MethodGet, Path: "/parkings/:id/lanes", Handler: GetLanes, Auth: true, Tag: "devices",
+			Summary: "Полосы парковки", Status: http.StatusOK, Response: []Lane{}},
+		{Name: "CreateLane", Method: http.MethodPost, Path: "/parkings/:id/lanes", Handler: CreateLane, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Добавить полосу", Request: CreateLaneRequest{}, Status: http.StatusCreated, Response: Lane{}},
+		{Name: "RotateLaneSecret", Method: http.MethodPost, Path: "/lanes/:id/secret", Handler: RotateLaneSecret, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Выдать полосе новый секрет устройства; старый перестает действовать", Status: http.StatusOK, Response: Lane{}},
+		{Name: "SendLaneCommand", Method: http.MethodPost, Path: "/lanes/:id/command", Handler: SendLaneCommand, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Команда шлагбауму", Request: SendLaneCommandRequest{}, Status: http.StatusAccepted, Response: MessageResponse{}},
+		{Name: "GetLaneEvents", Method: http.MethodGet, Path: "/lanes/:id/events", Handler: GetLaneEvents, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "События полосы", Status: http.StatusOK, Response: []GateEvent{}},
+		{Name: "RegisterSensor", Method: http.MethodPost, Path: "/sensors", Handler: RegisterSensor, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Зарегистрировать датчик", Request: RegisterSensorRequest{}, Status: http.StatusCreated, Response: Sensor{}},
+		{Name: "GetSensors", Method: http.MethodGet, Path: "/sensors", Handler: GetSensors, Auth: true, Tag: "devices",
+			Summary: "Датчики", Params: []Param{paramParkingID, queryParam("health", "string", "ok, low_battery, faulty или offline")},
+			Status: http.StatusOK, Response: []Sensor{}},
+		{Name: "IngestSensorReadings", Method: http.MethodPost, Path: "/sensors/readings", Handler: IngestSensorReadings, Gateway: true, Tag: "devices",
+			Summary: "Пакет показаний датчиков от шлюза", Request: IngestSensorReadingsRequest{}, Status: http.StatusOK, Response: IngestResult{}},
+		{Name: "GetSensorGateways", Method: http.MethodGet, Path: "/parkings/:id/sensor-gateways", Handler: GetSensorGateways, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Шлюзы датчиков парковки", Status: http.StatusOK, Response: []SensorGateway{}},
+		{Name: "CreateSensorGateway", Method: http.MethodPost, Path: "/parkings/:id/sensor-gateways", Handler: CreateSensorGateway, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Добавить шлюз датчиков; секрет возвращается один раз", Request: CreateSensorGatewayRequest{}, Status: http.StatusCreated, Response: SensorGateway{}},
+		{Name: "RotateSensorGatewaySecret", Method: http.MethodPost, Path: "/sensor-gateways/:id/secret", Handler: RotateSensorGatewaySecret, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Выдать шлюзу новый секрет; старый перестает действовать", Status: http.StatusOK, Response: SensorGateway{}},
+		{Name: "GetSensorMismatches", Method: http.MethodGet, Path: "/sensors/mismatches", Handler: GetSensorMismatches, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Расхождения датчиков с въездами", Params: []Param{paramParkingID, queryParam("all", "boolean", "Включая закрытые")},
+			Status: http.StatusOK, Response: []SensorMismatch{}},
+		{Name: "ResolveSensorMismatch", Method: http.MethodPost, Path: "/sensors/mismatches/:id/resolve", Handler: ResolveSensorMismatch, Auth: true, Role: UserRoleAdmin, Tag: "devices",
+			Summary: "Закрыть расхождение", Request: ResolveSensorMismatchRequest{}, Status: http.StatusOK, Response: SensorMismatch{}},
+
+		// Абонементы
+		{Name: "GetPermitProducts", Method: http.MethodGet, Path: "/parkings/:id/permit-products", Handler: GetPermitProducts, Auth: true, Tag: "permits",
+			Summary: "Виды абонементов парковки", Status: http.StatusOK, Response: []PermitProduct{}},
+		{Name: "CreatePermitProduct", Method: http.MethodPost, Path: "/parkings/:id/permit-products", Handler: CreatePermitProduct, Auth: true, Role: UserRoleAdmin, Tag: "permits",
+			Summary: "Создать вид абонемента", Request: CreatePermitProductRequest{}, Status: http.StatusCreated, Response: PermitProduct{}},
+		{Name: "GetPermits", Method: http.MethodGet, Path: "/permits", Handler: GetPermits, Auth: true, Tag: "permits",
+			Summary: "Абонементы пользователя", Status: http.StatusOK, Response: []Permit{}},
+		{Name: "PurchasePermit", Method: http.MethodPost, Path: "/permits", Handler: api.PurchasePermit, Auth: true, Tag: "permits",
+			Summary: "Купить абонемент", Request: PurchasePermitRequest{}, Status: http.StatusCreated, Response: Permit{}},
+		{Name: "RenewPermit", Method: http.MethodPost, Path: "/permits/:id/renew", Handler: api.RenewPermit, Auth: true, Tag: "permits",
+			Summary: "Продлить абонемент", Request: RenewPermitRequest{}, Status: http.StatusOK, Response: Permit{}},
+
+		// Организации
+		{Name: "CreateOrganization", Method: http.MethodPost, Path: "/organizations", Handler: CreateOrganization, Auth: true, Tag: "organizations",
+			Summary: "Создать организацию", Request: CreateOrganizationRequest{}, Status: http.StatusCreated, Response: Organization{}},
+		{Name: "GetOrganization", Method: http.MethodGet, Path: "/organizations/:id", Handler: GetOrganization, Auth: true, Tag: "organizations",
+			Summary: "Организация", Status: http.StatusOK, Response: Organization{}},
+		{Name: "UpdateOrganization", Method: http.MethodPatch, Path: "/organizations/:id", Handler: UpdateOrganization, Auth: true, Tag: "organizations",
+			Summary: "Изменить организацию", Request: UpdateOrganizationRequest{}, Status: http.StatusOK, Response: Organization{}},
+		{Name: "AddOrganizationMember", Method: http.MethodPost, Path: "/organizations/:id/members", Handler: AddOrganizationMember, Auth: true, Tag: "organizations",
+			Summary: "Добавить участника", Request: AddOrganizationMemberRequest{}, Status: http.StatusCreated, Response: OrganizationMember{}},
+		{Name: "RemoveOrganizationMember", Method: http.MethodDelete, Path: "/organizations/:id/members/:userID", Handler: RemoveOrganizationMember, Auth: true, Tag: "organizations",
+			Summary: "Удалить участника", Status: http.StatusNoContent},
+		{Name: "AddOrganizationVehicle", Method: http.MethodPost, Path: "/organizations/:id/vehicles", Handler: AddOrganizationVehicle, Auth: true, Tag: "organizations",
+			Summary: "Добавить автомобиль в автопарк", Request: AddOrganizationVehicleRequest{}, Status: http.StatusCreated, Response: Vehicle{}},
+		{Name: "RemoveOrganizationVehicle", Method: http.MethodDelete, Path: "/organizations/:id/vehicles/:vehicleID", Handler: RemoveOrganizationVehicle, Auth: true, Tag: "organizations",
+			Summary: "Убрать автомобиль из автопарка", Status: http.StatusNoContent},
+		{Name: "GetInvoices", Method: http.MethodGet, Path: "/organizations/:id/invoices", Handler: GetInvoices, Auth: true, Tag: "organizations",
+			Summary: "Счета организации", Status: http.StatusOK, Response: []Invoice{}},
+		{Name: "CreateInvoice", Method: http.MethodPost, Path: "/organizations/:id/invoices", Handler: CreateInvoice, Auth: true, Tag: "organizations",
+			Summary: "Выставить счет за месяц", Request: CreateInvoiceRequest{}, Status: http.StatusCreated, Response: Invoice{}},
+		{Name: "DownloadInvoice", Method: http.MethodGet, Path: "/organizations/:id/invoices/:invoiceID/:format", Handler: api.DownloadInvoice, Auth: true, Tag: "organizations",
+			Summary: "Скачать счет", Params: []Param{{Name: "format", In: "path", Type: "string", Enum: []string{"csv", "pdf"}, Required: true}},
+			Status: http.StatusOK, Produces: "application/octet-stream"},
+
+		// Продавцы
+		{Name: "CreateMerchant", Method: http.MethodPost, Path: "/merchants", Handler: api.CreateMerchant, Auth: true, Tag: "merchants",
+			Summary: "Зарегистрировать продавца; скидки доступны после одобрения администратором", Request: CreateMerchantRequest{}, Status: http.StatusCreated, Response: Merchant{}},
+		{Name: "GetMerchants", Method: http.MethodGet, Path: "/merchants", Handler: GetMerchants, Auth: true, Role: UserRoleAdmin, Tag: "merchants",
+			Summary: "Продавцы", Params: []Param{queryParam("status", "string", "pending или approved")}, Status: http.StatusOK, Response: []Merchant{}},
+		{Name: "ApproveMerchant", Method: http.MethodPost, Path: "/merchants/:id/approve", Handler: ApproveMerchant, Auth: true, Role: UserRoleAdmin, Tag: "merchants",
+			Summary: "Одобрить продавца", Status: http.StatusOK, Response: Merchant{}},
+		{Name: "GenerateValidationCodes", Method: http.MethodPost, Path: "/merchants/:id/codes", Handler: api.GenerateValidationCodes, Auth: true, Tag: "merchants",
+			Summary: "Выпустить коды валидации", Request: GenerateValidationCodesRequest{}, Status: http.StatusCreated, Response: []Validation{}},
+		{Name: "ValidateParking", Method: http.MethodPost, Path: "/merchants/:id/validations", Handler: api.ValidateParking, Auth: true, Tag: "merchants",
+			Summary: "Оплатить парковку клиенту", Request: ValidateParkingRequest{}, Status: http.StatusCreated, Response: Validation{}},
+		{Name: "GetMerchantReport", Method: http.MethodGet, Path: "/merchants/:id/report", Handler: GetMerchantReport, Auth: true, Tag: "merchants",
+			Summary: "Отчет продавца за месяц", Params: []Param{queryParam("month", "string", "ГГГГ-ММ, по умолчанию текущий месяц")},
+			Status: http.StatusOK, Response: MerchantReport{}},
+	}
+}
+
+// setupRoutes регистрирует служебные маршруты, все версии API и синонимы
+// без префикса, если они не отключены в настройках
+func setupRoutes(router *gin.Engine, api *API, cfg APIConfig) {
+	registerRoutes(&router.RouterGroup, systemRoutes(api), api)
+	for _, v := range apiVersions(api) {
+		registerRoutes(router.Group(v.Prefix), v.Routes, api)
+		if cfg.LegacyRoutes && !v.LegacySince.IsZero() {
+			legacy := router.Group("/", LegacyRouteMiddleware(v.Prefix, v.LegacySince, cfg.LegacySunsetTime()))
+			registerRoutes(legacy, v.Routes, api)
+		}
+	}
+}
+
+// registerRoutes регистрирует маршруты в группе; маршруты с Auth - за
+// AuthMiddleware и квотой пользователя, с Role - еще и за RequireRole,
+// с Gateway - за SensorGatewayMiddleware
+func registerRoutes(group *gin.RouterGroup, routes []Route, api *API) {
+	limits := api.limits
+	authorized := group.Group("/", api.AuthMiddleware(), limits.LimitByToken())
+	for _, r := range routes {
+		switch {
+		case r.Auth && r.Role != "":
+			authorized.Handle(r.Method, r.Path, RequireRole(r.Role), r.Handler)
+		case r.Auth:
+			authorized.Handle(r.Method, r.Path, r.Handler)
+		case r.Gateway:
+			group.Handle(r.Method, r.Path, SensorGatewayMiddleware(), r.Handler)
+		case r.LimitByIP:
+			group.Handle(r.Method, r.Path, limits.LimitByIP(), r.Handler)
+		default:
+			group.Handle(r.Method, r.Path, r.Handler)
+		}
+	}
+}
+
+// LegacyRouteMiddleware помечает ответы на пути без префикса версии как
+// устаревшие (RFC 9745, RFC 8594) и указывает путь-преемник. Запросы
+// считаются в метрике, чтобы видеть, какие клиенты еще не перешли.
+func LegacyRouteMiddleware(prefix string, since, sunset time.Time) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		h.Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", prefix, c.Request.URL.Path))
+		legacyRequestsTotal.WithLabelValues(c.Request.Method, c.FullPath()).Inc()
+		c.Next()
+	}
+}
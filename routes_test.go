@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// handlerBindings разбирает исходники пакета и для каждого обработчика
+// возвращает типы, которые он биндит через ShouldBindJSON. Ключ - имя
+// функции как в runtime: GetAnalytics или (*API).Login.
+func handlerBindings(t *testing.T) map[string][]string {
+	t.Helper()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := make(map[string][]string)
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			key := fn.Name.Name
+			if fn.Recv != nil {
+				if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok {
+					key = "(*" + star.X.(*ast.Ident).Name + ")." + key
+				}
+			}
+
+			vars := make(map[string]string)
+			bound := []string{}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.ValueSpec:
+					if ident, ok := n.Type.(*ast.Ident); ok {
+						for _, v := range n.Names {
+							vars[v.Name] = ident.Name
+						}
+					}
+				case *ast.CallExpr:
+					sel, ok := n.Fun.(*ast.SelectorExpr)
+					if !ok || sel.Sel.Name != "ShouldBindJSON" || len(n.Args) != 1 {
+						return true
+					}
+					if ref, ok := n.Args[0].(*ast.UnaryExpr); ok && ref.Op == token.AND {
+						if ident, ok := ref.X.(*ast.Ident); ok {
+							bound = append(bound, vars[ident.Name])
+							return true
+						}
+					}
+					bound = append(bound, "?")
+				}
+				return true
+			})
+			bindings[key] = bound
+		}
+	}
+	return bindings
+}
+
+// Route.Request попадает в OpenAPI и клиент, поэтому должен быть тем же
+// типом, который биндит обработчик
+func TestRouteRequestMatchesHandler(t *testing.T) {
+	bindings := handlerBindings(t)
+
+	for _, r := range apiRoutes(&API{}) {
+		// parking_manager.(*API).Login-fm -> (*API).Login
+		name := runtime.FuncForPC(reflect.ValueOf(r.Handler).Pointer()).Name()
+		name = name[strings.LastIndex(name, "/")+1:]
+		_, name, _ = strings.Cut(name, ".")
+		name = strings.TrimSuffix(name, "-fm")
+		bound, ok := bindings[name]
+		if !ok {
+			if r.Request != nil {
+				t.Errorf("%s: не найден обработчик %s", r.Name, name)
+			}
+			continue
+		}
+
+		var want []string
+		if r.Request != nil {
+			want = []string{reflect.TypeOf(r.Request).Name()}
+		}
+		if len(bound) != len(want) || (len(want) == 1 && bound[0] != want[0]) {
+			t.Errorf("%s: обработчик %s биндит %v, а в маршруте Request %v", r.Name, name, bound, want)
+		}
+	}
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	const successor = `</api/v1/parkings>; rel="successor-version"`
+	tests := []struct {
+		name        string
+		api         APIConfig
+		path        string
+		status      int
+		deprecation string // Пусто - заголовков устаревания нет
+		sunset      string
+		legacyCount float64 // Прирост метрики запросов на старые пути
+	}{
+		{"старый путь", APIConfig{LegacyRoutes: true, LegacySunset: "2027-04-01"}, "/parkings", http.StatusOK,
+			fmt.Sprintf("@%d", v1LegacySince.Unix()), "Thu, 01 Apr 2027 00:00:00 GMT", 1},
+		{"старый путь без даты отключения", APIConfig{LegacyRoutes: true}, "/parkings", http.StatusOK,
+			fmt.Sprintf("@%d", v1LegacySince.Unix()), "", 1},
+		{"путь с версией", APIConfig{LegacyRoutes: true, LegacySunset: "2027-04-01"}, "/api/v1/parkings", http.StatusOK, "", "", 0},
+		{"старые пути отключены", APIConfig{}, "/parkings", http.StatusNotFound, "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, func(cfg *Config) { cfg.API = tt.api })
+			s.createUser("driver@example.com", "secret123", UserRoleUser)
+			token := s.login("driver@example.com", "secret123")
+
+			counter := legacyRequestsTotal.WithLabelValues(http.MethodGet, "/parkings")
+			before := testutil.ToFloat64(counter)
+			w := s.do(http.MethodGet, tt.path, token, nil)
+			s.expect(w, tt.status, nil)
+
+			h := w.Header()
+			if h.Get("Deprecation") != tt.deprecation || h.Get("Sunset") != tt.sunset {
+				t.Errorf("Deprecation %q, Sunset %q; ожидалось %q, %q", h.Get("Deprecation"), h.Get("Sunset"), tt.deprecation, tt.sunset)
+			}
+			if link := h.Get("Link"); (tt.deprecation != "") != (link == successor) {
+				t.Errorf("Link %q", link)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != tt.legacyCount {
+				t.Errorf("запросов на старые пути %v, ожидалось %v", got, tt.legacyCount)
+			}
+		})
+	}
+}
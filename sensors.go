@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sensorDebounce - сколько новое состояние должно держаться, прежде чем
+	// мы ему поверим. Наземные датчики дребезжат, когда рядом проезжает машина.
+	sensorDebounce = 30 * time.Second
+	// sensorOfflineAfter - через сколько без показаний датчик считается отключенным
+	sensorOfflineAfter = 15 * time.Minute
+	// sensorLowBattery - порог заряда батареи в процентах
+	sensorLowBattery = 15
+)
+
+// Состояния датчика
+const (
+	SensorHealthOK         = "ok"
+	SensorHealthLowBattery = "low_battery"
+	SensorHealthFaulty     = "faulty"
+	SensorHealthOffline    = "offline"
+)
+
+// Виды расхождений
+const (
+	MismatchUnregisteredVehicle = "unregistered_vehicle" // место занято, а въезда нет
+	MismatchMissedExit          = "missed_exit"          // въезд открыт, а место свободно
+)
+
+// SensorReading одно показание датчика в пакете
+type SensorReading struct {
+	SensorID  string    `json:"sensor_id" binding:"required"`
+	Occupied  bool      `json:"occupied"`
+	Timestamp time.Time `json:"timestamp"`
+	Battery   *int      `json:"battery" binding:"omitempty,min=0,max=100"`
+	Fault     string    `json:"fault"`
+}
+
+type pendingSensorState struct {
+	occupied bool
+	since    time.Time
+}
+
+// sensorDebouncer подтверждает смену состояния датчика, только если она
+// продержалась sensorDebounce
+type sensorDebouncer struct {
+	mu      sync.Mutex
+	pending map[uint]pendingSensorState
+}
+
+var debouncer = &sensorDebouncer{pending: make(map[uint]pendingSensorState)}
+
+// Observe учитывает показание и возвращает true, если состояние подтверждено
+func (d *sensorDebouncer) Observe(sensor Sensor, occupied bool, at time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if sensor.Occupied != nil && *sensor.Occupied == occupied {
+		delete(d.pending, sensor.ID)
+		return false
+	}
+
+	p, ok := d.pending[sensor.ID]
+	if !ok || p.occupied != occupied {
+		d.pending[sensor.ID] = pendingSensorState{occupied: occupied, since: at}
+		return false
+	}
+
+	if at.Sub(p.since) < sensorDebounce {
+		return false
+	}
+	delete(d.pending, sensor.ID)
+	return true
+}
+
+// Expired забирает ожидающие состояния, которые продержались sensorDebounce.
+// Нужен для датчиков, которые шлют показания только при изменении.
+func (d *sensorDebouncer) Expired(now time.Time) map[uint]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expired := make(map[uint]bool)
+	for id, p := range d.pending {
+		if now.Sub(p.since) >= sensorDebounce {
+			expired[id] = p.occupied
+			delete(d.pending, id)
+		}
+	}
+	return expired
+}
+
+type RegisterSensorRequest struct {
+	SpotID     uint   `json:"spot_id" binding:"required"`
+	ExternalID string `json:"external_id" binding:"required"`
+	Kind       string `json:"kind" binding:"required,oneof=ground overhead"`
+}
+
+func RegisterSensor(c *gin.Context) {
+	var input RegisterSensorRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var spot Spot
+	if err := db.First(&spot, input.SpotID).Error; err != nil {
+		respondError(c, CodeSpotNotFound)
+		return
+	}
+
+	sensor := Sensor{
+		SpotID:     spot.ID,
+		ExternalID: input.ExternalID,
+		Kind:       input.Kind,
+		Health:     SensorHealthOffline,
+	}
+
+	if err := db.Create(&sensor).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, sensor)
+}
+
+func GetSensors(c *gin.Context) {
+	query := db.Model(&Sensor{})
+	if parkingID := c.Query("parking_id"); parkingID != "" {
+		query = query.Where("spot_id IN (?)", db.Model(&Spot{}).Select("id").Where("parking_id = ?", parkingID))
+	}
+	if health := c.Query("health"); health != "" {
+		query = query.Where("health = ?", health)
+	}
+
+	var sensors []Sensor
+	if err := query.Find(&sensors).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorsListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, sensors)
+}
+
+// Заголовки, которыми шлюз датчиков подтверждает себя
+const (
+	headerGatewayID     = "X-Gateway-ID"
+	headerGatewaySecret = "X-Gateway-Secret"
+)
+
+// SensorGatewayMiddleware пропускает запросы шлюзов датчиков с верным
+// секретом и кладет шлюз в контекст. JWT пользователей здесь не
+// принимаются: устройствам не нужны учетные записи администраторов.
+func SensorGatewayMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Неизвестному шлюзу и неверному секрету ответ одинаковый
+		var gateway SensorGateway
+		err := db.WithContext(c.Request.Context()).Where("gateway_id = ?", c.GetHeader(headerGatewayID)).First(&gateway).Error
+		if err != nil || !secretMatchesHash(c.GetHeader(headerGatewaySecret), gateway.SecretHash) {
+			abortWithError(c, CodeSensorGatewayUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		db.Model(&gateway).Update("last_seen_at", now)
+		c.Set("sensor_gateway", gateway)
+		c.Next()
+	}
+}
+
+// issueGatewaySecret выдает шлюзу новый секрет; в базе хранится только хеш
+func issueGatewaySecret(gateway *SensorGateway) error {
+	secret, hash, err := newUserToken()
+	if err != nil {
+		return err
+	}
+	gateway.SecretHash = hash
+	gateway.Secret = secret
+	return nil
+}
+
+type CreateSensorGatewayRequest struct {
+	Name      string `json:"name" binding:"required"`
+	GatewayID string `json:"gateway_id" binding:"required"`
+}
+
+func CreateSensorGateway(c *gin.Context) {
+	parkingID := c.Param("id")
+	var input CreateSensorGatewayRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var parking Parking
+	if err := db.First(&parking, parkingID).Error; err != nil {
+		respondError(c, CodeParkingNotFound)
+		return
+	}
+
+	gateway := SensorGateway{ParkingID: parking.ID, Name: input.Name, GatewayID: input.GatewayID}
+	if err := issueGatewaySecret(&gateway); err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorGatewayCreateFailed)
+		return
+	}
+
+	if err := db.Create(&gateway).Error; err != nil {
+		c.Error(err)
+		if isUniqueViolation(err) {
+			respondError(c, CodeSensorGatewayExists)
+			return
+		}
+		respondError(c, CodeSensorGatewayCreateFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gateway)
+}
+
+func GetSensorGateways(c *gin.Context) {
+	var gateways []SensorGateway
+	if err := db.Where("parking_id = ?", c.Param("id")).Find(&gateways).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorGatewaysListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, gateways)
+}
+
+// RotateSensorGatewaySecret выдает шлюзу новый секрет; старый сразу
+// перестает приниматься
+func RotateSensorGatewaySecret(c *gin.Context) {
+	var gateway SensorGateway
+	if err := db.First(&gateway, c.Param("id")).Error; err != nil {
+		respondError(c, CodeSensorGatewayNotFound)
+		return
+	}
+
+	if err := issueGatewaySecret(&gateway); err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorGatewayUpdateFailed)
+		return
+	}
+	if err := db.Model(&gateway).Update("secret_hash", gateway.SecretHash).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeSensorGatewayUpdateFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, gateway)
+}
+
+type IngestSensorReadingsRequest struct {
+	Readings []SensorReading `json:"readings" binding:"required,min=1,max=1000,dive"`
+}
+
+// IngestResult итог приема пакета показаний
+type IngestResult struct {
+	Accepted int      `json:"accepted"`
+	Changed  int      `json:"changed"`  // Сколько мест сменили состояние
+	Rejected []string `json:"rejected"` // Неизвестные датчики и датчики других парковок
+}
+
+// IngestSensorReadings принимает пакет показаний датчиков от шлюза. Шлюз
+// присылает показания только датчиков своей парковки.
+func IngestSensorReadings(c *gin.Context) {
+	gateway := c.MustGet("sensor_gateway").(SensorGateway)
+	var input IngestSensorReadingsRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	now := time.Now()
+	for i := range input.Readings {
+		if input.Readings[i].Timestamp.IsZero() || input.Readings[i].Timestamp.After(now) {
+			input.Readings[i].Timestamp = now
+		}
+	}
+	// Показания из пакета применяем в хронологическом порядке
+	sort.SliceStable(input.Readings, func(i, j int) bool {
+		return input.Readings[i].Timestamp.Before(input.Readings[j].Timestamp)
+	})
+
+	accepted, changed := 0, 0
+	rejected := []string{}
+	for _, reading := range input.Readings {
+		var sensor Sensor
+		err := db.Where("external_id = ? AND spot_id IN (?)", reading.SensorID,
+			db.Model(&Spot{}).Select("id").Where("parking_id = ?", gateway.ParkingID)).First(&sensor).Error
+		if err != nil {
+			rejected = append(rejected, reading.SensorID)
+			continue
+		}
+		accepted++
+
+		recordSensorHealth(&sensor, reading)
+		if reading.Fault != "" {
+			// Показаниям неисправного датчика не доверяем
+			continue
+		}
+
+		if debouncer.Observe(sensor, reading.Occupied, reading.Timestamp) {
+			applySensorState(sensor, reading.Occupied)
+			changed++
+		}
+	}
+
+	c.JSON(http.StatusOK, IngestResult{Accepted: accepted, Changed: changed, Rejected: rejected})
+}
+
+func recordSensorHealth(sensor *Sensor, reading SensorReading) {
+	seen := reading.Timestamp
+	sensor.LastSeenAt = &seen
+	if reading.Battery != nil {
+		sensor.BatteryLevel = reading.Battery
+	}
+
+	switch {
+	case reading.Fault != "":
+		sensor.ErrorCount++
+		sensor.Health = SensorHealthFaulty
+	case sensor.BatteryLevel != nil && *sensor.BatteryLevel < sensorLowBattery:
+		sensor.Health = SensorHealthLowBattery
+	default:
+		sensor.Health = SensorHealthOK
+	}
+
+	if err := db.Model(sensor).Select("last_seen_at", "battery_level", "error_count", "health").Updates(sensor).Error; err != nil {
+		slog.Error("Не удалось обновить состояние датчика", "sensor_id", sensor.ID, "error", err)
+	}
+}
+
+// applySensorState сверяет подтвержденное состояние датчика с записями о
+// въезде. Занятое без въезда место помечается занятым, чтобы его не
+// показывали свободным; открытый въезд на пустом месте не закрывается
+// автоматически - оба случая уходят операторам как расхождения.
+func applySensorState(sensor Sensor, occupied bool) {
+	if err := db.Model(&sensor).Update("occupied", occupied).Error; err != nil {
+		slog.Error("Не удалось обновить датчик", "sensor_id", sensor.ID, "error", err)
+		return
+	}
+
+	var spot Spot
+	if err := db.First(&spot, sensor.SpotID).Error; err != nil {
+		slog.Warn("Место датчика не найдено", "spot_id", sensor.SpotID, "sensor_id", sensor.ID)
+		return
+	}
+
+	var entry Entry
+	hasEntry := db.Where("spot_id = ? AND exit_time IS NULL", spot.ID).First(&entry).Error == nil
+
+	switch {
+	case occupied && !hasEntry:
+		openMismatch(spot.ID, sensor.ID, MismatchUnregisteredVehicle, nil)
+		if !spot.IsOccupied {
+			setSpotOccupied(spot, true)
+		}
+	case !occupied && hasEntry:
+		openMismatch(spot.ID, sensor.ID, MismatchMissedExit, &entry.ID)
+	default:
+		resolveSpotMismatches(spot.ID, "sensor_confirmed")
+		if !occupied && spot.IsOccupied {
+			setSpotOccupied(spot, false)
+		}
+	}
+}
+
+func setSpotOccupied(spot Spot, occupied bool) {
+	spot.IsOccupied = occupied
+	if err := db.Save(&spot).Error; err != nil {
+		slog.Error("Не удалось обновить статус места", "spot_id", spot.ID, "error", err)
+		return
+	}
+	notifySpotUpdate(spot.ParkingID)
+}
+
+func openMismatch(spotID, sensorID uint, kind string, entryID *uint) {
+	var existing SensorMismatch
+	err := db.Where("spot_id = ? AND kind = ? AND resolved_at IS NULL", spotID, kind).First(&existing).Error
+	if err == nil {
+		return
+	}
+
+	// Противоположное расхождение по этому месту уже неактуально
+	resolveSpotMismatches(spotID, "superseded")
+
+	mismatch := SensorMismatch{
+		SpotID:     spotID,
+		SensorID:   sensorID,
+		Kind:       kind,
+		EntryID:    entryID,
+		DetectedAt: time.Now(),
+	}
+	if err := db.Create(&mismatch).Error; err != nil {
+		slog.Error("Не удалось сохранить расхождение", "spot_id", spotID, "error", err)
+		return
+	}
+	slog.Warn("Расхождение датчика и записей", "spot_id", spotID, "kind", kind)
+}
+
+func resolveSpotMismatches(spotID uint, resolution string) {
+	db.Model(&SensorMismatch{}).
+		Where("spot_id = ? AND resolved_at IS NULL", spotID).
+		Updates(map[string]interface{}{"resolved_at": time.Now(), "resolution": resolution})
+}
+
+func GetSensorMismatches(c *gin.Context) {
+	query := db.Model(&SensorMismatch{})
+	if parkingID := c.Query("parking_id"); parkingID != "" {
+		query = query.Where("spot_id IN (?)", db.Model(&Spot{}).Select("id").Where("parking_id = ?", parkingID))
+	}
+	if c.Query("all") != "true" {
+		query = query.Where("resolved_at IS NULL")
+	}
+
+	var mismatches []SensorMismatch
+	if err := query.Order("detected_at DESC").Find(&mismatches).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeMismatchesListFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, mismatches)
+}
+
+type ResolveSensorMismatchRequest struct {
+	Resolution string `json:"resolution" binding:"required"`
+}
+
+func ResolveSensorMismatch(c *gin.Context) {
+	id := c.Param("id")
+	var input ResolveSensorMismatchRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var mismatch SensorMismatch
+	if err := db.First(&mismatch, id).Error; err != nil {
+		respondError(c, CodeMismatchNotFound)
+		return
+	}
+
+	if mismatch.ResolvedAt != nil {
+		respondError(c, CodeMismatchResolved)
+		return
+	}
+
+	now := time.Now()
+	mismatch.ResolvedAt = &now
+	mismatch.Resolution = input.Resolution
+	if err := db.Save(&mismatch).Error; err != nil {
+		c.Error(err)
+		respondError(c, CodeMismatchResolveFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, mismatch)
+}
+
+// runSensorMonitor подтверждает отложенные состояния и отмечает датчики,
+// которые давно не присылали показаний
+func runSensorMonitor(ctx context.Context) {
+	for now := range ticks(ctx, time.Minute) {
+		for sensorID, occupied := range debouncer.Expired(now) {
+			var sensor Sensor
+			if err := db.First(&sensor, sensorID).Error; err != nil {
+				continue
+			}
+			applySensorState(sensor, occupied)
+		}
+
+		db.Model(&Sensor{}).
+			Where("last_seen_at < ? AND health <> ?", now.Add(-sensorOfflineAfter), SensorHealthOffline).
+			Update("health", SensorHealthOffline)
+	}
+}
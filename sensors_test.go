@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSensorDebouncer(t *testing.T) {
+	occupied, free := true, false
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	type observation struct {
+		occupied bool
+		after    time.Duration // От t0
+		want     bool
+	}
+	tests := []struct {
+		name    string
+		current *bool // Подтвержденное состояние датчика
+		steps   []observation
+	}{
+		{"то же состояние не подтверждается", &occupied, []observation{
+			{true, 0, false},
+			{true, time.Minute, false},
+		}},
+		{"новое состояние держится 30 с", &free, []observation{
+			{true, 0, false},
+			{true, 29 * time.Second, false},
+			{true, 30 * time.Second, true},
+		}},
+		{"дребезг сбрасывает ожидание", &free, []observation{
+			{true, 0, false},
+			{false, 10 * time.Second, false},
+			{true, 20 * time.Second, false},
+			{true, 45 * time.Second, false},
+			{true, 50 * time.Second, true},
+		}},
+		{"первое показание нового датчика", nil, []observation{
+			{false, 0, false},
+			{false, 31 * time.Second, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &sensorDebouncer{pending: make(map[uint]pendingSensorState)}
+			sensor := Sensor{ID: 1, Occupied: tt.current}
+			for i, step := range tt.steps {
+				if got := d.Observe(sensor, step.occupied, t0.Add(step.after)); got != step.want {
+					t.Errorf("шаг %d (%v через %s): %v, ожидалось %v", i, step.occupied, step.after, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSensorDebouncerExpired(t *testing.T) {
+	free := false
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	d := &sensorDebouncer{pending: make(map[uint]pendingSensorState)}
+	d.Observe(Sensor{ID: 1, Occupied: &free}, true, t0)
+	d.Observe(Sensor{ID: 2, Occupied: &free}, true, t0.Add(20*time.Second))
+
+	tests := []struct {
+		at   time.Duration
+		want map[uint]bool
+	}{
+		{29 * time.Second, map[uint]bool{}},
+		{30 * time.Second, map[uint]bool{1: true}},
+		{40 * time.Second, map[uint]bool{}}, // Уже забрано
+		{50 * time.Second, map[uint]bool{2: true}},
+	}
+	for _, tt := range tests {
+		got := d.Expired(t0.Add(tt.at))
+		if len(got) != len(tt.want) {
+			t.Errorf("через %s: %v, ожидалось %v", tt.at, got, tt.want)
+			continue
+		}
+		for id, occupied := range tt.want {
+			if got[id] != occupied {
+				t.Errorf("через %s: %v, ожидалось %v", tt.at, got, tt.want)
+			}
+		}
+	}
+}
+
+// freshDebouncer подменяет глобальный debouncer на время теста: ID датчиков
+// в новых схемах повторяются
+func freshDebouncer(t *testing.T) {
+	prev := debouncer
+	debouncer = &sensorDebouncer{pending: make(map[uint]pendingSensorState)}
+	t.Cleanup(func() { debouncer = prev })
+}
+
+// sensorFixture парковка с местом, датчиком и шлюзом
+type sensorFixture struct {
+	parking Parking
+	spot    Spot
+	sensor  Sensor
+	gateway SensorGateway
+}
+
+func newSensorFixture(t *testing.T, name string) sensorFixture {
+	t.Helper()
+	f := sensorFixture{parking: Parking{Name: name, Capacity: 1}}
+	if err := db.Create(&f.parking).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.spot = Spot{ParkingID: f.parking.ID, Number: name + "-1"}
+	if err := db.Create(&f.spot).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.sensor = Sensor{SpotID: f.spot.ID, ExternalID: name + "-sensor", Kind: "ground", Health: SensorHealthOffline}
+	if err := db.Create(&f.sensor).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.gateway = SensorGateway{ParkingID: f.parking.ID, Name: name, GatewayID: name + "-gw"}
+	if err := issueGatewaySecret(&f.gateway); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&f.gateway).Error; err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// ingest отправляет пакет показаний с заголовками шлюза
+func (s *testServer) ingest(gatewayID, secret, token string, readings ...SensorReading) *httptest.ResponseRecorder {
+	s.t.Helper()
+	body, err := json.Marshal(IngestSensorReadingsRequest{Readings: readings})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sensors/readings", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if gatewayID != "" {
+		req.Header.Set(headerGatewayID, gatewayID)
+		req.Header.Set(headerGatewaySecret, secret)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIngestSensorReadingsAuth(t *testing.T) {
+	testDB(t)
+	freshDebouncer(t)
+	s := newTestServer(t, nil, nil)
+	f := newSensorFixture(t, "auth")
+	s.createUser("admin@example.com", "secret123", UserRoleAdmin)
+	admin := s.login("admin@example.com", "secret123")
+	reading := SensorReading{SensorID: f.sensor.ExternalID}
+
+	tests := []struct {
+		name      string
+		gatewayID string
+		secret    string
+		token     string
+		status    int
+	}{
+		{"секрет шлюза", f.gateway.GatewayID, f.gateway.Secret, "", http.StatusOK},
+		{"неверный секрет", f.gateway.GatewayID, "wrong", "", http.StatusUnauthorized},
+		{"неизвестный шлюз", "nobody", f.gateway.Secret, "", http.StatusUnauthorized},
+		{"JWT администратора", "", "", admin, http.StatusUnauthorized},
+		{"без учетных данных", "", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.ingest(tt.gatewayID, tt.secret, tt.token, reading)
+			if tt.status == http.StatusOK {
+				s.expect(w, tt.status, nil)
+				return
+			}
+			s.expectError(w, tt.status, CodeSensorGatewayUnauthorized)
+		})
+	}
+}
+
+func TestIngestSensorReadings(t *testing.T) {
+	testDB(t)
+	freshDebouncer(t)
+	s := newTestServer(t, nil, nil)
+	t0 := time.Now().Add(-time.Hour)
+	battery := func(level int) *int { return &level }
+
+	tests := []struct {
+		name         string
+		entry        bool // На месте открыт въезд
+		readings     func(sensorID string) []SensorReading
+		wantChanged  int
+		wantHealth   string
+		wantOccupied bool // Место занято после пакета
+		wantMismatch string
+	}{
+		{
+			name: "машина без въезда",
+			readings: func(id string) []SensorReading {
+				return []SensorReading{
+					{SensorID: id, Occupied: true, Timestamp: t0.Add(31 * time.Second)},
+					{SensorID: id, Occupied: true, Timestamp: t0}, // Пакет не по порядку
+				}
+			},
+			wantChanged: 1, wantHealth: SensorHealthOK, wantOccupied: true, wantMismatch: MismatchUnregisteredVehicle,
+		},
+		{
+			name:  "въезд открыт, место пусто",
+			entry: true,
+			readings: func(id string) []SensorReading {
+				return []SensorReading{
+					{SensorID: id, Occupied: false, Timestamp: t0},
+					{SensorID: id, Occupied: false, Timestamp: t0.Add(time.Minute)},
+				}
+			},
+			wantChanged: 1, wantHealth: SensorHealthOK, wantOccupied: true, wantMismatch: MismatchMissedExit,
+		},
+		{
+			name:  "въезд подтвержден",
+			entry: true,
+			readings: func(id string) []SensorReading {
+				return []SensorReading{
+					{SensorID: id, Occupied: true, Timestamp: t0},
+					{SensorID: id, Occupied: true, Timestamp: t0.Add(time.Minute), Battery: battery(10)},
+				}
+			},
+			wantChanged: 1, wantHealth: SensorHealthLowBattery, wantOccupied: true,
+		},
+		{
+			name: "дребезг",
+			readings: func(id string) []SensorReading {
+				return []SensorReading{
+					{SensorID: id, Occupied: true, Timestamp: t0},
+					{SensorID: id, Occupied: true, Timestamp: t0.Add(10 * time.Second)},
+				}
+			},
+			wantHealth: SensorHealthOK,
+		},
+		{
+			name: "неисправный датчик",
+			readings: func(id string) []SensorReading {
+				return []SensorReading{
+					{SensorID: id, Occupied: true, Timestamp: t0, Fault: "e1"},
+					{SensorID: id, Occupied: true, Timestamp: t0.Add(time.Minute), Fault: "e1"},
+				}
+			},
+			wantHealth: SensorHealthFaulty,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSensorFixture(t, "ingest"+string(rune('a'+i)))
+			if tt.entry {
+				if err := db.Create(&Entry{SpotID: f.spot.ID, VehicleID: 1, EntryTime: t0}).Error; err != nil {
+					t.Fatal(err)
+				}
+				db.Model(&f.spot).Update("is_occupied", true)
+			}
+
+			var result IngestResult
+			s.expect(s.ingest(f.gateway.GatewayID, f.gateway.Secret, "", tt.readings(f.sensor.ExternalID)...), http.StatusOK, &result)
+			if result.Changed != tt.wantChanged {
+				t.Errorf("changed = %d, ожидалось %d", result.Changed, tt.wantChanged)
+			}
+
+			var sensor Sensor
+			db.First(&sensor, f.sensor.ID)
+			if sensor.Health != tt.wantHealth {
+				t.Errorf("health = %q, ожидалось %q", sensor.Health, tt.wantHealth)
+			}
+			var spot Spot
+			db.First(&spot, f.spot.ID)
+			if spot.IsOccupied != tt.wantOccupied {
+				t.Errorf("место занято = %v, ожидалось %v", spot.IsOccupied, tt.wantOccupied)
+			}
+
+			var mismatches []SensorMismatch
+			db.Where("spot_id = ? AND resolved_at IS NULL", f.spot.ID).Find(&mismatches)
+			switch {
+			case tt.wantMismatch == "" && len(mismatches) > 0:
+				t.Errorf("неожиданное расхождение %s", mismatches[0].Kind)
+			case tt.wantMismatch != "" && (len(mismatches) != 1 || mismatches[0].Kind != tt.wantMismatch):
+				t.Errorf("расхождения %+v, ожидалось %s", mismatches, tt.wantMismatch)
+			}
+		})
+	}
+}
+
+// Шлюз принимает показания только датчиков своей парковки
+func TestIngestSensorReadingsOtherParking(t *testing.T) {
+	testDB(t)
+	freshDebouncer(t)
+	s := newTestServer(t, nil, nil)
+	own := newSensorFixture(t, "own")
+	other := newSensorFixture(t, "other")
+
+	var result IngestResult
+	s.expect(s.ingest(own.gateway.GatewayID, own.gateway.Secret, "",
+		SensorReading{SensorID: own.sensor.ExternalID},
+		SensorReading{SensorID: other.sensor.ExternalID},
+		SensorReading{SensorID: "missing"},
+	), http.StatusOK, &result)
+
+	if result.Accepted != 1 || len(result.Rejected) != 2 {
+		t.Errorf("принято %d, отклонено %v; ожидалось 1 и [%s missing]", result.Accepted, result.Rejected, other.sensor.ExternalID)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// background отслеживает горутины, которые работают с базой: периодические
+// задачи, выгрузки, пересчеты и подключения шлагбаумов. Пул соединений
+// закрывается только после них.
+var background sync.WaitGroup
+
+// goBackground запускает fn в отслеживаемой горутине
+func goBackground(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// ticks работает как time.Ticker, но канал закрывается при отмене ctx.
+// Периодические задачи перебирают его через range: текущий проход
+// доводится до конца, новый после сигнала остановки не начинается.
+func ticks(ctx context.Context, d time.Duration) <-chan time.Time {
+	out := make(chan time.Time)
+	go func() {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				select {
+				case out <- now:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// tracingShutdownTimeout сколько ждать отправки оставшихся спанов. Срок
+// свой, а не общий: к концу остановки общий может уже истечь.
+const tracingShutdownTimeout = 5 * time.Second
+
+// errBackgroundRunning возвращает shutdown, если фоновые задачи не
+// завершились за отведенное время
+var errBackgroundRunning = errors.New("фоновые задачи не завершились за отведенное время, пул соединений с базой не закрыт")
+
+// shutdown останавливает сервер по шагам: перестает принимать запросы и
+// ждет текущие, закрывает подключения шлагбаумов, ждет фоновые задачи,
+// затем останавливает рассылку WebSocket (клиенты получают кадр закрытия)
+// и закрывает пул соединений с базой, отправив оставшиеся спаны. Порядок
+// важен: обработчики и задачи отправляют обновления в broadcast, поэтому
+// рассылка останавливается последней. Если задачи не успели завершиться,
+// ни рассылка, ни пул не закрываются: задачи работают до выхода процесса,
+// а не падают посреди транзакции.
+func shutdown(srv *http.Server, timeout time.Duration, stopHub context.CancelFunc, hubDone <-chan struct{}, stopTracing func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer flushTraces(stopTracing)
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Не все запросы завершились до остановки", "error", err)
+	}
+
+	gates.Close()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errBackgroundRunning
+	}
+
+	stopHub()
+	<-hubDone
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.Close(); err != nil {
+		return err
+	}
+	slog.Info("Сервер остановлен")
+	return nil
+}
+
+// flushTraces отправляет оставшиеся спаны
+func flushTraces(stopTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := stopTracing(ctx); err != nil {
+		slog.Warn("Не удалось отправить оставшиеся спаны", "error", err)
+	}
+}
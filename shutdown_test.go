@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestTicks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ticks(ctx, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, ok := <-ch; !ok {
+			t.Fatal("канал закрыт до отмены")
+		}
+	}
+
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("канал не закрылся после отмены")
+		}
+	}
+}
+
+func TestPublishSpotUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		queued      int // Обновлений в очереди на 2 места до отправки
+		wantQueued  int
+		wantDropped float64
+	}{
+		{"есть место", 0, 1, 0},
+		{"последнее место", 1, 2, 0},
+		{"очередь заполнена", 2, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan SpotUpdate, 2)
+			for i := 0; i < tt.queued; i++ {
+				updates <- SpotUpdate{ParkingID: 1}
+			}
+			dropped := testutil.ToFloat64(broadcastDropped)
+
+			done := make(chan struct{})
+			go func() {
+				publishSpotUpdate(updates, SpotUpdate{ParkingID: 2})
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("отправка обновления заблокировалась")
+			}
+
+			if len(updates) != tt.wantQueued {
+				t.Errorf("в очереди %d обновлений, ожидалось %d", len(updates), tt.wantQueued)
+			}
+			if got := testutil.ToFloat64(broadcastDropped) - dropped; got != tt.wantDropped {
+				t.Errorf("отброшено %v обновлений, ожидалось %v", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobTime  time.Duration // Сколько фоновая задача работает после начала остановки
+		wantErr  error
+		wantStop bool // Остановлены рассылка и пул соединений
+	}{
+		{"задачи успели завершиться", 10 * time.Millisecond, nil, true},
+		{"задачи не успели", time.Hour, errBackgroundRunning, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Пул без подключений: соединения открываются только при запросе
+			conn, err := gorm.Open(postgres.Open("postgres://localhost:1/shutdown"), &gorm.Config{DisableAutomaticPing: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			prevDB, prevGates := db, gates
+			db, gates = conn, &gateHub{conns: make(map[uint]*gateConn), holds: make(map[uint]*time.Timer)}
+			release := make(chan struct{})
+			t.Cleanup(func() {
+				close(release)
+				background.Wait()
+				db, gates = prevDB, prevGates
+			})
+
+			goBackground(func() {
+				select {
+				case <-time.After(tt.jobTime):
+				case <-release:
+				}
+			})
+
+			hubStopped := false
+			hubDone := make(chan struct{})
+			stopHub := func() {
+				hubStopped = true
+				close(hubDone)
+			}
+			traced := false
+			stopTracing := func(ctx context.Context) error {
+				if _, ok := ctx.Deadline(); !ok || ctx.Err() != nil {
+					t.Error("спаны отправляются без своего срока")
+				}
+				traced = true
+				return nil
+			}
+
+			err = shutdown(&http.Server{}, 100*time.Millisecond, stopHub, hubDone, stopTracing)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%v, ожидалось %v", err, tt.wantErr)
+			}
+			if !traced {
+				t.Error("оставшиеся спаны не отправлены")
+			}
+			if hubStopped != tt.wantStop {
+				t.Errorf("рассылка остановлена: %v, ожидалось %v", hubStopped, tt.wantStop)
+			}
+			sqlDB, _ := conn.DB()
+			err = sqlDB.Ping()
+			if closed := err != nil && err.Error() == "sql: database is closed"; closed != tt.wantStop {
+				t.Errorf("пул закрыт: %v, ожидалось %v", closed, tt.wantStop)
+			}
+		})
+	}
+}
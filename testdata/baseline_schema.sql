@@ -0,0 +1,107 @@
+-- Схема базы до версионных миграций, как ее создавал AutoMigrate исходных
+-- моделей. Используется в migrate_test.go для проверки обновления.
+
+CREATE TABLE "parkings" (
+    "id" bigserial,
+    "name" text,
+    "latitude" decimal,
+    "longitude" decimal,
+    "capacity" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_parkings_deleted_at" ON "parkings" ("deleted_at");
+
+CREATE TABLE "spots" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "number" text,
+    "is_occupied" boolean,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_parkings_spots" FOREIGN KEY ("parking_id") REFERENCES "parkings"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_spots_deleted_at" ON "spots" ("deleted_at");
+
+CREATE TABLE "tariffs" (
+    "id" bigserial,
+    "parking_id" bigint,
+    "type" text,
+    "price" decimal,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_parkings_tariffs" FOREIGN KEY ("parking_id") REFERENCES "parkings"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_tariffs_deleted_at" ON "tariffs" ("deleted_at");
+
+CREATE TABLE "users" (
+    "id" bigserial,
+    "name" text,
+    "email" text,
+    "password" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+CREATE UNIQUE INDEX "idx_users_email" ON "users" ("email");
+
+CREATE TABLE "vehicles" (
+    "id" bigserial,
+    "license_plate" text,
+    "owner_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_vehicles" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX "idx_vehicles_license_plate" ON "vehicles" ("license_plate");
+CREATE INDEX "idx_vehicles_deleted_at" ON "vehicles" ("deleted_at");
+
+CREATE TABLE "payments" (
+    "id" bigserial,
+    "amount" decimal,
+    "method" text,
+    "status" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_payments_deleted_at" ON "payments" ("deleted_at");
+
+CREATE TABLE "entries" (
+    "id" bigserial,
+    "spot_id" bigint,
+    "vehicle_id" bigint,
+    "entry_time" timestamptz,
+    "exit_time" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_spots_entries" FOREIGN KEY ("spot_id") REFERENCES "spots"("id") ON DELETE SET NULL
+);
+CREATE INDEX "idx_entries_deleted_at" ON "entries" ("deleted_at");
+
+CREATE TABLE "exits" (
+    "id" bigserial,
+    "entry_id" bigint,
+    "exit_time" timestamptz,
+    "payment_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_exits_payment" FOREIGN KEY ("payment_id") REFERENCES "payments"("id"),
+    CONSTRAINT "fk_entries_exit" FOREIGN KEY ("entry_id") REFERENCES "entries"("id")
+);
+CREATE INDEX "idx_exits_deleted_at" ON "exits" ("deleted_at");
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+)
+
+// recordSpans подменяет tracer на записывающий спаны в память до конца теста
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevTracer, prevPropagator := tracer, otel.GetTextMapPropagator()
+	tracer = provider.Tracer(tracerName)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tracer = prevTracer
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	const (
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceparent = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+	router := gin.New()
+	router.Use(TracingMiddleware())
+	router.GET("/parkings/:id", func(c *gin.Context) {
+		if c.Query("fail") != "" {
+			c.Error(errors.New("база недоступна"))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantName    string
+		wantStatus  codes.Code
+		wantErrors  int // Событий exception в спане
+	}{
+		{"продолжает входящую трассу", "/parkings/1", traceparent, "GET /parkings/:id", codes.Unset, 0},
+		{"новая трасса", "/parkings/1", "", "GET /parkings/:id", codes.Unset, 0},
+		{"ошибка сервера", "/parkings/1?fail=1", "", "GET /parkings/:id", codes.Error, 1},
+		{"неизвестный маршрут", "/unknown", "", "GET", codes.Unset, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("%d спанов, ожидался 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName || span.Status().Code != tt.wantStatus || len(span.Events()) != tt.wantErrors {
+				t.Errorf("спан %q, статус %v, %d событий; ожидалось %q, %v, %d",
+					span.Name(), span.Status().Code, len(span.Events()), tt.wantName, tt.wantStatus, tt.wantErrors)
+			}
+			if continued := span.Parent().IsValid(); continued != (tt.traceparent != "") {
+				t.Errorf("родитель %v, ожидалось продолжение трассы: %v", span.Parent(), tt.traceparent != "")
+			}
+			if tt.traceparent != "" && span.SpanContext().TraceID().String() != traceID {
+				t.Errorf("трасса %s, ожидалась %s", span.SpanContext().TraceID(), traceID)
+			}
+		})
+	}
+}
+
+func TestGormTracing(t *testing.T) {
+	conn := testDB(t)
+	if err := conn.Use(gormTracing{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := recordSpans(t)
+	ctx, parent := tracer.Start(context.Background(), "запрос")
+	defer parent.End()
+	if err := conn.Create(&Parking{Name: "Трассировка", Capacity: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		query      func(tx *gorm.DB) error
+		wantName   string // Пусто - спана нет
+		wantStatus codes.Code
+	}{
+		{"выборка", ctx, func(tx *gorm.DB) error {
+			var parking Parking
+			return tx.First(&parking).Error
+		}, "db.select parkings", codes.Unset},
+		// Не найденная запись - не ошибка запроса
+		{"запись не найдена", ctx, func(tx *gorm.DB) error {
+			var parking Parking
+			tx.Where("name = ?", "нет такой").First(&parking)
+			return nil
+		}, "db.select parkings", codes.Unset},
+		{"ошибка запроса", ctx, func(tx *gorm.DB) error {
+			tx.Exec("SELECT * FROM no_such_table")
+			return nil
+		}, "db.raw", codes.Error},
+		// Фоновые задачи без спана в контексте не трассируются
+		{"без спана в контексте", context.Background(), func(tx *gorm.DB) error {
+			var parking Parking
+			return tx.First(&parking).Error
+		}, "", codes.Unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			if err := tt.query(conn.WithContext(tt.ctx)); err != nil {
+				t.Fatal(err)
+			}
+			spans := recorder.Ended()[before:]
+			if tt.wantName == "" {
+				if len(spans) != 0 {
+					t.Errorf("лишние спаны: %d", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("%d спанов, ожидался 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName || span.Status().Code != tt.wantStatus {
+				t.Errorf("спан %q со статусом %v, ожидался %q со статусом %v", span.Name(), span.Status().Code, tt.wantName, tt.wantStatus)
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("спан не вложен в спан запроса")
+			}
+			for _, attr := range span.Attributes() {
+				if attr.Key == "db.query.text" && attr.Value.AsString() == "" {
+					t.Errorf("пустой текст запроса")
+				}
+			}
+		})
+	}
+}